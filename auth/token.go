@@ -1,6 +1,13 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"bpl/config"
@@ -9,10 +16,14 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var ErrUnknownSigningKey = errors.New("token is signed with an unknown key")
+
 type Claims struct {
 	UserId      int      `json:"user_id"`
 	Permissions []string `json:"permissions"`
 	Exp         int64    `json:"exp"`
+	// Id is the jti of the token, which is used to revoke it
+	Id string `json:"jti"`
 }
 
 func (claims *Claims) FromJWTClaims(jwtClaims jwt.Claims) {
@@ -25,38 +36,96 @@ func (claims *Claims) FromJWTClaims(jwtClaims jwt.Claims) {
 	claims.Permissions = permissions
 	claims.UserId = int(jwtClaims.(jwt.MapClaims)["user_id"].(float64))
 	claims.Exp = int64(jwtClaims.(jwt.MapClaims)["exp"].(float64))
+	claims.Id, _ = jwtClaims.(jwt.MapClaims)["jti"].(string)
 }
 
 func (claims *Claims) Valid() error {
 	if time.Now().Unix() > claims.Exp {
 		return jwt.ErrTokenExpired
 	}
+	// tokens issued before tokens could be revoked have no id, their holders have to log in again
+	if claims.Id == "" {
+		return jwt.ErrTokenInvalidId
+	}
 	return nil
 }
 
-func CreateToken(user *repository.User) (string, error) {
+func (claims *Claims) ExpiresAt() time.Time {
+	return time.Unix(claims.Exp, 0)
+}
+
+// signingKeys returns the keys from JWT_SIGNING_KEYS by their id, or JWT_SECRET if no keys are configured
+var signingKeys = sync.OnceValue(func() map[string][]byte {
+	keys := make(map[string][]byte)
+	for entry := range strings.SplitSeq(config.Env().JWTSigningKeys, ",") {
+		id, secret, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if found && id != "" && secret != "" {
+			keys[id] = []byte(secret)
+		}
+	}
+	if len(keys) == 0 {
+		keys[config.Env().JWTSigningKeyId] = []byte(config.Env().JWTSecret)
+	}
+	return keys
+})
+
+// CreateAccessToken issues a short lived token that carries the current permissions of the user
+func CreateAccessToken(user *repository.User) (string, *Claims, error) {
+	keyId := config.Env().JWTSigningKeyId
+	key, ok := signingKeys()[keyId]
+	if !ok {
+		return "", nil, fmt.Errorf("signing key %q is not configured", keyId)
+	}
+	claims := &Claims{
+		UserId:      user.Id,
+		Permissions: make([]string, len(user.Permissions)),
+		Exp:         time.Now().Add(config.Env().AccessTokenTTL).Unix(),
+		Id:          rand.Text(),
+	}
+	for i, permission := range user.Permissions {
+		claims.Permissions[i] = string(permission)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		jwt.MapClaims{
-			"user_id":     user.Id,
-			"permissions": user.Permissions,
-			"exp":         time.Now().Add(time.Hour * 24 * 21).Unix(),
+			"user_id":     claims.UserId,
+			"permissions": claims.Permissions,
+			"exp":         claims.Exp,
+			"jti":         claims.Id,
 		})
+	token.Header["kid"] = keyId
 
-	tokenString, err := token.SignedString([]byte(config.Env().JWTSecret))
+	tokenString, err := token.SignedString(key)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return tokenString, nil
+	return tokenString, claims, nil
 }
 
+// ParseToken verifies the signature of the token with the key named in its kid header
 func ParseToken(tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		return []byte(config.Env().JWTSecret), nil
-	})
+		keyId, _ := token.Header["kid"].(string)
+		key, ok := signingKeys()[keyId]
+		if !ok {
+			return nil, ErrUnknownSigningKey
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
 	}
 	return token, nil
 }
+
+// NewRefreshToken returns an opaque refresh token together with the hash under which it is stored
+func NewRefreshToken() (token string, hash string) {
+	token = rand.Text() + rand.Text()
+	return token, HashRefreshToken(token)
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,18 +1,22 @@
 package client
 
 import (
+	"bpl/config"
 	"bpl/utils"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+var logger = config.Logger("client")
+
 type PriorityMutex struct {
 	dataMutex         *sync.Mutex
 	nextToAccess      *sync.Mutex
@@ -69,15 +73,32 @@ func (p *Policy) IsViolated(requestTimes []time.Time) bool {
 	return p.CurrentHits(requestTimes) >= p.MaxHits
 }
 
+// Wait returns how long it takes until the oldest hits of the period expire and the policy allows another request
+func (p *Policy) Wait(requestTimes []time.Time, now time.Time) time.Duration {
+	periodStart := now.Add(-p.Period)
+	hits := utils.Filter(requestTimes, func(t time.Time) bool { return t.After(periodStart) })
+	if len(hits) < p.MaxHits {
+		return 0
+	}
+	if p.MaxHits <= 0 {
+		return p.Period
+	}
+	slices.SortFunc(hits, time.Time.Compare)
+	return hits[len(hits)-p.MaxHits].Add(p.Period).Sub(now)
+}
+
+// MinRequestInterval is the time between two requests that keeps the client below the given requests per second
+func MinRequestInterval(maxRequestsPerSecond float64) time.Duration {
+	return time.Duration(float64(time.Second) / maxRequestsPerSecond)
+}
+
 type RequestKey struct {
 	Token    string
 	Endpoint string
 }
 
 type AsyncHttpClient struct {
-	mu                   *PriorityMutex
-	requestTimestamps    map[RequestKey][]time.Time
-	rateLimitPolicies    map[RequestKey]map[string][]Policy
+	store                RateLimitStore
 	baseURL              *url.URL
 	maxRequestsPerSecond float64
 	userAgent            string
@@ -86,9 +107,7 @@ type AsyncHttpClient struct {
 
 func NewAsyncHttpClient(baseURL *url.URL, userAgent string, maxRequestsPerSecond float64) *AsyncHttpClient {
 	return &AsyncHttpClient{
-		mu:                   NewPriorityMutex(),
-		requestTimestamps:    make(map[RequestKey][]time.Time),
-		rateLimitPolicies:    make(map[RequestKey]map[string][]Policy),
+		store:                DefaultRateLimitStore(),
 		baseURL:              baseURL,
 		maxRequestsPerSecond: maxRequestsPerSecond,
 		userAgent:            userAgent,
@@ -106,6 +125,8 @@ type RequestArgs struct {
 	BodyRaw       any
 	Headers       map[string]string
 	IgnoreBaseURL bool
+	// the request is traced as part of this context if set
+	Context context.Context
 }
 
 func (c *AsyncHttpClient) SendRequest(
@@ -176,90 +197,53 @@ func (c *AsyncHttpClient) SendRequest(
 	return resp, nil
 }
 
+// the wait for a reservation is recomputed at least this often, since the policies of the key may be learnt meanwhile
+const maxReserveWait = time.Second
+
 func (c *AsyncHttpClient) waitUntilRequestAllowed(ctx context.Context, key RequestKey) error {
 	for {
-		c.mu.Lock()
-		canMakeRequest := c.canMakeRequest(key)
-		if canMakeRequest {
-			c.requestTimestamps[key] = append(c.requestTimestamps[key], time.Now())
-			c.mu.Unlock()
+		wait, err := c.store.Reserve(key, c.maxRequestsPerSecond)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to reserve request", "endpoint", key.Endpoint, "error", err)
+			wait = maxReserveWait
+		} else if wait == 0 {
 			return nil
 		}
-		c.mu.Unlock()
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(100 * time.Millisecond):
+		case <-time.After(min(wait, maxReserveWait)):
 		}
 	}
 }
 
 func (c *AsyncHttpClient) adjustPolicies(key RequestKey, headers http.Header) {
-	c.mu.PriorityLock()
-	defer c.mu.PriorityUnlock()
-
-	delete(c.rateLimitPolicies[key], "dummy")
-
-	now := time.Now()
-	timestamps := c.requestTimestamps[key]
-	newPolicies := make(map[string][]Policy)
+	policies := make(map[string]map[Policy]int)
 	for _, rule := range c.getRules(headers) {
-		var policies []Policy
-		for policy, currentHits := range c.parsePolicies(rule, headers) {
-			policies = append(policies, policy)
-			startTime := now.Add(-policy.Period)
-			trackedHits := 0
-			for _, t := range timestamps {
-				if t.After(startTime) {
-					trackedHits++
-				}
-			}
-			missingHits := currentHits - trackedHits
-			for range missingHits {
-				timestamps = append(timestamps, now)
-			}
-		}
-		newPolicies[rule] = policies
+		policies[rule] = c.parsePolicies(rule, headers)
+	}
+	if err := c.store.UpdatePolicies(key, policies); err != nil {
+		logger.Error("Failed to update rate limit policies", "endpoint", key.Endpoint, "error", err)
 	}
-	// clear old timestamps > 10 minutes
-	c.requestTimestamps[key] = utils.Filter(timestamps, func(t time.Time) bool {
-		return t.After(now.Add(-600 * time.Second))
-	})
-	c.rateLimitPolicies[key] = newPolicies
 }
 
-func (c *AsyncHttpClient) canMakeRequest(key RequestKey) bool {
-	if c.ipIsRateLimited() {
-		return false
-	}
-	if _, ok := c.rateLimitPolicies[key]; !ok {
-		c.rateLimitPolicies[key] = map[string][]Policy{
-			"dummy": {{MaxHits: 1, Period: 9999999 * time.Second}},
-		}
-		return true
+// RemainingRequests returns how many requests can be sent for the token and endpoint before one of the known policies
+// is violated. Keys without known policies allow a single request, since their policies are learnt from the first response.
+func (c *AsyncHttpClient) RemainingRequests(token string, endpoint string) int {
+	if token == "" {
+		token = "IP"
 	}
-
-	for _, policies := range c.rateLimitPolicies[key] {
-		for _, policy := range policies {
-			if policy.IsViolated(c.requestTimestamps[key]) {
-				return false
-			}
-		}
+	remaining, err := c.store.RemainingRequests(RequestKey{Token: token, Endpoint: endpoint})
+	if err != nil {
+		logger.Error("Failed to get remaining requests", "endpoint", endpoint, "error", err)
+		return 0
 	}
-	return true
+	return remaining
 }
 
-func (c *AsyncHttpClient) ipIsRateLimited() bool {
-	start := time.Now().Add(-time.Second / time.Duration(c.maxRequestsPerSecond))
-	requestsTimePeriod := 0
-	for _, timestamps := range c.requestTimestamps {
-		for _, t := range timestamps {
-			if t.After(start) {
-				requestsTimePeriod++
-			}
-		}
-	}
-	return requestsTimePeriod >= 1
+// MaxRequestsPerSecond is the number of requests per second the client sends at most across all keys
+func (c *AsyncHttpClient) MaxRequestsPerSecond() float64 {
+	return c.maxRequestsPerSecond
 }
 
 func (c *AsyncHttpClient) getRules(headers http.Header) []string {
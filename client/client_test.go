@@ -1,6 +1,7 @@
 package client
 
 import (
+	"encoding/xml"
 	"net/http"
 	"net/url"
 	"sync"
@@ -162,32 +163,166 @@ func TestParsePolicies_EmptyHeaders(t *testing.T) {
 	assert.Nil(t, result)
 }
 
+// ========== MemoryRateLimitStore ==========
+
 func TestCanMakeRequest_FirstRequest(t *testing.T) {
-	c := newTestClient()
+	s := NewMemoryRateLimitStore()
 	key := RequestKey{Token: "tok", Endpoint: "ep"}
 	// First request always allowed (creates dummy policy)
-	assert.True(t, c.canMakeRequest(key))
+	assert.True(t, s.canMakeRequest(key, 10.0))
 }
 
 func TestCanMakeRequest_PolicyViolated(t *testing.T) {
-	c := newTestClient()
+	s := NewMemoryRateLimitStore()
 	key := RequestKey{Token: "tok", Endpoint: "ep"}
-	c.rateLimitPolicies[key] = map[string][]Policy{
+	s.rateLimitPolicies[key] = map[string][]Policy{
 		"rule": {{MaxHits: 1, Period: 10 * time.Second}},
 	}
 	now := time.Now()
-	c.requestTimestamps[key] = []time.Time{now}
-	assert.False(t, c.canMakeRequest(key))
+	s.requestTimestamps[key] = []time.Time{now}
+	assert.False(t, s.canMakeRequest(key, 10.0))
+}
+
+func TestReserve_WaitsForOldestHitToExpire(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	key := RequestKey{Token: "tok", Endpoint: "ep"}
+	s.rateLimitPolicies[key] = map[string][]Policy{
+		"rule": {{MaxHits: 2, Period: 10 * time.Second}},
+	}
+	now := time.Now()
+	s.requestTimestamps[key] = []time.Time{now.Add(-2 * time.Second), now.Add(-8 * time.Second)}
+
+	wait, err := s.Reserve(key, 10)
+	require.NoError(t, err)
+	assert.InDelta(t, 2*time.Second, wait, float64(100*time.Millisecond), "the request after the oldest hit expires is allowed")
+	assert.Len(t, s.requestTimestamps[key], 2, "a request that has to wait is not recorded")
+
+	s.requestTimestamps[key] = []time.Time{now.Add(-8 * time.Second)}
+	wait, err = s.Reserve(RequestKey{Token: "other", Endpoint: "ep"}, 0.5)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	wait, err = s.Reserve(key, 0.5)
+	require.NoError(t, err)
+	assert.InDelta(t, 2*time.Second, wait, float64(100*time.Millisecond), "the per second limit spans all keys")
+}
+
+func TestPolicyWait(t *testing.T) {
+	now := time.Now()
+	policy := Policy{MaxHits: 2, Period: time.Minute}
+	assert.Zero(t, policy.Wait(nil, now))
+	assert.Zero(t, policy.Wait([]time.Time{now.Add(-10 * time.Second), now.Add(-2 * time.Minute)}, now), "expired hits don't count")
+	assert.Equal(t, 30*time.Second, policy.Wait([]time.Time{now.Add(-10 * time.Second), now.Add(-40 * time.Second), now.Add(-30 * time.Second)}, now))
 }
 
 func TestIpIsRateLimited_NoRequests(t *testing.T) {
-	c := newTestClient()
-	assert.False(t, c.ipIsRateLimited())
+	s := NewMemoryRateLimitStore()
+	assert.False(t, s.ipIsRateLimited(10.0))
 }
 
 func TestIpIsRateLimited_RecentRequest(t *testing.T) {
-	c := newTestClient()
+	s := NewMemoryRateLimitStore()
+	key := RequestKey{Token: "tok", Endpoint: "ep"}
+	s.requestTimestamps[key] = []time.Time{time.Now()}
+	assert.True(t, s.ipIsRateLimited(10.0))
+}
+
+func TestRemainingRequests_UnknownKey(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	remaining, err := s.RemainingRequests(RequestKey{Token: "tok", Endpoint: "ep"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, remaining)
+}
+
+func TestRemainingRequests_StrictestPolicy(t *testing.T) {
+	s := NewMemoryRateLimitStore()
 	key := RequestKey{Token: "tok", Endpoint: "ep"}
-	c.requestTimestamps[key] = []time.Time{time.Now()}
-	assert.True(t, c.ipIsRateLimited())
+	s.rateLimitPolicies[key] = map[string][]Policy{
+		"account": {{MaxHits: 5, Period: 10 * time.Second}, {MaxHits: 30, Period: 300 * time.Second}},
+		"ip":      {{MaxHits: 3, Period: 5 * time.Second}},
+	}
+	now := time.Now()
+	s.requestTimestamps[key] = []time.Time{now.Add(-20 * time.Second), now.Add(-time.Second)}
+	remaining, err := s.RemainingRequests(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, remaining)
+	s.requestTimestamps[key] = append(s.requestTimestamps[key], now, now, now)
+	remaining, err = s.RemainingRequests(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestUpdatePolicies_LearnsPoliciesAndHits(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	key := RequestKey{Token: "tok", Endpoint: "ep"}
+	wait, err := s.Reserve(key, 1000)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	time.Sleep(2 * time.Millisecond)
+	wait, err = s.Reserve(key, 1000)
+	require.NoError(t, err)
+	assert.Positive(t, wait, "the dummy policy blocks until the first response arrives")
+
+	policy := Policy{MaxHits: 5, Period: time.Minute}
+	require.NoError(t, s.UpdatePolicies(key, map[string]map[Policy]int{"account": {policy: 3}}))
+	remaining, err := s.RemainingRequests(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, remaining, "hits counted by the API are added to the tracked ones")
+
+	usage, err := s.Usage()
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, MaskToken("tok"), usage[0].Token)
+	assert.Equal(t, "account", usage[0].Rule)
+	assert.Equal(t, 3, usage[0].CurrentHits)
+}
+
+func TestMaskToken(t *testing.T) {
+	assert.Equal(t, "IP", MaskToken("IP"))
+	assert.Len(t, MaskToken("secret"), 16)
+	assert.NotContains(t, MaskToken("secret"), "secret")
+}
+
+// ========== PlayerStats ==========
+
+func TestPlayerStats_GetStat(t *testing.T) {
+	stats := &PlayerStats{FireMaximumHitTaken: 4200}
+	value, ok := stats.GetStat("FireMaximumHitTaken")
+	assert.True(t, ok)
+	assert.Equal(t, 4200.0, value)
+
+	_, ok = stats.GetStat("NotAStat")
+	assert.False(t, ok)
+}
+
+// ========== PathOfBuilding ==========
+
+func TestPathOfBuilding_GetEquippedItems(t *testing.T) {
+	data := `<PathOfBuilding><Items>
+<Item id="1">
+Rarity: UNIQUE
+Tabula Rasa
+Simple Robe
+</Item>
+<Item id="2">
+Rarity: RARE
+Doom Visor
+Hubris Circlet
+</Item>
+<ItemSet id="1"><Slot name="Body Armour" itemId="1"/><Slot name="Helmet" itemId="2"/><Slot name="Gloves" itemId="0"/></ItemSet>
+</Items></PathOfBuilding>`
+	var pob PathOfBuilding
+	require.NoError(t, xml.Unmarshal([]byte(data), &pob))
+
+	equipped := pob.GetEquippedItems()
+	assert.Len(t, equipped, 2)
+	assert.Equal(t, "Tabula Rasa", equipped["Body Armour"].Name)
+	assert.Equal(t, "Hubris Circlet", equipped["Helmet"].BaseType)
+}
+
+func TestPathOfBuilding_GetGemLevels(t *testing.T) {
+	pob := &PathOfBuilding{Skills: Skills{SkillSets: []SkillSet{{Skills: []Skill{
+		{Gems: []Gem{{NameSpec: "Cyclone", Level: "18"}, {NameSpec: "Precision", Level: "10"}}},
+		{Gems: []Gem{{NameSpec: "Precision", Level: "20"}}},
+	}}}}}
+	assert.Equal(t, map[string]int{"Cyclone": 18, "Precision": 20}, pob.GetGemLevels())
 }
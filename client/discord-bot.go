@@ -3,6 +3,7 @@ package client
 import (
 	"bpl/config"
 	"bpl/utils"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -29,6 +30,22 @@ func (c *LocalDiscordClient) AssignRoles() (*http.Response, error) {
 	return c.Client.Post(fmt.Sprintf("%s/%s/assign-roles", c.BaseURL, c.ServerId), "application/json", nil)
 }
 
+func (c *LocalDiscordClient) SendDirectMessage(discordUserId string, message string) error {
+	body, err := json.Marshal(map[string]string{"message": message})
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Post(fmt.Sprintf("%s/%s/members/%s/message", c.BaseURL, c.ServerId, discordUserId), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer utils.Closer(resp.Body)()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("discord bot responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func (c *LocalDiscordClient) GetServerMembers() ([]*discordgo.Member, error) {
 	resp, err := c.Client.Get(fmt.Sprintf("%s/%s/members", c.BaseURL, c.ServerId))
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"bpl/utils"
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -43,6 +44,9 @@ func GetPoBExport(characterData *Character) (*PathOfBuilding, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
+	if response.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("pob server responded with status %d: %s", response.StatusCode, string(body))
+	}
 	export := string(body)
 	pob, err := DecodePoBExport(export)
 	if err != nil {
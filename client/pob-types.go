@@ -9,11 +9,13 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"reflect"
 	"strconv"
 	"strings"
 )
 
 type PoBItem struct {
+	Id       int    `xml:"-"`
 	Rarity   string `xml:"-"`
 	Name     string `xml:"-"`
 	BaseType string `xml:"-"`
@@ -29,6 +31,7 @@ func (p *PoBItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	if err := d.DecodeElement(&aux, &start); err != nil {
 		return err
 	}
+	p.Id = aux.ID
 	lines := strings.Split(aux.Text, "\n")
 	cleaned := make([]string, 0, len(lines))
 	for _, line := range lines {
@@ -67,11 +70,64 @@ func (p *PoBItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	return nil
 }
 
+// PoBSlot assigns an item to an equipment slot, e.g. <Slot name="Body Armour" itemId="3"/>
+type PoBSlot struct {
+	Name   string `xml:"name,attr"`
+	ItemId int    `xml:"itemId,attr"`
+}
+
+type PoBItemSet struct {
+	Id    int       `xml:"id,attr"`
+	Slots []PoBSlot `xml:"Slot"`
+}
+
 type PathOfBuilding struct {
-	Build  Build     `xml:"Build"`
-	Skills Skills    `xml:"Skills"`
-	Tree   Tree      `xml:"Tree"`
-	Items  []PoBItem `xml:"Items>Item"`
+	Build    Build        `xml:"Build"`
+	Skills   Skills       `xml:"Skills"`
+	Tree     Tree         `xml:"Tree"`
+	Items    []PoBItem    `xml:"Items>Item"`
+	ItemSets []PoBItemSet `xml:"Items>ItemSet"`
+	Slots    []PoBSlot    `xml:"Items>Slot"`
+}
+
+// GetEquippedItems maps the slot names of the first item set to the items equipped in them.
+// Older exports list their slots directly below the items instead of in an item set.
+func (p *PathOfBuilding) GetEquippedItems() map[string]PoBItem {
+	slots := p.Slots
+	if len(p.ItemSets) > 0 {
+		slots = p.ItemSets[0].Slots
+	}
+	itemsById := make(map[int]PoBItem, len(p.Items))
+	for _, item := range p.Items {
+		itemsById[item.Id] = item
+	}
+	equipped := make(map[string]PoBItem, len(slots))
+	for _, slot := range slots {
+		if item, ok := itemsById[slot.ItemId]; ok && slot.ItemId != 0 {
+			equipped[slot.Name] = item
+		}
+	}
+	return equipped
+}
+
+// GetGemLevels returns the highest level of every gem in the first skill set
+func (p *PathOfBuilding) GetGemLevels() map[string]int {
+	levels := make(map[string]int)
+	if len(p.Skills.SkillSets) == 0 {
+		return levels
+	}
+	for _, skill := range p.Skills.SkillSets[0].Skills {
+		for _, gem := range skill.Gems {
+			if gem.NameSpec == "" {
+				continue
+			}
+			level, _ := strconv.Atoi(gem.Level)
+			if current, ok := levels[gem.NameSpec]; !ok || level > current {
+				levels[gem.NameSpec] = level
+			}
+		}
+	}
+	return levels
 }
 
 func (p *PathOfBuilding) GetMainSkill() string {
@@ -94,6 +150,9 @@ func (p *PathOfBuilding) GetPassives() []int {
 		}
 		passives = append(passives, id)
 	}
+	if len(p.Tree.Spec.MasteryEffects) < 2 {
+		return passives
+	}
 	masteryEffects := strings.SplitSeq(p.Tree.Spec.MasteryEffects[1:len(p.Tree.Spec.MasteryEffects)-1], "},{")
 	for me := range masteryEffects {
 		parts := strings.Split(me, ",")
@@ -266,6 +325,15 @@ func (ps *playerStatXML) UnmarshalXML(d *xml.Decoder, start xml.StartElement) er
 	return nil
 }
 
+// GetStat returns the value of the stat with the given field name, the second return value is false for unknown stats
+func (ps *PlayerStats) GetStat(stat string) (float64, bool) {
+	field := reflect.ValueOf(ps).Elem().FieldByName(stat)
+	if !field.IsValid() || field.Kind() != reflect.Float64 {
+		return 0, false
+	}
+	return field.Float(), true
+}
+
 func (ps *PlayerStats) SetStat(stat string, value float64) {
 	switch stat {
 	case "AverageDamage":
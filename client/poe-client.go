@@ -8,7 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math"
 	"net/http"
 	"net/url"
@@ -17,11 +17,17 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PoEClient struct {
 	Client         *AsyncHttpClient
 	TimeOutSeconds int
+	// the endpoints that are not served by the API host
+	TokenURL      string
+	PoE2LadderURL string
 }
 
 type ClientError struct {
@@ -32,21 +38,68 @@ type ClientError struct {
 	Path            string
 }
 
+// LogValue logs the client error as a group of its fields
+func (e *ClientError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("status", e.StatusCode),
+		slog.Any("error", e.Error),
+		slog.String("description", e.Description),
+		slog.String("path", e.Path),
+	)
+}
+
 type ErrorResponse struct {
 	Error            any    `json:"error"`
 	ErrorDescription string `json:"error_description"`
 }
 
 func NewPoEClient(maxRequestsPerSecond float64, raiseForStatus bool, timeOutSeconds int) *PoEClient {
+	if apiURL := config.Env().POEAPIURL; apiURL != "" {
+		baseURL, err := url.Parse(apiURL)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid POE_API_URL %s: %v", apiURL, err))
+		}
+		return NewPoEClientWithBaseURL(baseURL, maxRequestsPerSecond, timeOutSeconds)
+	}
 	baseURL := &url.URL{Scheme: "https", Host: "api.pathofexile.com"}
 	return &PoEClient{
 		Client:         NewAsyncHttpClient(baseURL, config.Env().POEClientAgent, maxRequestsPerSecond),
 		TimeOutSeconds: timeOutSeconds,
+		TokenURL:       "https://www.pathofexile.com/oauth/token",
+		PoE2LadderURL:  "https://pathofexile2.com/internal-api/content/game-ladder/id",
 	}
 }
 
-func sendRequest[T any](client *PoEClient, requestKey string, args RequestArgs) (*T, *ClientError) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(client.TimeOutSeconds)*time.Second)
+// NewPoEClientWithBaseURL returns a client that sends all requests to a single server, including the OAuth and PoE2 ladder
+// requests that usually go to the website
+func NewPoEClientWithBaseURL(baseURL *url.URL, maxRequestsPerSecond float64, timeOutSeconds int) *PoEClient {
+	return &PoEClient{
+		Client:         NewAsyncHttpClient(baseURL, config.Env().POEClientAgent, maxRequestsPerSecond),
+		TimeOutSeconds: timeOutSeconds,
+		TokenURL:       baseURL.JoinPath("oauth", "token").String(),
+		PoE2LadderURL:  baseURL.JoinPath("internal-api", "content", "game-ladder", "id").String(),
+	}
+}
+
+func sendRequest[T any](client *PoEClient, requestKey string, args RequestArgs) (_ *T, clientErr *ClientError) {
+	parent := args.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	parent, span := config.Tracer().Start(parent, "poe."+requestKey,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(args.Method),
+			semconv.URLTemplate(args.Path),
+		),
+	)
+	defer func() {
+		if clientErr != nil {
+			span.SetStatus(codes.Error, fmt.Sprintf("%v: %s", clientErr.Error, clientErr.Description))
+		}
+		span.End()
+	}()
+	ctx, cancel := context.WithTimeout(parent, time.Duration(client.TimeOutSeconds)*time.Second)
 	defer cancel()
 
 	if args.Body == nil && args.BodyRaw != nil {
@@ -71,6 +124,7 @@ func sendRequest[T any](client *PoEClient, requestKey string, args RequestArgs)
 		}
 	}
 	metrics.ResponseCounter.WithLabelValues(fmt.Sprintf("%d", response.StatusCode)).Inc()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
 	defer utils.Closer(response.Body)()
 	respBody, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -84,8 +138,7 @@ func sendRequest[T any](client *PoEClient, requestKey string, args RequestArgs)
 	}
 
 	if response.StatusCode >= 400 {
-		fmt.Printf("Error at path %s with params %v\n", args.Path, args.PathParams)
-		log.Print(string(respBody))
+		logger.WarnContext(ctx, "PoE api returned an error", "path", args.Path, "params", args.PathParams, "status", response.StatusCode, "body", string(respBody))
 		errorBody := &ErrorResponse{}
 		err = json.Unmarshal(respBody, errorBody)
 		if err != nil {
@@ -109,8 +162,7 @@ func sendRequest[T any](client *PoEClient, requestKey string, args RequestArgs)
 	result := new(T)
 	err = json.Unmarshal(respBody, result)
 	if err != nil {
-		fmt.Printf("Failed to call %s with response:\n", args.Path)
-		fmt.Println(string(respBody))
+		logger.ErrorContext(ctx, "Failed to parse PoE api response", "path", args.Path, "body", string(respBody), "error", err)
 		return nil, &ClientError{
 			StatusCode:      response.StatusCode,
 			Error:           "bpl2_client_response_body_parse_error",
@@ -209,7 +261,7 @@ func (c *PoEClient) GetPoE2Ladder(league string) (*GetLeagueLadderResponse, *Cli
 	resp, err := sendRequest[GetPoE2LadderResponse](c,
 		"GetPoE2Ladder",
 		RequestArgs{
-			Path:          "https://pathofexile2.com/internal-api/content/game-ladder/id/%s",
+			Path:          c.PoE2LadderURL + "/%s",
 			PathParams:    []string{league},
 			Method:        "GET",
 			IgnoreBaseURL: true,
@@ -491,7 +543,7 @@ func (c *PoEClient) ListGuildStashes(token string, league string) (*ListGuildSta
 	)
 }
 
-func (c *PoEClient) GetGuildStash(token string, league string, stashId string, parentId *string) (*GetGuildStashResponse, *ClientError) {
+func (c *PoEClient) GetGuildStash(ctx context.Context, token string, league string, stashId string, parentId *string) (*GetGuildStashResponse, *ClientError) {
 	timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues("GetGuildStash"))
 	defer timer.ObserveDuration()
 	metrics.PoeRequestCounter.WithLabelValues("GetGuildStash").Inc()
@@ -509,11 +561,12 @@ func (c *PoEClient) GetGuildStash(token string, league string, stashId string, p
 			PathParams: pathParams,
 			Token:      token,
 			Method:     "GET",
+			Context:    ctx,
 		},
 	)
 }
 
-func (c *PoEClient) GetPublicStashes(token string, realm string, id string) (*GetPublicStashTabsResponse, *ClientError) {
+func (c *PoEClient) GetPublicStashes(ctx context.Context, token string, realm string, id string) (*GetPublicStashTabsResponse, *ClientError) {
 	timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues("GetPublicStashes"))
 	defer timer.ObserveDuration()
 	metrics.PoeRequestCounter.WithLabelValues("GetPublicStashes").Inc()
@@ -532,6 +585,7 @@ func (c *PoEClient) GetPublicStashes(token string, realm string, id string) (*Ge
 			Token:       token,
 			Method:      "GET",
 			QueryParams: params,
+			Context:     ctx,
 		},
 	)
 }
@@ -549,7 +603,7 @@ func (c *PoEClient) GetClientCredentials(clientId string, clientSecret string) (
 	return sendRequest[ClientCredentialsGrantResponse](c,
 		"GetClientCredentials",
 		RequestArgs{
-			Path:          "https://www.pathofexile.com/oauth/token",
+			Path:          c.TokenURL,
 			Token:         "",
 			Method:        "POST",
 			Body:          strings.NewReader(form.Encode()),
@@ -577,7 +631,7 @@ func (c *PoEClient) GetAccessToken(clientId string, clientSecret string, code st
 	return sendRequest[AccessTokenGrantResponse](c,
 		"GetAccessToken",
 		RequestArgs{
-			Path:   "https://www.pathofexile.com/oauth/token",
+			Path:   c.TokenURL,
 			Method: "POST",
 			Body:   strings.NewReader(form.Encode()),
 			Headers: map[string]string{
@@ -600,7 +654,7 @@ func (c *PoEClient) RefreshAccessToken(clientId string, clientSecret string, ref
 	return sendRequest[AccessTokenGrantResponse](c,
 		"RefreshAccessToken",
 		RequestArgs{
-			Path:   "https://www.pathofexile.com/oauth/token",
+			Path:   c.TokenURL,
 			Method: "POST",
 			Body:   strings.NewReader(form.Encode()),
 			Headers: map[string]string{
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"bpl/utils"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps track of the requests sent per RequestKey and of the rate limit policies the PoE API reported
+// for them. All clients share one store, so that they draw from the same budget.
+type RateLimitStore interface {
+	// Reserve records a request for the key if it can be sent without violating one of its known policies or
+	// exceeding the given number of requests per second across all keys. Otherwise it records nothing and
+	// returns how long to wait until the request may be allowed, a zero wait means the request was reserved.
+	Reserve(key RequestKey, maxRequestsPerSecond float64) (time.Duration, error)
+	// UpdatePolicies replaces the policies of the key with the ones reported in a response, per rule and
+	// together with the number of hits the API counted for each of them
+	UpdatePolicies(key RequestKey, policies map[string]map[Policy]int) error
+	RemainingRequests(key RequestKey) (int, error)
+	Usage() ([]*PolicyUsage, error)
+}
+
+type PolicyUsage struct {
+	// masked token of the request key, see MaskToken
+	Token       string
+	Endpoint    string
+	Rule        string
+	Policy      Policy
+	CurrentHits int
+}
+
+var (
+	defaultRateLimitStore   RateLimitStore = NewMemoryRateLimitStore()
+	defaultRateLimitStoreMu sync.RWMutex
+)
+
+// SetDefaultRateLimitStore replaces the store that clients created afterwards use
+func SetDefaultRateLimitStore(store RateLimitStore) {
+	defaultRateLimitStoreMu.Lock()
+	defer defaultRateLimitStoreMu.Unlock()
+	defaultRateLimitStore = store
+}
+
+func DefaultRateLimitStore() RateLimitStore {
+	defaultRateLimitStoreMu.RLock()
+	defer defaultRateLimitStoreMu.RUnlock()
+	return defaultRateLimitStore
+}
+
+// MaskToken returns an identifier for the token of a request key that can be persisted and displayed
+func MaskToken(token string) string {
+	if token == "IP" {
+		return token
+	}
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:8])
+}
+
+type MemoryRateLimitStore struct {
+	mu                *PriorityMutex
+	requestTimestamps map[RequestKey][]time.Time
+	rateLimitPolicies map[RequestKey]map[string][]Policy
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		mu:                NewPriorityMutex(),
+		requestTimestamps: make(map[RequestKey][]time.Time),
+		rateLimitPolicies: make(map[RequestKey]map[string][]Policy),
+	}
+}
+
+func (s *MemoryRateLimitStore) Reserve(key RequestKey, maxRequestsPerSecond float64) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wait := s.requestWait(key, maxRequestsPerSecond); wait > 0 {
+		return wait, nil
+	}
+	s.requestTimestamps[key] = append(s.requestTimestamps[key], time.Now())
+	return 0, nil
+}
+
+func (s *MemoryRateLimitStore) UpdatePolicies(key RequestKey, policies map[string]map[Policy]int) error {
+	s.mu.PriorityLock()
+	defer s.mu.PriorityUnlock()
+
+	delete(s.rateLimitPolicies[key], "dummy")
+
+	now := time.Now()
+	timestamps := s.requestTimestamps[key]
+	newPolicies := make(map[string][]Policy)
+	for rule, rulePolicies := range policies {
+		var policyList []Policy
+		for policy, currentHits := range rulePolicies {
+			policyList = append(policyList, policy)
+			missingHits := currentHits - policy.CurrentHits(timestamps)
+			for range missingHits {
+				timestamps = append(timestamps, now)
+			}
+		}
+		newPolicies[rule] = policyList
+	}
+	// clear old timestamps > 10 minutes
+	s.requestTimestamps[key] = utils.Filter(timestamps, func(t time.Time) bool {
+		return t.After(now.Add(-600 * time.Second))
+	})
+	s.rateLimitPolicies[key] = newPolicies
+	return nil
+}
+
+func (s *MemoryRateLimitStore) RemainingRequests(key RequestKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules, ok := s.rateLimitPolicies[key]
+	if !ok {
+		return 1, nil
+	}
+	remaining := math.MaxInt
+	for _, policies := range rules {
+		for _, policy := range policies {
+			remaining = min(remaining, max(0, policy.MaxHits-policy.CurrentHits(s.requestTimestamps[key])))
+		}
+	}
+	return remaining, nil
+}
+
+func (s *MemoryRateLimitStore) Usage() ([]*PolicyUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := make([]*PolicyUsage, 0)
+	for key, rules := range s.rateLimitPolicies {
+		for rule, policies := range rules {
+			for _, policy := range policies {
+				usage = append(usage, &PolicyUsage{
+					Token:       MaskToken(key.Token),
+					Endpoint:    key.Endpoint,
+					Rule:        rule,
+					Policy:      policy,
+					CurrentHits: policy.CurrentHits(s.requestTimestamps[key]),
+				})
+			}
+		}
+	}
+	slices.SortFunc(usage, func(a, b *PolicyUsage) int {
+		if c := strings.Compare(a.Endpoint, b.Endpoint); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Token, b.Token); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Rule, b.Rule); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Policy.Period, b.Policy.Period)
+	})
+	return usage, nil
+}
+
+func (s *MemoryRateLimitStore) canMakeRequest(key RequestKey, maxRequestsPerSecond float64) bool {
+	return s.requestWait(key, maxRequestsPerSecond) == 0
+}
+
+// requestWait returns how long it takes until a request of the key can be made, or 0 if it can be made now
+func (s *MemoryRateLimitStore) requestWait(key RequestKey, maxRequestsPerSecond float64) time.Duration {
+	now := time.Now()
+	if wait := s.ipWait(maxRequestsPerSecond, now); wait > 0 {
+		return wait
+	}
+	if _, ok := s.rateLimitPolicies[key]; !ok {
+		s.rateLimitPolicies[key] = map[string][]Policy{
+			"dummy": {{MaxHits: 1, Period: 9999999 * time.Second}},
+		}
+		return 0
+	}
+
+	wait := time.Duration(0)
+	for _, policies := range s.rateLimitPolicies[key] {
+		for _, policy := range policies {
+			wait = max(wait, policy.Wait(s.requestTimestamps[key], now))
+		}
+	}
+	return wait
+}
+
+func (s *MemoryRateLimitStore) ipIsRateLimited(maxRequestsPerSecond float64) bool {
+	return s.ipWait(maxRequestsPerSecond, time.Now()) > 0
+}
+
+// ipWait returns how long it takes until the latest request of any key is far enough in the past for another one
+func (s *MemoryRateLimitStore) ipWait(maxRequestsPerSecond float64, now time.Time) time.Duration {
+	var latest time.Time
+	for _, timestamps := range s.requestTimestamps {
+		for _, t := range timestamps {
+			if t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	return max(0, latest.Add(MinRequestInterval(maxRequestsPerSecond)).Sub(now))
+}
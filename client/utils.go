@@ -82,3 +82,50 @@ func (c *Character) HasPantheon() bool {
 	}
 	return false
 }
+
+var ascendancyClasses = map[string]string{
+	"Slayer":               "Duelist",
+	"Gladiator":            "Duelist",
+	"Champion":             "Duelist",
+	"Juggernaut":           "Marauder",
+	"Berserker":            "Marauder",
+	"Chieftain":            "Marauder",
+	"Deadeye":              "Ranger",
+	"Raider":               "Ranger",
+	"Pathfinder":           "Ranger",
+	"Warden":               "Ranger",
+	"Assassin":             "Shadow",
+	"Saboteur":             "Shadow",
+	"Trickster":            "Shadow",
+	"Inquisitor":           "Templar",
+	"Hierophant":           "Templar",
+	"Guardian":             "Templar",
+	"Necromancer":          "Witch",
+	"Occultist":            "Witch",
+	"Elementalist":         "Witch",
+	"Ascendant":            "Scion",
+	"Titan":                "Warrior",
+	"Warbringer":           "Warrior",
+	"Smith of Kitava":      "Warrior",
+	"Invoker":              "Monk",
+	"Acolyte of Chayula":   "Monk",
+	"Infernalist":          "Witch",
+	"Blood Mage":           "Witch",
+	"Lich":                 "Witch",
+	"Stormweaver":          "Sorceress",
+	"Chronomancer":         "Sorceress",
+	"Disciple of Varashta": "Sorceress",
+	"Witchhunter":          "Mercenary",
+	"Gemling Legionnaire":  "Mercenary",
+	"Tactician":            "Mercenary",
+	"Amazon":               "Huntress",
+	"Ritualist":            "Huntress",
+}
+
+// GetBaseClass returns the base class of an ascendancy. Characters that have not ascended yet already carry their base class.
+func GetBaseClass(ascendancy string) string {
+	if class, ok := ascendancyClasses[ascendancy]; ok {
+		return class
+	}
+	return ascendancy
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,7 +19,14 @@ type Config struct {
 	DatabaseName     string
 
 	// Authentication
+	// signs the tokens if JWTSigningKeys is empty
 	JWTSecret string
+	// signing keys by their id, e.g. "2026-10=secret,2026-07=oldsecret". Tokens are signed with JWTSigningKeyId and
+	// verified with the key of their kid header, so old keys can stay until the tokens signed with them have expired.
+	JWTSigningKeys  string
+	JWTSigningKeyId string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 
 	// Discord
 	DiscordClientID     string
@@ -36,13 +44,37 @@ type Config struct {
 	POEClientSecret  string
 	POEClientAgent   string
 	RefreshPoETokens bool
+	// where the PoE API rate limit state is kept, "memory" or "postgres" to share it between replicas
+	RateLimitStore string
+	// sends all PoE requests to this server instead, e.g. a fakepoe server in end-to-end tests
+	POEAPIURL string
 
 	// Path of Building
 	POBServerURL        string
 	NumberOfPoBReplicas int
 
+	// Shutdown
+	// how long in-flight requests and websocket connections get to finish after a SIGTERM
+	HTTPShutdownTimeout time.Duration
+	// how long running jobs get to save their pending work and hand over their leadership after a SIGTERM
+	WorkerShutdownTimeout time.Duration
+
+	// Logging
+	LogLevel string
+	// levels of single components that differ from LogLevel, e.g. "cron=debug,client=warn"
+	LogLevels string
+	// "json" or "text"
+	LogFormat string
+
+	// Tracing
+	// where spans are exported to, "none", "stdout" or "otlp"
+	TracingExporter    string
+	TracingServiceName string
+
 	// Other
 	KafkaBroker string
+	// identifies this process in the leader election, defaults to the hostname and process id
+	InstanceId string
 }
 
 var (
@@ -64,7 +96,11 @@ func loadConfig() *Config {
 		DatabaseName:     getEnvWithDefault("DATABASE_NAME", "postgres"),
 
 		// JWT - required
-		JWTSecret: getEnvWithDefault("JWT_SECRET", "dummyjwt"),
+		JWTSecret:       getEnvWithDefault("JWT_SECRET", "dummyjwt"),
+		JWTSigningKeys:  getEnvWithDefault("JWT_SIGNING_KEYS", ""),
+		JWTSigningKeyId: getEnvWithDefault("JWT_SIGNING_KEY_ID", "default"),
+		AccessTokenTTL:  time.Duration(getEnvAsInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL: time.Duration(getEnvAsInt("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour,
 
 		// Discord - optional
 		DiscordClientID:     getEnv("DISCORD_CLIENT_ID"),
@@ -82,13 +118,29 @@ func loadConfig() *Config {
 		POEClientSecret:  getEnv("POE_CLIENT_SECRET"),
 		POEClientAgent:   getEnv("POE_CLIENT_AGENT"),
 		RefreshPoETokens: getEnvWithDefault("REFRESH_POE_TOKENS", "false") == "true",
+		RateLimitStore:   getEnvWithDefault("RATE_LIMIT_STORE", "memory"),
+		POEAPIURL:        getEnvWithDefault("POE_API_URL", ""),
 
 		// Path of Building - optional
 		POBServerURL:        getEnvWithDefault("POB_SERVER_URL", "http://localhost:8080"),
 		NumberOfPoBReplicas: getEnvAsInt("POB_REPLICAS", 1),
 
+		// Shutdown
+		HTTPShutdownTimeout:   time.Duration(getEnvAsInt("HTTP_SHUTDOWN_TIMEOUT_SECONDS", 15)) * time.Second,
+		WorkerShutdownTimeout: time.Duration(getEnvAsInt("WORKER_SHUTDOWN_TIMEOUT_SECONDS", 60)) * time.Second,
+
+		// Logging
+		LogLevel:  getEnvWithDefault("LOG_LEVEL", "info"),
+		LogLevels: getEnvWithDefault("LOG_LEVELS", ""),
+		LogFormat: getEnvWithDefault("LOG_FORMAT", "json"),
+
+		// Tracing
+		TracingExporter:    getEnvWithDefault("TRACING_EXPORTER", "none"),
+		TracingServiceName: getEnvWithDefault("OTEL_SERVICE_NAME", "bpl-backend"),
+
 		// Other
 		KafkaBroker: getEnvWithDefault("KAFKA_BROKER", "localhost:9092"),
+		InstanceId:  getEnvWithDefault("INSTANCE_ID", defaultInstanceId()),
 	}
 
 	appConfig = config
@@ -132,6 +184,14 @@ func getEnvWithDefault(key, defaultValue string) string {
 	return value
 }
 
+func defaultInstanceId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 // IsProduction returns true if running in production
 func IsProduction() bool {
 	return getEnvWithDefault("ENVIRONMENT", "development") == "production"
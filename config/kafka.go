@@ -2,9 +2,11 @@ package config
 
 import (
 	"bpl/utils"
+	"context"
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -94,3 +96,49 @@ func GetReader(eventId int, consumerId int) (*kafka.Reader, error) {
 	}), nil
 
 }
+
+// GetConsumerLag returns how many messages of the event's topic the consumer group has not committed yet.
+// The topics only have a single partition, see CreateTopic.
+func GetConsumerLag(ctx context.Context, eventId int, consumerId int) (int64, error) {
+	broker := Env().KafkaBroker
+	if broker == "" {
+		return 0, fmt.Errorf("KAFKA_BROKER environment variable not set")
+	}
+	topic := fmt.Sprintf("stash-changes-%d", eventId)
+	client := &kafka.Client{Addr: kafka.TCP(broker), Timeout: 5 * time.Second}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: {kafka.FirstOffsetOf(0), kafka.LastOffsetOf(0)}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	partitions := offsets.Topics[topic]
+	if len(partitions) == 0 {
+		return 0, fmt.Errorf("topic %s not found", topic)
+	}
+	if partitions[0].Error != nil {
+		return 0, partitions[0].Error
+	}
+
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: fmt.Sprintf("%s-%d", topic, consumerId),
+		Topics:  map[string][]int{topic: {0}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if committed.Error != nil {
+		return 0, committed.Error
+	}
+	committedPartitions := committed.Topics[topic]
+	if len(committedPartitions) == 0 {
+		return 0, fmt.Errorf("no offsets for topic %s", topic)
+	}
+	if committedPartitions[0].Error != nil {
+		return 0, committedPartitions[0].Error
+	}
+	// a group without a commit reads from the first offset that is still retained
+	position := max(committedPartitions[0].CommittedOffset, partitions[0].FirstOffset)
+	return max(partitions[0].LastOffset-position, 0), nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type logAttrsKey struct{}
+
+var (
+	baseHandler     slog.Handler
+	componentLevels map[string]slog.Level
+	defaultLevel    slog.Level
+	onceLogging     sync.Once
+)
+
+func initHandler() {
+	onceLogging.Do(func() {
+		defaultLevel = parseLevel(Env().LogLevel, slog.LevelInfo)
+		componentLevels = make(map[string]slog.Level)
+		// e.g. "cron=debug,client=warn"
+		for entry := range strings.SplitSeq(Env().LogLevels, ",") {
+			component, level, found := strings.Cut(strings.TrimSpace(entry), "=")
+			if found {
+				componentLevels[component] = parseLevel(level, defaultLevel)
+			}
+		}
+		options := &slog.HandlerOptions{Level: slog.LevelDebug}
+		if Env().LogFormat == "text" {
+			baseHandler = slog.NewTextHandler(os.Stdout, options)
+		} else {
+			baseHandler = slog.NewJSONHandler(os.Stdout, options)
+		}
+	})
+}
+
+func parseLevel(value string, fallback slog.Level) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return fallback
+	}
+	return level
+}
+
+// InitLogging makes the structured logger the default one, so that the output of the standard log package is
+// written as structured records as well
+func InitLogging() {
+	initHandler()
+	slog.SetDefault(slog.New(&contextHandler{handler: baseHandler, level: defaultLevel}))
+}
+
+// Logger returns the logger of a component, its level can be set in LOG_LEVELS
+func Logger(component string) *slog.Logger {
+	initHandler()
+	level, ok := componentLevels[component]
+	if !ok {
+		level = defaultLevel
+	}
+	return slog.New(&contextHandler{
+		handler: baseHandler.WithAttrs([]slog.Attr{slog.String("component", component)}),
+		level:   level,
+	})
+}
+
+// WithLogAttrs returns a context whose log records carry the given attributes in addition to the ones already
+// attached to ctx, e.g. the request id of an http request or the job and event of a background job
+func WithLogAttrs(ctx context.Context, args ...any) context.Context {
+	attrs := slog.Group("", args...).Value.Group()
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// contextHandler adds the attributes attached to the context and the current trace to every record
+type contextHandler struct {
+	handler slog.Handler
+	level   slog.Level
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{handler: h.handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{handler: h.handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracerName = "bpl"
+
+// InitTracing installs the global tracer provider with the exporter configured in TRACING_EXPORTER and traces the
+// queries of the database connection, so it must be called after InitDB. Tracing stays disabled without an exporter.
+// The returned function flushes the pending spans and should be called before the process exits.
+func InitTracing(ctx context.Context) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch Env().TracingExporter {
+	case "", "none":
+		return func(ctx context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		// the endpoint is read from OTEL_EXPORTER_OTLP_ENDPOINT and defaults to a collector on localhost:4318
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, expected none, stdout or otlp", Env().TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", Env().TracingExporter, err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(Env().TracingServiceName),
+			semconv.ServiceInstanceID(Env().InstanceId),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	if db != nil {
+		if err := db.Use(&tracingPlugin{}); err != nil {
+			return nil, fmt.Errorf("failed to trace database queries: %w", err)
+		}
+	}
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for all spans of the application
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// EndSpan records the error on the span, if there is one, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// kafkaHeaderCarrier lets the trace context travel in the headers of a kafka message
+type kafkaHeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c kafkaHeaderCarrier) Get(key string) string {
+	for _, header := range *c.headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c kafkaHeaderCarrier) Set(key string, value string) {
+	for i, header := range *c.headers {
+		if header.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, header := range *c.headers {
+		keys[i] = header.Key
+	}
+	return keys
+}
+
+// InjectTraceContext writes the trace context of ctx into the headers of the message
+func InjectTraceContext(ctx context.Context, message *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{headers: &message.Headers})
+}
+
+// ExtractTraceContext returns ctx continuing the trace that the producer of the message wrote into its headers
+func ExtractTraceContext(ctx context.Context, message *kafka.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, kafkaHeaderCarrier{headers: &message.Headers})
+}
+
+const tracingSpanKey = "bpl:span"
+
+// tracingPlugin records a span for every query whose statement context belongs to a trace, i.e. queries that were
+// started with db.WithContext(ctx) from within a span. Queries outside of a trace are not recorded.
+type tracingPlugin struct{}
+
+func (p *tracingPlugin) Name() string {
+	return "bpl:tracing"
+}
+
+func (p *tracingPlugin) Initialize(db *gorm.DB) error {
+	type register func(name string, fn func(*gorm.DB)) error
+	callback := db.Callback()
+	registrations := map[string][2]register{
+		"create": {callback.Create().Before("gorm:create").Register, callback.Create().After("gorm:create").Register},
+		"query":  {callback.Query().Before("gorm:query").Register, callback.Query().After("gorm:query").Register},
+		"update": {callback.Update().Before("gorm:update").Register, callback.Update().After("gorm:update").Register},
+		"delete": {callback.Delete().Before("gorm:delete").Register, callback.Delete().After("gorm:delete").Register},
+		"row":    {callback.Row().Before("gorm:row").Register, callback.Row().After("gorm:row").Register},
+		"raw":    {callback.Raw().Before("gorm:raw").Register, callback.Raw().After("gorm:raw").Register},
+	}
+	for operation, registration := range registrations {
+		if err := registration[0]("bpl:tracing_before_"+operation, startQuerySpan(operation)); err != nil {
+			return err
+		}
+		if err := registration[1]("bpl:tracing_after_"+operation, endQuerySpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := Tracer().Start(ctx, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemNamePostgreSQL,
+				semconv.DBCollectionName(tx.Statement.Table),
+			),
+		)
+		tx.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func endQuerySpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	// the statement is only complete after gorm has built it, so it is added at the end
+	query := tx.Statement.SQL.String()
+	if len(query) > 2000 {
+		query = query[:2000]
+	}
+	span.SetAttributes(
+		semconv.DBQueryText(strings.TrimSpace(query)),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	err := tx.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	EndSpan(span, err)
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"bpl/service"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthController struct {
+	tokenService service.TokenService
+}
+
+func NewAuthController() *AuthController {
+	return &AuthController{
+		tokenService: service.NewTokenService(),
+	}
+}
+
+func setupAuthController() []RouteInfo {
+	e := NewAuthController()
+	basePath := "/auth"
+	routes := []RouteInfo{
+		{Method: "POST", Path: "/refresh", HandlerFunc: e.refreshHandler()},
+		{Method: "POST", Path: "/logout", HandlerFunc: e.logoutHandler(), Authenticated: true},
+		{Method: "POST", Path: "/logout-all", HandlerFunc: e.logoutAllHandler(), Authenticated: true},
+	}
+	for i, route := range routes {
+		routes[i].Path = basePath + route.Path
+	}
+	return routes
+}
+
+// @id RefreshTokens
+// @Description Exchanges a refresh token for a new access token and refresh token. The refresh token can only be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshTokenBody true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Router /auth/refresh [post]
+func (e *AuthController) refreshHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body RefreshTokenBody
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		tokens, err := e.tokenService.Refresh(body.RefreshToken)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidRefreshToken) {
+				c.JSON(401, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(200, toTokenResponse(tokens))
+	}
+}
+
+// @id Logout
+// @Description Revokes the access token and, if given, the session of the refresh token
+// @Tags auth
+// @Accept json
+// @Param body body LogoutBody false "Refresh token"
+// @Success 204
+// @Security BearerAuth
+// @Router /auth/logout [post]
+func (e *AuthController) logoutHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := getClaims(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Not authenticated"})
+			return
+		}
+		var body LogoutBody
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&body); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := e.tokenService.Logout(claims, body.RefreshToken); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(204)
+	}
+}
+
+// @id LogoutAll
+// @Description Ends all sessions of the authenticated user
+// @Tags auth
+// @Success 204
+// @Security BearerAuth
+// @Router /auth/logout-all [post]
+func (e *AuthController) logoutAllHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, ok := getUserId(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Not authenticated"})
+			return
+		}
+		if err := e.tokenService.RevokeAllTokens(userId); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(204)
+	}
+}
+
+type RefreshTokenBody struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutBody struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	AuthToken       string    `json:"auth_token" binding:"required"`
+	AuthTokenExpiry time.Time `json:"auth_token_expiry" binding:"required"`
+	RefreshToken    string    `json:"refresh_token" binding:"required"`
+}
+
+func toTokenResponse(tokens *service.TokenPair) *TokenResponse {
+	return &TokenResponse{
+		AuthToken:       tokens.AccessToken,
+		AuthTokenExpiry: tokens.AccessTokenExpiry,
+		RefreshToken:    tokens.RefreshToken,
+	}
+}
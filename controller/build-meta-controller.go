@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"bpl/service"
+	"bpl/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BuildMetaController struct {
+	buildMetaService service.BuildMetaService
+}
+
+func NewBuildMetaController() *BuildMetaController {
+	return &BuildMetaController{
+		buildMetaService: service.NewBuildMetaService(),
+	}
+}
+
+func setupBuildMetaController() []RouteInfo {
+	c := NewBuildMetaController()
+	baseUrl := "events/:event_id/meta"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "/builds", HandlerFunc: c.getBuildMetaHandler()},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id GetBuildMeta
+// @Description Get the class, ascendancy and main skill distribution of an event together with DPS and EHP per archetype and the evolution of the meta over the event
+// @Tags ladder
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param team_id query int false "Only include characters of this team"
+// @Param min_level query int false "Only include characters of at least this level"
+// @Param max_level query int false "Only include characters of at most this level"
+// @Param interval_hours query int false "Hours between two snapshots of the meta evolution (default 24)"
+// @Success 200 {object} BuildMeta
+// @Router /events/{event_id}/meta/builds [get]
+func (c *BuildMetaController) getBuildMetaHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		filter := service.BuildMetaFilter{Interval: 24 * time.Hour}
+		if teamId := ctx.Query("team_id"); teamId != "" {
+			id, err := strconv.Atoi(teamId)
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid team_id"})
+				return
+			}
+			filter.TeamId = &id
+		}
+		if minLevel := ctx.Query("min_level"); minLevel != "" {
+			level, err := strconv.Atoi(minLevel)
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid min_level"})
+				return
+			}
+			filter.MinLevel = level
+		}
+		if maxLevel := ctx.Query("max_level"); maxLevel != "" {
+			level, err := strconv.Atoi(maxLevel)
+			if err != nil {
+				ctx.JSON(400, gin.H{"error": "Invalid max_level"})
+				return
+			}
+			filter.MaxLevel = level
+		}
+		if intervalHours := ctx.Query("interval_hours"); intervalHours != "" {
+			hours, err := strconv.Atoi(intervalHours)
+			if err != nil || hours < 1 {
+				ctx.JSON(400, gin.H{"error": "Invalid interval_hours"})
+				return
+			}
+			filter.Interval = time.Duration(hours) * time.Hour
+		}
+		meta, err := c.buildMetaService.GetBuildMeta(event, filter)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, toBuildMetaResponse(meta))
+	}
+}
+
+type ArchetypeStats struct {
+	Name      string  `json:"name" binding:"required"`
+	Count     int     `json:"count" binding:"required"`
+	Share     float64 `json:"share" binding:"required"`
+	MedianDPS int64   `json:"median_dps" binding:"required"`
+	TopDPS    int64   `json:"top_dps" binding:"required"`
+	MedianEHP int32   `json:"median_ehp" binding:"required"`
+	TopEHP    int32   `json:"top_ehp" binding:"required"`
+}
+
+type BuildMetaSnapshot struct {
+	Timestamp    time.Time      `json:"timestamp" binding:"required" format:"date-time"`
+	Characters   int            `json:"characters" binding:"required"`
+	Classes      map[string]int `json:"classes" binding:"required"`
+	Ascendancies map[string]int `json:"ascendancies" binding:"required"`
+	MainSkills   map[string]int `json:"main_skills" binding:"required"`
+	MedianDPS    int64          `json:"median_dps" binding:"required"`
+	MedianEHP    int32          `json:"median_ehp" binding:"required"`
+}
+
+type BuildMeta struct {
+	Characters   int                  `json:"characters" binding:"required"`
+	Classes      []*ArchetypeStats    `json:"classes" binding:"required"`
+	Ascendancies []*ArchetypeStats    `json:"ascendancies" binding:"required"`
+	MainSkills   []*ArchetypeStats    `json:"main_skills" binding:"required"`
+	Evolution    []*BuildMetaSnapshot `json:"evolution" binding:"required"`
+}
+
+func toArchetypeStatsResponse(stats *service.ArchetypeStats) *ArchetypeStats {
+	return &ArchetypeStats{
+		Name:      stats.Name,
+		Count:     stats.Count,
+		Share:     stats.Share,
+		MedianDPS: stats.MedianDPS,
+		TopDPS:    stats.TopDPS,
+		MedianEHP: stats.MedianEHP,
+		TopEHP:    stats.TopEHP,
+	}
+}
+
+func toBuildMetaSnapshotResponse(snapshot *service.BuildMetaSnapshot) *BuildMetaSnapshot {
+	return &BuildMetaSnapshot{
+		Timestamp:    snapshot.Timestamp,
+		Characters:   snapshot.Characters,
+		Classes:      snapshot.Classes,
+		Ascendancies: snapshot.Ascendancies,
+		MainSkills:   snapshot.MainSkills,
+		MedianDPS:    snapshot.MedianDPS,
+		MedianEHP:    snapshot.MedianEHP,
+	}
+}
+
+func toBuildMetaResponse(meta *service.BuildMeta) *BuildMeta {
+	return &BuildMeta{
+		Characters:   meta.Characters,
+		Classes:      utils.Map(meta.Classes, toArchetypeStatsResponse),
+		Ascendancies: utils.Map(meta.Ascendancies, toArchetypeStatsResponse),
+		MainSkills:   utils.Map(meta.MainSkills, toArchetypeStatsResponse),
+		Evolution:    utils.Map(meta.Evolution, toBuildMetaSnapshotResponse),
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"bpl/repository"
 	"bpl/service"
 	"bpl/utils"
+	"errors"
 	"slices"
 	"strconv"
 	"time"
@@ -39,6 +40,7 @@ func setupCharacterController(poeClient *client.PoEClient) []RouteInfo {
 		{Method: "GET", Path: "/:character_id", HandlerFunc: e.getCharacterHistoryHandler()},
 		{Method: "PATCH", Path: "/:character_id", HandlerFunc: e.updateCharacterHandler(), Authenticated: true, RequiresUserSelf: true},
 		{Method: "GET", Path: "/:character_id/pobs", HandlerFunc: e.getPoBExportHandler()},
+		{Method: "GET", Path: "/:character_id/pobs/compare", HandlerFunc: e.comparePoBsHandler()},
 		{Method: "DELETE", Path: "/:character_id/pobs/:pob_id", HandlerFunc: e.deletePoBExportHandler(), Authenticated: true, RequiresUserSelf: true},
 		// {Method: "GET", Path: "/:user_id/:event_id/:character_name", HandlerFunc: e.getTimeSeries()},
 	}
@@ -112,6 +114,45 @@ func (e *CharacterController) getPoBExportHandler() gin.HandlerFunc {
 	}
 }
 
+// @id ComparePoBs
+// @Description Compare two PoB exports of a character: swapped items per slot, gem changes, passive changes and stat deltas
+// @Tags characters
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param character_id path string true "Character ID"
+// @Param from query int true "ID of the older PoB export"
+// @Param to query int true "ID of the newer PoB export"
+// @Success 200 {object} PoBDiff
+// @Router /users/{user_id}/characters/{character_id}/pobs/compare [get]
+func (e *CharacterController) comparePoBsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fromId, err := strconv.Atoi(c.Query("from"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid from PoB ID"})
+			return
+		}
+		toId, err := strconv.Atoi(c.Query("to"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid to PoB ID"})
+			return
+		}
+		diff, err := e.characterService.ComparePoBs(c.Param("character_id"), fromId, toId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(404, gin.H{"error": "PoB export not found"})
+				return
+			}
+			if errors.Is(err, service.ErrPoBOfOtherCharacter) {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, toPoBDiffResponse(diff))
+	}
+}
+
 // @id GetUserCharacters
 // @Description Fetches all event characters for a user
 // @Tags characters
@@ -262,6 +303,75 @@ func toPoBResponse(pob *repository.CharacterPob) *PoB {
 	}
 }
 
+type PoBDiffItem struct {
+	Rarity   string `json:"rarity" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	BaseType string `json:"base_type" binding:"required"`
+}
+
+type PoBItemChange struct {
+	Slot string       `json:"slot" binding:"required"`
+	From *PoBDiffItem `json:"from"`
+	To   *PoBDiffItem `json:"to"`
+}
+
+type PoBGemChange struct {
+	Name      string `json:"name" binding:"required"`
+	FromLevel *int   `json:"from_level"`
+	ToLevel   *int   `json:"to_level"`
+}
+
+type PoBStatDelta struct {
+	Stat  string  `json:"stat" binding:"required"`
+	From  float64 `json:"from" binding:"required"`
+	To    float64 `json:"to" binding:"required"`
+	Delta float64 `json:"delta" binding:"required"`
+}
+
+type PoBDiff struct {
+	From              *PoB             `json:"from" binding:"required"`
+	To                *PoB             `json:"to" binding:"required"`
+	Items             []*PoBItemChange `json:"items" binding:"required"`
+	GemsAdded         []*PoBGemChange  `json:"gems_added" binding:"required"`
+	GemsRemoved       []*PoBGemChange  `json:"gems_removed" binding:"required"`
+	GemsLevelled      []*PoBGemChange  `json:"gems_levelled" binding:"required"`
+	PassivesAllocated []int            `json:"passives_allocated" binding:"required"`
+	PassivesRemoved   []int            `json:"passives_removed" binding:"required"`
+	Stats             []*PoBStatDelta  `json:"stats" binding:"required"`
+}
+
+func toPoBDiffItemResponse(item *client.PoBItem) *PoBDiffItem {
+	if item == nil {
+		return nil
+	}
+	return &PoBDiffItem{
+		Rarity:   item.Rarity,
+		Name:     item.Name,
+		BaseType: item.BaseType,
+	}
+}
+
+func toPoBDiffResponse(diff *service.PoBDiff) *PoBDiff {
+	toGemChange := func(change *service.PoBGemChange) *PoBGemChange {
+		return &PoBGemChange{Name: change.Name, FromLevel: change.FromLevel, ToLevel: change.ToLevel}
+	}
+	return &PoBDiff{
+		From: toPoBResponse(diff.From),
+		To:   toPoBResponse(diff.To),
+		Items: utils.Map(diff.Items, func(change *service.PoBItemChange) *PoBItemChange {
+			return &PoBItemChange{Slot: change.Slot, From: toPoBDiffItemResponse(change.From), To: toPoBDiffItemResponse(change.To)}
+		}),
+		GemsAdded:         utils.Map(diff.GemsAdded, toGemChange),
+		GemsRemoved:       utils.Map(diff.GemsRemoved, toGemChange),
+		GemsLevelled:      utils.Map(diff.GemsLevelled, toGemChange),
+		PassivesAllocated: diff.PassivesAllocated,
+		PassivesRemoved:   diff.PassivesRemoved,
+		Stats: utils.Map(diff.Stats, func(delta *service.PoBStatDelta) *PoBStatDelta {
+			return &PoBStatDelta{Stat: delta.Stat, From: delta.From, To: delta.To, Delta: delta.Delta}
+		}),
+	}
+}
+
 type CharacterStat struct {
 	TimeStamp       int     `json:"timestamp" binding:"required"`
 	DPS             int64   `json:"dps" binding:"required"`
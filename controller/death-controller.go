@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"bpl/repository"
+	"bpl/service"
+	"bpl/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeathController struct {
+	deathService service.DeathService
+}
+
+func NewDeathController() *DeathController {
+	return &DeathController{
+		deathService: service.NewDeathService(),
+	}
+}
+
+func setupDeathController() []RouteInfo {
+	c := NewDeathController()
+	baseUrl := "events/:event_id/deaths"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "", HandlerFunc: c.getDeathsHandler()},
+		{Method: "GET", Path: "/teams", HandlerFunc: c.getTeamDeathCountsHandler()},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id GetDeaths
+// @Description Get the characters that died in a hardcore event, most recent first
+// @Tags characters
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Success 200 {array} CharacterDeath
+// @Router /events/{event_id}/deaths [get]
+func (c *DeathController) getDeathsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		deaths, err := c.deathService.GetDeathsForEvent(event.Id)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(deaths, toCharacterDeathResponse))
+	}
+}
+
+// @id GetTeamDeathCounts
+// @Description Get the number of characters that died per team in a hardcore event
+// @Tags team
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Success 200 {array} TeamDeathCount
+// @Router /events/{event_id}/deaths/teams [get]
+func (c *DeathController) getTeamDeathCountsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		counts, err := c.deathService.GetTeamDeathCounts(event)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(counts, func(count *service.TeamDeathCount) *TeamDeathCount {
+			return &TeamDeathCount{TeamId: count.TeamId, Deaths: count.Deaths}
+		}))
+	}
+}
+
+type CharacterDeath struct {
+	CharacterId string    `json:"character_id" binding:"required"`
+	UserId      int       `json:"user_id" binding:"required"`
+	TeamId      int       `json:"team_id" binding:"required"`
+	Name        string    `json:"name" binding:"required"`
+	Level       int       `json:"level" binding:"required"`
+	Ascendancy  string    `json:"ascendancy" binding:"required"`
+	PobId       *int      `json:"pob_id"`
+	Timestamp   time.Time `json:"timestamp" binding:"required" format:"date-time"`
+}
+
+type TeamDeathCount struct {
+	TeamId int `json:"team_id" binding:"required"`
+	Deaths int `json:"deaths" binding:"required"`
+}
+
+func toCharacterDeathResponse(death *repository.CharacterDeath) *CharacterDeath {
+	return &CharacterDeath{
+		CharacterId: death.CharacterId,
+		UserId:      death.UserId,
+		TeamId:      death.TeamId,
+		Name:        death.Name,
+		Level:       death.Level,
+		Ascendancy:  death.Ascendancy,
+		PobId:       death.PobId,
+		Timestamp:   death.Timestamp,
+	}
+}
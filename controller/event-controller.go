@@ -4,7 +4,6 @@ import (
 	"bpl/repository"
 	"bpl/service"
 	"bpl/utils"
-	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -64,11 +63,10 @@ func (e *EventController) getEventsHandler() gin.HandlerFunc {
 			return
 		}
 		roles := getUserRoles(c)
-		if !slices.Contains(roles, repository.PermissionAdmin) {
-			events = utils.Filter(events, func(event *repository.Event) bool {
-				return event.Public
-			})
-		}
+		roleEventIds := getRoleEventIds(c)
+		events = utils.Filter(events, func(event *repository.Event) bool {
+			return isEventVisible(event, roles, roleEventIds)
+		})
 		c.JSON(200, utils.Map(events, toEventResponse))
 	}
 }
@@ -96,8 +94,8 @@ func (e *EventController) getEvent() gin.HandlerFunc {
 			}
 			return
 		}
-		roles := getUserRoles(c)
-		if !slices.Contains(roles, repository.PermissionAdmin) && !event.Public {
+		// users with a role in the event can view it before it is public
+		if !isEventVisible(event, getUserRoles(c), getRoleEventIds(c)) {
 			c.JSON(403, gin.H{"error": "You are not allowed to view this event"})
 			return
 		}
@@ -228,40 +226,47 @@ func (e *EventController) duplicateEventHandler() gin.HandlerFunc {
 }
 
 type EventCreate struct {
-	Id                   *int                   `json:"id"`
-	Name                 string                 `json:"name" binding:"required"`
-	IsCurrent            bool                   `json:"is_current"`
-	GameVersion          repository.GameVersion `json:"game_version" binding:"required"`
-	Patch                *string                `json:"patch"`
-	MaxSize              int                    `json:"max_size" binding:"required"`
-	WaitlistSize         int                    `json:"waitlist_size" binding:"required"`
-	EventStartTime       time.Time              `json:"event_start_time" binding:"required" format:"date-time"`
-	EventEndTime         time.Time              `json:"event_end_time" binding:"required" format:"date-time"`
-	ApplicationStartTime time.Time              `json:"application_start_time" binding:"required" format:"date-time"`
-	ApplicationEndTime   time.Time              `json:"application_end_time" binding:"required" format:"date-time"`
-	Public               bool                   `json:"is_public"`
-	Locked               bool                   `json:"is_locked"`
-	IsMainEvent          bool                   `json:"is_main_event"`
-	UsesMedals           bool                   `json:"uses_medals"`
+	Id                   *int                    `json:"id"`
+	Name                 string                  `json:"name" binding:"required"`
+	IsCurrent            bool                    `json:"is_current"`
+	GameVersion          repository.GameVersion  `json:"game_version" binding:"required"`
+	Patch                *string                 `json:"patch"`
+	MaxSize              int                     `json:"max_size" binding:"required"`
+	WaitlistSize         int                     `json:"waitlist_size" binding:"required"`
+	EventStartTime       time.Time               `json:"event_start_time" binding:"required" format:"date-time"`
+	EventEndTime         time.Time               `json:"event_end_time" binding:"required" format:"date-time"`
+	ApplicationStartTime time.Time               `json:"application_start_time" binding:"required" format:"date-time"`
+	ApplicationEndTime   time.Time               `json:"application_end_time" binding:"required" format:"date-time"`
+	Public               bool                    `json:"is_public"`
+	Locked               bool                    `json:"is_locked"`
+	IsMainEvent          bool                    `json:"is_main_event"`
+	UsesMedals           bool                    `json:"uses_medals"`
+	Ruleset              repository.EventRuleset `json:"ruleset" binding:"omitempty,oneof=SOFTCORE HARDCORE RUTHLESS HARDCORE_RUTHLESS"`
+	DeathPolicy          repository.DeathPolicy  `json:"death_policy" binding:"omitempty,oneof=FREEZE RESET"`
+	GracePeriodMinutes   *int                    `json:"grace_period_minutes" binding:"omitempty,min=0"`
 }
 
 type Event struct {
-	Id                   int                    `json:"id" binding:"required"`
-	Name                 string                 `json:"name" binding:"required"`
-	IsCurrent            bool                   `json:"is_current" binding:"required"`
-	GameVersion          repository.GameVersion `json:"game_version" binding:"required"`
-	Patch                *string                `json:"patch"`
-	MaxSize              int                    `json:"max_size" binding:"required"`
-	WaitlistSize         int                    `json:"waitlist_size" binding:"required"`
-	Teams                []*Team                `json:"teams" binding:"required"`
-	ApplicationStartTime time.Time              `json:"application_start_time" binding:"required" format:"date-time"`
-	ApplicationEndTime   time.Time              `json:"application_end_time" binding:"required" format:"date-time"`
-	EventStartTime       time.Time              `json:"event_start_time" binding:"required" format:"date-time"`
-	EventEndTime         time.Time              `json:"event_end_time" binding:"required" format:"date-time"`
-	Public               bool                   `json:"is_public" binding:"required"`
-	Locked               bool                   `json:"is_locked" binding:"required"`
-	IsMainEvent          bool                   `json:"is_main_event" binding:"required"`
-	UsesMedals           bool                   `json:"uses_medals" binding:"required"`
+	Id                   int                     `json:"id" binding:"required"`
+	Name                 string                  `json:"name" binding:"required"`
+	IsCurrent            bool                    `json:"is_current" binding:"required"`
+	GameVersion          repository.GameVersion  `json:"game_version" binding:"required"`
+	Patch                *string                 `json:"patch"`
+	MaxSize              int                     `json:"max_size" binding:"required"`
+	WaitlistSize         int                     `json:"waitlist_size" binding:"required"`
+	Teams                []*Team                 `json:"teams" binding:"required"`
+	ApplicationStartTime time.Time               `json:"application_start_time" binding:"required" format:"date-time"`
+	ApplicationEndTime   time.Time               `json:"application_end_time" binding:"required" format:"date-time"`
+	EventStartTime       time.Time               `json:"event_start_time" binding:"required" format:"date-time"`
+	EventEndTime         time.Time               `json:"event_end_time" binding:"required" format:"date-time"`
+	Public               bool                    `json:"is_public" binding:"required"`
+	Locked               bool                    `json:"is_locked" binding:"required"`
+	IsMainEvent          bool                    `json:"is_main_event" binding:"required"`
+	UsesMedals           bool                    `json:"uses_medals" binding:"required"`
+	Ruleset              repository.EventRuleset `json:"ruleset" binding:"required"`
+	DeathPolicy          repository.DeathPolicy  `json:"death_policy" binding:"required"`
+	Phase                repository.EventPhase   `json:"phase" binding:"required"`
+	GracePeriodMinutes   int                     `json:"grace_period_minutes" binding:"required"`
 }
 
 func (e *EventCreate) toModel() *repository.Event {
@@ -279,6 +284,18 @@ func (e *EventCreate) toModel() *repository.Event {
 		Public:               e.Public,
 		Locked:               e.Locked,
 		IsMainEvent:          e.IsMainEvent,
+		Ruleset:              e.Ruleset,
+		DeathPolicy:          e.DeathPolicy,
+	}
+	if event.Ruleset == "" {
+		event.Ruleset = repository.RulesetSoftcore
+	}
+	if event.DeathPolicy == "" {
+		event.DeathPolicy = repository.DeathPolicyFreeze
+	}
+	event.GracePeriodMinutes = 60
+	if e.GracePeriodMinutes != nil {
+		event.GracePeriodMinutes = *e.GracePeriodMinutes
 	}
 	if e.Id != nil {
 		event.Id = *e.Id
@@ -307,5 +324,9 @@ func toEventResponse(event *repository.Event) *Event {
 		Locked:               event.Locked,
 		IsMainEvent:          event.IsMainEvent,
 		UsesMedals:           event.UsesMedals,
+		Ruleset:              event.Ruleset,
+		DeathPolicy:          event.DeathPolicy,
+		Phase:                event.Phase,
+		GracePeriodMinutes:   event.GracePeriodMinutes,
 	}
 }
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"bpl/repository"
+	"bpl/service"
+	"bpl/utils"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type EventRoleController struct {
+	eventRoleService service.EventRoleService
+}
+
+func NewEventRoleController() *EventRoleController {
+	return &EventRoleController{
+		eventRoleService: service.NewEventRoleService(),
+	}
+}
+
+func setupEventRoleController() []RouteInfo {
+	e := NewEventRoleController()
+	basePath := "/events/:event_id/roles"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "", HandlerFunc: e.getEventRolesHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "PUT", Path: "", HandlerFunc: e.grantEventRoleHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "DELETE", Path: "/:role_id", HandlerFunc: e.revokeEventRoleHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "GET", Path: "/self", HandlerFunc: e.getOwnEventRolesHandler(), Authenticated: true},
+	}
+	for i, route := range routes {
+		routes[i].Path = basePath + route.Path
+	}
+	return routes
+}
+
+// @id GetEventRoles
+// @Description Fetches the roles that were granted in an event
+// @Tags event
+// @Produce json
+// @Param event_id path int true "Event Id"
+// @Success 200 {array} EventRole
+// @Security BearerAuth
+// @Router /events/{event_id}/roles [get]
+func (e *EventRoleController) getEventRolesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		roles, err := e.eventRoleService.GetEventRoles(event.Id)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, utils.Map(roles, toEventRoleResponse))
+	}
+}
+
+// @id GrantEventRole
+// @Description Grants a role to a user within an event, optionally restricted to one of its teams
+// @Tags event
+// @Accept json
+// @Produce json
+// @Param event_id path int true "Event Id"
+// @Param role body EventRoleCreate true "Role"
+// @Success 201 {object} EventRole
+// @Security BearerAuth
+// @Router /events/{event_id}/roles [put]
+func (e *EventRoleController) grantEventRoleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		var body EventRoleCreate
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		role, err := e.eventRoleService.GrantEventRole(body.toModel(event.Id))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidEventRole) {
+				c.JSON(400, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(201, toEventRoleResponse(role))
+	}
+}
+
+// @id RevokeEventRole
+// @Description Revokes a role that was granted in an event
+// @Tags event
+// @Param event_id path int true "Event Id"
+// @Param role_id path int true "Role Id"
+// @Success 204
+// @Security BearerAuth
+// @Router /events/{event_id}/roles/{role_id} [delete]
+func (e *EventRoleController) revokeEventRoleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		roleId, err := strconv.Atoi(c.Param("role_id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		err = e.eventRoleService.RevokeEventRole(event.Id, roleId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(404, gin.H{"error": "Role not found"})
+			} else {
+				c.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.Status(204)
+	}
+}
+
+// @id GetOwnEventRoles
+// @Description Fetches the roles of the authenticated user in an event
+// @Tags event
+// @Produce json
+// @Param event_id path int true "Event Id"
+// @Success 200 {array} EventRole
+// @Security BearerAuth
+// @Router /events/{event_id}/roles/self [get]
+func (e *EventRoleController) getOwnEventRolesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, ok := getUserId(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Not authenticated"})
+			return
+		}
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		roles, err := e.eventRoleService.GetEventRolesForUser(userId, event.Id)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, utils.Map(roles, toEventRoleResponse))
+	}
+}
+
+type EventRoleCreate struct {
+	UserId int                   `json:"user_id" binding:"required"`
+	Role   repository.Permission `json:"role" binding:"required"`
+	TeamId *int                  `json:"team_id"`
+}
+
+func (e *EventRoleCreate) toModel(eventId int) *repository.EventRole {
+	return &repository.EventRole{
+		UserId:  e.UserId,
+		EventId: eventId,
+		TeamId:  e.TeamId,
+		Role:    e.Role,
+	}
+}
+
+type EventRole struct {
+	Id      int                   `json:"id" binding:"required"`
+	UserId  int                   `json:"user_id" binding:"required"`
+	EventId int                   `json:"event_id" binding:"required"`
+	TeamId  *int                  `json:"team_id"`
+	Role    repository.Permission `json:"role" binding:"required"`
+	User    *MinimalUser          `json:"user"`
+}
+
+func toEventRoleResponse(role *repository.EventRole) *EventRole {
+	response := &EventRole{
+		Id:      role.Id,
+		UserId:  role.UserId,
+		EventId: role.EventId,
+		TeamId:  role.TeamId,
+		Role:    role.Role,
+	}
+	if role.User != nil {
+		response.User = toMinimalUserResponse(role.User)
+	}
+	return response
+}
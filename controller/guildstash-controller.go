@@ -41,6 +41,7 @@ func setupGuildStashController(PoEClient *client.PoEClient) []RouteInfo {
 	routes := []RouteInfo{
 
 		{Method: "GET", Path: "/:event_id/teams/:team_id/guild-stash", HandlerFunc: e.getGuildStashForUser(), Authenticated: true, RequiresTeamSelf: true},
+		{Method: "POST", Path: "/:event_id/teams/:team_id/guild-stash/search", HandlerFunc: e.searchGuildStash(), Authenticated: true, RequiresTeamSelf: true},
 		{Method: "GET", Path: "/:event_id/teams/:team_id/guild-stash/:stash_id", HandlerFunc: e.getGuildStashTab(), Authenticated: true, RequiresTeamSelf: true},
 		{Method: "PATCH", Path: "/:event_id/teams/:team_id/guild-stash/:stash_id", HandlerFunc: e.switchStashFetch(), Authenticated: true, RequiresTeamLeader: true},
 		{Method: "POST", Path: "/:event_id/teams/:team_id/guild-stash/:stash_id/update", HandlerFunc: e.updateStashTab(), Authenticated: true, RequiresTeamLeader: true},
@@ -111,7 +112,7 @@ func (e *GuildStashController) saveGuild() gin.HandlerFunc {
 
 		var guild Guild
 		if err := c.ShouldBindJSON(&guild); err != nil {
-			fmt.Println("Error binding JSON:", err)
+			logger.WarnContext(c.Request.Context(), "Failed to bind guild", "error", err)
 			c.JSON(400, gin.H{"error": "invalid request"})
 			return
 		}
@@ -195,14 +196,14 @@ func (e *GuildStashController) addHistory() gin.HandlerFunc {
 		}
 		events, err := e.eventService.GetAllEvents()
 		if err != nil {
-			fmt.Println("Error fetching events:", err)
+			logger.ErrorContext(c.Request.Context(), "Failed to fetch events", "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 		logEntries := body.toLogEntries(events, guildId)
 		err = e.guildStashService.SaveGuildstashLogs(logEntries)
 		if err != nil {
-			fmt.Println("Error saving guild stash logs:", err)
+			logger.ErrorContext(c.Request.Context(), "Failed to save guild stash logs", "guild_id", guildId, "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
@@ -277,6 +278,20 @@ func getIntQueryParam(c *gin.Context, param string) (*int, error) {
 	}
 	return nil, nil
 }
+
+// getPaginationParams reads the optional limit and offset of a search, which must be positive and not negative respectively
+func getPaginationParams(c *gin.Context) (limit *int, offset *int, err error) {
+	limit, err = getIntQueryParam(c, "limit")
+	if err != nil || (limit != nil && *limit <= 0) {
+		return nil, nil, fmt.Errorf("invalid limit")
+	}
+	offset, err = getIntQueryParam(c, "offset")
+	if err != nil || (offset != nil && *offset < 0) {
+		return nil, nil, fmt.Errorf("invalid offset")
+	}
+	return limit, offset, nil
+}
+
 func getStringQueryParam(c *gin.Context, param string) *string {
 	if v := c.Query(param); v != "" {
 		return &v
@@ -342,6 +357,52 @@ func (e *GuildStashController) updateStashTab() gin.HandlerFunc {
 	}
 }
 
+// @id SearchGuildStash
+// @Description Searches the fetched contents of all guild stash tabs of a team for items matching the given conditions
+// @Tags guild-stash
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param eventId path int true "Event Id"
+// @Param teamId path int true "Team Id"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Param body body GuildStashSearchRequest true "Search conditions"
+// @Success 200 {object} GuildStashSearchResponse
+// @Router /{eventId}/teams/{teamId}/guild-stash/search [post]
+func (e *GuildStashController) searchGuildStash() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamId, err := strconv.Atoi(c.Param("team_id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid team id"})
+			return
+		}
+		var req GuildStashSearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request"})
+			return
+		}
+		limit, offset, err := getPaginationParams(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		conditions := utils.Map(req.Conditions, func(condition *Condition) *repository.Condition {
+			return condition.toModel()
+		})
+		if err := parser.ValidateConditions(conditions); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := e.guildStashService.SearchGuildStash(teamId, conditions, limit, offset)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, toGuildStashSearchResponse(result))
+	}
+}
+
 type TabSwitchRequest struct {
 	FetchEnabled  bool `json:"fetch_enabled"`
 	PriorityFetch bool `json:"priority_fetch"`
@@ -400,7 +461,7 @@ func (e *GuildStashController) getGuildStashTab() gin.HandlerFunc {
 		stashId := c.Param("stash_id")
 		tab, err := e.guildStashService.GetGuildStash(stashId, event.Id)
 		if err != nil || tab.Raw == "" || tab.Raw == "{}" {
-			fmt.Printf("Error fetching guild stash tab: %v\n", err)
+			logger.WarnContext(c.Request.Context(), "Failed to fetch guild stash tab", "stash_id", stashId, "event_id", event.Id, "error", err)
 			c.JSON(404, gin.H{"error": "stash tab not found"})
 			return
 		}
@@ -480,6 +541,59 @@ func toGGGModel(tab *repository.GuildStashTab, parser *parser.ItemChecker) *clie
 	return model
 }
 
+type GuildStashSearchRequest struct {
+	Conditions []*Condition `json:"conditions" binding:"required"`
+}
+
+type GuildStashSearchHit struct {
+	Item      client.Item `json:"item" binding:"required"`
+	TabId     string      `json:"tab_id" binding:"required"`
+	TabName   string      `json:"tab_name" binding:"required"`
+	ParentId  *string     `json:"parent_id"`
+	X         int         `json:"x" binding:"required"`
+	Y         int         `json:"y" binding:"required"`
+	LastFetch time.Time   `json:"last_fetch" binding:"required" format:"date-time"`
+}
+
+type BaseTypeCount struct {
+	BaseType  string `json:"base_type" binding:"required"`
+	ItemCount int    `json:"item_count" binding:"required"`
+	StackSize int    `json:"stack_size" binding:"required"`
+}
+
+type GuildStashSearchResponse struct {
+	Total          int                    `json:"total" binding:"required"`
+	Items          []*GuildStashSearchHit `json:"items" binding:"required"`
+	BaseTypeCounts []*BaseTypeCount       `json:"base_type_counts" binding:"required"`
+}
+
+func toGuildStashSearchResponse(result *service.GuildStashSearchResult) *GuildStashSearchResponse {
+	if result == nil {
+		return nil
+	}
+	return &GuildStashSearchResponse{
+		Total: result.Total,
+		Items: utils.Map(result.Hits, func(hit *service.GuildStashSearchHit) *GuildStashSearchHit {
+			return &GuildStashSearchHit{
+				Item:      hit.Item,
+				TabId:     hit.TabId,
+				TabName:   hit.TabName,
+				ParentId:  hit.ParentId,
+				X:         utils.Deref(hit.Item.X),
+				Y:         utils.Deref(hit.Item.Y),
+				LastFetch: hit.LastFetch,
+			}
+		}),
+		BaseTypeCounts: utils.Map(result.BaseTypeCounts, func(count *service.BaseTypeCount) *BaseTypeCount {
+			return &BaseTypeCount{
+				BaseType:  count.BaseType,
+				ItemCount: count.ItemCount,
+				StackSize: count.StackSize,
+			}
+		}),
+	}
+}
+
 type AddGuildStashHistoryResponse struct {
 	NumberOfAddedEntries int `json:"number_of_added_entries" binding:"required"`
 }
@@ -567,6 +681,7 @@ type GuildStashChangelog struct {
 	ItemName    string  `json:"item_name" binding:"required"`
 	Number      int     `json:"number" binding:"required"`
 	Action      Action  `json:"action" binding:"required"`
+	Derived     bool    `json:"derived" binding:"required"`
 }
 
 type Guild struct {
@@ -628,5 +743,6 @@ func toChangeLog(tab *repository.GuildStashChangelog) *GuildStashChangelog {
 		ItemName:    tab.ItemName,
 		Number:      tab.Number,
 		Action:      toActionModel(tab.Action),
+		Derived:     tab.Derived,
 	}
 }
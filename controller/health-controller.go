@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bpl/repository"
+	"bpl/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	pipelineHealthService service.PipelineHealthService
+}
+
+func NewHealthController() *HealthController {
+	return &HealthController{
+		pipelineHealthService: service.NewPipelineHealthService(),
+	}
+}
+
+func setupHealthController() []RouteInfo {
+	e := NewHealthController()
+	baseUrl := "/health"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "", HandlerFunc: e.getReadiness()},
+		{Method: "GET", Path: "/pipeline", HandlerFunc: e.getPipelineHealth(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id GetHealth
+// @Description Responds with 503 if this instance is not ready to serve requests, so it can be used as a load balancer health check. Only the database is checked.
+// @Tags health
+// @Produce json
+// @Success 200 {object} Readiness
+// @Failure 503 {object} Readiness
+// @Router /health [get]
+func (e *HealthController) getReadiness() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		err := e.pipelineHealthService.CheckReadiness(ctx.Request.Context())
+		if err != nil {
+			message := err.Error()
+			ctx.JSON(503, Readiness{Ready: false, Error: &message})
+			return
+		}
+		ctx.JSON(200, Readiness{Ready: true})
+	}
+}
+
+// @id GetPipelineHealth
+// @Description Reports the lag of every stage of the data pipeline for running events
+// @Security BearerAuth
+// @Tags health
+// @Produce json
+// @Success 200 {object} service.PipelineHealth
+// @Failure 503 {object} service.PipelineHealth
+// @Router /health/pipeline [get]
+func (e *HealthController) getPipelineHealth() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		health := e.pipelineHealthService.GetPipelineHealth(ctx.Request.Context())
+		if !health.Ready {
+			ctx.JSON(503, health)
+			return
+		}
+		ctx.JSON(200, health)
+	}
+}
+
+type Readiness struct {
+	Ready bool    `json:"ready" binding:"required"`
+	Error *string `json:"error"`
+}
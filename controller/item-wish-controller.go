@@ -1,11 +1,13 @@
 package controller
 
 import (
+	"bpl/parser"
 	"bpl/repository"
 	"bpl/service"
 	"bpl/utils"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,6 +30,7 @@ func setupItemWishController() []RouteInfo {
 	routes := []RouteInfo{
 		{Method: "GET", Path: "", HandlerFunc: e.getItemWishesForTeamHandler(), Authenticated: true, RequiresTeamSelf: true},
 		{Method: "POST", Path: "", HandlerFunc: e.creatItemWishHandler(), Authenticated: true, RequiresTeamSelf: true},
+		{Method: "GET", Path: "/candidates", HandlerFunc: e.getItemWishCandidatesHandler(), Authenticated: true, RequiresTeamSelf: true},
 		{Method: "PATCH", Path: "/:wish_id", HandlerFunc: e.changeItemWishHandler(), Authenticated: true},
 		{Method: "DELETE", Path: "/:wish_id", HandlerFunc: e.deleteItemWishHandler(), Authenticated: true},
 	}
@@ -91,12 +94,26 @@ func (e *ItemWishController) creatItemWishHandler() gin.HandlerFunc {
 			return
 		}
 
+		conditions := utils.Map(itemWishReq.Conditions, func(c *Condition) *repository.Condition { return c.toModel() })
+		if len(conditions) == 0 {
+			if itemWishReq.ItemField == "" || itemWishReq.Value == "" {
+				c.JSON(400, gin.H{"error": "Either conditions or item_field and value are required"})
+				return
+			}
+			conditions = repository.Conditions{{Field: itemWishReq.ItemField, Operator: repository.EQ, Value: itemWishReq.Value}}
+		}
+		if err := parser.ValidateConditions(conditions); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
 		itemWish := &repository.ItemWish{
-			UserID:    userId,
-			TeamID:    teamId,
-			ItemField: itemWishReq.ItemField,
-			Value:     itemWishReq.Value,
-			Fulfilled: false,
+			UserID:     userId,
+			TeamID:     teamId,
+			ItemField:  itemWishReq.ItemField,
+			Value:      itemWishReq.Value,
+			Conditions: conditions,
+			Fulfilled:  false,
 		}
 
 		savedItemWish, err := e.itemWishService.CreateItemWish(itemWish, teamId)
@@ -108,6 +125,30 @@ func (e *ItemWishController) creatItemWishHandler() gin.HandlerFunc {
 	}
 }
 
+// @id GetItemWishCandidates
+// @Description Get items found in the team's stashes that match open item wishes of the team
+// @Tags item_wishes
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param team_id path int true "Team ID"
+// @Success 200 {array} ItemWishCandidate
+// @Router /events/{event_id}/teams/{team_id}/item_wishes/candidates [get]
+func (e *ItemWishController) getItemWishCandidatesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamId, err := strconv.Atoi(c.Param("team_id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid team ID"})
+			return
+		}
+		candidates, err := e.itemWishService.GetItemWishCandidatesForTeam(teamId)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to get item wish candidates"})
+			return
+		}
+		c.JSON(200, utils.Map(candidates, toItemWishCandidateModel))
+	}
+}
+
 // @id ChangeItemWish
 // @Description Change an item wish for a user in a team
 // @Tags item_wishes
@@ -141,8 +182,8 @@ func (e *ItemWishController) changeItemWishHandler() gin.HandlerFunc {
 			c.JSON(403, gin.H{"error": "You are not part of a team"})
 			return
 		}
-		if (itemWishReq.BuildEnabling != nil || itemWishReq.Fulfilled != nil) && itemWish.UserID != teamUser.UserId {
-			c.JSON(403, gin.H{"error": "Only the user who created the wish can change its fulfilled or build enabling status"})
+		if (itemWishReq.BuildEnabling != nil || itemWishReq.Fulfilled != nil || itemWishReq.Conditions != nil) && itemWish.UserID != teamUser.UserId {
+			c.JSON(403, gin.H{"error": "Only the user who created the wish can change its fulfilled or build enabling status or its conditions"})
 			return
 		}
 		if (itemWishReq.Priority != nil) && !teamUser.IsTeamLead {
@@ -150,7 +191,17 @@ func (e *ItemWishController) changeItemWishHandler() gin.HandlerFunc {
 			return
 		}
 
-		updatedItemWish, err := e.itemWishService.UpdateItemWish(itemWish, teamUser.TeamId, itemWishReq.Fulfilled, itemWishReq.BuildEnabling, itemWishReq.Priority)
+		conditions := utils.Map(itemWishReq.Conditions, func(c *Condition) *repository.Condition { return c.toModel() })
+		if itemWishReq.Conditions != nil && len(conditions) == 0 {
+			c.JSON(400, gin.H{"error": "A wish needs at least one condition"})
+			return
+		}
+		if err := parser.ValidateConditions(conditions); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedItemWish, err := e.itemWishService.UpdateItemWish(itemWish, teamUser.TeamId, itemWishReq.Fulfilled, itemWishReq.BuildEnabling, itemWishReq.Priority, conditions)
 		if err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to update item wish %v", err)})
 			return
@@ -200,23 +251,40 @@ func (e *ItemWishController) deleteItemWishHandler() gin.HandlerFunc {
 type ItemWish struct {
 	Id            int                  `json:"id" binding:"required"`
 	UserId        int                  `json:"user_id" binding:"required"`
-	ItemField     repository.ItemField `json:"item_field" binding:"required"`
-	Value         string               `json:"value" binding:"required"`
+	ItemField     repository.ItemField `json:"item_field"`
+	Value         string               `json:"value"`
 	Fulfilled     bool                 `json:"fulfilled" binding:"required"`
 	BuildEnabling bool                 `json:"build_enabling" binding:"required"`
 	Priority      int                  `json:"priority" binding:"required"`
+	Conditions    []*Condition         `json:"conditions" binding:"required"`
 }
 
 type CreateItemWish struct {
-	ItemField     repository.ItemField `json:"item_field" binding:"required"`
-	Value         string               `json:"value" binding:"required"`
+	// item_field and value are only required if no conditions are given, the wish then matches items whose item_field equals the value
+	ItemField     repository.ItemField `json:"item_field"`
+	Value         string               `json:"value"`
 	BuildEnabling bool                 `json:"build_enabling"`
+	Conditions    []*Condition         `json:"conditions"`
+}
+
+type ItemWishCandidate struct {
+	Id          int                         `json:"id" binding:"required"`
+	ItemWishId  int                         `json:"item_wish_id" binding:"required"`
+	ItemId      string                      `json:"item_id" binding:"required"`
+	StashId     string                      `json:"stash_id" binding:"required"`
+	StashName   *string                     `json:"stash_name"`
+	AccountName string                      `json:"account_name" binding:"required"`
+	Source      repository.UniqueItemSource `json:"source" binding:"required"`
+	X           *int                        `json:"x"`
+	Y           *int                        `json:"y"`
+	Timestamp   time.Time                   `json:"timestamp" binding:"required"`
 }
 
 type UpdateItemWish struct {
-	Fulfilled     *bool `json:"fulfilled"`
-	BuildEnabling *bool `json:"build_enabling"`
-	Priority      *int  `json:"priority"`
+	Fulfilled     *bool        `json:"fulfilled"`
+	BuildEnabling *bool        `json:"build_enabling"`
+	Priority      *int         `json:"priority"`
+	Conditions    []*Condition `json:"conditions"`
 }
 
 func toItemWishModel(iw *repository.ItemWish) *ItemWish {
@@ -228,5 +296,21 @@ func toItemWishModel(iw *repository.ItemWish) *ItemWish {
 		Fulfilled:     iw.Fulfilled,
 		Priority:      iw.Priority,
 		BuildEnabling: iw.BuildEnabling,
+		Conditions:    utils.Map(iw.Conditions, toConditionResponse),
+	}
+}
+
+func toItemWishCandidateModel(c *repository.ItemWishCandidate) *ItemWishCandidate {
+	return &ItemWishCandidate{
+		Id:          c.Id,
+		ItemWishId:  c.ItemWishId,
+		ItemId:      c.ItemId,
+		StashId:     c.StashId,
+		StashName:   c.StashName,
+		AccountName: c.AccountName,
+		Source:      c.Source,
+		X:           c.X,
+		Y:           c.Y,
+		Timestamp:   c.Timestamp,
 	}
 }
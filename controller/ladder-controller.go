@@ -36,6 +36,8 @@ func setupLadderController(poeClient *client.PoEClient) []RouteInfo {
 	baseUrl := "events/:event_id"
 	routes := []RouteInfo{
 		{Method: "GET", Path: "/ladder", HandlerFunc: c.getLadderHandler()},
+		{Method: "GET", Path: "/ladder/characters/:character_name/timeline", HandlerFunc: c.getCharacterTimelineHandler()},
+		{Method: "GET", Path: "/ladder/races/level/:level", HandlerFunc: c.getLevelRaceHandler()},
 		{Method: "GET", Path: "/characters", HandlerFunc: c.GetCharactersForEvent()},
 		{Method: "GET", Path: "/team/:team_id/atlas", HandlerFunc: c.getAtlasesForEvent(), Authenticated: true, RequiresTeamSelf: true},
 	}
@@ -98,6 +100,59 @@ func (c *LadderController) getLadderHandler() gin.HandlerFunc {
 	}
 }
 
+// @id GetLadderTimelineForCharacter
+// @Description Get the history of level, experience, delve depth and rank of a character on the ladder
+// @Tags ladder
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param character_name path string true "Character name"
+// @Success 200 {array} LadderSnapshot
+// @Router /events/{event_id}/ladder/characters/{character_name}/timeline [get]
+func (c *LadderController) getCharacterTimelineHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		snapshots, err := c.ladderService.GetCharacterTimeline(event.Id, ctx.Param("character_name"))
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(snapshots, toLadderSnapshotResponse))
+	}
+}
+
+// @id GetLevelRace
+// @Description Get the first character of each team to reach a level, fastest team first
+// @Tags ladder
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param level path int true "Level"
+// @Success 200 {array} LevelRaceEntry
+// @Router /events/{event_id}/ladder/races/level/{level} [get]
+func (c *LadderController) getLevelRaceHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		level, err := strconv.Atoi(ctx.Param("level"))
+		if err != nil || level < 1 || level > 100 {
+			ctx.JSON(400, gin.H{"error": "Invalid level"})
+			return
+		}
+		entries, err := c.ladderService.GetLevelRace(event.Id, level)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(entries, func(entry *service.LevelRaceEntry) *LevelRaceEntry {
+			return toLevelRaceEntryResponse(entry, event.EventStartTime)
+		}))
+	}
+}
+
 // @id GetCharactersForEvent
 // @Description Get all characters for an event
 // @Tags characters
@@ -192,6 +247,45 @@ type LadderEntry struct {
 	Rank       int `json:"rank" binding:"required"`
 }
 
+type LadderSnapshot struct {
+	Level      int       `json:"level" binding:"required"`
+	Experience int       `json:"experience" binding:"required"`
+	Delve      int       `json:"delve" binding:"required"`
+	Rank       int       `json:"rank" binding:"required"`
+	Class      string    `json:"class" binding:"required"`
+	Timestamp  time.Time `json:"timestamp" binding:"required"`
+}
+
+type LevelRaceEntry struct {
+	TeamId        int       `json:"team_id" binding:"required"`
+	UserId        int       `json:"user_id" binding:"required"`
+	CharacterName string    `json:"character_name" binding:"required"`
+	Timestamp     time.Time `json:"timestamp" binding:"required"`
+	// seconds between the event start and the character reaching the level
+	SecondsAfterStart int64 `json:"seconds_after_start" binding:"required"`
+}
+
+func toLadderSnapshotResponse(snapshot *repository.LadderSnapshot) *LadderSnapshot {
+	return &LadderSnapshot{
+		Level:      snapshot.Level,
+		Experience: snapshot.Experience,
+		Delve:      snapshot.Delve,
+		Rank:       snapshot.Rank,
+		Class:      snapshot.Class,
+		Timestamp:  snapshot.Timestamp,
+	}
+}
+
+func toLevelRaceEntryResponse(entry *service.LevelRaceEntry, eventStart time.Time) *LevelRaceEntry {
+	return &LevelRaceEntry{
+		TeamId:            entry.TeamId,
+		UserId:            entry.UserId,
+		CharacterName:     entry.Character,
+		Timestamp:         entry.Timestamp,
+		SecondsAfterStart: int64(entry.Timestamp.Sub(eventStart).Seconds()),
+	}
+}
+
 type Atlas struct {
 	UserId       int           `json:"user_id" binding:"required"`
 	PrimaryIndex int           `json:"primary_index" binding:"required"`
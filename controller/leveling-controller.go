@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"bpl/service"
+	"bpl/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LevelingController struct {
+	levelingService service.LevelingService
+}
+
+func NewLevelingController() *LevelingController {
+	return &LevelingController{
+		levelingService: service.NewLevelingService(),
+	}
+}
+
+func setupLevelingController() []RouteInfo {
+	c := NewLevelingController()
+	baseUrl := "events/:event_id/leveling"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "", HandlerFunc: c.getLevelingReportHandler()},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id GetLevelingReport
+// @Description Get the XP per active hour and the wall clock and active play time to reach each level milestone per character, compared per team
+// @Tags ladder
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Success 200 {object} LevelingReport
+// @Router /events/{event_id}/leveling [get]
+func (c *LevelingController) getLevelingReportHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		report, err := c.levelingService.GetLevelingReport(event)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, toLevelingReportResponse(report))
+	}
+}
+
+type LevelMilestone struct {
+	Level             int       `json:"level" binding:"required"`
+	ReachedAt         time.Time `json:"reached_at" binding:"required" format:"date-time"`
+	WallClockSeconds  int64     `json:"wall_clock_seconds" binding:"required"`
+	ActiveTimeSeconds int64     `json:"active_time_seconds" binding:"required"`
+}
+
+type CharacterLeveling struct {
+	CharacterId       string            `json:"character_id" binding:"required"`
+	Name              string            `json:"name" binding:"required"`
+	UserId            int               `json:"user_id" binding:"required"`
+	TeamId            *int              `json:"team_id"`
+	Level             int               `json:"level" binding:"required"`
+	XP                int64             `json:"xp" binding:"required"`
+	ActiveTimeSeconds int64             `json:"active_time_seconds" binding:"required"`
+	XPPerActiveHour   float64           `json:"xp_per_active_hour" binding:"required"`
+	Milestones        []*LevelMilestone `json:"milestones" binding:"required"`
+}
+
+type TeamMilestone struct {
+	Level                   int   `json:"level" binding:"required"`
+	Reached                 int   `json:"reached" binding:"required"`
+	FastestActiveSeconds    int64 `json:"fastest_active_seconds" binding:"required"`
+	MedianActiveSeconds     int64 `json:"median_active_seconds" binding:"required"`
+	FastestWallClockSeconds int64 `json:"fastest_wall_clock_seconds" binding:"required"`
+}
+
+type TeamLeveling struct {
+	TeamId                int              `json:"team_id" binding:"required"`
+	Characters            int              `json:"characters" binding:"required"`
+	MedianXPPerActiveHour float64          `json:"median_xp_per_active_hour" binding:"required"`
+	Milestones            []*TeamMilestone `json:"milestones" binding:"required"`
+}
+
+type LevelingReport struct {
+	Characters []*CharacterLeveling `json:"characters" binding:"required"`
+	Teams      []*TeamLeveling      `json:"teams" binding:"required"`
+}
+
+func toCharacterLevelingResponse(leveling *service.CharacterLeveling) *CharacterLeveling {
+	return &CharacterLeveling{
+		CharacterId:       leveling.CharacterId,
+		Name:              leveling.Name,
+		UserId:            leveling.UserId,
+		TeamId:            leveling.TeamId,
+		Level:             leveling.Level,
+		XP:                leveling.XP,
+		ActiveTimeSeconds: int64(leveling.ActiveTime.Seconds()),
+		XPPerActiveHour:   leveling.XPPerActiveHour,
+		Milestones: utils.Map(leveling.Milestones, func(milestone *service.LevelMilestone) *LevelMilestone {
+			return &LevelMilestone{
+				Level:             milestone.Level,
+				ReachedAt:         milestone.ReachedAt,
+				WallClockSeconds:  int64(milestone.WallClock.Seconds()),
+				ActiveTimeSeconds: int64(milestone.ActiveTime.Seconds()),
+			}
+		}),
+	}
+}
+
+func toTeamLevelingResponse(leveling *service.TeamLeveling) *TeamLeveling {
+	return &TeamLeveling{
+		TeamId:                leveling.TeamId,
+		Characters:            leveling.Characters,
+		MedianXPPerActiveHour: leveling.MedianXPPerActiveHour,
+		Milestones: utils.Map(leveling.Milestones, func(milestone *service.TeamMilestone) *TeamMilestone {
+			return &TeamMilestone{
+				Level:                   milestone.Level,
+				Reached:                 milestone.Reached,
+				FastestActiveSeconds:    int64(milestone.FastestActive.Seconds()),
+				MedianActiveSeconds:     int64(milestone.MedianActive.Seconds()),
+				FastestWallClockSeconds: int64(milestone.FastestWallClock.Seconds()),
+			}
+		}),
+	}
+}
+
+func toLevelingReportResponse(report *service.LevelingReport) *LevelingReport {
+	return &LevelingReport{
+		Characters: utils.Map(report.Characters, toCharacterLevelingResponse),
+		Teams:      utils.Map(report.Teams, toTeamLevelingResponse),
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"bpl/config"
 	"bpl/repository"
 	"bpl/service"
-	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,12 +19,14 @@ type Verifier struct {
 type OauthController struct {
 	oauthService service.OauthService
 	userService  service.UserService
+	tokenService service.TokenService
 }
 
 func NewOauthController() *OauthController {
 	return &OauthController{
 		oauthService: service.NewOauthService(),
 		userService:  service.NewUserService(),
+		tokenService: service.NewTokenService(),
 	}
 }
 
@@ -50,7 +52,7 @@ type DiscordBotLoginBody struct {
 // @Description Logs in the discord bot (only for internal use)
 // @Tags oauth
 // @Produce json
-// @Success 200 {string} authToken
+// @Success 200 {object} BotTokenResponse
 // @Router /oauth2/discord/bot-login [post]
 func (e *OauthController) loginDiscordBotHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -65,17 +67,28 @@ func (e *OauthController) loginDiscordBotHandler() gin.HandlerFunc {
 			return
 		}
 
-		authToken, _ := auth.CreateToken(
+		// the bot has no session, it logs in again with its token once the access token has expired
+		authToken, claims, err := auth.CreateAccessToken(
 			&repository.User{
 				Id:          0,
 				DisplayName: "bot",
 				Permissions: []repository.Permission{repository.PermissionAdmin},
 			},
 		)
-		c.JSON(200, authToken)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, &BotTokenResponse{AuthToken: authToken, AuthTokenExpiry: claims.ExpiresAt()})
 	}
 }
 
+// BotTokenResponse carries the expiry of the bot's access token, so that the bot knows when to log in again
+type BotTokenResponse struct {
+	AuthToken       string    `json:"auth_token" binding:"required"`
+	AuthTokenExpiry time.Time `json:"auth_token_expiry" binding:"required"`
+}
+
 // @Id OauthRedirect
 // @Description Redirects to an oauth provider
 // @Tags oauth
@@ -121,16 +134,23 @@ func (e *OauthController) callbackHandler() gin.HandlerFunc {
 		config := *e.oauthService.GetOauthConfig(provider)
 		verifier, err := e.oauthService.Verify(body.State, body.Code, body.Referrer, provider, config)
 		if err != nil {
-			fmt.Printf("Failed to verify oauth: %v\n", err)
+			logger.ErrorContext(c.Request.Context(), "Failed to verify oauth", "provider", provider, "error", err)
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		tokens, err := e.tokenService.IssueTokens(verifier.User)
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to issue tokens", "user_id", verifier.User.Id, "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		authToken, _ := auth.CreateToken(verifier.User)
 		c.JSON(200,
 			CallbackResponse{
-				LastPath:  verifier.LastUrl,
-				AuthToken: authToken,
-				User:      *toUserResponse(verifier.User),
+				LastPath:        verifier.LastUrl,
+				AuthToken:       tokens.AccessToken,
+				AuthTokenExpiry: tokens.AccessTokenExpiry,
+				RefreshToken:    tokens.RefreshToken,
+				User:            *toUserResponse(verifier.User),
 			},
 		)
 	}
@@ -143,7 +163,9 @@ type CallbackBody struct {
 }
 
 type CallbackResponse struct {
-	LastPath  string `json:"last_path" binding:"required"`
-	AuthToken string `json:"auth_token" binding:"required"`
-	User      User   `json:"user" binding:"required"`
+	LastPath        string    `json:"last_path" binding:"required"`
+	AuthToken       string    `json:"auth_token" binding:"required"`
+	AuthTokenExpiry time.Time `json:"auth_token_expiry" binding:"required"`
+	RefreshToken    string    `json:"refresh_token" binding:"required"`
+	User            User      `json:"user" binding:"required"`
 }
@@ -19,6 +19,7 @@ type ObjectiveController struct {
 	objectiveService        service.ObjectiveService
 	objectiveMatchService   service.ObjectiveMatchService
 	eventService            service.EventService
+	pobStatService          service.PoBStatService
 	poeClient               *client.PoEClient
 	validationContextCancel *context.CancelFunc
 }
@@ -28,6 +29,7 @@ func NewObjectiveController() *ObjectiveController {
 		objectiveService:      service.NewObjectiveService(),
 		eventService:          service.NewEventService(),
 		objectiveMatchService: service.NewObjectiveMatchService(),
+		pobStatService:        service.NewPoBStatService(),
 	}
 }
 
@@ -38,14 +40,14 @@ func setupObjectiveController(poeClient *client.PoEClient) []RouteInfo {
 	editorRoles := []repository.Permission{repository.PermissionAdmin, repository.PermissionManager, repository.PermissionObjectiveDesigner}
 	routes := []RouteInfo{
 		{Method: "GET", Path: "", HandlerFunc: e.GetObjectiveTreeForEventHandler()},
-		{Method: "PUT", Path: "", HandlerFunc: e.createObjectiveHandler(), Authenticated: true, RequiredRoles: editorRoles},
-		{Method: "GET", Path: "/:id", HandlerFunc: e.getObjectiveByIdHandler(), Authenticated: true, RequiredRoles: editorRoles},
-		{Method: "DELETE", Path: "/:id", HandlerFunc: e.deleteObjectiveHandler(), Authenticated: true, RequiredRoles: editorRoles},
+		{Method: "PUT", Path: "", HandlerFunc: e.createObjectiveHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "GET", Path: "/:id", HandlerFunc: e.getObjectiveByIdHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "DELETE", Path: "/:id", HandlerFunc: e.deleteObjectiveHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
 		// todo: move this somewhere else
-		{Method: "POST", Path: "/parser", HandlerFunc: e.getObjectiveParserHandler(), Authenticated: true, RequiredRoles: editorRoles},
-		{Method: "POST", Path: "/validations", HandlerFunc: e.validateObjectivesHandler(), Authenticated: true, RequiredRoles: editorRoles},
-		{Method: "GET", Path: "/validations", HandlerFunc: e.getObjectiveValidationsHandler(), Authenticated: true, RequiredRoles: editorRoles},
-		{Method: "GET", Path: "/valid-mappings", HandlerFunc: e.getValidMappingsHandler(), Authenticated: true, RequiredRoles: editorRoles},
+		{Method: "POST", Path: "/parser", HandlerFunc: e.getObjectiveParserHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "POST", Path: "/validations", HandlerFunc: e.validateObjectivesHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "GET", Path: "/validations", HandlerFunc: e.getObjectiveValidationsHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "GET", Path: "/valid-mappings", HandlerFunc: e.getValidMappingsHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
 	}
 	for i, route := range routes {
 		routes[i].Path = baseUrl + route.Path
@@ -63,10 +65,19 @@ func setupObjectiveController(poeClient *client.PoEClient) []RouteInfo {
 // @Router /events/{event_id}/objectives/valid-mappings [get]
 func (e *ObjectiveController) getValidMappingsHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		pobStatMappings, err := e.pobStatService.GetMappingsForEvent(event.Id)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(200, ConditionMappings{
 			FieldToType:                  repository.FieldToType,
 			ValidOperators:               repository.OperatorsForTypes,
-			ObjectiveTypeToTrackedValues: repository.ObjectiveTypeToTrackedValues,
+			ObjectiveTypeToTrackedValues: repository.TrackedValuesForEvent(pobStatMappings),
 		})
 	}
 }
@@ -151,7 +162,7 @@ func (e *ObjectiveController) GetObjectiveTreeForEventHandler() gin.HandlerFunc
 			c.JSON(404, gin.H{"error": "Objectives not found"})
 			return
 		}
-		roles := getUserRoles(c)
+		roles := getEventRoles(c)
 		public := !(slices.Contains(roles, repository.PermissionAdmin) ||
 			slices.Contains(roles, repository.PermissionManager) ||
 			slices.Contains(roles, repository.PermissionObjectiveDesigner))
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"bpl/repository"
+	"bpl/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ObjectiveMatchController struct {
+	objectiveMatchService service.ObjectiveMatchService
+}
+
+func NewObjectiveMatchController() *ObjectiveMatchController {
+	return &ObjectiveMatchController{
+		objectiveMatchService: service.NewObjectiveMatchService(),
+	}
+}
+
+func setupObjectiveMatchController() []RouteInfo {
+	c := NewObjectiveMatchController()
+	baseUrl := "events/:event_id/objective-matches"
+	routes := []RouteInfo{
+		{Method: "POST", Path: "/compact", HandlerFunc: c.compactMatchesHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id CompactObjectiveMatches
+// @Description Delete player and team objective matches that repeat the previous value of the same player or team without changing any score
+// @Security BearerAuth
+// @Tags objective
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Success 200 {object} CompactObjectiveMatchesResponse
+// @Router /events/{event_id}/objective-matches/compact [post]
+func (c *ObjectiveMatchController) compactMatchesHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		deleted, err := c.objectiveMatchService.CompactMatches(event.Id)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, CompactObjectiveMatchesResponse{DeletedMatches: deleted})
+	}
+}
+
+type CompactObjectiveMatchesResponse struct {
+	DeletedMatches int64 `json:"deleted_matches" binding:"required"`
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"bpl/service"
+	"bpl/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PassiveTreeController struct {
+	passiveTreeService service.PassiveTreeService
+}
+
+func NewPassiveTreeController() *PassiveTreeController {
+	return &PassiveTreeController{
+		passiveTreeService: service.NewPassiveTreeService(),
+	}
+}
+
+func setupPassiveTreeController() []RouteInfo {
+	c := NewPassiveTreeController()
+	routes := []RouteInfo{
+		{Method: "GET", Path: "users/:user_id/characters/:character_id/passives", HandlerFunc: c.getPassiveTreeTimelineHandler()},
+		{Method: "GET", Path: "events/:event_id/passives/common", HandlerFunc: c.getCommonNodesHandler()},
+	}
+	return routes
+}
+
+// @id GetPassiveTreeTimeline
+// @Description Get the passive nodes a character allocated and removed over time
+// @Tags characters
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param character_id path string true "Character ID"
+// @Success 200 {array} PassiveTreeChange
+// @Router /users/{user_id}/characters/{character_id}/passives [get]
+func (c *PassiveTreeController) getPassiveTreeTimelineHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		timeline, err := c.passiveTreeService.GetTimeline(ctx.Param("character_id"))
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(timeline, toPassiveTreeChangeResponse))
+	}
+}
+
+// @id GetCommonPassiveNodes
+// @Description Get the most commonly allocated passive nodes per ascendancy across the event
+// @Tags characters
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param limit query int false "Maximum number of nodes per ascendancy (default 50)"
+// @Success 200 {array} AscendancyNodes
+// @Router /events/{event_id}/passives/common [get]
+func (c *PassiveTreeController) getCommonNodesHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		limit := 50
+		if l := ctx.Query("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed < 1 {
+				ctx.JSON(400, gin.H{"error": "Invalid limit"})
+				return
+			}
+			limit = parsed
+		}
+		nodes, err := c.passiveTreeService.GetCommonNodes(event.Id, limit)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(nodes, toAscendancyNodesResponse))
+	}
+}
+
+type PassiveTreeChange struct {
+	Timestamp  time.Time `json:"timestamp" binding:"required" format:"date-time"`
+	Level      int       `json:"level" binding:"required"`
+	Ascendancy string    `json:"ascendancy" binding:"required"`
+	NodeCount  int       `json:"node_count" binding:"required"`
+	Allocated  []int     `json:"allocated" binding:"required"`
+	Removed    []int     `json:"removed" binding:"required"`
+}
+
+type NodePopularity struct {
+	Node  int     `json:"node" binding:"required"`
+	Count int     `json:"count" binding:"required"`
+	Share float64 `json:"share" binding:"required"`
+}
+
+type AscendancyNodes struct {
+	Ascendancy string            `json:"ascendancy" binding:"required"`
+	Characters int               `json:"characters" binding:"required"`
+	Nodes      []*NodePopularity `json:"nodes" binding:"required"`
+}
+
+func toPassiveTreeChangeResponse(change *service.PassiveTreeChange) *PassiveTreeChange {
+	return &PassiveTreeChange{
+		Timestamp:  change.Timestamp,
+		Level:      change.Level,
+		Ascendancy: change.Ascendancy,
+		NodeCount:  change.NodeCount,
+		Allocated:  change.Allocated,
+		Removed:    change.Removed,
+	}
+}
+
+func toAscendancyNodesResponse(nodes *service.AscendancyNodes) *AscendancyNodes {
+	return &AscendancyNodes{
+		Ascendancy: nodes.Ascendancy,
+		Characters: nodes.Characters,
+		Nodes: utils.Map(nodes.Nodes, func(node *service.NodePopularity) *NodePopularity {
+			return &NodePopularity{Node: node.Node, Count: node.Count, Share: node.Share}
+		}),
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"bpl/repository"
+	"bpl/service"
+	"bpl/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PoBQueueController struct {
+	pobQueueService service.PoBQueueService
+}
+
+func NewPoBQueueController() *PoBQueueController {
+	return &PoBQueueController{
+		pobQueueService: service.NewPoBQueueService(),
+	}
+}
+
+func setupPoBQueueController() []RouteInfo {
+	c := NewPoBQueueController()
+	baseUrl := "/pob-jobs"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "", HandlerFunc: c.getPoBJobsHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "POST", Path: "/requeue", HandlerFunc: c.requeuePoBJobsHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id GetPoBJobs
+// @Description Get the queued PoB calculations, optionally filtered by status
+// @Security BearerAuth
+// @Tags jobs
+// @Produce json
+// @Param status query string false "Job status" Enums(pending, running, dead)
+// @Success 200 {object} PoBJobOverview
+// @Router /pob-jobs [get]
+func (c *PoBQueueController) getPoBJobsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var status *repository.PoBJobStatus
+		if s := ctx.Query("status"); s != "" {
+			jobStatus := repository.PoBJobStatus(s)
+			if jobStatus != repository.PoBJobStatusPending && jobStatus != repository.PoBJobStatusRunning && jobStatus != repository.PoBJobStatusDead {
+				ctx.JSON(400, gin.H{"error": "Invalid status"})
+				return
+			}
+			status = &jobStatus
+		}
+		jobs, err := c.pobQueueService.GetJobs(status)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		counts, err := c.pobQueueService.CountJobsByStatus()
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, PoBJobOverview{
+			Counts: counts,
+			Jobs:   utils.Map(jobs, toPoBJobResponse),
+		})
+	}
+}
+
+// @id RequeuePoBJobs
+// @Description Requeue PoB calculations so they are retried immediately. Without character ids all dead jobs are requeued.
+// @Security BearerAuth
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param body body RequeuePoBJobs true "Characters to requeue"
+// @Success 200 {object} RequeuePoBJobsResponse
+// @Router /pob-jobs/requeue [post]
+func (c *PoBQueueController) requeuePoBJobsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var body RequeuePoBJobs
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		requeued, err := c.pobQueueService.RequeueJobs(body.CharacterIds)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, RequeuePoBJobsResponse{Requeued: requeued})
+	}
+}
+
+type PoBJob struct {
+	CharacterId   string                  `json:"character_id" binding:"required"`
+	EventId       int                     `json:"event_id" binding:"required"`
+	UserId        *int                    `json:"user_id"`
+	Status        repository.PoBJobStatus `json:"status" binding:"required"`
+	Attempts      int                     `json:"attempts" binding:"required"`
+	NextAttemptAt time.Time               `json:"next_attempt_at" binding:"required"`
+	LastError     string                  `json:"last_error" binding:"required"`
+	CreatedAt     time.Time               `json:"created_at" binding:"required"`
+	UpdatedAt     time.Time               `json:"updated_at" binding:"required"`
+}
+
+type PoBJobOverview struct {
+	Counts map[repository.PoBJobStatus]int `json:"counts" binding:"required"`
+	Jobs   []*PoBJob                       `json:"jobs" binding:"required"`
+}
+
+type RequeuePoBJobs struct {
+	CharacterIds []string `json:"character_ids"`
+}
+
+type RequeuePoBJobsResponse struct {
+	Requeued int64 `json:"requeued" binding:"required"`
+}
+
+func toPoBJobResponse(job *repository.PoBJob) *PoBJob {
+	return &PoBJob{
+		CharacterId:   job.CharacterId,
+		EventId:       job.EventId,
+		UserId:        job.UserId,
+		Status:        job.Status,
+		Attempts:      job.Attempts,
+		NextAttemptAt: job.NextAttemptAt,
+		LastError:     job.LastError,
+		CreatedAt:     job.CreatedAt,
+		UpdatedAt:     job.UpdatedAt,
+	}
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"bpl/repository"
+	"bpl/service"
+	"bpl/utils"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PoBStatController struct {
+	pobStatService service.PoBStatService
+}
+
+func NewPoBStatController() *PoBStatController {
+	return &PoBStatController{
+		pobStatService: service.NewPoBStatService(),
+	}
+}
+
+func setupPoBStatController() []RouteInfo {
+	c := NewPoBStatController()
+	editorRoles := []repository.Permission{repository.PermissionAdmin, repository.PermissionManager, repository.PermissionObjectiveDesigner}
+	baseUrl := "events/:event_id/pob-stats"
+	routes := []RouteInfo{
+		{Method: "GET", Path: "", HandlerFunc: c.getPoBStatMappingsHandler()},
+		{Method: "PUT", Path: "", HandlerFunc: c.savePoBStatMappingHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "DELETE", Path: "/:mapping_id", HandlerFunc: c.deletePoBStatMappingHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "POST", Path: "/recalculate", HandlerFunc: c.recalculatePoBStatsHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+	}
+	for i, route := range routes {
+		routes[i].Path = baseUrl + route.Path
+	}
+	return routes
+}
+
+// @id GetPoBStatMappings
+// @Description Get the PoB stat mappings of an event. Each mapping can be used in objectives through its tracked value.
+// @Tags pob
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Success 200 {array} PoBStatMapping
+// @Router /events/{event_id}/pob-stats [get]
+func (c *PoBStatController) getPoBStatMappingsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		mappings, err := c.pobStatService.GetMappingsForEvent(event.Id)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(mappings, toPoBStatMappingResponse))
+	}
+}
+
+// @id SavePoBStatMapping
+// @Description Creates or updates a PoB stat mapping for an event
+// @Security BearerAuth
+// @Tags pob
+// @Accept json
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param body body PoBStatMappingCreate true "Mapping to save"
+// @Success 200 {object} PoBStatMapping
+// @Router /events/{event_id}/pob-stats [put]
+func (c *PoBStatController) savePoBStatMappingHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		if event.Locked {
+			ctx.JSON(400, gin.H{"error": "event is locked"})
+			return
+		}
+		var body PoBStatMappingCreate
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		mapping := body.toModel()
+		mapping.EventId = event.Id
+		if err := mapping.Validate(); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		mapping, err := c.pobStatService.SaveMapping(mapping)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ctx.JSON(404, gin.H{"error": "Mapping not found"})
+			} else if errors.Is(err, service.ErrPoBStatMappingInUse) {
+				ctx.JSON(409, gin.H{"error": err.Error()})
+			} else {
+				ctx.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		ctx.JSON(200, toPoBStatMappingResponse(mapping))
+	}
+}
+
+// @id DeletePoBStatMapping
+// @Description Deletes a PoB stat mapping
+// @Security BearerAuth
+// @Tags pob
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Param mapping_id path int true "Mapping ID"
+// @Success 204
+// @Router /events/{event_id}/pob-stats/{mapping_id} [delete]
+func (c *PoBStatController) deletePoBStatMappingHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		mappingId, err := strconv.Atoi(ctx.Param("mapping_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid mapping ID"})
+			return
+		}
+		if event.Locked {
+			ctx.JSON(400, gin.H{"error": "event is locked"})
+			return
+		}
+		if err := c.pobStatService.DeleteMapping(event.Id, mappingId); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ctx.JSON(404, gin.H{"error": "Mapping not found"})
+			} else if errors.Is(err, service.ErrPoBStatMappingInUse) {
+				ctx.JSON(409, gin.H{"error": err.Error()})
+			} else {
+				ctx.JSON(500, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		ctx.Status(204)
+	}
+}
+
+// @id RecalculatePoBStats
+// @Description Applies the current PoB stat mappings to the latest PoB of every character in the event
+// @Security BearerAuth
+// @Tags pob
+// @Produce json
+// @Param event_id path int true "Event ID"
+// @Success 200 {object} RecalculatePoBStatsResponse
+// @Router /events/{event_id}/pob-stats/recalculate [post]
+func (c *PoBStatController) recalculatePoBStatsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		updated, err := c.pobStatService.RecalculateLatestStats(event.Id)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, RecalculatePoBStatsResponse{Updated: updated})
+	}
+}
+
+type PoBStatMappingCreate struct {
+	Id          *int                       `json:"id"`
+	Name        string                     `json:"name" binding:"required"`
+	Fields      []string                   `json:"fields" binding:"required"`
+	Aggregation repository.StatAggregation `json:"aggregation" binding:"required"`
+	Multiplier  float64                    `json:"multiplier"`
+}
+
+func (m *PoBStatMappingCreate) toModel() *repository.PoBStatMapping {
+	mapping := &repository.PoBStatMapping{
+		Name:        m.Name,
+		Fields:      m.Fields,
+		Aggregation: m.Aggregation,
+		Multiplier:  m.Multiplier,
+	}
+	if mapping.Multiplier == 0 {
+		mapping.Multiplier = 1
+	}
+	if m.Id != nil {
+		mapping.Id = *m.Id
+	}
+	return mapping
+}
+
+type PoBStatMapping struct {
+	Id           int                        `json:"id" binding:"required"`
+	Name         string                     `json:"name" binding:"required"`
+	Fields       []string                   `json:"fields" binding:"required"`
+	Aggregation  repository.StatAggregation `json:"aggregation" binding:"required"`
+	Multiplier   float64                    `json:"multiplier" binding:"required"`
+	TrackedValue repository.TrackedValue    `json:"tracked_value" binding:"required"`
+}
+
+type RecalculatePoBStatsResponse struct {
+	Updated int `json:"updated" binding:"required"`
+}
+
+func toPoBStatMappingResponse(mapping *repository.PoBStatMapping) *PoBStatMapping {
+	return &PoBStatMapping{
+		Id:           mapping.Id,
+		Name:         mapping.Name,
+		Fields:       mapping.Fields,
+		Aggregation:  mapping.Aggregation,
+		Multiplier:   mapping.Multiplier,
+		TrackedValue: repository.PoBStatTrackedValue(mapping.Name),
+	}
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"bpl/client"
+	"bpl/repository"
+	"bpl/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RateLimitController struct {
+	store client.RateLimitStore
+}
+
+func NewRateLimitController() *RateLimitController {
+	return &RateLimitController{
+		store: client.DefaultRateLimitStore(),
+	}
+}
+
+func setupRateLimitController() []RouteInfo {
+	c := NewRateLimitController()
+	return []RouteInfo{
+		{Method: "GET", Path: "/rate-limits", HandlerFunc: c.getRateLimitUsageHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+	}
+}
+
+// @id GetRateLimitUsage
+// @Description Get the current usage of every PoE API rate limit policy the clients know about
+// @Tags jobs
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} RateLimitUsage
+// @Router /rate-limits [get]
+func (c *RateLimitController) getRateLimitUsageHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		usage, err := c.store.Usage()
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(usage, toRateLimitUsageResponse))
+	}
+}
+
+type RateLimitUsage struct {
+	Token         string `json:"token" binding:"required"`
+	Endpoint      string `json:"endpoint" binding:"required"`
+	Rule          string `json:"rule" binding:"required"`
+	MaxHits       int    `json:"max_hits" binding:"required"`
+	PeriodSeconds int64  `json:"period_seconds" binding:"required"`
+	CurrentHits   int    `json:"current_hits" binding:"required"`
+}
+
+func toRateLimitUsageResponse(usage *client.PolicyUsage) *RateLimitUsage {
+	return &RateLimitUsage{
+		Token:         usage.Token,
+		Endpoint:      usage.Endpoint,
+		Rule:          usage.Rule,
+		MaxHits:       usage.Policy.MaxHits,
+		PeriodSeconds: int64(usage.Policy.Period.Seconds()),
+		CurrentHits:   usage.CurrentHits,
+	}
+}
@@ -1,11 +1,14 @@
 package controller
 
 import (
-	"bpl/client"
 	"bpl/cron"
 	"bpl/repository"
+	"bpl/service"
+	"bpl/utils"
+	"errors"
 	"fmt"
 	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,11 +16,13 @@ import (
 
 type RecurringJobsController struct {
 	service *cron.RecurringJobService
+	elector *service.LeaderElector
 }
 
 type JobCreate struct {
 	JobType                  repository.JobType `json:"job_type"`
 	SleepAfterEachRunSeconds int                `json:"sleep_after_each_run_seconds"`
+	Schedule                 *string            `json:"schedule"`
 	EventId                  int                `json:"event_id"`
 	DurationInSeconds        *int               `json:"duration_in_seconds"`
 	EndDate                  *time.Time         `json:"end_date" format:"date-time"`
@@ -37,12 +42,17 @@ func (j *JobCreate) toJob() (*cron.RecurringJob, error) {
 		endDate := time.Now().Add(time.Duration(*j.DurationInSeconds) * time.Second)
 		j.EndDate = &endDate
 	}
-	return &cron.RecurringJob{
+	job := &cron.RecurringJob{
 		JobType:                  j.JobType,
 		SleepAfterEachRunSeconds: j.SleepAfterEachRunSeconds,
+		Schedule:                 j.Schedule,
 		EndDate:                  *j.EndDate,
 		EventId:                  j.EventId,
-	}, nil
+	}
+	if err := job.Validate(); err != nil {
+		return nil, err
+	}
+	return job, nil
 }
 
 var jobList = []repository.JobType{
@@ -50,25 +60,34 @@ var jobList = []repository.JobType{
 	repository.EvaluateStashChanges,
 	repository.FetchCharacterData,
 	repository.FetchGuildStashes,
+	repository.CompactObjectiveMatches,
 }
 
-func NewRecurringJobsController(poeClient *client.PoEClient) *RecurringJobsController {
+func NewRecurringJobsController(jobService *cron.RecurringJobService) *RecurringJobsController {
 	controller := &RecurringJobsController{
-		service: cron.NewRecurringJobService(poeClient),
+		service: jobService,
+		elector: service.NewLeaderElector(),
 	}
 	return controller
 }
 
-func setupRecurringJobsController(poeClient *client.PoEClient) []RouteInfo {
-	c := NewRecurringJobsController(poeClient)
+func setupRecurringJobsController(jobService *cron.RecurringJobService) []RouteInfo {
+	c := NewRecurringJobsController(jobService)
 	baseUrl := "jobs"
 	routes := []RouteInfo{
 		{Method: "GET", Path: "", HandlerFunc: c.getJobsHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
 		{Method: "POST", Path: "", HandlerFunc: c.startJobHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "POST", Path: "/:job_id/pause", HandlerFunc: c.pauseJobHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "POST", Path: "/:job_id/resume", HandlerFunc: c.resumeJobHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "POST", Path: "/:job_id/trigger", HandlerFunc: c.triggerJobHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "GET", Path: "/leaders", HandlerFunc: c.getLeadersHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
+		{Method: "GET", Path: "/:job_id/runs", HandlerFunc: c.getJobRunsHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
 	}
 	for i, route := range routes {
 		routes[i].Path = baseUrl + route.Path
 	}
+	// phase transitions start and stop the event's jobs, so they are handled by the same scheduler
+	routes = append(routes, RouteInfo{Method: "POST", Path: "/events/:event_id/phase", HandlerFunc: c.transitionEventHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}})
 	return routes
 }
 
@@ -81,14 +100,7 @@ func setupRecurringJobsController(poeClient *client.PoEClient) []RouteInfo {
 // @Router /jobs [get]
 func (c *RecurringJobsController) getJobsHandler() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		jobs := make([]*cron.RecurringJob, 0)
-		for _, jobType := range jobList {
-			job, ok := c.service.Jobs[jobType]
-			if ok {
-				jobs = append(jobs, job)
-			}
-		}
-		ctx.JSON(200, jobs)
+		ctx.JSON(200, c.service.GetJobs())
 	}
 }
 
@@ -122,3 +134,254 @@ func (c *RecurringJobsController) startJobHandler() gin.HandlerFunc {
 		ctx.JSON(201, job)
 	}
 }
+
+// @id PauseJob
+// @Description Pause a recurring job, stopping its current run
+// @Security BearerAuth
+// @Tags jobs
+// @Produce json
+// @Param job_id path int true "Job Id"
+// @Success 200 {object} cron.RecurringJob
+// @Router /jobs/{job_id}/pause [post]
+func (c *RecurringJobsController) pauseJobHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		jobId, err := strconv.Atoi(ctx.Param("job_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid job id"})
+			return
+		}
+		job, err := c.service.PauseJob(jobId)
+		if err != nil {
+			ctx.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, job)
+	}
+}
+
+// @id ResumeJob
+// @Description Resume a paused recurring job
+// @Security BearerAuth
+// @Tags jobs
+// @Produce json
+// @Param job_id path int true "Job Id"
+// @Success 200 {object} cron.RecurringJob
+// @Router /jobs/{job_id}/resume [post]
+func (c *RecurringJobsController) resumeJobHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		jobId, err := strconv.Atoi(ctx.Param("job_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid job id"})
+			return
+		}
+		job, err := c.service.ResumeJob(jobId)
+		if err != nil {
+			ctx.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, job)
+	}
+}
+
+// @id TriggerJob
+// @Description Run a recurring job immediately instead of waiting for its schedule or restart backoff
+// @Security BearerAuth
+// @Tags jobs
+// @Produce json
+// @Param job_id path int true "Job Id"
+// @Success 202 {object} cron.RecurringJob
+// @Router /jobs/{job_id}/trigger [post]
+func (c *RecurringJobsController) triggerJobHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		jobId, err := strconv.Atoi(ctx.Param("job_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid job id"})
+			return
+		}
+		job, err := c.service.TriggerJob(jobId)
+		if err != nil {
+			ctx.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(202, job)
+	}
+}
+
+// @id GetJobRuns
+// @Description Get the latest runs of a recurring job
+// @Security BearerAuth
+// @Tags jobs
+// @Produce json
+// @Param job_id path int true "Job Id"
+// @Param limit query int false "Maximum number of runs (default 50)"
+// @Success 200 {array} RecurringJobRun
+// @Router /jobs/{job_id}/runs [get]
+func (c *RecurringJobsController) getJobRunsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		jobId, err := strconv.Atoi(ctx.Param("job_id"))
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid job id"})
+			return
+		}
+		limit := 50
+		if l := ctx.Query("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed < 1 {
+				ctx.JSON(400, gin.H{"error": "Invalid limit"})
+				return
+			}
+			limit = parsed
+		}
+		runs, err := c.service.GetRuns(jobId, limit)
+		if err != nil {
+			ctx.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, utils.Map(runs, toRecurringJobRunResponse))
+	}
+}
+
+// @id GetLeaders
+// @Description Shows which instance leads which background role and thereby owns which job
+// @Security BearerAuth
+// @Tags jobs
+// @Produce json
+// @Success 200 {object} LeaderStatus
+// @Router /jobs/leaders [get]
+func (c *RecurringJobsController) getLeadersHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		leases, err := c.elector.GetLeases()
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		var jobOwner *string
+		for _, lease := range leases {
+			if lease.Role == service.LeaderRoleRecurringJobs {
+				jobOwner = &lease.InstanceId
+			}
+		}
+		jobs := c.service.GetJobs()
+		status := &LeaderStatus{
+			InstanceId: c.elector.InstanceId(),
+			Leases:     utils.Map(leases, toLeaderLeaseResponse),
+			Jobs:       make([]*JobOwner, 0, len(jobs)),
+		}
+		for _, job := range jobs {
+			status.Jobs = append(status.Jobs, &JobOwner{
+				JobId:      job.Id,
+				JobType:    job.JobType,
+				EventId:    job.EventId,
+				InstanceId: jobOwner,
+			})
+		}
+		ctx.JSON(200, status)
+	}
+}
+
+// @id TransitionEvent
+// @Description Move an event to a later phase of its lifecycle, e.g. to publish a draft, finish an event early or archive it.
+// @Description The side effects of every phase on the way are performed, like starting the event's jobs when it starts running.
+// @Security BearerAuth
+// @Tags event
+// @Accept json
+// @Produce json
+// @Param event_id path int true "Event Id"
+// @Param body body EventPhaseUpdate true "Phase to move to"
+// @Success 200 {object} Event
+// @Router /events/{event_id}/phase [post]
+func (c *RecurringJobsController) transitionEventHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		event := getEvent(ctx)
+		if event == nil {
+			return
+		}
+		var body EventPhaseUpdate
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if !slices.Contains(repository.EventPhases, body.Phase) {
+			ctx.JSON(400, gin.H{"error": "Invalid phase"})
+			return
+		}
+		if !event.Phase.IsBefore(body.Phase) {
+			ctx.JSON(400, gin.H{"error": fmt.Sprintf("event cannot move from %s back to %s", event.Phase, body.Phase)})
+			return
+		}
+		err := c.service.TransitionEvent(event, body.Phase)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(200, toEventResponse(event))
+	}
+}
+
+type EventPhaseUpdate struct {
+	Phase repository.EventPhase `json:"phase" binding:"required"`
+}
+
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cron.ErrJobNotFound):
+		return 404
+	case errors.Is(err, cron.ErrJobRunning), errors.Is(err, cron.ErrJobNotActive):
+		return 409
+	default:
+		return 500
+	}
+}
+
+type RecurringJobRun struct {
+	Id             int                              `json:"id" binding:"required"`
+	JobId          int                              `json:"job_id" binding:"required"`
+	StartedAt      time.Time                        `json:"started_at" binding:"required"`
+	EndedAt        *time.Time                       `json:"ended_at"`
+	Status         repository.RecurringJobRunStatus `json:"status" binding:"required"`
+	Error          *string                          `json:"error"`
+	ItemsProcessed int64                            `json:"items_processed" binding:"required"`
+}
+
+func toRecurringJobRunResponse(run *repository.RecurringJobRun) *RecurringJobRun {
+	return &RecurringJobRun{
+		Id:             run.Id,
+		JobId:          run.JobId,
+		StartedAt:      run.StartedAt,
+		EndedAt:        run.EndedAt,
+		Status:         run.Status,
+		Error:          run.Error,
+		ItemsProcessed: run.ItemsProcessed,
+	}
+}
+
+type LeaderLease struct {
+	Role       string    `json:"role" binding:"required"`
+	InstanceId string    `json:"instance_id" binding:"required"`
+	AcquiredAt time.Time `json:"acquired_at" binding:"required"`
+	RenewedAt  time.Time `json:"renewed_at" binding:"required"`
+}
+
+type JobOwner struct {
+	JobId   int                `json:"job_id" binding:"required"`
+	JobType repository.JobType `json:"job_type" binding:"required"`
+	EventId int                `json:"event_id" binding:"required"`
+	// the instance running the job, empty while no instance leads the recurring jobs
+	InstanceId *string `json:"instance_id"`
+}
+
+type LeaderStatus struct {
+	// the instance that answered the request
+	InstanceId string         `json:"instance_id" binding:"required"`
+	Leases     []*LeaderLease `json:"leases" binding:"required"`
+	Jobs       []*JobOwner    `json:"jobs" binding:"required"`
+}
+
+func toLeaderLeaseResponse(lease *repository.LeaderLease) *LeaderLease {
+	return &LeaderLease{
+		Role:       lease.Role,
+		InstanceId: lease.InstanceId,
+		AcquiredAt: lease.AcquiredAt,
+		RenewedAt:  lease.RenewedAt,
+	}
+}
@@ -3,56 +3,79 @@ package controller
 import (
 	"bpl/auth"
 	"bpl/client"
+	"bpl/config"
+	"bpl/cron"
 	"bpl/repository"
 	"bpl/service"
 	"bpl/utils"
-	"fmt"
+	"context"
+	"errors"
 	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+var logger = config.Logger("controller")
+
 type RouteInfo struct {
 	Method             string
 	Path               string
 	HandlerFunc        gin.HandlerFunc
 	Authenticated      bool
 	RequiredRoles      []repository.Permission
+	RequiredEventRoles []repository.Permission
+	// EventRoleTeam resolves the team that the request targets, so that event roles restricted to that team are accepted
+	EventRoleTeam      func(c *gin.Context) (int, error)
 	RequiresUserSelf   bool
 	RequiresTeamSelf   bool
 	RequiresTeamLeader bool
 }
 
-func SetRoutes(r *gin.Engine) {
+// SetRoutes registers the routes of all controllers and returns a function that closes their long lived connections on shutdown.
+// The job service is shared with the worker, so that jobs and event transitions of this instance are coordinated.
+func SetRoutes(r *gin.Engine, poeClient *client.PoEClient, jobService *cron.RecurringJobService) func(ctx context.Context) {
 	cache := persistence.NewInMemoryStore(60 * time.Second)
-	poeClient := client.NewPoEClient(10, false, 600)
+	scoreController := NewScoreController(poeClient)
 
 	routes := make([]RouteInfo, 0)
 	group := r.Group("/api")
 	routes = append(routes, setupEventController()...)
+	routes = append(routes, setupEventRoleController()...)
 	routes = append(routes, setupTeamController()...)
 	routes = append(routes, setupObjectiveController(poeClient)...)
+	routes = append(routes, setupObjectiveMatchController()...)
 	routes = append(routes, setupOauthController()...)
+	routes = append(routes, setupAuthController()...)
 	routes = append(routes, setupUserController(poeClient)...)
 	routes = append(routes, setupScoringRuleController()...)
 	routes = append(routes, setupSignupController()...)
 	routes = append(routes, setupSubmissionController()...)
-	routes = append(routes, setupScoreController(poeClient)...)
+	routes = append(routes, setupScoreController(scoreController)...)
 	routes = append(routes, setupLadderController(poeClient)...)
+	routes = append(routes, setupBuildMetaController()...)
 	routes = append(routes, setupTeamSuggestionController()...)
 	routes = append(routes, setupCharacterController(poeClient)...)
+	routes = append(routes, setupPassiveTreeController()...)
 	routes = append(routes, setupStreamController(cache)...)
-	routes = append(routes, setupRecurringJobsController(poeClient)...)
+	routes = append(routes, setupRecurringJobsController(jobService)...)
+	routes = append(routes, setupPoBQueueController()...)
+	routes = append(routes, setupPoBStatController()...)
 	routes = append(routes, setupGuildStashController(poeClient)...)
 	routes = append(routes, setupActivityController()...)
+	routes = append(routes, setupLevelingController()...)
+	routes = append(routes, setupDeathController()...)
 	routes = append(routes, setupTimingController()...)
+	routes = append(routes, setupRateLimitController()...)
 	routes = append(routes, setupItemWishController()...)
 	routes = append(routes, setupItemController()...)
 	routes = append(routes, setupEngagementController()...)
 	routes = append(routes, setupAchievementController()...)
+	routes = append(routes, setupHealthController()...)
 	for _, route := range routes {
 		handlerfuncs := make([]gin.HandlerFunc, 0)
 		if route.Authenticated {
@@ -62,6 +85,9 @@ func SetRoutes(r *gin.Engine) {
 			handlerfuncs = append(handlerfuncs, AuthorizationMiddleware(route.RequiredRoles))
 		}
 		handlerfuncs = append(handlerfuncs, LoadEventMiddleware())
+		if len(route.RequiredEventRoles) > 0 {
+			handlerfuncs = append(handlerfuncs, EventAuthorizationMiddleware(route.RequiredEventRoles, route.EventRoleTeam))
+		}
 		if route.RequiresUserSelf {
 			handlerfuncs = append(handlerfuncs, UserSelfMiddleware())
 		}
@@ -74,6 +100,7 @@ func SetRoutes(r *gin.Engine) {
 		handlerfuncs = append(handlerfuncs, route.HandlerFunc)
 		group.Handle(route.Method, route.Path, handlerfuncs...)
 	}
+	return scoreController.Shutdown
 }
 
 func LoadEventMiddleware() gin.HandlerFunc {
@@ -116,14 +143,37 @@ func getEvent(c *gin.Context) *repository.Event {
 		return nil
 	}
 	ev := event.(*repository.Event)
-	userRoles := getUserRoles(c)
-	if !ev.Public && len(userRoles) == 0 {
+	if !isEventVisible(ev, getUserRoles(c), getRoleEventIds(c)) {
 		c.AbortWithStatus(404)
 		return nil
 	}
 	return ev
 }
 
+// isEventVisible returns whether the user can see the event. Before an event is public, only admins and users
+// with a role in the event can see it.
+func isEventVisible(event *repository.Event, userRoles []repository.Permission, roleEventIds []int) bool {
+	return event.Public || slices.Contains(userRoles, repository.PermissionAdmin) || slices.Contains(roleEventIds, event.Id)
+}
+
+// getRoleEventIds returns the events in which the authenticated user holds any role, including roles restricted to a team
+func getRoleEventIds(r *gin.Context) []int {
+	if value, ok := r.Get("roleEventIds"); ok {
+		return value.([]int)
+	}
+	eventIds := make([]int, 0)
+	if userId, ok := getUserId(r); ok {
+		ids, err := eventRoleService().GetEventIdsForUser(userId)
+		if err != nil {
+			logger.ErrorContext(r.Request.Context(), "Failed to get events of user roles", "user_id", userId, "error", err)
+		} else {
+			eventIds = ids
+		}
+	}
+	r.Set("roleEventIds", eventIds)
+	return eventIds
+}
+
 func AuthenticationMiddleware() gin.HandlerFunc {
 	return func(r *gin.Context) {
 		if !isAuthenticated(r) {
@@ -169,13 +219,13 @@ func TeamSelfMiddleware() gin.HandlerFunc {
 		}
 		teamId, err := strconv.Atoi(teamIdParam)
 		if err != nil {
-			fmt.Println("Error parsing team ID:", err)
+			logger.WarnContext(r.Request.Context(), "Failed to parse team id", "team_id", teamIdParam, "error", err)
 			r.AbortWithStatus(400)
 			return
 		}
 		event := getEvent(r)
 		if event == nil {
-			fmt.Println("Event not found in context")
+			logger.WarnContext(r.Request.Context(), "Event not found in context")
 			r.AbortWithStatus(400)
 			return
 		}
@@ -229,41 +279,121 @@ func AuthorizationMiddleware(requiredRoles []repository.Permission) gin.HandlerF
 	}
 }
 
-func getUserId(r *gin.Context) (userId int, ok bool) {
-	authHeader := r.Request.Header.Get("Authorization")
-	if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-		return 0, false
+// EventAuthorizationMiddleware is the variant of AuthorizationMiddleware for routes of an event. Besides the global
+// permissions it accepts the roles that the user has been granted in the event loaded by LoadEventMiddleware.
+// Roles restricted to a team are accepted if teamOf resolves the target of the request to that team.
+func EventAuthorizationMiddleware(requiredRoles []repository.Permission, teamOf func(c *gin.Context) (int, error)) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		if _, ok := r.Get("event"); !ok {
+			r.AbortWithStatus(400)
+			return
+		}
+		if teamOf != nil {
+			teamId, err := teamOf(r)
+			if err != nil {
+				var numErr *strconv.NumError
+				switch {
+				case errors.As(err, &numErr):
+					r.AbortWithStatus(400)
+				case errors.Is(err, gorm.ErrRecordNotFound):
+					r.AbortWithStatus(404)
+				default:
+					logger.ErrorContext(r.Request.Context(), "Failed to resolve team of request", "error", err)
+					r.AbortWithStatus(500)
+				}
+				return
+			}
+			r.Set("eventRoleTeam", teamId)
+		}
+		userRoles := getEventRoles(r)
+		for _, requiredRole := range requiredRoles {
+			if slices.Contains(userRoles, requiredRole) {
+				r.Next()
+				return
+			}
+		}
+		r.AbortWithStatus(403)
 	}
-	token, err := auth.ParseToken(authHeader[7:])
-	if err != nil {
-		return 0, false
+}
+
+// eventRoleService is created on first use, since the database connection is only set up in main
+var eventRoleService = sync.OnceValue(func() service.EventRoleService {
+	return service.NewEventRoleService()
+})
+
+// getEventRoles returns the global permissions of the user together with their roles in the event of the request.
+// Roles that are restricted to a team only count for the team of the request, which is resolved by the route
+// or taken from the team_id path parameter.
+func getEventRoles(r *gin.Context) []repository.Permission {
+	if value, ok := r.Get("eventRoles"); ok {
+		return value.([]repository.Permission)
 	}
-	claims := &auth.Claims{}
-	if !token.Valid {
-		return 0, false
+	var teamId *int
+	if value, ok := r.Get("eventRoleTeam"); ok {
+		id := value.(int)
+		teamId = &id
+	} else if id, err := strconv.Atoi(r.Param("team_id")); err == nil {
+		teamId = &id
 	}
-	claims.FromJWTClaims(token.Claims)
-	if err := claims.Valid(); err != nil {
-		return 0, false
+	roles := loadEventRoles(r, teamId)
+	r.Set("eventRoles", roles)
+	return roles
+}
+
+// getTeamEventRoles returns the roles of the user that apply to the given team, for handlers that only know the team
+// of their target after loading it
+func getTeamEventRoles(r *gin.Context, teamId int) []repository.Permission {
+	return loadEventRoles(r, &teamId)
+}
+
+func loadEventRoles(r *gin.Context, teamId *int) []repository.Permission {
+	roles := getUserRoles(r)
+	userId, authenticated := getUserId(r)
+	event, ok := r.Get("event")
+	if authenticated && ok {
+		eventRoles, err := eventRoleService().GetEventPermissions(userId, event.(*repository.Event).Id, teamId)
+		if err != nil {
+			logger.ErrorContext(r.Request.Context(), "Failed to get event roles", "user_id", userId, "error", err)
+		}
+		for _, role := range eventRoles {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
 	}
-	return claims.UserId, true
+	return roles
 }
 
-func getUserRoles(r *gin.Context) (permissions []repository.Permission) {
-	authHeader := r.Request.Header.Get("Authorization")
-	if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-		return permissions
+// getClaims returns the claims of the access token of the request if it is valid and has not been revoked.
+// The token is only verified once per request.
+func getClaims(r *gin.Context) (*auth.Claims, bool) {
+	if value, ok := r.Get("claims"); ok {
+		claims := value.(*auth.Claims)
+		return claims, claims != nil
 	}
-	token, err := auth.ParseToken(authHeader[7:])
-	if err != nil {
-		return permissions
+	var claims *auth.Claims
+	authHeader := r.Request.Header.Get("Authorization")
+	if len(authHeader) >= 7 && authHeader[:7] == "Bearer " {
+		verified, err := service.NewTokenService().VerifyAccessToken(authHeader[7:])
+		if err == nil {
+			claims = verified
+		}
 	}
-	claims := &auth.Claims{}
-	if !token.Valid {
-		return permissions
+	r.Set("claims", claims)
+	return claims, claims != nil
+}
+
+func getUserId(r *gin.Context) (userId int, ok bool) {
+	claims, ok := getClaims(r)
+	if !ok {
+		return 0, false
 	}
-	claims.FromJWTClaims(token.Claims)
-	if err := claims.Valid(); err != nil {
+	return claims.UserId, true
+}
+
+func getUserRoles(r *gin.Context) (permissions []repository.Permission) {
+	claims, ok := getClaims(r)
+	if !ok {
 		return permissions
 	}
 	return utils.Map(claims.Permissions, func(perm string) repository.Permission {
@@ -272,13 +402,6 @@ func getUserRoles(r *gin.Context) (permissions []repository.Permission) {
 }
 
 func isAuthenticated(r *gin.Context) bool {
-	authHeader := r.Request.Header.Get("Authorization")
-	if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-		return false
-	}
-	token, err := auth.ParseToken(authHeader[7:])
-	if err != nil {
-		return false
-	}
-	return token.Valid
+	_, ok := getClaims(r)
+	return ok
 }
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"bpl/auth"
+	"bpl/repository"
+	"bpl/service"
+	"bpl/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// ==================== Stubs ====================
+
+// stubEventRoleService answers the permission lookups from a fixed set of roles
+type stubEventRoleService struct {
+	service.EventRoleService
+	roles []*repository.EventRole
+}
+
+func (s *stubEventRoleService) GetEventPermissions(userId int, eventId int, teamId *int) ([]repository.Permission, error) {
+	roles := utils.Filter(s.roles, func(role *repository.EventRole) bool {
+		return role.UserId == userId && role.EventId == eventId
+	})
+	return service.EventPermissions(roles, teamId), nil
+}
+
+type stubSubmissionService struct {
+	service.SubmissionService
+	submissions map[int]*repository.Submission
+}
+
+func (s *stubSubmissionService) GetSubmissionById(id int) (*repository.Submission, error) {
+	submission, ok := s.submissions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return submission, nil
+}
+
+type stubTeamService struct {
+	service.TeamService
+	teams map[int]*repository.Team
+}
+
+func (s *stubTeamService) GetTeamById(teamId int) (*repository.Team, error) {
+	team, ok := s.teams[teamId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return team, nil
+}
+
+// ==================== Event Authorization ====================
+
+func TestEventAuthorizationMiddleware_TeamScopedJudge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	event := &repository.Event{Id: 1}
+	teamJudge, eventJudge := 10, 11
+	ownTeam := 1
+	roles := &stubEventRoleService{roles: []*repository.EventRole{
+		{UserId: teamJudge, EventId: event.Id, TeamId: &ownTeam, Role: repository.PermissionSubmissionJudge},
+		{UserId: eventJudge, EventId: event.Id, Role: repository.PermissionSubmissionJudge},
+	}}
+	previous := eventRoleService
+	eventRoleService = func() service.EventRoleService { return roles }
+	defer func() { eventRoleService = previous }()
+
+	c := &SubmissionController{
+		submissionService: &stubSubmissionService{submissions: map[int]*repository.Submission{
+			100: {Id: 100, TeamId: 1},
+			200: {Id: 200, TeamId: 2},
+			300: {Id: 300, TeamId: 3},
+		}},
+		teamService: &stubTeamService{teams: map[int]*repository.Team{
+			1: {Id: 1, EventId: event.Id},
+			2: {Id: 2, EventId: event.Id},
+			3: {Id: 3, EventId: 2},
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		userId       int
+		submissionId string
+		want         int
+	}{
+		{"team judge reviews a submission of their team", teamJudge, "100", 200},
+		{"team judge reviews a submission of another team", teamJudge, "200", 403},
+		{"event judge reviews a submission of any team", eventJudge, "200", 200},
+		{"unknown submission", eventJudge, "400", 404},
+		{"submission of another event", eventJudge, "300", 404},
+		{"invalid submission id", eventJudge, "abc", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.PUT("/events/:event_id/submissions/:submission_id/review",
+				func(ctx *gin.Context) {
+					ctx.Set("claims", &auth.Claims{UserId: tt.userId})
+					ctx.Set("event", event)
+				},
+				EventAuthorizationMiddleware([]repository.Permission{repository.PermissionAdmin, repository.PermissionSubmissionJudge}, c.submissionTeam),
+				func(ctx *gin.Context) { ctx.Status(200) },
+			)
+			w := httptest.NewRecorder()
+			path := fmt.Sprintf("/events/%d/submissions/%s/review", event.Id, tt.submissionId)
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, nil))
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestIsEventVisible(t *testing.T) {
+	private := &repository.Event{Id: 1}
+	public := &repository.Event{Id: 2, Public: true}
+	assert.True(t, isEventVisible(public, nil, nil))
+	assert.False(t, isEventVisible(private, nil, []int{2}))
+	assert.True(t, isEventVisible(private, nil, []int{1}), "users with a role in the event should see it before it is public")
+	assert.True(t, isEventVisible(private, []repository.Permission{repository.PermissionAdmin}, nil))
+}
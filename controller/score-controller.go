@@ -6,10 +6,12 @@ import (
 	"bpl/scoring"
 	"bpl/service"
 	"bpl/utils"
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,6 +23,8 @@ type ScoreController struct {
 	eventService      service.EventService
 	scoreService      service.ScoreService
 	userService       service.UserService
+	elector           *service.LeaderElector
+	stopUpdater       chan struct{}
 	mu                sync.Mutex
 	connections       map[int]map[*websocket.Conn]int
 	simpleConnections map[int]map[*websocket.Conn]int
@@ -32,6 +36,8 @@ func NewScoreController(PoEClient *client.PoEClient) *ScoreController {
 		eventService:      eventService,
 		scoreService:      service.NewScoreService(PoEClient),
 		userService:       service.NewUserService(),
+		elector:           service.NewLeaderElector(),
+		stopUpdater:       make(chan struct{}),
 		connections:       make(map[int]map[*websocket.Conn]int),
 		simpleConnections: make(map[int]map[*websocket.Conn]int),
 	}
@@ -39,13 +45,13 @@ func NewScoreController(PoEClient *client.PoEClient) *ScoreController {
 	return controller
 }
 
-func setupScoreController(PoEClient *client.PoEClient) []RouteInfo {
-	e := NewScoreController(PoEClient)
+func setupScoreController(e *ScoreController) []RouteInfo {
 	baseUrl := "events/:event_id/scores"
 	routes := []RouteInfo{
 		{Method: "GET", Path: "/latest", HandlerFunc: e.getLatestScoresForEventHandler()},
 		{Method: "GET", Path: "/ws", HandlerFunc: e.WebSocketHandler},
 		{Method: "GET", Path: "/simple/ws", HandlerFunc: e.SimpleWebSocketHandler},
+		{Method: "GET", Path: "/teams/:team_id/gaps", HandlerFunc: e.getObjectiveGapsHandler(), Authenticated: true, RequiresTeamSelf: true},
 	}
 	for i, route := range routes {
 		routes[i].Path = baseUrl + route.Path
@@ -165,70 +171,118 @@ func (e *ScoreController) SimpleWebSocketHandler(c *gin.Context) {
 	}
 }
 
+// StartScoreUpdater pushes score changes to the websocket connections of this instance. Only the leader of the
+// score updater role calculates the scores, all other instances pick up the results it has cached.
 func (e *ScoreController) StartScoreUpdater() {
+	e.elector.RunAsLeader(service.LeaderRoleScoreUpdater, func(ctx context.Context) {
+		<-ctx.Done()
+	})
 	go func() {
-		events, err := e.eventService.GetAllEvents()
-		if err != nil {
-			fmt.Println("Error fetching events for score updater:", err)
-			return
-		}
-		eventMap := make(map[int]*repository.Event)
-		for _, event := range events {
-			eventMap[event.Id] = event
-		}
-
 		for {
-			e.mu.Lock()
-			// calculate scores for events with active websocket connections
-			eventIds := utils.Keys(e.connections)
-			eventIds = utils.Uniques(append(eventIds, utils.Keys(e.simpleConnections)...))
-			e.mu.Unlock()
-			for _, eventId := range eventIds {
-				event, ok := eventMap[eventId]
-				// dont update event if its over and its already cached
-				if !ok || (event.EventEndTime.Before(time.Now()) && e.scoreService.GetLatestScores(eventId) != nil) {
-					continue
-				}
+			e.updateScores()
+			select {
+			case <-e.stopUpdater:
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
 
-				diff, err := e.scoreService.GetNewDiff(eventId)
-				if err != nil {
-					continue
+// Shutdown stops the score updater and closes all websocket connections, telling the clients to reconnect to another instance
+func (e *ScoreController) Shutdown(ctx context.Context) {
+	close(e.stopUpdater)
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second)
+	}
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, connections := range []map[int]map[*websocket.Conn]int{e.connections, e.simpleConnections} {
+		for _, eventConnections := range connections {
+			for conn := range eventConnections {
+				if err := conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+					logger.WarnContext(ctx, "Failed to send close message to websocket connection", "error", err)
 				}
-				simpleScore, err := json.Marshal(e.scoreService.GetLatestScores(eventId).GetSimpleScore())
-				if err != nil {
-					fmt.Printf("Failed to marshal simple score: %v", err)
-					continue
+				if err := conn.Close(); err != nil {
+					logger.WarnContext(ctx, "Failed to close websocket connection", "error", err)
 				}
+			}
+		}
+	}
+}
 
-				e.mu.Lock()
-				for conn, teamId := range e.connections[eventId] {
-					serializedDiff, err := json.Marshal(toScoreMapResponse(diff, teamId))
-					if err != nil {
-						fmt.Printf("Failed to marshal score diff: %v", err)
-						continue
-					}
-					if err := conn.WriteMessage(websocket.TextMessage, serializedDiff); err != nil {
-						err := conn.Close()
-						if err != nil {
-							log.Printf("Error closing websocket connection: %v", err)
-						}
-						delete(e.connections[eventId], conn)
-					}
-				}
-				for conn := range e.simpleConnections[eventId] {
-					if err := conn.WriteMessage(websocket.TextMessage, simpleScore); err != nil {
-						err := conn.Close()
-						if err != nil {
-							log.Printf("Error closing websocket connection: %v", err)
-						}
-						delete(e.simpleConnections[eventId], conn)
-					}
-				}
-				e.mu.Unlock()
+func (e *ScoreController) updateScores() {
+	events, err := e.eventService.GetAllEvents()
+	if err != nil {
+		logger.Error("Failed to fetch events for score updater", "error", err)
+		return
+	}
+	leading := e.elector.IsLeader(service.LeaderRoleScoreUpdater)
+
+	e.mu.Lock()
+	// calculate scores for events with active websocket connections
+	eventIds := utils.Keys(e.connections)
+	eventIds = utils.Uniques(append(eventIds, utils.Keys(e.simpleConnections)...))
+	e.mu.Unlock()
+	for _, event := range events {
+		connected := slices.Contains(eventIds, event.Id)
+		// the leader keeps live events up to date for the connections of the other instances
+		live := leading && (event.Phase == repository.EventPhaseRunning || event.Phase == repository.EventPhaseGracePeriod)
+		if !connected && !live {
+			continue
+		}
+		// dont update event if its final and its already cached
+		if event.GracePeriodEndTime().Before(time.Now()) && e.scoreService.GetLatestScores(event.Id) != nil {
+			continue
+		}
+
+		var diff service.ScoreMap
+		if leading {
+			diff, err = e.scoreService.GetNewDiff(event.Id)
+		} else {
+			diff, err = e.scoreService.GetCachedDiff(event.Id)
+		}
+		if err != nil || !connected {
+			continue
+		}
+		e.broadcast(event.Id, diff)
+	}
+}
+
+func (e *ScoreController) broadcast(eventId int, diff service.ScoreMap) {
+	simpleScore, err := json.Marshal(e.scoreService.GetLatestScores(eventId).GetSimpleScore())
+	if err != nil {
+		logger.Error("Failed to marshal simple score", "event_id", eventId, "error", err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for conn, teamId := range e.connections[eventId] {
+		serializedDiff, err := json.Marshal(toScoreMapResponse(diff, teamId))
+		if err != nil {
+			logger.Error("Failed to marshal score diff", "event_id", eventId, "team_id", teamId, "error", err)
+			continue
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, serializedDiff); err != nil {
+			err := conn.Close()
+			if err != nil {
+				logger.Warn("Failed to close websocket connection", "event_id", eventId, "error", err)
 			}
-			time.Sleep(5 * time.Second)
+			delete(e.connections[eventId], conn)
 		}
-	}()
+	}
+	for conn := range e.simpleConnections[eventId] {
+		if err := conn.WriteMessage(websocket.TextMessage, simpleScore); err != nil {
+			err := conn.Close()
+			if err != nil {
+				logger.Warn("Failed to close websocket connection", "event_id", eventId, "error", err)
+			}
+			delete(e.simpleConnections[eventId], conn)
+		}
+	}
 }
 
 // @id GetLatestScoresForEvent
@@ -259,6 +313,67 @@ func (e *ScoreController) getLatestScoresForEventHandler() gin.HandlerFunc {
 	}
 }
 
+// @id GetObjectiveGaps
+// @Description Fetches the planning view for a team: progress on every objective and the points gained by finishing it or improving one rank, most valuable first
+// @Tags scores
+// @Produce json
+// @Security BearerAuth
+// @Param event_id path int true "Event Id"
+// @Param team_id path int true "Team Id"
+// @Success 200 {array} ObjectiveGap
+// @Router /events/{event_id}/scores/teams/{team_id}/gaps [get]
+func (e *ScoreController) getObjectiveGapsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		teamId, err := strconv.Atoi(c.Param("team_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			return
+		}
+		gaps, err := e.scoreService.GetObjectiveGaps(event.Id, teamId)
+		if err != nil {
+			if errors.Is(err, service.ErrTeamNotInEvent) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, utils.Map(gaps, toObjectiveGapResponse))
+	}
+}
+
+type ObjectiveGap struct {
+	ObjectiveId     int    `json:"objective_id" binding:"required"`
+	Number          int    `json:"number" binding:"required"`
+	RequiredAmount  int    `json:"required_amount" binding:"required"`
+	Finished        bool   `json:"finished" binding:"required"`
+	Rank            int    `json:"rank" binding:"required"`
+	Points          int    `json:"points" binding:"required"`
+	PointsOnFinish  int    `json:"points_on_finish" binding:"required"`
+	PointsOnRankUp  int    `json:"points_on_rank_up" binding:"required"`
+	Suggested       bool   `json:"suggested" binding:"required"`
+	SuggestionExtra string `json:"suggestion_extra,omitempty"`
+}
+
+func toObjectiveGapResponse(gap *service.ObjectiveGap) *ObjectiveGap {
+	return &ObjectiveGap{
+		ObjectiveId:     gap.ObjectiveId,
+		Number:          gap.Number,
+		RequiredAmount:  gap.RequiredAmount,
+		Finished:        gap.Finished,
+		Rank:            gap.Rank,
+		Points:          gap.Points,
+		PointsOnFinish:  gap.PointsOnFinish,
+		PointsOnRankUp:  gap.PointsOnRankUp,
+		Suggested:       gap.Suggested,
+		SuggestionExtra: gap.SuggestionExtra,
+	}
+}
+
 type Completion struct {
 	PresetId  int   `json:"preset_id" binding:"required"`
 	Points    int   `json:"points" binding:"required"`
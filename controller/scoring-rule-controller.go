@@ -27,8 +27,8 @@ func setupScoringRuleController() []RouteInfo {
 	editorRoles := []repository.Permission{repository.PermissionAdmin, repository.PermissionManager, repository.PermissionObjectiveDesigner}
 	routes := []RouteInfo{
 		{Method: "GET", Path: "/events/:event_id/scoring-rules", HandlerFunc: e.getScoringRulesForEventHandler()},
-		{Method: "PUT", Path: "/events/:event_id/scoring-rules", HandlerFunc: e.createScoringRuleHandler(), Authenticated: true, RequiredRoles: editorRoles},
-		{Method: "DELETE", Path: "/events/:event_id/scoring-rules/:id", HandlerFunc: e.deleteScoringRuleHandler(), Authenticated: true, RequiredRoles: editorRoles},
+		{Method: "PUT", Path: "/events/:event_id/scoring-rules", HandlerFunc: e.createScoringRuleHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
+		{Method: "DELETE", Path: "/events/:event_id/scoring-rules/:id", HandlerFunc: e.deleteScoringRuleHandler(), Authenticated: true, RequiredEventRoles: editorRoles},
 	}
 	return routes
 }
@@ -4,6 +4,7 @@ import (
 	"bpl/client"
 	"bpl/repository"
 	"bpl/service"
+	"slices"
 	"strconv"
 	"time"
 
@@ -31,11 +32,11 @@ func setupSignupController() []RouteInfo {
 	e := NewSignupController()
 	basePath := "/events/:event_id/signups"
 	routes := []RouteInfo{
-		{Method: "GET", Path: "", HandlerFunc: e.getSignupsForEvent(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionManager}},
+		{Method: "GET", Path: "", HandlerFunc: e.getSignupsForEvent(), Authenticated: true, RequiredEventRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionManager}},
 		{Method: "GET", Path: "/self", HandlerFunc: e.getPersonalSignupHandler(), Authenticated: true},
 		{Method: "PUT", Path: "/self", HandlerFunc: e.createSignupHandler(), Authenticated: true},
 		{Method: "DELETE", Path: "/:user_id", HandlerFunc: e.deleteSignupHandler(), Authenticated: true, RequiresUserSelf: true},
-		{Method: "GET", Path: "/discord", HandlerFunc: getDiscordMembersHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionManager}},
+		{Method: "GET", Path: "/discord", HandlerFunc: getDiscordMembersHandler(), Authenticated: true, RequiredEventRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionManager}},
 	}
 	for i, route := range routes {
 		routes[i].Path = basePath + route.Path
@@ -116,7 +117,7 @@ func (e *SignupController) createSignupHandler() gin.HandlerFunc {
 			c.JSON(401, gin.H{"error": "Not authenticated"})
 			return
 		}
-		if event.ApplicationStartTime.After(time.Now()) || event.ApplicationEndTime.Before(time.Now()) {
+		if !event.SignupsOpen() {
 			c.JSON(400, gin.H{"error": "Applications are not open"})
 			return
 		}
@@ -175,6 +176,10 @@ func (e *SignupController) deleteSignupHandler() gin.HandlerFunc {
 		if event == nil {
 			return
 		}
+		if !event.SignupsOpen() && !slices.Contains(getUserRoles(c), repository.PermissionAdmin) {
+			c.JSON(400, gin.H{"error": "Applications are not open"})
+			return
+		}
 		userId, err := strconv.Atoi(c.Param("user_id"))
 		if err != nil {
 			c.JSON(400, gin.H{"error": "Invalid user ID"})
@@ -4,12 +4,12 @@ import (
 	"bpl/repository"
 	"bpl/service"
 	"bpl/utils"
-	"fmt"
 	"slices"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type SubmissionController struct {
@@ -35,8 +35,8 @@ func setupSubmissionController() []RouteInfo {
 		{Method: "GET", Path: "", HandlerFunc: e.getSubmissionsHandler()},
 		{Method: "PUT", Path: "", HandlerFunc: e.submitBountyHandler(), Authenticated: true},
 		{Method: "DELETE", Path: "/:submission_id", HandlerFunc: e.deleteSubmissionHandler(), Authenticated: true},
-		{Method: "PUT", Path: "/:submission_id/review", HandlerFunc: e.reviewSubmissionHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionSubmissionJudge}},
-		{Method: "PUT", Path: "/admin", HandlerFunc: e.setBulkSubmissionForAdmin(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionSubmissionJudge}},
+		{Method: "PUT", Path: "/:submission_id/review", HandlerFunc: e.reviewSubmissionHandler(), Authenticated: true, RequiredEventRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionSubmissionJudge}, EventRoleTeam: e.submissionTeam},
+		{Method: "PUT", Path: "/admin", HandlerFunc: e.setBulkSubmissionForAdmin(), Authenticated: true, RequiredEventRoles: []repository.Permission{repository.PermissionSubmissionJudge}},
 	}
 	for i, route := range routes {
 		routes[i].Path = baseUrl + route.Path
@@ -44,6 +44,26 @@ func setupSubmissionController() []RouteInfo {
 	return routes
 }
 
+// submissionTeam resolves the team of the submission of the request, so that judges of that team can review it
+func (e *SubmissionController) submissionTeam(c *gin.Context) (int, error) {
+	submissionId, err := strconv.Atoi(c.Param("submission_id"))
+	if err != nil {
+		return 0, err
+	}
+	submission, err := e.submissionService.GetSubmissionById(submissionId)
+	if err != nil {
+		return 0, err
+	}
+	team, err := e.teamService.GetTeamById(submission.TeamId)
+	if err != nil {
+		return 0, err
+	}
+	if team.EventId != c.MustGet("event").(*repository.Event).Id {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return team.Id, nil
+}
+
 // @id SetBulkSubmissionForAdmin
 // @Description Sets submissions for teams
 // @Tags submission
@@ -77,7 +97,7 @@ func (e *SubmissionController) setBulkSubmissionForAdmin() gin.HandlerFunc {
 		}
 		submissions, err := e.submissionService.SaveBulkSubmissions(submissionCreate.toModels(user.Id, teamLeads))
 		if err != nil {
-			fmt.Println(err)
+			logger.ErrorContext(c.Request.Context(), "Failed to save submissions", "event_id", event.Id, "error", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
@@ -181,7 +201,7 @@ func (e *SubmissionController) deleteSubmissionHandler() gin.HandlerFunc {
 			c.JSON(404, gin.H{"error": err.Error()})
 			return
 		}
-		if submission.UserId != user.Id && !slices.Contains(user.Permissions, repository.PermissionSubmissionJudge) {
+		if submission.UserId != user.Id && !slices.Contains(getTeamEventRoles(c, submission.TeamId), repository.PermissionSubmissionJudge) {
 			c.JSON(403, gin.H{"error": "You are not allowed to delete this submission"})
 			return
 		}
@@ -5,7 +5,6 @@ import (
 	"bpl/repository"
 	"bpl/service"
 	"bpl/utils"
-	"log"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -43,7 +42,7 @@ func setupTeamController() []RouteInfo {
 		{Method: "GET", Path: "", HandlerFunc: e.getTeamsHandler()},
 		{Method: "PUT", Path: "", HandlerFunc: e.createTeamHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
 		{Method: "GET", Path: "/users", HandlerFunc: e.getSortedUsersHandler(), Authenticated: true},
-		{Method: "PUT", Path: "/users", HandlerFunc: e.addUsersToTeamsHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionManager}},
+		{Method: "PUT", Path: "/users", HandlerFunc: e.addUsersToTeamsHandler(), Authenticated: true, RequiredEventRoles: []repository.Permission{repository.PermissionAdmin, repository.PermissionManager}},
 		{Method: "GET", Path: "/:team_id", HandlerFunc: e.getTeamHandler()},
 		{Method: "DELETE", Path: "/:team_id", HandlerFunc: e.deleteTeamHandler(), Authenticated: true, RequiredRoles: []repository.Permission{repository.PermissionAdmin}},
 	}
@@ -92,7 +91,7 @@ func (e *TeamController) createTeamHandler() gin.HandlerFunc {
 		if event == nil {
 			return
 		}
-		if event.Locked {
+		if event.Locked || event.TeamsFrozen() {
 			c.JSON(400, gin.H{"error": "event is locked"})
 			return
 		}
@@ -152,6 +151,14 @@ func (e *TeamController) getTeamHandler() gin.HandlerFunc {
 // @Router /events/{event_id}/teams/{team_id} [delete]
 func (e *TeamController) deleteTeamHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		event := getEvent(c)
+		if event == nil {
+			return
+		}
+		if event.Locked || event.TeamsFrozen() {
+			c.JSON(400, gin.H{"error": "event is locked"})
+			return
+		}
 		teamId, err := strconv.Atoi(c.Param("team_id"))
 		if err != nil {
 			c.JSON(400, gin.H{"error": err.Error()})
@@ -208,6 +215,10 @@ func (e *TeamController) addUsersToTeamsHandler() gin.HandlerFunc {
 		if event == nil {
 			return
 		}
+		if event.TeamsFrozen() {
+			c.JSON(400, gin.H{"error": "Teams can no longer change"})
+			return
+		}
 
 		var teamUsers []TeamUserCreate
 		if err := c.BindJSON(&teamUsers); err != nil {
@@ -223,7 +234,7 @@ func (e *TeamController) addUsersToTeamsHandler() gin.HandlerFunc {
 		func() {
 			_, err := client.NewLocalDiscordClient().AssignRoles()
 			if err != nil {
-				log.Printf("Failed to assign roles in Discord: %v", err)
+				logger.ErrorContext(c.Request.Context(), "Failed to assign roles in Discord", "event_id", event.Id, "error", err)
 			}
 		}()
 		c.Status(204)
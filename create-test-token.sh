@@ -79,10 +79,23 @@ load_env() {
 # Load environment variables from .env
 load_env
 
-# Check if JWT_SECRET environment variable is set
-if [ -z "$JWT_SECRET" ]; then
-    echo "Error: JWT_SECRET environment variable is not set"
-    echo "Make sure JWT_SECRET is defined in your .env file or environment"
+# Tokens are signed with the key JWT_SIGNING_KEY_ID from JWT_SIGNING_KEYS, or with JWT_SECRET if no keys are configured
+KEY_ID="${JWT_SIGNING_KEY_ID:-default}"
+SECRET="$JWT_SECRET"
+if [ -n "$JWT_SIGNING_KEYS" ]; then
+    SECRET=""
+    IFS=',' read -ra KEY_ARRAY <<< "$JWT_SIGNING_KEYS"
+    for entry in "${KEY_ARRAY[@]}"; do
+        if [ "${entry%%=*}" == "$KEY_ID" ]; then
+            SECRET="${entry#*=}"
+        fi
+    done
+fi
+
+# Check if a secret could be found
+if [ -z "$SECRET" ]; then
+    echo "Error: neither JWT_SIGNING_KEYS contains the key $KEY_ID nor is JWT_SECRET set"
+    echo "Make sure JWT_SECRET or JWT_SIGNING_KEYS is defined in your .env file or environment"
     exit 1
 fi
 
@@ -95,7 +108,7 @@ base64url_encode() {
 exp=$(date -d "+100 year" +%s)
 
 # Create JWT header
-header='{"alg":"HS256","typ":"JWT"}'
+header="{\"alg\":\"HS256\",\"kid\":\"$KEY_ID\",\"typ\":\"JWT\"}"
 
 # Create JWT payload with dynamic values
 if [ -n "$PERMISSIONS" ]; then
@@ -114,7 +127,10 @@ else
     permissions_json="[]"
 fi
 
-payload="{\"exp\":$exp,\"permissions\":$permissions_json,\"user_id\":$USER_ID}"
+# The token id is required, revoked tokens are looked up by it
+jti=$(openssl rand -hex 16)
+
+payload="{\"exp\":$exp,\"jti\":\"$jti\",\"permissions\":$permissions_json,\"user_id\":$USER_ID}"
 
 # Base64url encode header and payload
 encoded_header=$(base64url_encode "$header")
@@ -124,7 +140,7 @@ encoded_payload=$(base64url_encode "$payload")
 signature_input="${encoded_header}.${encoded_payload}"
 
 # Create HMAC-SHA256 signature
-signature=$(echo -n "$signature_input" | openssl dgst -sha256 -hmac "$JWT_SECRET" -binary | base64 -w 0 | tr '+/' '-_' | tr -d '=')
+signature=$(echo -n "$signature_input" | openssl dgst -sha256 -hmac "$SECRET" -binary | base64 -w 0 | tr '+/' '-_' | tr -d '=')
 # Construct the final JWT
 jwt="${signature_input}.${signature}"
 
@@ -0,0 +1,215 @@
+package cron
+
+import (
+	"bpl/client"
+	"bpl/parser"
+	"bpl/repository"
+	"bpl/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ==================== Fetch Scheduler ====================
+
+func TestFetchWeight(t *testing.T) {
+	tests := []struct {
+		name          string
+		unfinished    int
+		active        bool
+		rankProximity float64
+		want          float64
+	}{
+		{"nothing to gain", 0, false, 0, 1},
+		{"unfinished objectives", 4, false, 0, 2},
+		{"active player", 0, true, 0, 2},
+		{"close to another player", 0, false, 1, 2},
+		{"all signals", 4, true, 0.5, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, fetchWeight(tt.unfinished, tt.active, tt.rankProximity), 0.0001)
+		})
+	}
+}
+
+func playerWithExperience(userId int, experience int) *parser.PlayerUpdate {
+	player := &parser.PlayerUpdate{UserId: userId}
+	player.New.Character = &client.Character{Experience: experience}
+	return player
+}
+
+func TestRankProximities(t *testing.T) {
+	tests := []struct {
+		name    string
+		players []*parser.PlayerUpdate
+		want    map[int]float64
+	}{
+		{"no players", nil, map[int]float64{}},
+		{"single player", []*parser.PlayerUpdate{playerWithExperience(1, 1000)}, map[int]float64{1: 0}},
+		{"tied players", []*parser.PlayerUpdate{playerWithExperience(1, 1000), playerWithExperience(2, 1000)}, map[int]float64{1: 1, 2: 1}},
+		{
+			"gap of at least 5%",
+			[]*parser.PlayerUpdate{playerWithExperience(1, 1000), playerWithExperience(2, 2000)},
+			map[int]float64{1: 0, 2: 0},
+		},
+		{
+			"closest neighbour counts",
+			[]*parser.PlayerUpdate{playerWithExperience(1, 10000), playerWithExperience(2, 10250), playerWithExperience(3, 20000)},
+			map[int]float64{1: 0.5, 2: 0.5, 3: 0},
+		},
+		{
+			"players without experience are not ranked",
+			[]*parser.PlayerUpdate{playerWithExperience(1, 1000), playerWithExperience(2, 0), {UserId: 3}},
+			map[int]float64{1: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankProximities(tt.players)
+			require.Len(t, got, len(tt.want))
+			for userId, want := range tt.want {
+				assert.InDelta(t, want, got[userId], 0.02, "user %d", userId)
+			}
+		})
+	}
+}
+
+func TestUnfinishedObjectives(t *testing.T) {
+	levelObjective := &repository.Objective{Id: 1, ObjectiveType: repository.ObjectiveTypePlayer, TrackedValue: repository.TrackedValueCharacterLevel, RequiredAmount: 90}
+	atlasObjective := &repository.Objective{Id: 2, ObjectiveType: repository.ObjectiveTypePlayer, TrackedValue: repository.TrackedValueAtlasPoints, RequiredAmount: 10}
+	deathObjective := &repository.Objective{Id: 3, ObjectiveType: repository.ObjectiveTypeTeam, TrackedValue: repository.TrackedValueCharacterDeaths, RequiredAmount: 2}
+
+	newPlayer := func(userId int, teamId int, level int, deaths int) *parser.PlayerUpdate {
+		player := &parser.PlayerUpdate{UserId: userId, TeamId: teamId}
+		player.New.Character = &client.Character{Level: level}
+		player.New.Deaths = deaths
+		return player
+	}
+	players := []*parser.PlayerUpdate{newPlayer(1, 1, 95, 1), newPlayer(2, 1, 50, 1), newPlayer(3, 2, 50, 0)}
+
+	tests := []struct {
+		name       string
+		objectives []*repository.Objective
+		want       map[int]map[fetchKind]int
+	}{
+		{
+			"no objectives",
+			nil,
+			map[int]map[fetchKind]int{1: {}, 2: {}, 3: {}},
+		},
+		{
+			"player objectives by kind",
+			[]*repository.Objective{levelObjective, atlasObjective},
+			map[int]map[fetchKind]int{
+				1: {fetchLeagueAccount: 1},
+				2: {fetchCharacter: 1, fetchLeagueAccount: 1},
+				3: {fetchCharacter: 1, fetchLeagueAccount: 1},
+			},
+		},
+		{
+			"team objectives count for every member",
+			[]*repository.Objective{deathObjective},
+			map[int]map[fetchKind]int{1: {}, 2: {}, 3: {fetchCharacter: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playerChecker, err := parser.NewPlayerChecker(tt.objectives)
+			require.NoError(t, err)
+			teamChecker, err := parser.NewTeamChecker(tt.objectives)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, unfinishedObjectives(players, tt.objectives, playerChecker, teamChecker))
+		})
+	}
+}
+
+func TestFetchSchedulerNext(t *testing.T) {
+	timings := map[repository.TimingKey]time.Duration{
+		repository.CharacterNameRefetchDelay: time.Hour,
+		repository.CharacterRefetchDelay:     time.Minute,
+		repository.InactivityDuration:        time.Hour,
+	}
+	// only the character refresh is considered, since the names are fresh and PoE2 has no league accounts
+	newPlayer := func(userId int, sinceCharacterUpdate time.Duration) *parser.PlayerUpdate {
+		player := &parser.PlayerUpdate{
+			UserId:      userId,
+			Token:       "fetch-scheduler-token-" + string(rune('a'+userId)),
+			TokenExpiry: time.Now().Add(time.Hour),
+			LastActive:  time.Now(),
+		}
+		player.New.Character = &client.Character{Name: "character", Level: 10}
+		player.LastUpdateTimes.CharacterName = time.Now()
+		player.LastUpdateTimes.Character = time.Now().Add(-sinceCharacterUpdate)
+		return player
+	}
+	due := newPlayer(1, 2*time.Minute)
+	dueImportant := newPlayer(2, 2*time.Minute)
+	early := newPlayer(3, 40*time.Second)
+	fresh := newPlayer(4, 0)
+	players := []*parser.PlayerUpdate{due, dueImportant, early, fresh}
+	importance := fetchImportance{
+		unfinished:    map[int]map[fetchKind]int{dueImportant.UserId: {fetchCharacter: 4}},
+		rankProximity: map[int]float64{},
+	}
+
+	tests := []struct {
+		name                 string
+		maxRequestsPerSecond float64
+		want                 []*parser.PlayerUpdate
+	}{
+		// early refreshes are held back while the token has no requests beyond the reserve
+		{"most important first", 10, []*parser.PlayerUpdate{dueImportant, due}},
+		{"limited by the dispatch window", 0.1, []*parser.PlayerUpdate{dueImportant}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := &fetchScheduler{
+				client:      client.NewAsyncHttpClient(nil, "test", tt.maxRequestsPerSecond),
+				gameVersion: repository.PoE2,
+				recorded:    make(map[int]bool),
+			}
+			tasks := scheduler.next(players, timings, importance)
+			require.Len(t, tasks, len(tt.want))
+			for i, task := range tasks {
+				assert.Equal(t, fetchCharacter, task.kind)
+				assert.Equal(t, tt.want[i].UserId, task.player.UserId)
+			}
+			assert.Len(t, scheduler.recorded, len(players))
+
+			scheduler.next(players[:1], timings, importance)
+			assert.Equal(t, map[int]bool{due.UserId: true}, scheduler.recorded, "players that left the schedule should be forgotten")
+		})
+	}
+}
+
+// ==================== Recurring Jobs ====================
+
+type stubJobsRepository struct {
+	repository.RecurringJobsRepository
+	jobs []*repository.RecurringJob
+}
+
+func (r *stubJobsRepository) GetAllJobs() ([]*repository.RecurringJob, error) {
+	return r.jobs, nil
+}
+
+func TestSyncJobsRemovesDeletedJobs(t *testing.T) {
+	stopped := false
+	done := make(chan struct{})
+	deleted := &RecurringJob{Id: 2, JobType: repository.FetchStashChanges, done: done, Cancel: func() {
+		stopped = true
+		close(done)
+	}}
+	kept := &repository.RecurringJob{Id: 1, JobType: repository.FetchStashChanges, EndDate: time.Now().Add(time.Hour)}
+	s := &RecurringJobService{
+		jobRepository: &stubJobsRepository{jobs: []*repository.RecurringJob{kept}},
+		jobs:          map[int]*RecurringJob{deleted.Id: deleted},
+	}
+
+	require.NoError(t, s.syncJobs())
+	assert.True(t, stopped, "jobs that were deleted from the database should be stopped")
+	assert.Equal(t, []int{1}, utils.Keys(s.jobs))
+}
@@ -0,0 +1,136 @@
+package cron
+
+import (
+	"bpl/repository"
+	"bpl/service"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// the jobs that collect the data of an event while it is running and during its grace period
+var eventJobs = []repository.JobType{
+	repository.FetchStashChanges,
+	repository.EvaluateStashChanges,
+	repository.FetchCharacterData,
+	repository.FetchGuildStashes,
+}
+
+// waitForEventStart blocks until shortly after the event has started and returns false if the context is done before
+func waitForEventStart(ctx context.Context, event *repository.Event) bool {
+	return sleep(ctx, time.Until(event.EventStartTime.Add(5*time.Minute)))
+}
+
+func (s *RecurringJobService) EventLifecycleLoop(ctx context.Context) {
+	for {
+		err := s.AdvanceEventPhases(time.Now())
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to advance event phases", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// AdvanceEventPhases moves all events into the phase their schedule implies
+func (s *RecurringJobService) AdvanceEventPhases(now time.Time) error {
+	events, err := s.eventService.GetAllEvents()
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0)
+	for _, event := range events {
+		due := service.DueEventPhase(event, now)
+		if due == event.Phase {
+			continue
+		}
+		err := s.TransitionEvent(event, due)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("event %d: %w", event.Id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TransitionEvent moves the event to a later phase and performs the side effects of every phase it enters on the way.
+// A phase is only stored once its side effects succeeded, so a failed transition is retried by the lifecycle loop.
+func (s *RecurringJobService) TransitionEvent(event *repository.Event, phase repository.EventPhase) error {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	// the phase might have changed since the event was loaded
+	current, err := s.eventService.GetEventById(event.Id)
+	if err != nil {
+		return err
+	}
+	phases, err := service.EventPhaseTransitions(current.Phase, phase)
+	if err != nil {
+		return err
+	}
+	for _, next := range phases {
+		err := s.enterPhase(current, next)
+		if err != nil {
+			return fmt.Errorf("failed to enter phase %s: %w", next, err)
+		}
+		err = s.eventService.UpdatePhase(current, next)
+		if err != nil {
+			return err
+		}
+		logger.Info("Event entered phase", "event_id", current.Id, "phase", next)
+	}
+	*event = *current
+	return nil
+}
+
+func (s *RecurringJobService) enterPhase(event *repository.Event, phase repository.EventPhase) error {
+	switch phase {
+	case repository.EventPhaseRunning:
+		return s.startEventJobs(event)
+	case repository.EventPhaseFinal:
+		err := s.stopEventJobs(event)
+		if err != nil {
+			return err
+		}
+		err = s.eventService.LockEvent(event)
+		if err != nil {
+			return err
+		}
+		_, err = s.scoreService.SaveFinalScore(event.Id)
+		return err
+	}
+	return nil
+}
+
+// startEventJobs starts the data collection of the event, which keeps running until its grace period is over
+func (s *RecurringJobService) startEventJobs(event *repository.Event) error {
+	errs := make([]error, 0)
+	for _, jobType := range eventJobs {
+		err := s.StartJob(&RecurringJob{
+			JobType: jobType,
+			EventId: event.Id,
+			EndDate: event.GracePeriodEndTime(),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", jobType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stopEventJobs pauses the data collection of the event, in case the event is finished before its grace period is over
+func (s *RecurringJobService) stopEventJobs(event *repository.Event) error {
+	errs := make([]error, 0)
+	for _, job := range s.GetJobs() {
+		if job.EventId != event.Id || !job.IsLongRunning() || job.Paused {
+			continue
+		}
+		_, err := s.PauseJob(job.Id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", job.JobType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
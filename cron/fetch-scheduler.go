@@ -0,0 +1,295 @@
+package cron
+
+import (
+	"bpl/client"
+	"bpl/metrics"
+	"bpl/parser"
+	"bpl/repository"
+	"container/heap"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// fetchKind is a refresh of player data that the scheduler can dispatch
+type fetchKind string
+
+const (
+	fetchCharacterName fetchKind = "character_name"
+	fetchCharacter     fetchKind = "character"
+	fetchLeagueAccount fetchKind = "league_account"
+)
+
+var fetchKinds = []fetchKind{fetchCharacterName, fetchCharacter, fetchLeagueAccount}
+
+// the request keys of the PoE client whose rate limit policies each refresh consumes
+var fetchEndpoints = map[fetchKind]string{
+	fetchCharacterName: "ListCharacters",
+	fetchCharacter:     "GetCharacter",
+	fetchLeagueAccount: "GetLeagueAccount",
+}
+
+const (
+	// refreshes are queued once this share of their regular delay has passed and sent early if the rate limit leaves room
+	earlyFetchThreshold = 0.5
+	// requests that are kept in reserve per token and endpoint for refreshes that are due
+	earlyFetchReserve = 1
+	// at most as many refreshes are dispatched per iteration as the client can send within this window
+	fetchDispatchWindow = 5 * time.Second
+	// refreshes that never happened or that are long overdue are not ranked by staleness any further
+	maxFetchStaleness = 100.0
+)
+
+type fetchTask struct {
+	player *parser.PlayerUpdate
+	kind   fetchKind
+	// time since the last refresh relative to the regular delay, a refresh is due at 1
+	staleness float64
+	priority  float64
+}
+
+func (t *fetchTask) isDue() bool {
+	return t.staleness >= 1
+}
+
+// fetchQueue is a max heap of fetch tasks ordered by priority
+type fetchQueue []*fetchTask
+
+func (q fetchQueue) Len() int           { return len(q) }
+func (q fetchQueue) Less(i, j int) bool { return q[i].priority > q[j].priority }
+func (q fetchQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *fetchQueue) Push(x any)        { *q = append(*q, x.(*fetchTask)) }
+func (q *fetchQueue) Pop() any {
+	old := *q
+	task := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return task
+}
+
+// fetchImportance holds the signals that make refreshing a player more valuable
+type fetchImportance struct {
+	// number of unfinished objectives per user that depend on each kind of refresh
+	unfinished map[int]map[fetchKind]int
+	// how close each user's character is to the neighbouring characters on the ladder, from 0 to 1
+	rankProximity map[int]float64
+}
+
+// fetchScheduler decides which player refreshes are sent next. Refreshes are ordered by how stale and how important
+// they are and only as many are handed out as the rate limit policies of the PoE API currently allow.
+type fetchScheduler struct {
+	client      *client.AsyncHttpClient
+	gameVersion repository.GameVersion
+	// users whose data age is currently exported
+	recorded map[int]bool
+}
+
+func newFetchScheduler(poeClient *client.PoEClient, event *repository.Event) *fetchScheduler {
+	return &fetchScheduler{client: poeClient.Client, gameVersion: event.GameVersion, recorded: make(map[int]bool)}
+}
+
+// schedule returns when the refresh was last done and its regular delay, or false if it can't be done at the moment
+func (s *fetchScheduler) schedule(player *parser.PlayerUpdate, kind fetchKind, timings map[repository.TimingKey]time.Duration) (time.Time, time.Duration, bool) {
+	switch kind {
+	case fetchCharacterName:
+		return player.LastUpdateTimes.CharacterName, timings[repository.CharacterNameRefetchDelay], player.CanMakeRequests()
+	case fetchCharacter:
+		return player.LastUpdateTimes.Character, player.CharacterRefetchDelay(timings), player.CanUpdateCharacter()
+	case fetchLeagueAccount:
+		return player.LastUpdateTimes.LeagueAccount, player.LeagueAccountRefetchDelay(timings), s.gameVersion != repository.PoE2 && player.CanUpdateLeagueAccount()
+	}
+	return time.Time{}, 0, false
+}
+
+// next returns the refreshes that should be dispatched now, most important first
+func (s *fetchScheduler) next(players []*parser.PlayerUpdate, timings map[repository.TimingKey]time.Duration, importance fetchImportance) []*fetchTask {
+	queue := &fetchQueue{}
+	queued := make(map[fetchKind]int, len(fetchKinds))
+	scheduled := make(map[int]bool, len(players))
+	for _, player := range players {
+		scheduled[player.UserId] = true
+		s.recordFreshness(player)
+		for _, kind := range fetchKinds {
+			lastUpdate, delay, ok := s.schedule(player, kind, timings)
+			if !ok {
+				continue
+			}
+			staleness := maxFetchStaleness
+			if delay > 0 && !lastUpdate.IsZero() {
+				staleness = min(maxFetchStaleness, float64(time.Since(lastUpdate))/float64(delay))
+			}
+			if staleness < earlyFetchThreshold {
+				continue
+			}
+			unfinished := importance.unfinished[player.UserId][kind]
+			if kind == fetchCharacterName {
+				// a new character name is needed before any of its objectives can progress
+				unfinished = importance.unfinished[player.UserId][fetchCharacter]
+			}
+			weight := fetchWeight(unfinished, !player.IsInactive(timings), importance.rankProximity[player.UserId])
+			heap.Push(queue, &fetchTask{
+				player:    player,
+				kind:      kind,
+				staleness: staleness,
+				priority:  staleness * weight,
+			})
+			queued[kind]++
+		}
+	}
+	s.forgetPlayers(scheduled)
+	for _, kind := range fetchKinds {
+		metrics.FetchQueueGauge.WithLabelValues(string(kind)).Set(float64(queued[kind]))
+	}
+
+	limit := max(1, int(s.client.MaxRequestsPerSecond()*fetchDispatchWindow.Seconds()))
+	budgets := make(map[client.RequestKey]int)
+	tasks := make([]*fetchTask, 0, min(limit, queue.Len()))
+	for queue.Len() > 0 && len(tasks) < limit {
+		task := heap.Pop(queue).(*fetchTask)
+		key := client.RequestKey{Token: task.player.Token, Endpoint: fetchEndpoints[task.kind]}
+		remaining, ok := budgets[key]
+		if !ok {
+			remaining = s.client.RemainingRequests(key.Token, key.Endpoint)
+		}
+		if remaining <= 0 || (!task.isDue() && remaining <= earlyFetchReserve) {
+			budgets[key] = remaining
+			continue
+		}
+		budgets[key] = remaining - 1
+		tasks = append(tasks, task)
+		metrics.FetchDispatchedCounter.WithLabelValues(string(task.kind), strconv.FormatBool(task.isDue())).Inc()
+	}
+	return tasks
+}
+
+func (s *PlayerFetchingService) runFetchTask(task *fetchTask, event *repository.Event) {
+	switch task.kind {
+	case fetchCharacterName:
+		s.UpdateCharacterName(task.player, event)
+	case fetchCharacter:
+		if _, err := s.UpdateCharacter(task.player, event); err != nil {
+			logger.Error("Failed to update character", "event_id", event.Id, "user_id", task.player.UserId, "error", err)
+		}
+	case fetchLeagueAccount:
+		s.UpdateLeagueAccount(task.player, event)
+	}
+}
+
+func (s *fetchScheduler) recordFreshness(player *parser.PlayerUpdate) {
+	s.recorded[player.UserId] = true
+	userId := strconv.Itoa(player.UserId)
+	for kind, lastUpdate := range map[fetchKind]time.Time{
+		fetchCharacterName: player.LastUpdateTimes.CharacterName,
+		fetchCharacter:     player.LastUpdateTimes.Character,
+		fetchLeagueAccount: player.LastUpdateTimes.LeagueAccount,
+	} {
+		if !lastUpdate.IsZero() {
+			metrics.PlayerDataAge.WithLabelValues(userId, string(kind)).Set(time.Since(lastUpdate).Seconds())
+		}
+	}
+}
+
+// forgetPlayers removes the data age of players that are no longer scheduled, so that their series don't linger
+func (s *fetchScheduler) forgetPlayers(scheduled map[int]bool) {
+	for userId := range s.recorded {
+		if scheduled[userId] {
+			continue
+		}
+		for _, kind := range fetchKinds {
+			metrics.PlayerDataAge.DeleteLabelValues(strconv.Itoa(userId), string(kind))
+		}
+		delete(s.recorded, userId)
+	}
+}
+
+// fetchWeight favours players with unfinished objectives that depend on the refresh, players that are currently
+// playing and players that are about to overtake or be overtaken by another player
+func fetchWeight(unfinished int, active bool, rankProximity float64) float64 {
+	weight := 1 + 0.25*float64(unfinished)
+	if active {
+		weight *= 2
+	}
+	return weight * (1 + rankProximity)
+}
+
+func fetchKindForTrackedValue(trackedValue repository.TrackedValue) fetchKind {
+	if trackedValue == repository.TrackedValueAtlasPoints {
+		return fetchLeagueAccount
+	}
+	return fetchCharacter
+}
+
+// unfinishedObjectives counts the PLAYER and TEAM objectives every player has not completed yet, per kind of refresh
+// that can make progress on them
+func unfinishedObjectives(players []*parser.PlayerUpdate, objectives []*repository.Objective, playerChecker *parser.PlayerChecker, teamChecker *parser.TeamChecker) map[int]map[fetchKind]int {
+	objectivesById := make(map[int]*repository.Objective, len(objectives))
+	for _, objective := range objectives {
+		objectivesById[objective.Id] = objective
+	}
+	unfinished := make(map[int]map[fetchKind]int, len(players))
+	teams := make(map[int][]*parser.PlayerUpdate)
+	for _, player := range players {
+		unfinished[player.UserId] = make(map[fetchKind]int, len(fetchKinds))
+		teams[player.TeamId] = append(teams[player.TeamId], player)
+	}
+	for id, checker := range *playerChecker {
+		objective, ok := objectivesById[id]
+		if !ok {
+			continue
+		}
+		kind := fetchKindForTrackedValue(objective.TrackedValue)
+		for _, player := range players {
+			if checker(&player.New) < objective.RequiredAmount {
+				unfinished[player.UserId][kind]++
+			}
+		}
+	}
+	for id, checker := range *teamChecker {
+		objective, ok := objectivesById[id]
+		if !ok {
+			continue
+		}
+		kind := fetchKindForTrackedValue(objective.TrackedValue)
+		for _, teamPlayers := range teams {
+			team := make([]*parser.Player, 0, len(teamPlayers))
+			for _, player := range teamPlayers {
+				team = append(team, &player.New)
+			}
+			if checker(team) >= objective.RequiredAmount {
+				continue
+			}
+			for _, player := range teamPlayers {
+				unfinished[player.UserId][kind]++
+			}
+		}
+	}
+	return unfinished
+}
+
+// rankProximities returns how close each player's character is to the next character above or below it by experience,
+// from 0 when the gap is at least 5% of the character's experience to 1 when they are tied
+func rankProximities(players []*parser.PlayerUpdate) map[int]float64 {
+	ranked := make([]*parser.PlayerUpdate, 0, len(players))
+	for _, player := range players {
+		if player.New.Character != nil && player.New.Character.Experience > 0 {
+			ranked = append(ranked, player)
+		}
+	}
+	slices.SortFunc(ranked, func(a, b *parser.PlayerUpdate) int {
+		return b.New.Character.Experience - a.New.Character.Experience
+	})
+	proximities := make(map[int]float64, len(ranked))
+	for i, player := range ranked {
+		experience := player.New.Character.Experience
+		gap := math.MaxInt
+		if i > 0 {
+			gap = ranked[i-1].New.Character.Experience - experience
+		}
+		if i < len(ranked)-1 {
+			gap = min(gap, experience-ranked[i+1].New.Character.Experience)
+		}
+		closeGap := max(1, experience/20)
+		proximities[player.UserId] = max(0, 1-float64(gap)/float64(closeGap))
+	}
+	return proximities
+}
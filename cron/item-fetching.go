@@ -11,13 +11,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type FetchingService struct {
@@ -25,7 +26,7 @@ type FetchingService struct {
 	event                *repository.Event
 	poeClient            *client.PoEClient
 	stashChangeService   service.StashChangeService
-	stashChannel         chan repository.StashChangeMessage
+	stashChannel         chan tracedStashChange
 	oauthService         service.OauthService
 	userRepository       repository.UserRepository
 	guildStashRepository repository.GuildStashRepository
@@ -33,28 +34,25 @@ type FetchingService struct {
 	timingRepository     repository.TimingRepository
 }
 
-var (
-	fetchingService *FetchingService
-	once            sync.Once
-)
-
 func NewFetchingService(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) *FetchingService {
-	once.Do(func() {
-		stashChangeService := service.NewStashChangeService()
-		fetchingService = &FetchingService{
-			ctx:                  ctx,
-			event:                event,
-			poeClient:            poeClient,
-			stashChangeService:   stashChangeService,
-			oauthService:         service.NewOauthService(),
-			stashChannel:         make(chan repository.StashChangeMessage),
-			userRepository:       repository.NewUserRepository(),
-			guildStashRepository: repository.NewGuildStashRepository(),
-			activityRepository:   repository.NewActivityRepository(),
-			timingRepository:     repository.NewTimingRepository(),
-		}
-	})
-	return fetchingService
+	return &FetchingService{
+		ctx:                  ctx,
+		event:                event,
+		poeClient:            poeClient,
+		stashChangeService:   service.NewStashChangeService(),
+		oauthService:         service.NewOauthService(),
+		stashChannel:         make(chan tracedStashChange),
+		userRepository:       repository.NewUserRepository(),
+		guildStashRepository: repository.NewGuildStashRepository(),
+		activityRepository:   repository.NewActivityRepository(),
+		timingRepository:     repository.NewTimingRepository(),
+	}
+}
+
+// tracedStashChange hands a fetched stash change to the filter together with the trace it was fetched in
+type tracedStashChange struct {
+	ctx    context.Context
+	change repository.StashChangeMessage
 }
 
 func (f *FetchingService) GetTimings() (map[repository.TimingKey]time.Duration, error) {
@@ -62,18 +60,17 @@ func (f *FetchingService) GetTimings() (map[repository.TimingKey]time.Duration,
 }
 
 func (f *FetchingService) FetchStashChanges() error {
-	fmt.Println("Starting stash change fetch loop")
+	logger.InfoContext(f.ctx, "Starting stash change fetch loop")
 	token, err := f.oauthService.GetApplicationToken(repository.ProviderPoE)
 	if err != nil {
-		log.Printf("Failed to get PoE token: %v", err)
+		logger.ErrorContext(f.ctx, "Failed to get PoE token", "error", err)
 		return fmt.Errorf("failed to get PoE token: %w", err)
 	}
 	initialStashChange, err := f.stashChangeService.GetInitialChangeId(f.event)
-	fmt.Printf("Initial stash change ID: %s\n", initialStashChange)
 	if err != nil {
-		log.Print(err)
-		return nil
+		return fmt.Errorf("failed to get initial change id: %w", err)
 	}
+	logger.InfoContext(f.ctx, "Starting from initial change id", "change_id", initialStashChange)
 
 	changeId := initialStashChange
 	count := 0
@@ -83,32 +80,51 @@ func (f *FetchingService) FetchStashChanges() error {
 		case <-f.ctx.Done():
 			return nil
 		default:
-			response, clientErr := f.poeClient.GetPublicStashes(token, "pc", changeId)
+			ctx, span := config.Tracer().Start(f.ctx, "FetchStashChanges", trace.WithAttributes(
+				attribute.Int("event.id", f.event.Id),
+				attribute.String("change_id", changeId),
+			))
+			response, clientErr := f.poeClient.GetPublicStashes(ctx, token, "pc", changeId)
 			if clientErr != nil {
+				span.End()
 				consecutiveErrors++
 				if consecutiveErrors > 5 {
-					log.Print("Too many consecutive errors, exiting")
+					logger.ErrorContext(ctx, "Too many consecutive errors, exiting", "error", clientErr)
 					return fmt.Errorf("too many consecutive errors")
 				}
 				if clientErr.StatusCode == 429 {
-					log.Print(clientErr.ResponseHeaders)
+					logger.WarnContext(ctx, "Rate limited while fetching public stashes", "retry_after", clientErr.ResponseHeaders.Get("Retry-After"))
 					retryAfter, err := strconv.Atoi(clientErr.ResponseHeaders.Get("Retry-After"))
 					if err != nil {
 						retryAfter = 60
 					}
-					<-time.After((time.Duration(retryAfter) + 1) * time.Second)
+					if !sleep(f.ctx, (time.Duration(retryAfter)+1)*time.Second) {
+						return nil
+					}
 				} else {
-					log.Print(clientErr)
-					<-time.After(60 * time.Second)
+					logger.WarnContext(ctx, "Failed to fetch public stashes", "error", clientErr)
+					if !sleep(f.ctx, 60*time.Second) {
+						return nil
+					}
 				}
 				continue
 			}
 			consecutiveErrors = 0
+			span.SetAttributes(
+				attribute.String("next_change_id", response.NextChangeId),
+				attribute.Int("stash.count", len(response.Stashes)),
+			)
 			select {
-			case f.stashChannel <- repository.StashChangeMessage{ChangeId: changeId, NextChangeId: response.NextChangeId, Stashes: response.Stashes}:
+			case f.stashChannel <- tracedStashChange{
+				ctx:    ctx,
+				change: repository.StashChangeMessage{ChangeId: changeId, NextChangeId: response.NextChangeId, Stashes: response.Stashes},
+			}:
+				span.End()
 			case <-f.ctx.Done():
+				span.End()
 				return nil
 			}
+			addItemsProcessed(f.ctx, len(response.Stashes))
 			changeId = response.NextChangeId
 			metrics.ChangeIdGauge.Set(float64(service.ChangeIdToInt(changeId)))
 			if count%20 == 0 {
@@ -124,6 +140,7 @@ func (f *FetchingService) FetchStashChanges() error {
 
 type GuildStashFetcher struct {
 	UserId      int
+	AccountName string
 	Token       string
 	TokenExpiry time.Time
 	LastUse     time.Time
@@ -152,11 +169,21 @@ func (f *GuildStashFetchers) GetToken(stash *repository.GuildStashTab) (string,
 	return chosenFetcher.Token, nil
 }
 
+func (f *GuildStashFetchers) GetAccountName(userId int) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fetcher, exists := f.Fetchers[userId]; exists {
+		return fetcher.AccountName
+	}
+	return ""
+}
+
 func InitFetchers(users []*repository.TeamUserWithPoEToken, stashes []*repository.GuildStashTab) *GuildStashFetchers {
 	fetcherMap := make(map[int]*GuildStashFetcher)
 	for _, user := range users {
 		fetcher := &GuildStashFetcher{
 			UserId:      user.UserId,
+			AccountName: user.AccountName,
 			Token:       user.Token,
 			TokenExpiry: user.TokenExpiry,
 			LastUse:     time.Now(),
@@ -189,11 +216,16 @@ func (f *FetchingService) FilterStashChanges() error {
 	}
 	defer utils.Closer(writer)()
 
-	for stashChange := range f.stashChannel {
+	for traced := range f.stashChannel {
 		select {
 		case <-f.ctx.Done():
 			return fmt.Errorf("context canceled")
 		default:
+			stashChange := traced.change
+			ctx, span := config.Tracer().Start(traced.ctx, "FilterStashChanges", trace.WithAttributes(
+				attribute.Int("event.id", f.event.Id),
+				attribute.String("change_id", stashChange.ChangeId),
+			))
 			stashes := make([]client.PublicStashChange, 0)
 			now := time.Now()
 			for _, stash := range stashChange.Stashes {
@@ -208,14 +240,17 @@ func (f *FetchingService) FilterStashChanges() error {
 							EventId: f.event.Id,
 						})
 						if err != nil {
-							log.Printf("Failed to save activity for user %s: %v", *stash.AccountName, err)
+							logger.ErrorContext(ctx, "Failed to save activity", "account", *stash.AccountName, "error", err)
 						}
 					}
 				}
 			}
 			if len(stashes) > 0 {
-				log.Printf("Found %d stashes for change ID: %s\n", len(stashes), stashChange.ChangeId)
+				logger.InfoContext(ctx, "Found stashes of the event", "change_id", stashChange.ChangeId, "stashes", len(stashes))
 			}
+			span.SetAttributes(attribute.StringSlice("stash.ids", utils.Map(stashes, func(stash client.PublicStashChange) string {
+				return stash.Id
+			})))
 			message := repository.StashChangeMessage{
 				ChangeId:     stashChange.ChangeId,
 				NextChangeId: stashChange.NextChangeId,
@@ -226,15 +261,14 @@ func (f *FetchingService) FilterStashChanges() error {
 			// make sure that stash changes are only saved if the messages are successfully written to kafka
 			err = f.stashChangeService.SaveStashChangesConditionally(message, f.event.Id,
 				func(data []byte) error {
-					return writer.WriteMessages(context.Background(),
-						kafka.Message{
-							Value: data,
-						},
-					)
+					kafkaMessage := kafka.Message{Value: data}
+					config.InjectTraceContext(ctx, &kafkaMessage)
+					return writer.WriteMessages(context.Background(), kafkaMessage)
 				})
 			if err != nil {
-				log.Printf("Failed to save stash changes conditionally: %v", err)
+				logger.ErrorContext(ctx, "Failed to save stash changes", "change_id", stashChange.ChangeId, "error", err)
 			}
+			config.EndSpan(span, err)
 		}
 	}
 	return nil
@@ -243,24 +277,23 @@ func (f *FetchingService) FilterStashChanges() error {
 func (f *FetchingService) InitGuildStashFetching() (kafkaWriter *kafka.Writer, fetchers *GuildStashFetchers, err error) {
 	users, err := f.userRepository.GetUsersForEvent(f.event.Id)
 	if err != nil {
-		log.Printf("Failed to get users for event %d: %v", f.event.Id, err)
+		logger.ErrorContext(f.ctx, "Failed to get users", "error", err)
 		return
 	}
 	// todo: move this redundant db call
 	stashes, err := f.guildStashRepository.GetByEvent(f.event.Id)
 	if err != nil {
-		log.Printf("Failed to get stashes for event %d: %v", f.event.Id, err)
+		logger.ErrorContext(f.ctx, "Failed to get guild stashes", "error", err)
 		return
 	}
 	fetchers = InitFetchers(users, stashes)
 	err = config.CreateTopic(f.event.Id)
 	if err != nil {
-		log.Print(err)
+		logger.ErrorContext(f.ctx, "Failed to create kafka topic", "error", err)
 		return
 	}
 	kafkaWriter, err = config.GetWriter(f.event.Id)
 	if err != nil {
-		log.Print(err)
 		return nil, nil, fmt.Errorf("failed to get kafka writer: %w", err)
 	}
 	return kafkaWriter, fetchers, nil
@@ -269,21 +302,21 @@ func (f *FetchingService) InitGuildStashFetching() (kafkaWriter *kafka.Writer, f
 func (f *FetchingService) FetchGuildStashTab(tab *repository.GuildStashTab) error {
 	kafkaWriter, fetchers, err := f.InitGuildStashFetching()
 	if err != nil {
-		fmt.Printf("Failed to initialize guild stash fetching: %v\n", err)
+		logger.ErrorContext(f.ctx, "Failed to initialize guild stash fetching", "error", err)
 		return err
 	}
 	wg := sync.WaitGroup{}
 	wg.Go(func() {
 		err := f.updateGuildStash(tab, fetchers, kafkaWriter)
 		if err != nil {
-			fmt.Printf("Failed to fetch stash %s for team %d: %v\n", tab.Id, tab.TeamId, err)
+			logger.ErrorContext(f.ctx, "Failed to fetch guild stash", "team_id", tab.TeamId, "stash_id", tab.Id, "error", err)
 		}
 	})
 	for _, child := range tab.Children {
 		wg.Go(func() {
 			err := f.updateGuildStash(child, fetchers, kafkaWriter)
 			if err != nil {
-				fmt.Printf("Failed to fetch stash %s for team %d: %v\n", child.Id, child.TeamId, err)
+				logger.ErrorContext(f.ctx, "Failed to fetch guild stash", "team_id", child.TeamId, "stash_id", child.Id, "error", err)
 			}
 		})
 	}
@@ -292,14 +325,13 @@ func (f *FetchingService) FetchGuildStashTab(tab *repository.GuildStashTab) erro
 }
 
 func (f *FetchingService) AccessDeterminationLoop() {
+	if !waitForEventStart(f.ctx, f.event) {
+		return
+	}
 	for {
-		if time.Now().Before(f.event.EventStartTime.Add(5 * time.Minute)) {
-			time.Sleep(10 * time.Second)
-			continue
-		}
 		err := f.DetermineStashAccess()
 		if err != nil {
-			fmt.Printf("Failed to determine stash access: %v\n", err)
+			logger.ErrorContext(f.ctx, "Failed to determine stash access", "error", err)
 		}
 		select {
 		case <-f.ctx.Done():
@@ -417,11 +449,10 @@ func (f *FetchingService) FetchGuildStashes() error {
 	}
 	defer utils.Closer(kafkaWriter)()
 
+	if !waitForEventStart(f.ctx, f.event) {
+		return nil
+	}
 	for {
-		if time.Now().Before(f.event.EventStartTime.Add(5 * time.Minute)) {
-			time.Sleep(10 * time.Second)
-			continue
-		}
 		timings, err := f.GetTimings()
 		if err != nil {
 			return err
@@ -435,33 +466,38 @@ func (f *FetchingService) FetchGuildStashes() error {
 			if !stash.ShouldUpdate(timings) {
 				continue
 			}
-			fmt.Printf("Fetching guild stash %s for team %d\n", stash.Id, stash.TeamId)
+			logger.DebugContext(f.ctx, "Fetching guild stash", "team_id", stash.TeamId, "stash_id", stash.Id)
 			wg.Go(func() {
 				err := f.updateGuildStash(stash, fetchers, kafkaWriter)
 				if err != nil {
-					fmt.Println(err.Error())
+					logger.ErrorContext(f.ctx, "Failed to fetch guild stash", "team_id", stash.TeamId, "stash_id", stash.Id, "error", err)
 					return
 				}
+				addItemsProcessed(f.ctx, 1)
 			})
 		}
 		wg.Wait()
-		select {
-		case <-f.ctx.Done():
-			return fmt.Errorf("context canceled")
-		case <-time.After(1 * time.Second):
+		if !sleep(f.ctx, time.Second) {
+			return nil
 		}
 	}
 }
 
-func (f *FetchingService) updateGuildStash(stash *repository.GuildStashTab, fetchers *GuildStashFetchers, kafkaWriter *kafka.Writer) error {
+func (f *FetchingService) updateGuildStash(stash *repository.GuildStashTab, fetchers *GuildStashFetchers, kafkaWriter *kafka.Writer) (err error) {
+	ctx, span := config.Tracer().Start(f.ctx, "UpdateGuildStash", trace.WithAttributes(
+		attribute.Int("event.id", f.event.Id),
+		attribute.Int("team.id", stash.TeamId),
+		attribute.String("stash.id", stash.Id),
+	))
+	defer func() { config.EndSpan(span, err) }()
 	token, err := fetchers.GetToken(stash)
 	if err != nil {
 		return fmt.Errorf("no token found for team %d: %w", stash.TeamId, err)
 	}
-	response, httpError := f.poeClient.GetGuildStash(token, f.event.Name, stash.Id, stash.ParentId)
+	response, httpError := f.poeClient.GetGuildStash(ctx, token, f.event.Name, stash.Id, stash.ParentId)
 	if httpError != nil {
 		if httpError.StatusCode == 404 {
-			fmt.Printf("Stash %s not found (404), deleting from database\n", stash.Id)
+			logger.InfoContext(ctx, "Guild stash not found, deleting it", "team_id", stash.TeamId, "stash_id", stash.Id)
 			if err := f.guildStashRepository.Delete(stash.Id, stash.EventId); err != nil {
 				return fmt.Errorf("failed to delete stash %s after 404: %w", stash.Id, err)
 			}
@@ -469,6 +505,7 @@ func (f *FetchingService) updateGuildStash(stash *repository.GuildStashTab, fetc
 		}
 		return fmt.Errorf("failed to fetch guild stash %s for team %d: %d - %s", stash.Id, stash.TeamId, httpError.StatusCode, httpError.Description)
 	}
+	previousFetch := stash.LastFetch
 	stash.LastFetch = time.Now()
 	stash.Index = response.Stash.Index
 	stash.Name = response.Stash.Name
@@ -477,7 +514,7 @@ func (f *FetchingService) updateGuildStash(stash *repository.GuildStashTab, fetc
 	if response.Stash.Items != nil && response.Stash.Type == "UniqueStash" && len(*response.Stash.Items) > 0 {
 		stash.Name = parser.ItemClasses[(*response.Stash.Items)[0].BaseType]
 	}
-	err = f.updateStashItems(stash, response, kafkaWriter)
+	err = f.updateStashItems(ctx, stash, response, fetchers, previousFetch, kafkaWriter)
 	if err != nil {
 		return err
 	}
@@ -487,7 +524,8 @@ func (f *FetchingService) updateGuildStash(stash *repository.GuildStashTab, fetc
 	return f.guildStashRepository.Save(stash)
 }
 
-func (f *FetchingService) updateStashItems(stash *repository.GuildStashTab, response *client.GetGuildStashResponse, kafkaWriter *kafka.Writer) error {
+func (f *FetchingService) updateStashItems(ctx context.Context, stash *repository.GuildStashTab, response *client.GetGuildStashResponse, fetchers *GuildStashFetchers, previousFetch time.Time, kafkaWriter *kafka.Writer) error {
+	var previousItems *[]client.Item
 	if stash.Raw != "" && stash.Raw != "{}" {
 		var existingStash client.GuildStashTabGGG
 		err := json.Unmarshal([]byte(stash.Raw), &existingStash)
@@ -495,9 +533,13 @@ func (f *FetchingService) updateStashItems(stash *repository.GuildStashTab, resp
 			return fmt.Errorf("failed to unmarshal existing stash data for stash %s: %v", stash.Id, err)
 		}
 		if existingStash.GetHash() == response.Stash.GetHash() {
-			fmt.Printf("No changes for stash %s, skipping\n", stash.Id)
+			logger.DebugContext(ctx, "No changes in guild stash, skipping", "team_id", stash.TeamId, "stash_id", stash.Id)
 			return nil
 		}
+		previousItems = existingStash.Items
+		if previousItems == nil {
+			previousItems = &[]client.Item{}
+		}
 	}
 	raw, err := json.Marshal(response.Stash)
 	if err != nil {
@@ -508,22 +550,69 @@ func (f *FetchingService) updateStashItems(stash *repository.GuildStashTab, resp
 	if response.Stash.Items != nil {
 		items = *response.Stash.Items
 	}
+	// the first snapshot of a tab has nothing to compare against, so we only derive changelogs from the second fetch onwards
+	if previousItems != nil {
+		err = f.saveDerivedChangelog(stash, *previousItems, items, fetchers, previousFetch)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to derive guild stash changelog", "team_id", stash.TeamId, "stash_id", stash.Id, "error", err)
+		}
+	}
 	newStashChange := &client.PublicStashChange{
 		Id:        stash.Id,
 		Public:    true,
 		League:    &f.event.Name,
 		TeamId:    stash.TeamId,
+		Stash:     &stash.Name,
 		Items:     items,
 		StashType: stash.Type,
 	}
-	err = addGuildStashesToQueue(kafkaWriter, newStashChange)
+	err = addGuildStashesToQueue(ctx, kafkaWriter, newStashChange)
 	if err != nil {
 		return fmt.Errorf("failed to add stash change to queue for stash %s: %w", stash.Id, err)
 	}
 	return nil
 }
 
-func addGuildStashesToQueue(kafkaWriter *kafka.Writer, change *client.PublicStashChange) error {
+// saveDerivedChangelog persists the differences between two snapshots of a tab as guild stash changelog entries.
+// The acting account is guessed from the tab's users that were active since the previous fetch, since GGG doesn't expose it.
+func (f *FetchingService) saveDerivedChangelog(stash *repository.GuildStashTab, previous []client.Item, current []client.Item, fetchers *GuildStashFetchers, previousFetch time.Time) error {
+	logs := service.DiffGuildStashItems(previous, current)
+	if len(logs) == 0 {
+		return nil
+	}
+	guilds, err := f.guildStashRepository.GetGuildsForTeams([]int{stash.TeamId})
+	if err != nil {
+		return fmt.Errorf("failed to get guild for team %d: %w", stash.TeamId, err)
+	}
+	guild, found := utils.FindFirst(guilds, func(g *repository.Guild) bool {
+		return g.EventId == f.event.Id
+	})
+	if !found {
+		return fmt.Errorf("no guild registered for team %d", stash.TeamId)
+	}
+	accountName := ""
+	lastActive, err := f.activityRepository.GetLatestActiveTimestampsForUsers(f.event.Id, utils.Map(stash.UserIds, func(id int32) int { return int(id) }), previousFetch)
+	if err != nil {
+		logger.ErrorContext(f.ctx, "Failed to get activity", "team_id", stash.TeamId, "stash_id", stash.Id, "error", err)
+	}
+	latest := time.Time{}
+	for userId, timestamp := range lastActive {
+		if timestamp.After(latest) {
+			latest = timestamp
+			accountName = fetchers.GetAccountName(userId)
+		}
+	}
+	for _, entry := range logs {
+		entry.Timestamp = stash.LastFetch
+		entry.GuildId = guild.Id
+		entry.EventId = f.event.Id
+		entry.StashName = &stash.Name
+		entry.AccountName = accountName
+	}
+	return f.guildStashRepository.SaveGuildstashLogs(logs)
+}
+
+func addGuildStashesToQueue(ctx context.Context, kafkaWriter *kafka.Writer, change *client.PublicStashChange) error {
 	message, err := json.Marshal(repository.StashChangeMessage{
 		ChangeId:     "",
 		NextChangeId: "",
@@ -534,37 +623,51 @@ func addGuildStashesToQueue(kafkaWriter *kafka.Writer, change *client.PublicStas
 	if err != nil {
 		return err
 	}
-	return kafkaWriter.WriteMessages(
-		context.Background(),
-		kafka.Message{Value: message},
-	)
+	kafkaMessage := kafka.Message{Value: message}
+	config.InjectTraceContext(ctx, &kafkaMessage)
+	return kafkaWriter.WriteMessages(context.Background(), kafkaMessage)
 }
 
-func GuildStashFetchLoop(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) {
-	fetchingService := NewFetchingService(ctx, event, poeClient)
-	go func() {
-		err := fetchingService.FetchGuildStashes()
-		if err != nil {
-			fmt.Printf("Failed to fetch guild stashes: %v\n", err)
-		}
-	}()
+// GuildStashFetchLoop fetches the guild stashes of the event and determines which players can access them until the context is done
+func GuildStashFetchLoop(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) error {
+	loopCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fetchingService := NewFetchingService(loopCtx, event, poeClient)
 	go fetchingService.AccessDeterminationLoop()
+	err := fetchingService.FetchGuildStashes()
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to fetch guild stashes: %w", err)
+	}
+	return nil
 }
 
-func ItemFetchLoop(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) {
-	fmt.Println("Starting item fetch loop")
-	fetchingService := NewFetchingService(ctx, event, poeClient)
-	go func() {
-		err := fetchingService.FetchStashChanges()
-		if err != nil {
-			fmt.Printf("Failed to fetch stash changes: %v\n", err)
-		}
-	}()
-	go func() {
-		err := fetchingService.FilterStashChanges()
-		if err != nil {
-			fmt.Printf("Failed to filter stash changes: %v\n", err)
-		}
-	}()
-
+// ItemFetchLoop fetches the public stash river and forwards the changes of the event's league to kafka until the context is done
+func ItemFetchLoop(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) error {
+	logger.InfoContext(ctx, "Starting item fetch loop")
+	loopCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fetchingService := NewFetchingService(loopCtx, event, poeClient)
+	var fetchErr, filterErr error
+	wg := sync.WaitGroup{}
+	wg.Go(func() {
+		// closing the channel stops the filter once the fetcher is done
+		defer close(fetchingService.stashChannel)
+		fetchErr = fetchingService.FetchStashChanges()
+	})
+	wg.Go(func() {
+		// the fetcher would block on the channel forever if the filter stopped on its own
+		defer cancel()
+		filterErr = fetchingService.FilterStashChanges()
+	})
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if fetchErr != nil {
+		return fmt.Errorf("failed to fetch stash changes: %w", fetchErr)
+	}
+	if filterErr != nil {
+		return fmt.Errorf("failed to filter stash changes: %w", filterErr)
+	}
+	return nil
 }
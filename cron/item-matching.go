@@ -11,11 +11,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"slices"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MatchingService struct {
@@ -24,6 +25,7 @@ type MatchingService struct {
 	objectiveService          service.ObjectiveService
 	userService               service.UserService
 	uniqueItemTrackingService service.UniqueItemTrackingService
+	itemWishService           service.ItemWishService
 	lastTimestamp             *time.Time
 	event                     *repository.Event
 }
@@ -38,6 +40,7 @@ func NewMatchingService(ctx context.Context, poeClient *client.PoEClient, event
 		objectiveService:          objectiveService,
 		userService:               userService,
 		uniqueItemTrackingService: uniqueItemTrackingService,
+		itemWishService:           service.NewItemWishService(),
 		event:                     event,
 		ctx:                       ctx,
 	}
@@ -48,15 +51,51 @@ func NewMatchingService(ctx context.Context, poeClient *client.PoEClient, event
 	return matchingService, nil
 }
 
-func (m *MatchingService) GetStashChange(reader *kafka.Reader) (stashChange repository.StashChangeMessage, err error) {
-	msg, err := reader.ReadMessage(context.Background())
+// GetStashChange fetches the next stash change without committing it, so that it is read again after a restart
+// unless its matches have been saved. The message is returned whenever one was fetched, even if it cannot be parsed.
+func (m *MatchingService) GetStashChange(reader *kafka.Reader) (stashChange repository.StashChangeMessage, msg *kafka.Message, err error) {
+	fetched, err := reader.FetchMessage(m.ctx)
 	if err != nil {
-		return stashChange, err
+		return stashChange, nil, err
 	}
-	if err := json.Unmarshal(msg.Value, &stashChange); err != nil {
-		return stashChange, err
+	if err := json.Unmarshal(fetched.Value, &stashChange); err != nil {
+		return stashChange, &fetched, err
 	}
-	return stashChange, nil
+	return stashChange, &fetched, nil
+}
+
+// saveMatches persists the matches of all stash changes up to the given message and commits the message afterwards
+func (m *MatchingService) saveMatches(ctx context.Context, reader *kafka.Reader, matches []*repository.ObjectiveMatch, desyncedObjectiveIds []int, lastMessage *kafka.Message) (err error) {
+	ctx, span := config.Tracer().Start(ctx, "SaveMatches", trace.WithAttributes(
+		attribute.Int("event.id", m.event.Id),
+		attribute.Int("match.count", len(matches)),
+		attribute.IntSlice("objective.desynced_ids", desyncedObjectiveIds),
+	))
+	defer func() { config.EndSpan(span, err) }()
+	err = m.objectiveMatchService.SaveMatches(ctx, matches, desyncedObjectiveIds)
+	if err != nil {
+		return fmt.Errorf("failed to save matches: %w", err)
+	}
+	if lastMessage == nil {
+		return nil
+	}
+	// the matches are saved either way, a failed commit only means that the messages are read again after a restart
+	if err := reader.CommitMessages(ctx, *lastMessage); err != nil {
+		logger.ErrorContext(ctx, "Failed to commit stash changes", "error", err)
+	}
+	return nil
+}
+
+// drain saves the matches that are still pending when the loop is stopped. Matches of an unfinished resync are
+// dropped, the resync starts over with the next run.
+func (m *MatchingService) drain(reader *kafka.Reader, matches []*repository.ObjectiveMatch, desyncedObjectiveIds []int, lastMessage *kafka.Message, syncing bool) error {
+	if syncing || (len(matches) == 0 && lastMessage == nil) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.Env().WorkerShutdownTimeout)
+	defer cancel()
+	logger.InfoContext(m.ctx, "Saving pending matches before stopping", "matches", len(matches))
+	return m.saveMatches(ctx, reader, matches, desyncedObjectiveIds, lastMessage)
 }
 
 func (m *MatchingService) getItemMatches(
@@ -91,11 +130,17 @@ func (m *MatchingService) getItemMatches(
 			continue
 		}
 
-		fmt.Printf("Processing stash %s for team %d\n", stash.Id, teamId)
+		logger.DebugContext(m.ctx, "Processing stash", "team_id", teamId, "stash_id", stash.Id)
 		completions := make(map[int]int)
 		if stash.Items != nil {
 			if err := m.uniqueItemTrackingService.TrackUniqueItems(stash.Items, teamId, userId, m.event.Id, stashChange.Source, stashChange.Timestamp); err != nil {
-				log.Printf("Failed to track unique items for stash %s: %v", stash.Id, err)
+				logger.ErrorContext(m.ctx, "Failed to track unique items", "team_id", teamId, "stash_id", stash.Id, "error", err)
+			}
+			// replayed changes during a resync are old, so only live changes are matched against item wishes
+			if syncFinished {
+				if err := m.itemWishService.MatchStashItems(m.event.Id, teamId, &stash, stashChange.Source, stashChange.Timestamp); err != nil {
+					logger.ErrorContext(m.ctx, "Failed to match item wishes", "team_id", teamId, "stash_id", stash.Id, "error", err)
+				}
 			}
 			for _, item := range stash.Items {
 				for _, result := range itemChecker.CheckForCompletions(&item) {
@@ -140,7 +185,7 @@ func (m *MatchingService) GetReader(desyncedObjectiveIds []int) (*kafka.Reader,
 		consumer.GroupId += 1
 		err = m.objectiveMatchService.SaveKafkaConsumerId(consumer)
 		if err != nil {
-			log.Print(err)
+			logger.ErrorContext(m.ctx, "Failed to save kafka consumer", "error", err)
 		}
 	}
 
@@ -148,11 +193,10 @@ func (m *MatchingService) GetReader(desyncedObjectiveIds []int) (*kafka.Reader,
 
 }
 
-func (m *MatchingService) ProcessStashChanges(itemChecker *parser.ItemChecker, objectives []*repository.Objective) {
+func (m *MatchingService) ProcessStashChanges(itemChecker *parser.ItemChecker, objectives []*repository.Objective) error {
 	users, err := m.userService.GetUsersForEvent(m.event.Id)
 	if err != nil {
-		log.Printf("Failed to get users for event %d: %v", m.event.Id, err)
-		return
+		return fmt.Errorf("failed to get users for event %d: %w", m.event.Id, err)
 	}
 	userMap := make(map[string]*repository.TeamUserWithPoEToken)
 	teamMap := make(map[string]string)
@@ -173,8 +217,7 @@ func (m *MatchingService) ProcessStashChanges(itemChecker *parser.ItemChecker, o
 	}
 	reader, err := m.GetReader(desyncedObjectiveIds)
 	if err != nil {
-		log.Fatal(err)
-		return
+		return fmt.Errorf("failed to get kafka reader: %w", err)
 	}
 	defer utils.Closer(reader)()
 
@@ -183,60 +226,81 @@ func (m *MatchingService) ProcessStashChanges(itemChecker *parser.ItemChecker, o
 	if syncing {
 		err = m.objectiveService.StartSync(desyncedObjectiveIds)
 		if err != nil {
-			log.Printf("Failed to start sync for desynced objectives: %v", err)
-			return
+			return fmt.Errorf("failed to start sync for desynced objectives: %w", err)
 		}
 	}
 	if m.lastTimestamp == nil {
-		log.Println("No last change id found")
+		logger.InfoContext(m.ctx, "No last change id found")
 		// this means we dont have any earlier changes, so we assume there are no desynced objectives
 		err = m.objectiveService.SetSynced(desyncedObjectiveIds)
 		if err != nil {
-			log.Printf("Failed to set synced for desynced objectives: %v", err)
+			logger.ErrorContext(m.ctx, "Failed to set desynced objectives synced", "error", err)
 		}
 		desyncedObjectiveIds = make([]int, 0)
 	}
+	// the last message whose matches are pending, it is committed once they are saved
+	var lastMessage *kafka.Message
 	for {
 		select {
 		case <-m.ctx.Done():
-			return
+			return m.drain(reader, matches, desyncedObjectiveIds, lastMessage, syncing)
 		default:
-			stashChange, err := m.GetStashChange(reader)
+			stashChange, msg, err := m.GetStashChange(reader)
+			if msg != nil {
+				lastMessage = msg
+			}
 			if err != nil {
-				fmt.Printf("Failed to get stash change: %v", err)
+				if m.ctx.Err() == nil {
+					logger.ErrorContext(m.ctx, "Failed to get stash change", "error", err)
+				}
 				continue
 			}
+			// continues the trace of the fetcher that produced the message
+			ctx, span := config.Tracer().Start(config.ExtractTraceContext(m.ctx, msg), "ProcessStashChanges", trace.WithAttributes(
+				attribute.Int("event.id", m.event.Id),
+				attribute.String("change_id", stashChange.ChangeId),
+				attribute.String("source", string(stashChange.Source)),
+				attribute.Int64("kafka.offset", msg.Offset),
+				attribute.Bool("syncing", syncing),
+			))
 			if m.lastTimestamp != nil && stashChange.Timestamp.Truncate(time.Millisecond).Equal(m.lastTimestamp.Truncate(time.Millisecond)) {
-				log.Println("Sync finished")
+				logger.InfoContext(m.ctx, "Sync finished", "objective_ids", desyncedObjectiveIds)
 				// once we reach the starting change id the sync is finished
 				err = m.objectiveService.SetSynced(desyncedObjectiveIds)
 				if err != nil {
-					log.Print(err)
+					logger.ErrorContext(m.ctx, "Failed to set desynced objectives synced", "error", err)
 				}
 				syncing = false
 			}
 
-			matches = append(matches, m.getItemMatches(stashChange, userMap, teamMap, itemChecker, desyncedObjectiveIds)...)
+			newMatches := m.getItemMatches(stashChange, userMap, teamMap, itemChecker, desyncedObjectiveIds)
+			span.SetAttributes(attribute.Int("match.count", len(newMatches)))
+			matches = append(matches, newMatches...)
+			addItemsProcessed(m.ctx, 1)
 			if !syncing {
-				err = m.objectiveMatchService.SaveMatches(matches, desyncedObjectiveIds)
+				err = m.saveMatches(ctx, reader, matches, desyncedObjectiveIds, lastMessage)
+				config.EndSpan(span, err)
 				if err != nil {
-					fmt.Printf("Failed to save matches: %v", err)
+					logger.ErrorContext(ctx, "Failed to save matches", "error", err)
 					continue
 				}
 				desyncedObjectiveIds = make([]int, 0)
 				matches = make([]*repository.ObjectiveMatch, 0)
+				lastMessage = nil
+				continue
 			}
+			span.End()
 
 		}
 	}
 }
 
+// StashEvaluationLoop matches the stash changes of the event against its item objectives until the context is done
 func StashEvaluationLoop(ctx context.Context, poeClient *client.PoEClient, event *repository.Event) error {
-	fmt.Println("Starting stash evaluation loop for event", event.Name)
+	logger.InfoContext(ctx, "Starting stash evaluation loop")
 	m, err := NewMatchingService(ctx, poeClient, event)
 	if err != nil {
-		log.Fatal("Failed to create matching service:", err)
-		return err
+		return fmt.Errorf("failed to create matching service: %w", err)
 	}
 	objectives, err := m.objectiveService.GetObjectivesForEvent(event.Id)
 	if err != nil {
@@ -246,7 +310,6 @@ func StashEvaluationLoop(ctx context.Context, poeClient *client.PoEClient, event
 	if err != nil {
 		return err
 	}
-	fmt.Println("Item checker initialized with", len(objectives), "objectives")
-	go m.ProcessStashChanges(itemChecker, objectives)
-	return nil
+	logger.InfoContext(ctx, "Item checker initialized", "objectives", len(objectives))
+	return m.ProcessStashChanges(itemChecker, objectives)
 }
@@ -7,8 +7,6 @@ import (
 	"bpl/service"
 	"bpl/utils"
 	"context"
-	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -36,7 +34,7 @@ func ValidationLoop(ctx context.Context, poeClient *client.PoEClient) {
 	}
 
 	if err != nil {
-		log.Print("Failed to get objectives for event:", err)
+		logger.ErrorContext(ctx, "Failed to get objectives", "error", err)
 		return
 	}
 	objectiveMap := make(map[int]*repository.Objective)
@@ -45,18 +43,18 @@ func ValidationLoop(ctx context.Context, poeClient *client.PoEClient) {
 	}
 	itemChecker, err := parser.NewItemChecker(objectives, false)
 	if err != nil {
-		log.Print("Failed to create item checker:", err)
+		logger.ErrorContext(ctx, "Failed to create item checker", "error", err)
 		return
 	}
 
 	token, err := service.NewOauthService().GetApplicationToken(repository.ProviderPoE)
 	if err != nil {
-		log.Print("Failed to get PoE token:", err)
+		logger.ErrorContext(ctx, "Failed to get PoE token", "error", err)
 		return
 	}
 	initialStashChange, err := service.GetNinjaChangeId()
 	if err != nil {
-		log.Print("Failed to get initial stash change ID:", err)
+		logger.ErrorContext(ctx, "Failed to get initial change id", "error", err)
 		return
 	}
 	changeId := AddToChangeId(initialStashChange, -100000)
@@ -66,23 +64,27 @@ func ValidationLoop(ctx context.Context, poeClient *client.PoEClient) {
 		case <-ctx.Done():
 			return
 		default:
-			response, clientError := poeClient.GetPublicStashes(token, "pc", changeId)
+			response, clientError := poeClient.GetPublicStashes(ctx, token, "pc", changeId)
 			if clientError != nil {
 				consecutiveErrors++
 				if consecutiveErrors > 5 {
-					log.Print("Too many consecutive errors, exiting")
+					logger.ErrorContext(ctx, "Too many consecutive errors, exiting", "error", clientError)
 					return
 				}
 				if clientError.StatusCode == 429 {
-					log.Print(clientError.ResponseHeaders)
+					logger.WarnContext(ctx, "Rate limited while fetching public stashes", "retry_after", clientError.ResponseHeaders.Get("Retry-After"))
 					retryAfter, err := strconv.Atoi(clientError.ResponseHeaders.Get("Retry-After"))
 					if err != nil {
 						retryAfter = 60
 					}
-					<-time.After((time.Duration(retryAfter) + 1) * time.Second)
+					if !sleep(ctx, (time.Duration(retryAfter)+1)*time.Second) {
+						return
+					}
 				} else {
-					log.Print(clientError)
-					<-time.After(60 * time.Second)
+					logger.WarnContext(ctx, "Failed to fetch public stashes", "error", clientError)
+					if !sleep(ctx, 60*time.Second) {
+						return
+					}
 				}
 				continue
 			}
@@ -91,7 +93,7 @@ func ValidationLoop(ctx context.Context, poeClient *client.PoEClient) {
 			for _, stash := range response.Stashes {
 				for _, item := range stash.Items {
 					for _, match := range itemChecker.CheckForCompletions(&item) {
-						fmt.Printf("Item %s validated objective %s\n", item.Name, objectiveMap[match.ObjectiveId].Name)
+						logger.DebugContext(ctx, "Item validated objective", "item", item.Name, "objective", objectiveMap[match.ObjectiveId].Name)
 						validations[match.ObjectiveId] = &repository.ObjectiveValidation{
 							ObjectiveId: match.ObjectiveId,
 							Timestamp:   time.Now(),
@@ -104,11 +106,11 @@ func ValidationLoop(ctx context.Context, poeClient *client.PoEClient) {
 			if len(validations) > 0 {
 				err := objectiveMatchRepository.SaveValidations(utils.Values(validations))
 				if err != nil {
-					log.Print("Failed to save validations:", err)
+					logger.ErrorContext(ctx, "Failed to save validations", "error", err)
 					return
 				}
 			} else {
-				log.Printf("No validations found in batch %s\n", changeId)
+				logger.DebugContext(ctx, "No validations found in batch", "change_id", changeId)
 			}
 		}
 	}
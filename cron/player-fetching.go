@@ -10,18 +10,14 @@ import (
 	"bpl/utils"
 	"context"
 	"fmt"
-	"log"
+	"maps"
 	"sync"
 	"time"
 
 	"github.com/lib/pq"
 )
 
-var (
-	charQueue      = make(chan *client.Character, 2000)
-	pobQueue       = make(chan *repository.CharacterPob, 2000)
-	activeServices sync.Map // eventId int -> *PlayerFetchingService
-)
+var activeServices sync.Map // eventId int -> *PlayerFetchingService
 
 func GetActiveServiceForEvent(eventId int) (*PlayerFetchingService, bool) {
 	v, ok := activeServices.Load(eventId)
@@ -44,11 +40,42 @@ type PlayerFetchingService struct {
 	activityRepository        repository.ActivityRepository
 	itemWishService           service.ItemWishService
 	uniqueItemTrackingService service.UniqueItemTrackingService
+	pobQueueService           service.PoBQueueService
+	passiveTreeService        service.PassiveTreeService
+	levelingService           service.LevelingService
+	deathService              service.DeathService
 	timings                   map[repository.TimingKey]time.Duration
 
-	lastLadderUpdate time.Time
-	poeClient        *client.PoEClient
-	playersByUserId  map[int]*parser.PlayerUpdate
+	lastLadderUpdate   time.Time
+	lastLadderSnapshot time.Time
+	poeClient          *client.PoEClient
+	playersByUserId    map[int]*parser.PlayerUpdate
+
+	pobMu sync.Mutex
+	// latest PoB per character that was calculated since the fetch loop last picked them up
+	pobResults map[string]*repository.CharacterPob
+}
+
+func (s *PlayerFetchingService) addPoBResult(pob *repository.CharacterPob) {
+	s.pobMu.Lock()
+	defer s.pobMu.Unlock()
+	s.pobResults[pob.CharacterId] = pob
+}
+
+func (s *PlayerFetchingService) takePoBResults() map[string]*repository.CharacterPob {
+	s.pobMu.Lock()
+	defer s.pobMu.Unlock()
+	results := s.pobResults
+	s.pobResults = make(map[string]*repository.CharacterPob)
+	return results
+}
+
+// deliverPoB hands a calculated PoB to the player fetch loop of the event. Nothing is lost without a running loop,
+// since the loop loads the latest saved PoBs when it starts.
+func deliverPoB(eventId int, pob *repository.CharacterPob) {
+	if s, ok := GetActiveServiceForEvent(eventId); ok {
+		s.addPoBResult(pob)
+	}
 }
 
 func (s *PlayerFetchingService) GetPlayerByUserId(userId int) (*parser.PlayerUpdate, bool) {
@@ -76,11 +103,16 @@ func NewPlayerFetchingService(poeClient *client.PoEClient) *PlayerFetchingServic
 		oauthService:              service.NewOauthService(),
 		itemWishService:           service.NewItemWishService(),
 		uniqueItemTrackingService: service.NewUniqueItemTrackingService(),
+		pobQueueService:           service.NewPoBQueueService(),
+		passiveTreeService:        service.NewPassiveTreeService(),
+		levelingService:           service.NewLevelingService(),
+		deathService:              service.NewDeathService(),
 		timingRepository:          repository.NewTimingRepository(),
 		characterRepository:       repository.NewCharacterRepository(),
 		activityRepository:        repository.NewActivityRepository(),
 		lastLadderUpdate:          time.Now().Add(-1 * time.Hour),
 		poeClient:                 poeClient,
+		pobResults:                make(map[string]*repository.CharacterPob),
 	}
 }
 
@@ -99,12 +131,26 @@ func (s *PlayerFetchingService) UpdateCharacterName(player *parser.PlayerUpdate,
 			player.TokenExpiry = time.Now()
 			return
 		}
-		log.Printf("Error fetching characters for player %d: %v", player.UserId, err)
+		logger.Warn("Failed to fetch characters", "event_id", event.Id, "user_id", player.UserId, "error", err)
 		return
 	}
 	player.SuccessiveErrors = 0
+	if event.IsHardcore() && player.New.Character.Id != "" {
+		for _, char := range charactersResponse.Characters {
+			if char.Id == player.New.Character.Id && (char.League == nil || *char.League != event.Name) {
+				s.recordDeath(player, event)
+				break
+			}
+		}
+	}
 	for _, char := range charactersResponse.Characters {
 		if char.League != nil && *char.League == event.Name && char.Level > player.New.Character.Level {
+			if player.IsFrozen() {
+				// a new character replaces the dead one once it has a higher level, until then the frozen contributions count
+				logger.Info("Character replaces frozen character", "event_id", event.Id, "user_id", player.UserId, "character", char.Name)
+				player.New.Character = &client.Character{Id: char.Id}
+				player.New.PoB = &repository.CharacterPob{}
+			}
 			player.New.Character.Name = char.Name
 			player.New.Character.Level = char.Level
 			player.New.Character.Experience = char.Experience
@@ -114,7 +160,7 @@ func (s *PlayerFetchingService) UpdateCharacterName(player *parser.PlayerUpdate,
 }
 
 func (s *PlayerFetchingService) UpdateCharacter(player *parser.PlayerUpdate, event *repository.Event) (*client.Character, error) {
-	fmt.Println("Updating character", player.New.Character.Name)
+	logger.Debug("Updating character", "event_id", event.Id, "user_id", player.UserId, "character", player.New.Character.Name)
 	characterResponse, clientError := s.poeClient.GetCharacter(player.Token, player.New.Character.Name, event.GetRealm())
 	player.Mu.Lock()
 	defer player.Mu.Unlock()
@@ -131,9 +177,15 @@ func (s *PlayerFetchingService) UpdateCharacter(player *parser.PlayerUpdate, eve
 		}
 		return nil, fmt.Errorf("error fetching character for player %d: %v", player.UserId, clientError)
 	}
+	// characters that die in a hardcore league are moved to its parent league
+	if event.IsHardcore() && characterResponse.Character.League != nil && *characterResponse.Character.League != event.Name {
+		player.SuccessiveErrors = 0
+		s.recordDeath(player, event)
+		return characterResponse.Character, nil
+	}
 	err := s.itemWishService.UpdateItemWishFulfillment(player.TeamId, player.UserId, characterResponse.Character)
 	if err != nil {
-		log.Printf("Error updating item wish fulfillment for player %d: %v", player.UserId, err)
+		logger.Error("Failed to update item wish fulfillment", "event_id", event.Id, "user_id", player.UserId, "error", err)
 	}
 	player.SuccessiveErrors = 0
 	player.New.Character = characterResponse.Character
@@ -145,12 +197,15 @@ func (s *PlayerFetchingService) UpdateCharacter(player *parser.PlayerUpdate, eve
 		repository.UniqueItemSourceCharacter,
 		time.Now(),
 	); err != nil {
-		log.Printf("Failed to track unique items for character %s: %v", characterResponse.Character.Name, err)
+		logger.Error("Failed to track unique items", "event_id", event.Id, "user_id", player.UserId, "character", characterResponse.Character.Name, "error", err)
 	}
 	if !player.New.Character.HasSameEquipment(player.Old.Character) {
-		log.Printf("Character equipment changed for player %d, queuing for PoB processing", player.UserId)
-		charQueue <- characterResponse.Character
-		player.LastUpdateTimes.PoB = time.Now()
+		logger.Debug("Character equipment changed, queuing for PoB processing", "event_id", event.Id, "user_id", player.UserId)
+		if err := s.pobQueueService.Enqueue(event.Id, &player.UserId, characterResponse.Character); err != nil {
+			logger.Error("Failed to queue PoB calculation", "event_id", event.Id, "user_id", player.UserId, "error", err)
+		} else {
+			player.LastUpdateTimes.PoB = time.Now()
+		}
 	}
 	player.New.VoidStones = player.Old.VoidStones.Union(player.New.Character.GetVoidStones())
 	character := &repository.Character{
@@ -169,6 +224,9 @@ func (s *PlayerFetchingService) UpdateCharacter(player *parser.PlayerUpdate, eve
 	if err != nil {
 		return nil, fmt.Errorf("error saving character %s (%s) for user %d: %v", character.Name, character.Id, player.UserId, err)
 	}
+	if err := s.passiveTreeService.SaveTree(event.Id, characterResponse.Character); err != nil {
+		logger.Error("Failed to save passive tree", "event_id", event.Id, "user_id", player.UserId, "character", character.Name, "error", err)
+	}
 	return characterResponse.Character, nil
 }
 
@@ -183,11 +241,11 @@ func (s *PlayerFetchingService) UpdateLeagueAccount(player *parser.PlayerUpdate,
 	if err != nil {
 		player.SuccessiveErrors++
 		if err.StatusCode == 401 || err.StatusCode == 403 {
-			fmt.Printf("Error fetching league account for player %d: %d", player.UserId, err.StatusCode)
+			logger.Warn("Token was rejected while fetching league account", "event_id", event.Id, "user_id", player.UserId, "error", err)
 			player.TokenExpiry = time.Now()
 			return
 		}
-		log.Print(err)
+		logger.Warn("Failed to fetch league account", "event_id", event.Id, "user_id", player.UserId, "error", err)
 		return
 	}
 	player.SuccessiveErrors = 0
@@ -195,7 +253,7 @@ func (s *PlayerFetchingService) UpdateLeagueAccount(player *parser.PlayerUpdate,
 	if len(player.New.AtlasPassiveTrees) > 0 {
 		err := s.atlasService.SaveAtlasTrees(player.UserId, event.Id, player.New.AtlasPassiveTrees)
 		if err != nil {
-			fmt.Printf("Error saving atlas trees %d: %v\n", player.UserId, err)
+			logger.Error("Failed to save atlas trees", "event_id", event.Id, "user_id", player.UserId, "error", err)
 		}
 	}
 
@@ -214,13 +272,13 @@ func (s *PlayerFetchingService) UpdateLadder(players []*parser.PlayerUpdate, eve
 	} else {
 		token, err := s.oauthService.GetApplicationToken(repository.ProviderPoE)
 		if err != nil {
-			log.Printf("Error fetching application token: %v", err)
+			logger.Error("Failed to get application token", "event_id", event.Id, "error", err)
 			return
 		}
 		resp, clientError = s.poeClient.GetFullLadder(token, event.Name)
 	}
 	if clientError != nil {
-		log.Printf("Error fetching ladder: %v", clientError)
+		logger.Warn("Failed to fetch ladder", "event_id", event.Id, "error", clientError)
 		return
 	}
 
@@ -228,8 +286,11 @@ func (s *PlayerFetchingService) UpdateLadder(players []*parser.PlayerUpdate, eve
 	foundInLadder := make(map[string]bool)
 	charToUserId := map[string]int{}
 	for _, player := range players {
-		charToUpdate[player.New.Character.Name] = player
 		charToUserId[player.New.Character.Name] = player.UserId
+		if player.IsFrozen() {
+			continue
+		}
+		charToUpdate[player.New.Character.Name] = player
 	}
 
 	entriesToPersist := make([]*client.LadderEntry, 0, len(resp.Ladder.Entries))
@@ -238,6 +299,11 @@ func (s *PlayerFetchingService) UpdateLadder(players []*parser.PlayerUpdate, eve
 		if player, ok := charToUpdate[entry.Character.Name]; ok {
 			player.Mu.Lock()
 			foundInLadder[entry.Character.Name] = true
+			if event.IsHardcore() && entry.Dead != nil && *entry.Dead {
+				s.recordDeath(player, event)
+				player.Mu.Unlock()
+				continue
+			}
 			player.New.Character.Level = entry.Character.Level
 			if entry.Character.Depth != nil && entry.Character.Depth.Default != nil {
 				player.New.DelveDepth = *entry.Character.Depth.Default
@@ -250,8 +316,77 @@ func (s *PlayerFetchingService) UpdateLadder(players []*parser.PlayerUpdate, eve
 	}
 	err := s.ladderService.UpsertLadder(entriesToPersist, event.Id, charToUserId)
 	if err != nil {
-		log.Print(clientError)
+		logger.Error("Failed to save ladder", "event_id", event.Id, "error", err)
+		return
 	}
+	s.SnapshotLadder(event)
+}
+
+func (s *PlayerFetchingService) SnapshotLadder(event *repository.Event) {
+	if time.Since(s.lastLadderSnapshot) < s.timings[repository.LadderSnapshotInterval] {
+		return
+	}
+	s.lastLadderSnapshot = time.Now()
+	if err := s.ladderService.SnapshotLadder(event.Id, s.lastLadderSnapshot); err != nil {
+		logger.Error("Failed to save ladder snapshot", "event_id", event.Id, "error", err)
+	}
+	if err := s.ladderService.PruneSnapshots(event.Id, s.timings[repository.LadderSnapshotRetention]); err != nil {
+		logger.Error("Failed to prune ladder snapshots", "event_id", event.Id, "error", err)
+	}
+}
+
+// recordDeath stores the death of the player's current character and applies the death policy of the event.
+// The caller has to hold the player's lock.
+func (s *PlayerFetchingService) recordDeath(player *parser.PlayerUpdate, event *repository.Event) {
+	if player.IsFrozen() || player.New.Character.Id == "" {
+		return
+	}
+	death := &repository.CharacterDeath{
+		CharacterId: player.New.Character.Id,
+		EventId:     event.Id,
+		UserId:      player.UserId,
+		TeamId:      player.TeamId,
+		Name:        player.New.Character.Name,
+		Level:       player.New.Character.Level,
+		Ascendancy:  player.New.Character.Class,
+		Timestamp:   time.Now(),
+	}
+	if player.New.PoB != nil && player.New.PoB.Id != 0 {
+		pobId := player.New.PoB.Id
+		death.PobId = &pobId
+	}
+	if err := s.deathService.RecordDeath(death); err != nil {
+		logger.Error("Failed to record death", "event_id", event.Id, "user_id", player.UserId, "character", death.Name, "error", err)
+		return
+	}
+	logger.Info("Character died", "event_id", event.Id, "team_id", player.TeamId, "user_id", player.UserId, "character", death.Name, "level", death.Level)
+	player.ApplyDeath(event.DeathPolicy)
+}
+
+// updateLevelMilestones records the active play time for every level milestone the player reached for the first time
+func (service *PlayerFetchingService) updateLevelMilestones(player *parser.PlayerUpdate, event *repository.Event) {
+	var reached []int
+	for _, level := range repository.LevelMilestones {
+		if _, ok := player.New.ActiveTimeToLevel[level]; !ok && player.New.Character.Level >= level {
+			reached = append(reached, level)
+		}
+	}
+	if len(reached) == 0 {
+		return
+	}
+	activeTime, err := service.levelingService.GetActiveTime(player.UserId, event, time.Now())
+	if err != nil {
+		logger.Error("Failed to calculate active time", "event_id", event.Id, "user_id", player.UserId, "error", err)
+		return
+	}
+	activeTimeToLevel := maps.Clone(player.New.ActiveTimeToLevel)
+	if activeTimeToLevel == nil {
+		activeTimeToLevel = make(map[int]time.Duration, len(reached))
+	}
+	for _, level := range reached {
+		activeTimeToLevel[level] = activeTime
+	}
+	player.New.ActiveTimeToLevel = activeTimeToLevel
 }
 
 func (service *PlayerFetchingService) initPlayerUpdates(event *repository.Event) ([]*parser.PlayerUpdate, error) {
@@ -296,17 +431,43 @@ func (service *PlayerFetchingService) initPlayerUpdates(event *repository.Event)
 	for _, pob := range latestPobs {
 		pobMap[pob.CharacterId] = pob
 	}
+	activeTimesToLevel, err := service.levelingService.GetActiveTimesToLevel(event)
+	if err != nil {
+		return nil, err
+	}
+	deaths, err := service.deathService.GetDeathsForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	deathCounts := make(map[int]int)
+	deadCharacters := make(map[string]bool, len(deaths))
+	// with the FREEZE policy a player stays on the character that died last
+	frozenCharacters := make(map[int]string)
+	for _, death := range deaths {
+		deathCounts[death.UserId]++
+		deadCharacters[death.CharacterId] = true
+		if _, ok := frozenCharacters[death.UserId]; !ok && event.DeathPolicy == repository.DeathPolicyFreeze {
+			frozenCharacters[death.UserId] = death.CharacterId
+		}
+	}
 	characterMap := make(map[int]*repository.Character, len(latestCharacters))
 	voidStonesMap := make(map[int]utils.Set[string], len(latestCharacters))
 	for _, character := range latestCharacters {
 		existing := characterMap[*character.UserId]
-		if existing == nil || character.Level > existing.Level {
+		// dead characters no longer contribute, except for the frozen one until a character with a higher level replaces it
+		contributes := !deadCharacters[character.Id] || character.Id == frozenCharacters[*character.UserId]
+		if contributes && (existing == nil || character.Level > existing.Level) {
 			characterMap[*character.UserId] = character
 		}
 		voidStonesMap[*character.UserId] = voidStonesMap[*character.UserId].Union(utils.ToSet([]string(character.VoidStones)))
 	}
 
 	for _, player := range players {
+		player.New.ActiveTimeToLevel = activeTimesToLevel[player.UserId]
+		player.Old.ActiveTimeToLevel = activeTimesToLevel[player.UserId]
+		player.New.Deaths = deathCounts[player.UserId]
+		player.Old.Deaths = deathCounts[player.UserId]
+		player.FrozenCharacterId = frozenCharacters[player.UserId]
 		if character, ok := characterMap[player.UserId]; ok {
 			player.New.Character.Name = character.Name
 			player.Old.Character.Name = character.Name
@@ -337,7 +498,7 @@ func (service *PlayerFetchingService) UpdatePlayerTokens(players []*parser.Playe
 	users, err := service.userRepository.GetUsersForEvent(event.Id)
 	usermap := make(map[int]*repository.TeamUserWithPoEToken, len(users))
 	if err != nil {
-		fmt.Printf("Error fetching users for event %d: %v", event.Id, err)
+		logger.Error("Failed to get users", "event_id", event.Id, "error", err)
 		return players
 	}
 	for _, player := range players {
@@ -349,23 +510,15 @@ func (service *PlayerFetchingService) UpdatePlayerTokens(players []*parser.Playe
 	return players
 }
 
-func updateStats(character *client.Character, characterRepo repository.CharacterRepository, itemService service.ItemService) {
-	pob, export, err := client.GetPoBExport(character)
-	if err != nil {
-		metrics.PobsCalculatedErrorCounter.Inc()
-		fmt.Printf("Error fetching PoB export for character %s: %v\n", character.Name, err)
-		return
-	}
-	metrics.PobsCalculatedCounter.Inc()
+func updateStats(eventId int, character *client.Character, pob *client.PathOfBuilding, export string, statMappings []*repository.PoBStatMapping, characterRepo repository.CharacterRepository, itemService service.ItemService) error {
 	p := repository.PoBExport{}
-	err = p.FromString(export)
+	err := p.FromString(export)
 	if err != nil {
-		fmt.Printf("Error parsing PoB export for character %s: %v\n", character.Name, err)
-		return
+		return fmt.Errorf("error parsing PoB export for character %s: %w", character.Name, err)
 	}
 	itemIds, err := itemService.GetItemIds(character)
 	if err != nil {
-		fmt.Printf("Error getting item ids for character %s: %v\n", character.Name, err)
+		logger.Error("Failed to get item ids", "character", character.Name, "error", err)
 	}
 	pobEntity := &repository.CharacterPob{
 		CreatedAt:        time.Now(),
@@ -379,116 +532,161 @@ func updateStats(character *client.Character, characterRepo repository.Character
 		HighIlevelFlasks: int8(character.GetNumberOfHighIlvlFlasks()),
 	}
 	pobEntity.UpdateStats(pob)
-	pobQueue <- pobEntity
+	pobEntity.UpdateCustomStats(pob, statMappings)
+	deliverPoB(eventId, pobEntity)
 	oldPob, _ := characterRepo.GetLatestCharacterPoB(character.Id)
 	if pobEntity.HasEqualStats(oldPob) {
-		log.Printf("No changes in stats for character %s, skipping save", character.Name)
-		return
+		logger.Debug("No changes in stats, skipping save", "character", character.Name)
+		return nil
 	}
 	metrics.PobsSavedCounter.Inc()
 	err = characterRepo.SavePoB(pobEntity)
 	if err != nil {
-		log.Printf("Error saving character stats for %s: %v", character.Name, err)
+		return fmt.Errorf("error saving character stats for %s: %w", character.Name, err)
+	}
+	return nil
+}
+
+type pobWorker struct {
+	breaker         *utils.CircuitBreaker
+	pobQueueService service.PoBQueueService
+	pobStatService  service.PoBStatService
+	characterRepo   repository.CharacterRepository
+	itemService     service.ItemService
+}
+
+func (w *pobWorker) process(job *repository.PoBJob) {
+	character := job.GetCharacter()
+	statMappings, err := w.pobStatService.GetMappingsForEvent(job.EventId)
+	if err != nil {
+		logger.Error("Failed to get PoB stat mappings", "event_id", job.EventId, "error", err)
+	}
+	pob, export, err := client.GetPoBExport(character)
+	if err != nil {
+		metrics.PobsCalculatedErrorCounter.Inc()
+		w.breaker.Failure()
+	} else {
+		metrics.PobsCalculatedCounter.Inc()
+		w.breaker.Success()
+		err = updateStats(job.EventId, character, pob, export, statMappings, w.characterRepo, w.itemService)
+	}
+	if err != nil {
+		logger.Warn("Failed to calculate PoB", "event_id", job.EventId, "character", character.Name, "attempt", job.Attempts+1, "error", err)
+		if err := w.pobQueueService.FailJob(job, err); err != nil {
+			logger.Error("Failed to update failed PoB job", "event_id", job.EventId, "character", character.Name, "error", err)
+		}
+		return
+	}
+	if err := w.pobQueueService.CompleteJob(job); err != nil {
+		logger.Error("Failed to complete PoB job", "event_id", job.EventId, "character", character.Name, "error", err)
 	}
 }
 
 func PlayerStatsLoop(ctx context.Context) {
-	characterRepo := repository.NewCharacterRepository()
-	itemService := service.NewItemService()
+	pobQueueService := service.NewPoBQueueService()
+	// stop hammering the pob server after successive failures and probe it with a single job once a minute
+	breaker := utils.NewCircuitBreaker(5, time.Minute)
+	worker := &pobWorker{
+		breaker:         breaker,
+		pobQueueService: pobQueueService,
+		pobStatService:  service.NewPoBStatService(),
+		characterRepo:   repository.NewCharacterRepository(),
+		itemService:     service.NewItemService(),
+	}
 
-	// make sure that only 4 goroutines are running at the same time
+	// make sure that only as many calculations as there are pob replicas are running at the same time
 	semaphore := make(chan struct{}, config.Env().NumberOfPoBReplicas)
+	// let the claimed calculations finish before returning, so that they are not left behind as claimed
+	defer func() {
+		for range cap(semaphore) {
+			semaphore <- struct{}{}
+		}
+	}()
 	for {
-		select {
-		case <-ctx.Done():
+		if !sleep(ctx, time.Second) {
 			return
-		default:
-			entry, ok := <-charQueue
-			metrics.PobQueueGauge.Set(float64(len(charQueue)))
-			if !ok {
-				log.Println("PoB queue closed, stopping player stats loop")
-				return
+		}
+		if counts, err := pobQueueService.CountJobsByStatus(); err == nil {
+			metrics.PobQueueGauge.Set(float64(counts[repository.PoBJobStatusPending]))
+		}
+		limit := cap(semaphore) - len(semaphore)
+		if limit == 0 {
+			continue
+		}
+		trial := breaker.IsOpen()
+		if trial {
+			if !breaker.Allow() {
+				continue
 			}
+			limit = 1
+		}
+		jobs, err := pobQueueService.ClaimJobs(limit)
+		if err != nil || len(jobs) == 0 {
+			if err != nil {
+				logger.ErrorContext(ctx, "Failed to claim PoB jobs", "error", err)
+			}
+			if trial {
+				breaker.CancelTrial()
+			}
+			continue
+		}
+		for _, job := range jobs {
 			semaphore <- struct{}{}
-			go func(character *client.Character) {
+			go func(job *repository.PoBJob) {
 				defer func() { <-semaphore }() // Release the slot when done
-				updateStats(character, characterRepo, itemService)
-			}(entry)
-		}
-	}
-}
-func drainStatQueue() map[string]*repository.CharacterPob {
-	pobMap := make(map[string]*repository.CharacterPob)
-	for {
-		select {
-		case pob := <-pobQueue:
-			pobMap[pob.CharacterId] = pob
-		default:
-			return pobMap
+				worker.process(job)
+			}(job)
 		}
 	}
 }
 
-func PlayerFetchLoop(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) {
+// PlayerFetchLoop refreshes the characters of the event's players and checks them against the objectives until the context is done
+func PlayerFetchLoop(ctx context.Context, event *repository.Event, poeClient *client.PoEClient) error {
 	service := NewPlayerFetchingService(poeClient)
 	players, err := service.initPlayerUpdates(event)
 	if err != nil {
-		log.Print(err)
-		return
+		return fmt.Errorf("failed to initialize player updates: %w", err)
 	}
 	objectives, err := service.objectiveService.GetObjectivesForEvent(event.Id)
 	if err != nil {
-		log.Print(err)
-		return
+		return fmt.Errorf("failed to get objectives: %w", err)
 	}
 	playerChecker, err := parser.NewPlayerChecker(objectives)
 	if err != nil {
-		log.Print(err)
-		return
+		return fmt.Errorf("failed to create player checker: %w", err)
 	}
 	teamChecker, err := parser.NewTeamChecker(objectives)
 	if err != nil {
-		log.Print(err)
-		return
+		return fmt.Errorf("failed to create team checker: %w", err)
 	}
+	scheduler := newFetchScheduler(poeClient, event)
+	defer scheduler.forgetPlayers(nil)
 	activeServices.Store(event.Id, service)
 	defer activeServices.Delete(event.Id)
-	fmt.Printf("Starting PlayerFetchLoop for event: %s with %d players\n", event.Name, len(players))
+	logger.InfoContext(ctx, "Starting player fetch loop", "players", len(players))
+	if !waitForEventStart(ctx, event) {
+		return nil
+	}
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
-			if time.Now().Before(event.EventStartTime.Add(5 * time.Minute)) {
-				time.Sleep(10 * time.Second)
-				continue
-			}
 			err := service.ReloadTimings()
 			if err != nil {
-				log.Print(err)
-				return
+				return fmt.Errorf("failed to reload timings: %w", err)
 			}
 
+			importance := fetchImportance{
+				unfinished:    unfinishedObjectives(players, objectives, playerChecker, teamChecker),
+				rankProximity: rankProximities(players),
+			}
 			wg := sync.WaitGroup{}
-			for _, player := range players {
-				if player.ShouldUpdateCharacterName(service.timings) {
-					wg.Go(func() {
-						service.UpdateCharacterName(player, event)
-					})
-				}
-				if player.ShouldUpdateCharacter(service.timings) {
-					wg.Go(func() {
-						_, err := service.UpdateCharacter(player, event)
-						if err != nil {
-							fmt.Printf("Error updating character for player %d: %v\n", player.UserId, err)
-						}
-					})
-				}
-				if player.ShouldUpdateLeagueAccount(service.timings) {
-					wg.Go(func() {
-						service.UpdateLeagueAccount(player, event)
-					})
-				}
+			tasks := scheduler.next(players, service.timings, importance)
+			for _, task := range tasks {
+				wg.Go(func() {
+					service.runFetchTask(task, event)
+				})
 			}
 			if service.shouldUpdateLadder(service.timings) {
 				wg.Go(func() {
@@ -496,11 +694,12 @@ func PlayerFetchLoop(ctx context.Context, event *repository.Event, poeClient *cl
 				})
 			}
 			wg.Wait()
+			addItemsProcessed(ctx, len(tasks))
 
-			pobMap := drainStatQueue()
+			pobMap := service.takePoBResults()
 			for _, player := range players {
 				player.Mu.Lock()
-				if pob, ok := pobMap[player.New.Character.Id]; ok {
+				if pob, ok := pobMap[player.New.Character.Id]; ok && !player.IsFrozen() {
 					player.New.PoB = pob
 				}
 				if player.New.Character.Experience != player.Old.Character.Experience {
@@ -511,8 +710,9 @@ func PlayerFetchLoop(ctx context.Context, event *repository.Event, poeClient *cl
 						EventId: event.Id,
 					})
 					if err != nil {
-						fmt.Printf("Error saving activity for player %d: %v\n", player.UserId, err)
+						logger.ErrorContext(ctx, "Failed to save activity", "user_id", player.UserId, "error", err)
 					}
+					service.updateLevelMilestones(player, event)
 				}
 				player.Mu.Unlock()
 			}
@@ -524,13 +724,14 @@ func PlayerFetchLoop(ctx context.Context, event *repository.Event, poeClient *cl
 				teamPlayers := utils.Filter(players, func(player *parser.PlayerUpdate) bool {
 					return player.TeamId == team.Id
 				})
-				fmt.Printf("Checking team objectives for team %d with %d players\n", team.Id, len(teamPlayers))
+				logger.DebugContext(ctx, "Checking team objectives", "team_id", team.Id, "players", len(teamPlayers))
 				teamMatches := service.GetTeamMatches(teamPlayers, teamChecker)
 				matches = append(matches, teamMatches...)
 			}
-			err = service.objectiveMatchService.SaveMatches(matches, []int{})
+			// most checks return the same numbers as in the previous tick, only changes are persisted
+			err = service.objectiveMatchService.SaveChangedMatches(matches, objectives)
 			if err != nil {
-				log.Print(err)
+				logger.ErrorContext(ctx, "Failed to save matches", "error", err)
 			}
 			for _, player := range players {
 				player.Mu.Lock()
@@ -5,164 +5,606 @@ import (
 	"bpl/config"
 	"bpl/repository"
 	"bpl/service"
+	"bpl/utils"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	jobRestartBaseBackoff = 10 * time.Second
+	jobRestartMaxBackoff  = 10 * time.Minute
+	// how often the jobs are reloaded from the database to pick up changes made through other instances
+	jobSyncInterval = 10 * time.Second
+)
+
+var logger = config.Logger("cron")
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobRunning   = errors.New("job is already running")
+	ErrJobNotActive = errors.New("job is paused or has ended")
+)
+
+// long running jobs are loops that are restarted whenever they stop before the job ends,
+// all other jobs run to completion at every tick of their schedule
+var longRunningJobs = []repository.JobType{
+	repository.FetchStashChanges,
+	repository.EvaluateStashChanges,
+	repository.FetchCharacterData,
+	repository.FetchGuildStashes,
+}
+
 type RecurringJob struct {
+	Id                       int                `json:"id" binding:"required"`
 	JobType                  repository.JobType `json:"job_type" binding:"required"`
 	SleepAfterEachRunSeconds int                `json:"sleep_after_each_run_seconds" binding:"required"`
-	Cancel                   context.CancelFunc `json:"-"`
+	Schedule                 *string            `json:"schedule"`
 	EndDate                  time.Time          `json:"end_date" binding:"required"`
 	EventId                  int                `json:"event_id" binding:"required"`
+	Paused                   bool               `json:"paused" binding:"required"`
+	Running                  bool               `json:"running" binding:"required"`
+	ConsecutiveFailures      int                `json:"consecutive_failures" binding:"required"`
+	NextRun                  *time.Time         `json:"next_run"`
+	Cancel                   context.CancelFunc `json:"-"`
+
+	schedule           *utils.CronSchedule
+	triggerRequestedAt *time.Time
+	trigger            chan struct{}
+	done               chan struct{}
+}
+
+func (job *RecurringJob) IsLongRunning() bool {
+	return slices.Contains(longRunningJobs, job.JobType)
+}
+
+// Validate checks the schedule of the job and parses its cron expression
+func (job *RecurringJob) Validate() error {
+	if job.Schedule != nil {
+		if job.IsLongRunning() {
+			return fmt.Errorf("%s runs continuously and cannot have a schedule", job.JobType)
+		}
+		schedule, err := utils.ParseCronSchedule(*job.Schedule)
+		if err != nil {
+			return err
+		}
+		job.schedule = schedule
+		return nil
+	}
+	if !job.IsLongRunning() && job.SleepAfterEachRunSeconds <= 0 {
+		return fmt.Errorf("%s needs a schedule or a sleep after each run", job.JobType)
+	}
+	return nil
+}
+
+func (job *RecurringJob) isActive(now time.Time) bool {
+	return !job.Paused && job.EndDate.After(now)
+}
+
+// sameSettings returns true if the other job can keep running under the supervisor of this one
+func (job *RecurringJob) sameSettings(other *RecurringJob) bool {
+	return job.JobType == other.JobType &&
+		job.EventId == other.EventId &&
+		job.SleepAfterEachRunSeconds == other.SleepAfterEachRunSeconds &&
+		job.Paused == other.Paused &&
+		job.EndDate.Equal(other.EndDate) &&
+		(job.Schedule == nil) == (other.Schedule == nil) &&
+		(job.Schedule == nil || *job.Schedule == *other.Schedule)
+}
+
+// untilNextRun returns how long a scheduled job waits before its next run, or false if the schedule never fires again
+func (job *RecurringJob) untilNextRun(now time.Time, firstRun bool) (time.Duration, bool) {
+	if job.schedule != nil {
+		next := job.schedule.Next(now)
+		return next.Sub(now), !next.IsZero()
+	}
+	if firstRun {
+		return 0, true
+	}
+	return time.Duration(job.SleepAfterEachRunSeconds) * time.Second, true
+}
+
+type itemsProcessedKey struct{}
+
+// addItemsProcessed adds to the item count of the job run that the context belongs to, if any
+func addItemsProcessed(ctx context.Context, n int) {
+	if counter, ok := ctx.Value(itemsProcessedKey{}).(*atomic.Int64); ok {
+		counter.Add(int64(n))
+	}
+}
+
+// sleep waits for the duration and returns false if the context is done before
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
 }
 
 type RecurringJobService struct {
-	objectiveRepository repository.ObjectiveRepository
-	eventService        service.EventService
-	oauthService        service.OauthService
-	poeClient           *client.PoEClient
-	jobRepository       repository.RecurringJobsRepository
-	Jobs                map[repository.JobType]*RecurringJob
+	objectiveRepository   repository.ObjectiveRepository
+	eventService          service.EventService
+	oauthService          service.OauthService
+	objectiveMatchService service.ObjectiveMatchService
+	scoreService          service.ScoreService
+	poeClient             *client.PoEClient
+	jobRepository         repository.RecurringJobsRepository
+	elector               *service.LeaderElector
+	mu                    sync.Mutex
+	jobs                  map[int]*RecurringJob
+	// only the leader of the recurring jobs role starts the jobs, all other instances mirror them from the database
+	leading bool
+	// set while the sync loop of a worker keeps the jobs up to date, api instances reload them when they are read
+	syncing     atomic.Bool
+	syncMu      sync.Mutex
+	lifecycleMu sync.Mutex
 }
 
+// NewRecurringJobService loads the jobs from the database. The jobs are kept in sync and run only on instances
+// that have called StartLongRunningJobs, and only while they are elected to lead them.
 func NewRecurringJobService(poeClient *client.PoEClient) *RecurringJobService {
-	eventService := service.NewEventService()
-
 	s := &RecurringJobService{
-		objectiveRepository: repository.NewObjectiveRepository(),
-		jobRepository:       repository.NewRecurringJobsRepository(),
-		oauthService:        service.NewOauthService(),
-		eventService:        eventService,
-		poeClient:           poeClient,
-		Jobs:                make(map[repository.JobType]*RecurringJob),
+		objectiveRepository:   repository.NewObjectiveRepository(),
+		jobRepository:         repository.NewRecurringJobsRepository(),
+		oauthService:          service.NewOauthService(),
+		objectiveMatchService: service.NewObjectiveMatchService(),
+		scoreService:          service.NewScoreService(poeClient),
+		eventService:          service.NewEventService(),
+		poeClient:             poeClient,
+		elector:               service.NewLeaderElector(),
+		jobs:                  make(map[int]*RecurringJob),
 	}
 
-	jobs, err := s.InitializeJobs()
+	err := s.syncJobs()
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("Failed to load jobs", "error", err)
+		os.Exit(1)
 	}
-	s.StartLongRunningJobs()
-	s.Jobs = jobs
 	return s
 }
 
-func (s *RecurringJobService) StartLongRunningJobs() {
+// StartLongRunningJobs keeps the jobs in sync with the database until the context is done and campaigns for the
+// background roles of the worker. The roles stop when the leader elector shuts down.
+func (s *RecurringJobService) StartLongRunningJobs(ctx context.Context) {
+	s.syncing.Store(true)
+	go s.syncLoop(ctx)
 	if config.Env().RefreshPoETokens {
 		// make sure to only run this on the server
-		go s.oauthService.RefreshPoETokensLoop(context.Background(), time.Duration(10)*time.Minute)
+		s.elector.RunAsLeader(service.LeaderRolePoETokenRefresh, func(ctx context.Context) {
+			s.oauthService.RefreshPoETokensLoop(ctx, time.Duration(10)*time.Minute)
+		})
+	}
+	s.elector.RunAsLeader(service.LeaderRoleRecurringJobs, s.lead)
+	s.elector.RunAsLeader(service.LeaderRoleTokenCleanup, func(ctx context.Context) {
+		service.NewTokenService().DeleteExpiredTokensLoop(ctx, time.Hour)
+	})
+	if config.Env().RateLimitStore == "postgres" {
+		s.elector.RunAsLeader(service.LeaderRoleRateLimitPrune, func(ctx context.Context) {
+			pruneRateLimitRequestsLoop(ctx, repository.NewRateLimitRepository())
+		})
 	}
-	go PlayerStatsLoop(context.Background())
 }
 
-func (s *RecurringJobService) InitializeJobs() (map[repository.JobType]*RecurringJob, error) {
-	jobs := make(map[repository.JobType]*RecurringJob)
+// pruneRateLimitRequestsLoop deletes the requests that no policy counts anymore, outside of the reservations of requests
+func pruneRateLimitRequestsLoop(ctx context.Context, rateLimitRepository repository.RateLimitRepository) {
+	for sleep(ctx, time.Minute) {
+		deleted, err := rateLimitRepository.DeleteExpiredRequests(time.Now())
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to prune rate limit requests", "error", err)
+			continue
+		}
+		logger.DebugContext(ctx, "Pruned rate limit requests", "deleted", deleted)
+	}
+}
+
+// lead runs the jobs and the loops that orchestrate them for as long as this instance is the leader
+func (s *RecurringJobService) lead(ctx context.Context) {
+	// runs that were still going belong to a previous leader that is gone, they can never finish
+	_, err := s.jobRepository.FailUnfinishedRuns("interrupted by a change of leader")
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to fail unfinished runs", "error", err)
+	}
+	s.mu.Lock()
+	s.leading = true
+	s.mu.Unlock()
+	if err := s.syncJobs(); err != nil {
+		logger.ErrorContext(ctx, "Failed to sync jobs", "error", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { PlayerStatsLoop(ctx) })
+	wg.Go(func() { s.EventLifecycleLoop(ctx) })
+	<-ctx.Done()
+
+	s.syncMu.Lock()
+	s.mu.Lock()
+	s.leading = false
+	jobs := slices.Collect(maps.Values(s.jobs))
+	s.mu.Unlock()
+	for _, job := range jobs {
+		s.stop(job)
+	}
+	s.syncMu.Unlock()
+	wg.Wait()
+}
+
+func (s *RecurringJobService) syncLoop(ctx context.Context) {
+	defer s.syncing.Store(false)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobSyncInterval):
+		}
+		if err := s.syncJobs(); err != nil {
+			logger.ErrorContext(ctx, "Failed to sync jobs", "error", err)
+		}
+	}
+}
+
+// syncJobs brings the local jobs in line with the database. Jobs whose settings changed are restarted, jobs that
+// were deleted are stopped and trigger requests from other instances are passed on, as long as this instance is the leader.
+func (s *RecurringJobService) syncJobs() error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
 	repoJobs, err := s.jobRepository.GetAllJobs()
 	if err != nil {
-		return jobs, err
+		return err
 	}
-	for _, job := range repoJobs {
-		jobs[job.JobType] = &RecurringJob{
-			JobType:                  job.JobType,
-			SleepAfterEachRunSeconds: job.SleepAfterEachRunSeconds,
-			EndDate:                  job.EndDate,
-			EventId:                  job.EventId,
+	s.removeDeletedJobs(repoJobs)
+	for _, repoJob := range repoJobs {
+		job := &RecurringJob{
+			Id:                       repoJob.Id,
+			JobType:                  repoJob.JobType,
+			SleepAfterEachRunSeconds: repoJob.SleepAfterEachRunSeconds,
+			Schedule:                 repoJob.Schedule,
+			EndDate:                  repoJob.EndDate,
+			EventId:                  repoJob.EventId,
+			Paused:                   repoJob.Paused,
+			triggerRequestedAt:       repoJob.TriggerRequestedAt,
 		}
-		serviceJob := jobs[job.JobType]
-		if job.EndDate.Before(time.Now()) {
+		if err := job.Validate(); err != nil {
+			logger.Warn("Skipping invalid job", "job_id", job.Id, "error", err)
 			continue
 		}
-		err := s.StartJob(serviceJob)
-		if err != nil {
-			fmt.Println(err)
-			if serviceJob.Cancel != nil {
-				serviceJob.Cancel()
+		s.mu.Lock()
+		existing := s.jobs[job.Id]
+		unchanged := existing != nil && existing.sameSettings(job)
+		s.mu.Unlock()
+		if existing != nil && !unchanged {
+			s.stop(existing)
+		}
+
+		s.mu.Lock()
+		if unchanged {
+			triggered := job.triggerRequestedAt != nil &&
+				(existing.triggerRequestedAt == nil || job.triggerRequestedAt.After(*existing.triggerRequestedAt))
+			existing.triggerRequestedAt = job.triggerRequestedAt
+			job = existing
+			if triggered && s.leading && job.done != nil {
+				select {
+				case job.trigger <- struct{}{}:
+				default:
+				}
 			}
-			jobs[job.JobType] = nil
 		}
+		s.jobs[job.Id] = job
+		if s.leading && job.isActive(time.Now()) && job.done == nil {
+			s.start(job)
+		}
+		s.mu.Unlock()
 	}
-	return jobs, nil
+	return nil
 }
 
-func (s *RecurringJobService) StartJob(job *RecurringJob) error {
-	existingJob, ok := s.Jobs[job.JobType]
-	if ok {
-		if existingJob.Cancel != nil {
-			existingJob.Cancel()
+// removeDeletedJobs stops and forgets the local jobs that are no longer in the database, the caller has to hold the sync lock
+func (s *RecurringJobService) removeDeletedJobs(repoJobs []*repository.RecurringJob) {
+	ids := make(map[int]bool, len(repoJobs))
+	for _, repoJob := range repoJobs {
+		ids[repoJob.Id] = true
+	}
+	s.mu.Lock()
+	deleted := make([]*RecurringJob, 0)
+	for id, job := range s.jobs {
+		if !ids[id] {
+			deleted = append(deleted, job)
+			delete(s.jobs, id)
 		}
 	}
-	err := s.jobRepository.CreateRecurringJob(&repository.RecurringJob{
+	s.mu.Unlock()
+	for _, job := range deleted {
+		s.stop(job)
+	}
+}
+
+// refresh reloads the jobs of instances that do not keep them in sync in the background
+func (s *RecurringJobService) refresh() {
+	if s.syncing.Load() {
+		return
+	}
+	if err := s.syncJobs(); err != nil {
+		logger.Error("Failed to sync jobs", "error", err)
+	}
+}
+
+// GetJobs returns a snapshot of all jobs ordered by id. Only the leader knows whether a job is currently running.
+func (s *RecurringJobService) GetJobs() []*RecurringJob {
+	s.refresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*RecurringJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobCopy := *job
+		jobs = append(jobs, &jobCopy)
+	}
+	slices.SortFunc(jobs, func(a, b *RecurringJob) int { return a.Id - b.Id })
+	return jobs
+}
+
+func (s *RecurringJobService) GetJob(jobId int) (*RecurringJob, error) {
+	s.refresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[jobId]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
+func (s *RecurringJobService) GetRuns(jobId int, limit int) ([]*repository.RecurringJobRun, error) {
+	if _, err := s.GetJob(jobId); err != nil {
+		return nil, err
+	}
+	return s.jobRepository.GetRuns(jobId, limit)
+}
+
+// IsLeader returns true if the jobs are run by this instance
+func (s *RecurringJobService) IsLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leading
+}
+
+// StartJob persists the job and starts it on the leader. An existing job of the same type for the same event is replaced.
+func (s *RecurringJobService) StartJob(job *RecurringJob) error {
+	if err := job.Validate(); err != nil {
+		return err
+	}
+	repoJob := &repository.RecurringJob{
 		JobType:                  job.JobType,
 		SleepAfterEachRunSeconds: job.SleepAfterEachRunSeconds,
+		Schedule:                 job.Schedule,
+		Paused:                   job.Paused,
 		EndDate:                  job.EndDate,
 		EventId:                  job.EventId,
-	})
+	}
+	err := s.jobRepository.SaveRecurringJob(repoJob)
 	if err != nil {
 		return err
 	}
-	s.Jobs[job.JobType] = job
+	job.Id = repoJob.Id
+	return s.syncJobs()
+}
 
-	switch job.JobType {
-	case repository.FetchStashChanges:
-		return s.FetchStashChanges(job)
-	case repository.EvaluateStashChanges:
-		return s.EvaluateStashChanges(job)
-	case repository.FetchCharacterData:
-		return s.FetchCharacterData(job)
-	case repository.FetchGuildStashes:
-		return s.FetchGuildStashes(job)
+func (s *RecurringJobService) PauseJob(jobId int) (*RecurringJob, error) {
+	return s.setPaused(jobId, true)
+}
+
+func (s *RecurringJobService) ResumeJob(jobId int) (*RecurringJob, error) {
+	return s.setPaused(jobId, false)
+}
+
+// TriggerJob starts the next run of the job immediately instead of waiting for its schedule or restart backoff.
+// On instances other than the leader the trigger is requested through the database and picked up with the next sync.
+func (s *RecurringJobService) TriggerJob(jobId int) (*RecurringJob, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[jobId]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrJobNotFound
+	}
+	if !job.isActive(time.Now()) {
+		s.mu.Unlock()
+		return nil, ErrJobNotActive
+	}
+	if !s.leading {
+		s.mu.Unlock()
+		if err := s.jobRepository.RequestTrigger(jobId); err != nil {
+			return nil, err
+		}
+		return s.GetJob(jobId)
+	}
+	if job.done == nil {
+		s.mu.Unlock()
+		return nil, ErrJobNotActive
+	}
+	if job.Running {
+		s.mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	select {
+	case job.trigger <- struct{}{}:
 	default:
-		return fmt.Errorf("invalid job type")
 	}
+	s.mu.Unlock()
+	return s.GetJob(jobId)
 }
 
-func (s *RecurringJobService) EvaluateStashChanges(job *RecurringJob) error {
-
-	event, err := s.eventService.GetEventById(job.EventId, "Teams")
+func (s *RecurringJobService) setPaused(jobId int, paused bool) (*RecurringJob, error) {
+	job, err := s.GetJob(jobId)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = s.jobRepository.SaveRecurringJob(&repository.RecurringJob{
+		JobType:                  job.JobType,
+		SleepAfterEachRunSeconds: job.SleepAfterEachRunSeconds,
+		Schedule:                 job.Schedule,
+		Paused:                   paused,
+		EndDate:                  job.EndDate,
+		EventId:                  job.EventId,
+	})
+	if err != nil {
+		return nil, err
 	}
+	if err := s.syncJobs(); err != nil {
+		return nil, err
+	}
+	return s.GetJob(jobId)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Until(job.EndDate))
+// start launches the supervisor of the job, the caller has to hold the lock
+func (s *RecurringJobService) start(job *RecurringJob) {
+	ctx, cancel := context.WithDeadline(context.Background(), job.EndDate)
 	job.Cancel = cancel
-	return StashEvaluationLoop(ctx, s.poeClient, event)
+	job.trigger = make(chan struct{}, 1)
+	job.done = make(chan struct{})
+	go s.supervise(ctx, job)
 }
 
-func (s *RecurringJobService) FetchStashChanges(job *RecurringJob) error {
-	event, err := s.eventService.GetEventById(job.EventId)
-	if err != nil {
-		return err
+// stop cancels the job and waits until its current run has finished
+func (s *RecurringJobService) stop(job *RecurringJob) {
+	s.mu.Lock()
+	cancel, done := job.Cancel, job.done
+	s.mu.Unlock()
+	if cancel == nil || done == nil {
+		return
 	}
+	cancel()
+	<-done
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Until(job.EndDate))
-	job.Cancel = cancel
-	ItemFetchLoop(ctx, event, s.poeClient)
-	return nil
+func (s *RecurringJobService) supervise(ctx context.Context, job *RecurringJob) {
+	defer func() {
+		s.mu.Lock()
+		job.Cancel()
+		close(job.done)
+		job.done = nil
+		job.NextRun = nil
+		s.mu.Unlock()
+	}()
+	firstRun := true
+	for {
+		s.mu.Lock()
+		failures := job.ConsecutiveFailures
+		s.mu.Unlock()
+
+		var delay time.Duration
+		switch {
+		case job.IsLongRunning() && failures > 0:
+			delay = utils.ExponentialBackoff(failures, jobRestartBaseBackoff, jobRestartMaxBackoff)
+		case job.IsLongRunning() && !firstRun:
+			// the loop stopped without an error before the job ended
+			delay = jobRestartBaseBackoff
+		case job.IsLongRunning():
+			delay = 0
+		default:
+			var ok bool
+			delay, ok = job.untilNextRun(time.Now(), firstRun)
+			if !ok {
+				<-ctx.Done()
+				return
+			}
+		}
+		firstRun = false
+		nextRun := time.Now().Add(delay)
+		s.mu.Lock()
+		job.NextRun = &nextRun
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-job.trigger:
+		case <-time.After(delay):
+		}
+
+		err := s.execute(ctx, job)
+		if ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		if err != nil {
+			logger.ErrorContext(ctx, "Job failed", "job_id", job.Id, "job", job.JobType, "error", err)
+			job.ConsecutiveFailures++
+		} else {
+			job.ConsecutiveFailures = 0
+		}
+		s.mu.Unlock()
+	}
 }
 
-func (s *RecurringJobService) FetchCharacterData(job *RecurringJob) error {
-	event, err := s.eventService.GetEventById(job.EventId, "Teams")
+// execute performs a single run of the job and records it in the run log
+func (s *RecurringJobService) execute(ctx context.Context, job *RecurringJob) (err error) {
+	run, err := s.jobRepository.StartRun(job.Id)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to record run: %w", err)
 	}
+	s.mu.Lock()
+	job.Running = true
+	job.NextRun = nil
+	s.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Until(job.EndDate))
-	job.Cancel = cancel
-	go PlayerFetchLoop(ctx, event, s.poeClient)
-	go PlayerStatsLoop(ctx)
-	return nil
-}
+	counter := &atomic.Int64{}
+	runCtx := context.WithValue(ctx, itemsProcessedKey{}, counter)
+	// every log line of the run can be traced back to it
+	runCtx = config.WithLogAttrs(runCtx, "job_id", job.Id, "job", job.JobType, "event_id", job.EventId, "run_id", run.Id)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		s.mu.Lock()
+		job.Running = false
+		s.mu.Unlock()
+
+		now := time.Now()
+		run.EndedAt = &now
+		run.ItemsProcessed = counter.Load()
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			// the job has reached its end date
+			run.Status = repository.RecurringJobRunStatusSucceeded
+		case ctx.Err() != nil:
+			run.Status = repository.RecurringJobRunStatusCancelled
+		case err != nil:
+			run.Status = repository.RecurringJobRunStatusFailed
+			message := err.Error()
+			run.Error = &message
+		default:
+			run.Status = repository.RecurringJobRunStatusSucceeded
+		}
+		if finishErr := s.jobRepository.FinishRun(run); finishErr != nil {
+			logger.ErrorContext(runCtx, "Failed to record the end of run", "error", finishErr)
+		}
+	}()
 
-func (s *RecurringJobService) FetchGuildStashes(job *RecurringJob) error {
 	event, err := s.eventService.GetEventById(job.EventId, "Teams")
 	if err != nil {
 		return err
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Until(job.EndDate))
-	job.Cancel = cancel
-	go GuildStashFetchLoop(ctx, event, s.poeClient)
-	return nil
+	switch job.JobType {
+	case repository.FetchStashChanges:
+		return ItemFetchLoop(runCtx, event, s.poeClient)
+	case repository.EvaluateStashChanges:
+		return StashEvaluationLoop(runCtx, s.poeClient, event)
+	case repository.FetchCharacterData:
+		return PlayerFetchLoop(runCtx, event, s.poeClient)
+	case repository.FetchGuildStashes:
+		return GuildStashFetchLoop(runCtx, event, s.poeClient)
+	case repository.CompactObjectiveMatches:
+		deleted, err := s.objectiveMatchService.CompactMatches(event.Id)
+		addItemsProcessed(runCtx, int(deleted))
+		return err
+	default:
+		return fmt.Errorf("invalid job type")
+	}
 }
@@ -0,0 +1,190 @@
+package e2e
+
+import (
+	"bpl/client"
+	"bpl/config"
+	"bpl/cron"
+	"bpl/fakepoe"
+	"bpl/repository"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var (
+	db        *gorm.DB
+	poeServer *fakepoe.Server
+)
+
+func TestMain(m *testing.M) {
+	// every PoE client of the application, including the ones the services create themselves, talks to the fake server
+	poeServer = fakepoe.NewServer()
+	defer poeServer.Close()
+	os.Setenv("POE_API_URL", poeServer.URL())
+
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("Could not construct pool: %s", err)
+	}
+	err = pool.Client.Ping()
+	if err != nil {
+		log.Fatalf("Could not connect to Docker: %s", err)
+	}
+	resource, err := pool.Run("postgres", "17.2-alpine", []string{"POSTGRES_USER=postgres", "POSTGRES_PASSWORD=postgres", "DATABASE_NAME=postgres"})
+	if err != nil {
+		log.Fatalf("Could not start resource: %s", err)
+	}
+	err = resource.Expire(600)
+	if err != nil {
+		log.Fatalf("Could not set resource expiration: %s", err)
+	}
+	if err := pool.Retry(func() error {
+		// the repositories use the global connection, so the test has to initialise it like main does
+		var err error
+		db, err = config.InitDB("localhost", resource.GetPort("5432/tcp"), "postgres", "postgres", "postgres")
+		if err != nil {
+			return err
+		}
+		if err := db.Exec(`CREATE SCHEMA IF NOT EXISTS bpl2`).Error; err != nil {
+			return err
+		}
+		err = db.AutoMigrate(
+			&repository.Event{},
+			&repository.Objective{},
+			&repository.Condition{},
+			&repository.ScoringRule{},
+			&repository.ObjectiveScoringRule{},
+			&repository.Team{},
+			&repository.User{},
+			&repository.TeamUser{},
+			&repository.Oauth{},
+			&repository.ClientCredentials{},
+			&repository.ObjectiveMatch{},
+			&repository.Character{},
+			&repository.CharacterPob{},
+			&repository.CharacterDeath{},
+			&repository.PassiveTree{},
+			&repository.AtlasTree{},
+			&repository.Activity{},
+			&repository.LadderEntry{},
+			&repository.LadderSnapshot{},
+			&repository.PoBJob{},
+			&repository.ItemWish{},
+			&repository.UniqueItemTracking{},
+			&repository.Timing{},
+		)
+		if err != nil {
+			fmt.Println("Error in AutoMigrate: ", err)
+		}
+		return err
+	}); err != nil {
+		log.Fatalf("Could not connect to database: %s", err)
+	}
+
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Fatalf("Could not purge resource: %s", err)
+		}
+	}()
+	m.Run()
+}
+
+func createPlayer(t *testing.T, event *repository.Event, token string) *repository.User {
+	team := &repository.Team{Name: "team", Abbreviation: "T", EventId: event.Id, Color: "#ffffff", AllowedClasses: []string{}}
+	require.NoError(t, db.Create(team).Error)
+	user := &repository.User{DisplayName: "player", Permissions: repository.Permissions{}}
+	require.NoError(t, db.Create(user).Error)
+	require.NoError(t, db.Create(&repository.TeamUser{TeamId: team.Id, UserId: user.Id}).Error)
+	require.NoError(t, db.Create(&repository.Oauth{
+		UserId:        user.Id,
+		Provider:      repository.ProviderPoE,
+		AccessToken:   token,
+		Expiry:        time.Now().Add(24 * time.Hour),
+		RefreshExpiry: time.Now().Add(24 * time.Hour),
+		Name:          "player#1234",
+		AccountId:     "account",
+	}).Error)
+	return user
+}
+
+func TestPlayerFetchLoop(t *testing.T) {
+	league := "Settlers"
+	event := &repository.Event{
+		Name:                 league,
+		IsCurrent:            true,
+		GameVersion:          repository.PoE1,
+		MaxSize:              10,
+		ApplicationStartTime: time.Now().Add(-48 * time.Hour),
+		ApplicationEndTime:   time.Now().Add(-24 * time.Hour),
+		EventStartTime:       time.Now().Add(-time.Hour),
+		EventEndTime:         time.Now().Add(24 * time.Hour),
+	}
+	require.NoError(t, db.Create(event).Error)
+	user := createPlayer(t, event, "player-token")
+
+	experience := 5000000
+	poeServer.SetCharacter("player-token", &client.Character{
+		Id:         "character1",
+		Name:       "FakeWitch",
+		Class:      "Necromancer",
+		League:     &league,
+		Level:      60,
+		Experience: experience,
+		Equipment:  &[]client.Item{},
+		Inventory:  &[]client.Item{},
+		Jewels:     &[]client.Item{},
+	})
+	poeServer.SetLeagueAccount("player-token", league, &client.LeagueAccount{
+		AtlasPassiveTrees: []client.AtlasPassiveTree{{Name: "maps", Hashes: []int{1, 2, 3}}},
+	})
+	poeServer.SetLadder(league, client.LadderEntry{
+		Rank:      1,
+		Character: client.LadderEntryCharacter{Id: "character1", Name: "FakeWitch", Level: 60, Class: "Necromancer", Experience: &experience},
+		Account:   &client.Account{Name: "player#1234"},
+	})
+	poeServer.SetRateLimit(fakepoe.EndpointGetCharacter, "Account", fakepoe.RateLimitPolicy{MaxHits: 5, Period: 10 * time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cron.PlayerFetchLoop(ctx, event, poeServer.Client(10, 10))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	assert.Eventually(t, func() bool {
+		var character repository.Character
+		err := db.Where("id = ? AND event_id = ?", "character1", event.Id).First(&character).Error
+		return err == nil && character.UserId != nil && *character.UserId == user.Id && character.Level == 60
+	}, 30*time.Second, 500*time.Millisecond, "the character should be fetched by name and persisted")
+
+	assert.Eventually(t, func() bool {
+		var count int64
+		db.Model(&repository.AtlasTree{}).Where("user_id = ? AND event_id = ?", user.Id, event.Id).Count(&count)
+		return count > 0
+	}, 30*time.Second, 500*time.Millisecond, "the atlas trees of the league account should be persisted")
+
+	assert.Eventually(t, func() bool {
+		var count int64
+		db.Model(&repository.LadderEntry{}).Where("event_id = ?", event.Id).Count(&count)
+		return count > 0
+	}, 30*time.Second, 500*time.Millisecond, "the ladder should be fetched with an application token and persisted")
+
+	for _, request := range poeServer.Requests(fakepoe.EndpointGetLeagueLadder) {
+		assert.Equal(t, fakepoe.ClientCredentialsToken, request.Token)
+	}
+	for _, request := range poeServer.Requests(fakepoe.EndpointGetCharacter) {
+		assert.NotEqual(t, 429, request.Status, "the client should respect the rate limits it learns from the server")
+	}
+}
@@ -0,0 +1,519 @@
+// Package fakepoe provides a local stand-in for the Path of Exile API that serves scripted fixtures, so that the
+// fetching pipeline can run end-to-end in tests without talking to GGG.
+package fakepoe
+
+import (
+	"bpl/client"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint names the PoE API endpoints the server implements, they match the request keys of the PoE client
+type Endpoint string
+
+const (
+	EndpointListCharacters   Endpoint = "ListCharacters"
+	EndpointGetCharacter     Endpoint = "GetCharacter"
+	EndpointGetLeagueAccount Endpoint = "GetLeagueAccount"
+	EndpointListGuildStashes Endpoint = "ListGuildStashes"
+	EndpointGetGuildStash    Endpoint = "GetGuildStash"
+	EndpointGetLeagueLadder  Endpoint = "GetLeagueLadder"
+	EndpointGetPoE2Ladder    Endpoint = "GetPoE2Ladder"
+	EndpointGetPublicStashes Endpoint = "GetPublicStashes"
+	EndpointOAuthToken       Endpoint = "OAuthToken"
+)
+
+// ClientCredentialsToken is the access token the server grants for the client credentials grant unless scripted otherwise
+const ClientCredentialsToken = "fake-client-credentials-token"
+
+// RateLimitPolicy is a policy of a rate limit rule, it is violated once more than MaxHits requests are sent within Period.
+// Periods are reported in whole seconds, like the PoE API does.
+type RateLimitPolicy struct {
+	MaxHits int
+	Period  time.Duration
+	// how long requests are rejected after the policy was violated, defaults to the period
+	Restriction time.Duration
+}
+
+type rateLimitRule struct {
+	name     string
+	policies []RateLimitPolicy
+}
+
+type hitKey struct {
+	endpoint Endpoint
+	rule     string
+	token    string
+}
+
+// Request is a request the server received
+type Request struct {
+	Endpoint Endpoint
+	Method   string
+	Path     string
+	// access token of the request, empty for requests without one
+	Token  string
+	Status int
+	Time   time.Time
+}
+
+type publicStashPage struct {
+	nextChangeId string
+	stashes      []client.PublicStashChange
+}
+
+// Server is a fake PoE API. Fixtures and rate limits can be changed while clients are talking to it.
+type Server struct {
+	server *httptest.Server
+	mu     sync.Mutex
+
+	characters        map[string][]*client.Character
+	leagueAccounts    map[string]map[string]*client.LeagueAccount
+	guildStashes      map[string][]client.GuildStashTabGGG
+	ladders           map[string][]client.LadderEntry
+	publicStashPages  map[string]*publicStashPage
+	firstChangeId     string
+	clientCredentials *client.ClientCredentialsGrantResponse
+	// access token grants by authorization code or refresh token
+	accessTokenGrants map[string]*client.AccessTokenGrantResponse
+
+	rateLimits   map[Endpoint][]rateLimitRule
+	hits         map[hitKey][]time.Time
+	restrictions map[hitKey]time.Time
+	failures     map[Endpoint][]int
+	requests     []Request
+}
+
+// NewServer starts a fake PoE API on a local port, it has to be closed after use
+func NewServer() *Server {
+	s := &Server{
+		characters:       make(map[string][]*client.Character),
+		leagueAccounts:   make(map[string]map[string]*client.LeagueAccount),
+		guildStashes:     make(map[string][]client.GuildStashTabGGG),
+		ladders:          make(map[string][]client.LadderEntry),
+		publicStashPages: make(map[string]*publicStashPage),
+		clientCredentials: &client.ClientCredentialsGrantResponse{
+			AccessToken: ClientCredentialsToken,
+			TokenType:   "bearer",
+			Scope:       "service:psapi service:leagues:ladder",
+		},
+		accessTokenGrants: make(map[string]*client.AccessTokenGrantResponse),
+		rateLimits:        make(map[Endpoint][]rateLimitRule),
+		hits:              make(map[hitKey][]time.Time),
+		restrictions:      make(map[hitKey]time.Time),
+		failures:          make(map[Endpoint][]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /character", s.handle(EndpointListCharacters, s.listCharacters))
+	// the PoE client requests both the character list of a realm and a character of the pc realm with this path
+	mux.HandleFunc("GET /character/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if isRealm(r.PathValue("name")) {
+			s.handle(EndpointListCharacters, s.listCharacters)(w, r)
+			return
+		}
+		s.handle(EndpointGetCharacter, s.getCharacter)(w, r)
+	})
+	mux.HandleFunc("GET /character/{realm}/{name}", s.handle(EndpointGetCharacter, s.getCharacter))
+	mux.HandleFunc("GET /league-account/{league}", s.handle(EndpointGetLeagueAccount, s.getLeagueAccount))
+	mux.HandleFunc("GET /guild/stash/{league}", s.handle(EndpointListGuildStashes, s.listGuildStashes))
+	mux.HandleFunc("GET /guild/stash/{league}/{stash}", s.handle(EndpointGetGuildStash, s.getGuildStash))
+	mux.HandleFunc("GET /guild/stash/{league}/{parent}/{stash}", s.handle(EndpointGetGuildStash, s.getGuildStash))
+	mux.HandleFunc("GET /league/{league}/ladder", s.handle(EndpointGetLeagueLadder, s.getLeagueLadder))
+	mux.HandleFunc("GET /internal-api/content/game-ladder/id/{league}", s.handle(EndpointGetPoE2Ladder, s.getPoE2Ladder))
+	mux.HandleFunc("GET /public-stash-tabs", s.handle(EndpointGetPublicStashes, s.getPublicStashes))
+	mux.HandleFunc("GET /public-stash-tabs/{realm}", s.handle(EndpointGetPublicStashes, s.getPublicStashes))
+	mux.HandleFunc("POST /oauth/token", s.handle(EndpointOAuthToken, s.grantToken))
+	s.server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL is the base url of the server, both for the API and for the OAuth and PoE2 ladder endpoints of the website
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Client returns a PoE client that sends all of its requests to the server
+func (s *Server) Client(maxRequestsPerSecond float64, timeOutSeconds int) *client.PoEClient {
+	baseURL, _ := url.Parse(s.server.URL)
+	return client.NewPoEClientWithBaseURL(baseURL, maxRequestsPerSecond, timeOutSeconds)
+}
+
+// SetCharacter adds the character to the account of the token or replaces the one with the same id
+func (s *Server) SetCharacter(token string, character *client.Character) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	characters := s.characters[token]
+	index := slices.IndexFunc(characters, func(c *client.Character) bool { return c.Id == character.Id })
+	if index >= 0 {
+		characters[index] = character
+		return
+	}
+	s.characters[token] = append(characters, character)
+}
+
+// DeleteCharacter removes the character with the given id from the account of the token
+func (s *Server) DeleteCharacter(token string, characterId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.characters[token] = slices.DeleteFunc(s.characters[token], func(c *client.Character) bool { return c.Id == characterId })
+}
+
+func (s *Server) SetLeagueAccount(token string, league string, account *client.LeagueAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leagueAccounts[token] == nil {
+		s.leagueAccounts[token] = make(map[string]*client.LeagueAccount)
+	}
+	s.leagueAccounts[token][league] = account
+}
+
+// SetGuildStashes replaces the guild stash tabs of the league, the list endpoint serves them without their items
+func (s *Server) SetGuildStashes(league string, stashes ...client.GuildStashTabGGG) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guildStashes[league] = stashes
+}
+
+// SetLadder replaces the ladder of the league, it is served by both the PoE1 and the PoE2 ladder endpoint
+func (s *Server) SetLadder(league string, entries ...client.LadderEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ladders[league] = entries
+}
+
+// AddPublicStashPage scripts the public stash changes that are served for the change id together with the id of the
+// next page. The first page that is added is served to requests without a change id, unknown change ids are treated as
+// the end of the river and return no changes.
+func (s *Server) AddPublicStashPage(changeId string, nextChangeId string, stashes ...client.PublicStashChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.firstChangeId == "" {
+		s.firstChangeId = changeId
+	}
+	s.publicStashPages[changeId] = &publicStashPage{nextChangeId: nextChangeId, stashes: stashes}
+}
+
+func (s *Server) SetClientCredentials(response *client.ClientCredentialsGrantResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientCredentials = response
+}
+
+// SetAccessTokenGrant scripts the response to the authorization code or refresh token grant with the given code or
+// refresh token, other codes are rejected as invalid grants
+func (s *Server) SetAccessTokenGrant(codeOrRefreshToken string, response *client.AccessTokenGrantResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokenGrants[codeOrRefreshToken] = response
+}
+
+// SetRateLimit replaces the policies of a rate limit rule of the endpoint. Hits are counted per rule and access token,
+// or per rule for requests without a token.
+func (s *Server) SetRateLimit(endpoint Endpoint, rule string, policies ...RateLimitPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules := slices.DeleteFunc(s.rateLimits[endpoint], func(r rateLimitRule) bool { return r.name == rule })
+	s.rateLimits[endpoint] = append(rules, rateLimitRule{name: rule, policies: policies})
+}
+
+// FailNext makes the next requests to the endpoint fail with the given status codes, one per request
+func (s *Server) FailNext(endpoint Endpoint, statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], statusCodes...)
+}
+
+// Requests returns the requests the server received for the endpoint, or all requests if no endpoint is given
+func (s *Server) Requests(endpoints ...Endpoint) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]Request, 0, len(s.requests))
+	for _, request := range s.requests {
+		if len(endpoints) == 0 || slices.Contains(endpoints, request.Endpoint) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func errorBody(status int) any {
+	return map[string]apiError{"error": {Code: status, Message: http.StatusText(status)}}
+}
+
+// handle serves a request of the endpoint, applying its rate limits and scripted failures before the handler is called
+func (s *Server) handle(endpoint Endpoint, handler func(r *http.Request, token string) (int, any)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		now := time.Now()
+		status, body := http.StatusOK, any(nil)
+		if retryAfter, limited := s.applyRateLimits(w.Header(), endpoint, token, now); limited {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			status, body = http.StatusTooManyRequests, errorBody(http.StatusTooManyRequests)
+		} else if failures := s.failures[endpoint]; len(failures) > 0 {
+			s.failures[endpoint] = failures[1:]
+			status, body = failures[0], errorBody(failures[0])
+		} else {
+			status, body = handler(r, token)
+		}
+		s.requests = append(s.requests, Request{
+			Endpoint: endpoint,
+			Method:   r.Method,
+			Path:     r.URL.RequestURI(),
+			Token:    token,
+			Status:   status,
+			Time:     now,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+// applyRateLimits counts the request against the rules of the endpoint and writes the rate limit headers of the PoE API.
+// It returns the number of seconds until the request can be retried if one of the policies is restricting requests.
+func (s *Server) applyRateLimits(headers http.Header, endpoint Endpoint, token string, now time.Time) (int, bool) {
+	rules := s.rateLimits[endpoint]
+	if len(rules) == 0 {
+		return 0, false
+	}
+	headers.Set("X-Rate-Limit-Policy", string(endpoint))
+	ruleNames := make([]string, 0, len(rules))
+	retryAfter := 0
+	for _, rule := range rules {
+		ruleNames = append(ruleNames, rule.name)
+		key := hitKey{endpoint: endpoint, rule: rule.name, token: token}
+		longestPeriod := time.Duration(0)
+		for _, policy := range rule.policies {
+			longestPeriod = max(longestPeriod, policy.Period)
+		}
+		hits := slices.DeleteFunc(s.hits[key], func(t time.Time) bool { return !t.After(now.Add(-longestPeriod)) })
+		hits = append(hits, now)
+		s.hits[key] = hits
+
+		limits := make([]string, 0, len(rule.policies))
+		states := make([]string, 0, len(rule.policies))
+		for _, policy := range rule.policies {
+			restriction := policy.Restriction
+			if restriction == 0 {
+				restriction = policy.Period
+			}
+			current := 0
+			for _, hit := range hits {
+				if hit.After(now.Add(-policy.Period)) {
+					current++
+				}
+			}
+			if current > policy.MaxHits && !s.restrictions[key].After(now) {
+				s.restrictions[key] = now.Add(restriction)
+			}
+			active := 0
+			if until := s.restrictions[key]; until.After(now) {
+				active = int(until.Sub(now).Round(time.Second).Seconds())
+				retryAfter = max(retryAfter, active, 1)
+			}
+			limits = append(limits, fmt.Sprintf("%d:%d:%d", policy.MaxHits, int(policy.Period.Seconds()), int(restriction.Seconds())))
+			states = append(states, fmt.Sprintf("%d:%d:%d", current, int(policy.Period.Seconds()), active))
+		}
+		headers.Set("X-Rate-Limit-"+rule.name, strings.Join(limits, ","))
+		headers.Set("X-Rate-Limit-"+rule.name+"-State", strings.Join(states, ","))
+	}
+	headers.Set("X-Rate-Limit-Rules", strings.Join(ruleNames, ","))
+	return retryAfter, retryAfter > 0
+}
+
+func isRealm(value string) bool {
+	return slices.Contains([]client.Realm{client.PC, client.Sony, client.Xbox, client.PoE2}, client.Realm(value))
+}
+
+func realmOf(r *http.Request) client.Realm {
+	if realm := r.PathValue("realm"); realm != "" {
+		return client.Realm(realm)
+	}
+	if name := r.PathValue("name"); isRealm(name) {
+		return client.Realm(name)
+	}
+	return client.PC
+}
+
+// characterRealm returns the realm of a character fixture, characters without one are on pc
+func characterRealm(character *client.Character) client.Realm {
+	if character.Realm == "" {
+		return client.PC
+	}
+	return character.Realm
+}
+
+func (s *Server) listCharacters(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	realm := realmOf(r)
+	characters := make([]client.MinimalCharacter, 0)
+	for _, character := range s.characters[token] {
+		if characterRealm(character) != realm {
+			continue
+		}
+		characters = append(characters, client.MinimalCharacter{
+			Id:         character.Id,
+			Name:       character.Name,
+			Realm:      realm,
+			Class:      character.Class,
+			League:     character.League,
+			Level:      character.Level,
+			Experience: character.Experience,
+			Ruthless:   character.Ruthless,
+			Expired:    character.Expired,
+			Deleted:    character.Deleted,
+			Current:    character.Current,
+		})
+	}
+	return http.StatusOK, client.ListCharactersResponse{Characters: characters}
+}
+
+func (s *Server) getCharacter(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	realm := realmOf(r)
+	for _, character := range s.characters[token] {
+		if character.Name == r.PathValue("name") && characterRealm(character) == realm {
+			return http.StatusOK, client.GetCharacterResponse{Character: character}
+		}
+	}
+	return http.StatusNotFound, errorBody(http.StatusNotFound)
+}
+
+func (s *Server) getLeagueAccount(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	account, ok := s.leagueAccounts[token][r.PathValue("league")]
+	if !ok {
+		return http.StatusOK, client.GetLeagueAccountResponse{LeagueAccount: client.LeagueAccount{AtlasPassiveTrees: []client.AtlasPassiveTree{}}}
+	}
+	return http.StatusOK, client.GetLeagueAccountResponse{LeagueAccount: *account}
+}
+
+// withoutItems returns a copy of the stash tab and its children without their items, like the list endpoint serves them
+func withoutItems(stash client.GuildStashTabGGG) client.GuildStashTabGGG {
+	stash.Items = nil
+	if stash.Children != nil {
+		children := make([]client.GuildStashTabGGG, 0, len(*stash.Children))
+		for _, child := range *stash.Children {
+			children = append(children, withoutItems(child))
+		}
+		stash.Children = &children
+	}
+	return stash
+}
+
+func (s *Server) listGuildStashes(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	stashes := make([]client.GuildStashTabGGG, 0, len(s.guildStashes[r.PathValue("league")]))
+	for _, stash := range s.guildStashes[r.PathValue("league")] {
+		stashes = append(stashes, withoutItems(stash))
+	}
+	return http.StatusOK, client.ListGuildStashesResponse{Stashes: stashes}
+}
+
+func (s *Server) getGuildStash(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	stashId, parentId := r.PathValue("stash"), r.PathValue("parent")
+	for _, root := range s.guildStashes[r.PathValue("league")] {
+		for _, stash := range root.FlatMap() {
+			if stash.StashTab == nil || stash.Id != stashId {
+				continue
+			}
+			if parentId != "" && (stash.Parent == nil || *stash.Parent != parentId) {
+				continue
+			}
+			return http.StatusOK, client.GetGuildStashResponse{Stash: stash}
+		}
+	}
+	return http.StatusNotFound, errorBody(http.StatusNotFound)
+}
+
+func (s *Server) ladderPage(league string, query url.Values) *client.GetLeagueLadderResponse {
+	entries := s.ladders[league]
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(entries)
+	}
+	start := min(max(0, offset), len(entries))
+	end := min(start+limit, len(entries))
+	return &client.GetLeagueLadderResponse{
+		League: &client.League{Id: league},
+		Ladder: &client.Ladder{Total: len(entries), Entries: slices.Clone(entries[start:end])},
+	}
+}
+
+func (s *Server) getLeagueLadder(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	return http.StatusOK, s.ladderPage(r.PathValue("league"), r.URL.Query())
+}
+
+func (s *Server) getPoE2Ladder(r *http.Request, token string) (int, any) {
+	return http.StatusOK, client.GetPoE2LadderResponse{Context: s.ladderPage(r.PathValue("league"), url.Values{})}
+}
+
+func (s *Server) getPublicStashes(r *http.Request, token string) (int, any) {
+	if token == "" {
+		return http.StatusUnauthorized, errorBody(http.StatusUnauthorized)
+	}
+	changeId := r.URL.Query().Get("id")
+	if changeId == "" {
+		changeId = s.firstChangeId
+	}
+	page, ok := s.publicStashPages[changeId]
+	if !ok {
+		return http.StatusOK, client.GetPublicStashTabsResponse{NextChangeId: changeId, Stashes: []client.PublicStashChange{}}
+	}
+	return http.StatusOK, client.GetPublicStashTabsResponse{NextChangeId: page.nextChangeId, Stashes: page.stashes}
+}
+
+func (s *Server) grantToken(r *http.Request, token string) (int, any) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, client.ErrorResponse{Error: "invalid_request", ErrorDescription: err.Error()}
+	}
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "client_credentials":
+		return http.StatusOK, s.clientCredentials
+	case "authorization_code", "refresh_token":
+		code := r.PostForm.Get("code")
+		if grantType == "refresh_token" {
+			code = r.PostForm.Get("refresh_token")
+		}
+		if grant, ok := s.accessTokenGrants[code]; ok {
+			return http.StatusOK, grant
+		}
+		return http.StatusBadRequest, client.ErrorResponse{Error: "invalid_grant", ErrorDescription: "unknown code or refresh token"}
+	default:
+		return http.StatusBadRequest, client.ErrorResponse{Error: "unsupported_grant_type", ErrorDescription: grantType}
+	}
+}
@@ -0,0 +1,241 @@
+package fakepoe
+
+import (
+	"bpl/client"
+	"bpl/config"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func newTestServer(t *testing.T) (*Server, *client.PoEClient) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	// every test starts without the rate limit state of the previous ones
+	client.SetDefaultRateLimitStore(client.NewMemoryRateLimitStore())
+	return server, server.Client(100, 5)
+}
+
+func TestCharacters(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	league := "Settlers"
+	server.SetCharacter("token1", &client.Character{Id: "c1", Name: "Alice", Class: "Witch", League: &league, Level: 12, Experience: 1000})
+	server.SetCharacter("token1", &client.Character{Id: "c2", Name: "AliceTwo", Realm: client.PoE2, Class: "Monk", Level: 3})
+	server.SetCharacter("token1", &client.Character{Id: "c1", Name: "Alice", Class: "Witch", League: &league, Level: 13, Experience: 2000})
+
+	list, err := poeClient.ListCharacters("token1", nil)
+	require.Nil(t, err)
+	require.Len(t, list.Characters, 1)
+	assert.Equal(t, "Alice", list.Characters[0].Name)
+	assert.Equal(t, 13, list.Characters[0].Level)
+
+	realm := client.PoE2
+	list, err = poeClient.ListCharacters("token1", &realm)
+	require.Nil(t, err)
+	require.Len(t, list.Characters, 1)
+	assert.Equal(t, "AliceTwo", list.Characters[0].Name)
+
+	character, err := poeClient.GetCharacter("token1", "AliceTwo", &realm)
+	require.Nil(t, err)
+	assert.Equal(t, "c2", character.Character.Id)
+
+	_, err = poeClient.GetCharacter("token2", "Alice", nil)
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.StatusCode)
+
+	server.DeleteCharacter("token1", "c1")
+	list, err = poeClient.ListCharacters("token1", nil)
+	require.Nil(t, err)
+	assert.Empty(t, list.Characters)
+}
+
+func TestLeagueAccount(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	server.SetLeagueAccount("token1", "Settlers", &client.LeagueAccount{
+		AtlasPassiveTrees: []client.AtlasPassiveTree{{Name: "main", Hashes: []int{1, 2, 3}}},
+	})
+
+	account, err := poeClient.GetLeagueAccount("token1", "Settlers")
+	require.Nil(t, err)
+	require.Len(t, account.LeagueAccount.AtlasPassiveTrees, 1)
+	assert.Equal(t, []int{1, 2, 3}, account.LeagueAccount.AtlasPassiveTrees[0].Hashes)
+
+	account, err = poeClient.GetLeagueAccount("token1", "Standard")
+	require.Nil(t, err)
+	assert.Empty(t, account.LeagueAccount.AtlasPassiveTrees)
+}
+
+func TestGuildStashes(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	parent := "folder"
+	items := []client.Item{{Id: "item1", Name: "Headhunter"}}
+	server.SetGuildStashes("Settlers", client.GuildStashTabGGG{
+		StashTab: &client.StashTab{Id: "folder", Name: "Folder", Type: "Folder"},
+		Children: &[]client.GuildStashTabGGG{{
+			StashTab: &client.StashTab{Id: "tab1", Parent: &parent, Name: "Uniques", Type: "NormalStash"},
+			Items:    &items,
+		}},
+	})
+
+	list, err := poeClient.ListGuildStashes("token1", "Settlers")
+	require.Nil(t, err)
+	require.Len(t, list.Stashes, 1)
+	require.NotNil(t, list.Stashes[0].Children)
+	assert.Nil(t, (*list.Stashes[0].Children)[0].Items, "the list endpoint should not serve items")
+
+	stash, err := poeClient.GetGuildStash(context.Background(), "token1", "Settlers", "tab1", &parent)
+	require.Nil(t, err)
+	require.NotNil(t, stash.Stash.Items)
+	assert.Equal(t, "Headhunter", (*stash.Stash.Items)[0].Name)
+
+	_, err = poeClient.GetGuildStash(context.Background(), "token1", "Settlers", "missing", nil)
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.StatusCode)
+}
+
+func TestLadder(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	entries := make([]client.LadderEntry, 0, 5)
+	for i := range 5 {
+		entries = append(entries, client.LadderEntry{Rank: i + 1, Character: client.LadderEntryCharacter{Name: string(rune('a' + i)), Level: 90 - i}})
+	}
+	server.SetLadder("Settlers", entries...)
+
+	page, err := poeClient.GetLeagueLadder("token1", "Settlers", "pc", "xp", 2, 2)
+	require.Nil(t, err)
+	assert.Equal(t, 5, page.Ladder.Total)
+	require.Len(t, page.Ladder.Entries, 2)
+	assert.Equal(t, 3, page.Ladder.Entries[0].Rank)
+
+	full, err := poeClient.GetPoE2Ladder("Settlers")
+	require.Nil(t, err)
+	assert.Len(t, full.Ladder.Entries, 5)
+}
+
+func TestPublicStashes(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	league := "Settlers"
+	server.AddPublicStashPage("0-0", "1-1", client.PublicStashChange{Id: "stash1", Public: true, League: &league, Items: []client.Item{}})
+	server.AddPublicStashPage("1-1", "2-2", client.PublicStashChange{Id: "stash2", Public: true, League: &league, Items: []client.Item{}})
+
+	changeId := ""
+	stashIds := []string{}
+	for range 3 {
+		response, err := poeClient.GetPublicStashes(context.Background(), "token1", "pc", changeId)
+		require.Nil(t, err)
+		for _, stash := range response.Stashes {
+			stashIds = append(stashIds, stash.Id)
+		}
+		changeId = response.NextChangeId
+	}
+	assert.Equal(t, []string{"stash1", "stash2"}, stashIds)
+	assert.Equal(t, "2-2", changeId, "the end of the river should keep returning its change id")
+}
+
+func TestPublicStashesTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	_, poeClient := newTestServer(t)
+
+	ctx, parent := config.Tracer().Start(context.Background(), "FetchStashChanges")
+	_, err := poeClient.GetPublicStashes(ctx, "token1", "pc", "")
+	require.Nil(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	request := spans[0]
+	assert.Equal(t, "poe.GetPublicStashes", request.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), request.Parent().SpanID(), "the request should be traced as part of the caller's span")
+	assert.Contains(t, request.Attributes(), semconv.HTTPResponseStatusCode(200))
+}
+
+func TestTokenGrants(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	server.SetAccessTokenGrant("code1", &client.AccessTokenGrantResponse{AccessToken: "access1", RefreshToken: "refresh1", ExpiresIn: 3600})
+	server.SetAccessTokenGrant("refresh1", &client.AccessTokenGrantResponse{AccessToken: "access2", RefreshToken: "refresh2", ExpiresIn: 3600})
+
+	credentials, err := poeClient.GetClientCredentials("id", "secret")
+	require.Nil(t, err)
+	assert.Equal(t, ClientCredentialsToken, credentials.AccessToken)
+
+	grant, err := poeClient.GetAccessToken("id", "secret", "code1", "verifier", []string{"account:profile"}, "http://localhost")
+	require.Nil(t, err)
+	assert.Equal(t, "access1", grant.AccessToken)
+
+	grant, err = poeClient.RefreshAccessToken("id", "secret", "refresh1")
+	require.Nil(t, err)
+	assert.Equal(t, "access2", grant.AccessToken)
+
+	_, err = poeClient.GetAccessToken("id", "secret", "unknown", "verifier", []string{"account:profile"}, "http://localhost")
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode)
+	assert.Equal(t, "invalid_grant", err.Error)
+}
+
+func TestRateLimits(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	server.SetCharacter("token1", &client.Character{Id: "c1", Name: "Alice"})
+	server.SetRateLimit(EndpointGetCharacter, "Account", RateLimitPolicy{MaxHits: 2, Period: 10 * time.Second, Restriction: 60 * time.Second})
+
+	_, err := poeClient.GetCharacter("token1", "Alice", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, poeClient.Client.RemainingRequests("token1", "GetCharacter"), "the client should learn the policy from the headers")
+
+	// requests that bypass the client's rate limiting run into the restriction
+	statuses := []int{}
+	for range 2 {
+		request, _ := http.NewRequest("GET", server.URL()+"/character/Alice", nil)
+		request.Header.Set("Authorization", "Bearer token1")
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		statuses = append(statuses, response.StatusCode)
+		if response.StatusCode == http.StatusTooManyRequests {
+			assert.Equal(t, "60", response.Header.Get("Retry-After"))
+			assert.Equal(t, "3:10:60", response.Header.Get("X-Rate-Limit-Account-State"))
+		}
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, statuses)
+
+	// other tokens are counted separately
+	server.SetCharacter("token2", &client.Character{Id: "c2", Name: "Bob"})
+	_, err = poeClient.GetCharacter("token2", "Bob", nil)
+	assert.Nil(t, err)
+}
+
+func TestFailNextAndRequests(t *testing.T) {
+	server, poeClient := newTestServer(t)
+	server.SetCharacter("token1", &client.Character{Id: "c1", Name: "Alice"})
+	server.FailNext(EndpointListCharacters, http.StatusServiceUnavailable, http.StatusUnauthorized)
+
+	_, err := poeClient.ListCharacters("token1", nil)
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, err.StatusCode)
+	_, err = poeClient.ListCharacters("token1", nil)
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode)
+	list, err := poeClient.ListCharacters("token1", nil)
+	require.Nil(t, err)
+	assert.Len(t, list.Characters, 1)
+
+	_, err = poeClient.GetCharacter("token1", "Alice", nil)
+	require.Nil(t, err)
+
+	requests := server.Requests(EndpointListCharacters)
+	require.Len(t, requests, 3)
+	assert.Equal(t, []int{http.StatusServiceUnavailable, http.StatusUnauthorized, http.StatusOK},
+		[]int{requests[0].Status, requests[1].Status, requests[2].Status})
+	assert.Equal(t, "token1", requests[0].Token)
+	assert.Len(t, server.Requests(), 4)
+}
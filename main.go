@@ -1,13 +1,24 @@
 package main
 
 import (
+	"bpl/client"
 	"bpl/config"
 	"bpl/controller"
+	"bpl/cron"
 	_ "bpl/docs"
-	"fmt"
-	"log"
+	"bpl/repository"
+	"bpl/service"
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -29,6 +40,16 @@ import (
 // @in header
 // @name Authorization
 func main() {
+	// "api" serves the http routes, "worker" runs the background jobs and "all" does both in one process
+	command := "all"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	config.InitLogging()
+	if !slices.Contains([]string{"api", "worker", "all"}, command) {
+		fatal("Unknown command, expected api, worker or all", "command", command)
+	}
+	logger.Info("Starting server", "command", command, "instance_id", config.Env().InstanceId)
 
 	// Load and validate configuration
 	cfg := config.Env()
@@ -40,35 +61,128 @@ func main() {
 		cfg.DatabaseName,
 	)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to initialize database", "error", err)
 	}
 	_ = db
+	shutdownTracing, err := config.InitTracing(context.Background())
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
+	}
+	if cfg.RateLimitStore == "postgres" {
+		client.SetDefaultRateLimitStore(repository.NewRateLimitRepository())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// autoMigrate(db)
 	r := gin.New()
 	r.Use(gin.Recovery())
 	err = r.SetTrustedProxies(nil)
 	if err != nil {
-		log.Fatalf("Failed to set trusted proxies: %v", err)
+		fatal("Failed to set trusted proxies", "error", err)
 	}
+	addRequestId(r)
 	addLogger(r)
 	addMetrics(r)
-	addDocs(r)
-	setCors(r)
-	controller.SetRoutes(r)
-	err = r.Run(":8000")
-	if err != nil {
-		fmt.Println("Failed to start server:", err)
+	poeClient := client.NewPoEClient(10, false, 600)
+	jobService := cron.NewRecurringJobService(poeClient)
+	closeConnections := func(ctx context.Context) {}
+	if command != "worker" {
+		addDocs(r)
+		setCors(r)
+		closeConnections = controller.SetRoutes(r, poeClient, jobService)
+	}
+	if command != "api" {
+		jobService.StartLongRunningJobs(ctx)
 	}
+
+	server := &http.Server{Addr: ":8000", Handler: r}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", "error", err)
+		}
+	}()
+	<-ctx.Done()
+	stop()
+	shutdown(server, closeConnections, shutdownTracing)
 }
 
-func addLogger(r *gin.Engine) {
-	r.Use(gin.LoggerWithConfig(gin.LoggerConfig{
-		SkipPaths: []string{"/api/metrics"},
-		Skip: func(c *gin.Context) bool {
-			return c.Request.URL.Query().Get("token") != ""
-		},
-	}))
+// shutdown lets in-flight requests finish and hands the leadership of this instance over to the other instances,
+// giving each step at most its configured timeout
+func shutdown(server *http.Server, closeConnections func(ctx context.Context), shutdownTracing func(ctx context.Context) error) {
+	logger.Info("Shutting down")
+	httpCtx, cancel := context.WithTimeout(context.Background(), config.Env().HTTPShutdownTimeout)
+	defer cancel()
+	closeConnections(httpCtx)
+	if err := server.Shutdown(httpCtx); err != nil {
+		logger.Error("Failed to finish in-flight requests", "error", err)
+	}
+
+	workerCtx, cancel := context.WithTimeout(context.Background(), config.Env().WorkerShutdownTimeout)
+	defer cancel()
+	if err := service.NewLeaderElector().Shutdown(workerCtx); err != nil {
+		logger.Error("Failed to stop background jobs in time", "error", err)
+	}
+	// flush the spans of the jobs that were just stopped
+	if err := shutdownTracing(workerCtx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+		return
+	}
+	logger.Info("Shutdown complete")
+}
+
+var logger = config.Logger("main")
+
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// addRequestId tags every request with an id, taken from the X-Request-Id header of the proxy if there is one, and
+// attaches it to the logs of the request
+func addRequestId(r *gin.Engine) {
+	r.Use(func(c *gin.Context) {
+		requestId := c.GetHeader("X-Request-Id")
+		if requestId == "" {
+			requestId = rand.Text()
+		}
+		c.Header("X-Request-Id", requestId)
+		c.Request = c.Request.WithContext(config.WithLogAttrs(c.Request.Context(), "request_id", requestId))
+		c.Next()
+	})
+}
 
+// addLogger writes a json access log line per request. Tokens that are passed as query parameters, e.g. by
+// websocket connections, are redacted.
+func addLogger(r *gin.Engine) {
+	accessLogger := config.Logger("http")
+	r.Use(func(c *gin.Context) {
+		if c.Request.URL.Path == "/api/metrics" {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+		query := c.Request.URL.Query()
+		if query.Has("token") {
+			query.Set("token", "REDACTED")
+		}
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		accessLogger.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("query", query.Encode()),
+			slog.Int("status", c.Writer.Status()),
+			slog.Int("size", c.Writer.Size()),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
+		)
+	})
 }
 
 func addMetrics(r *gin.Engine) {
@@ -87,3 +87,18 @@ var ScoreEvaluationDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 		0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10,
 	},
 })
+
+var PlayerDataAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bpl_player_data_age_seconds",
+	Help: "Time since the data of a player was last fetched from the PoE API",
+}, []string{"user_id", "kind"})
+
+var FetchQueueGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bpl_fetch_queue_size",
+	Help: "Number of pending player refreshes in the fetch scheduler",
+}, []string{"kind"})
+
+var FetchDispatchedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bpl_fetch_dispatched_total",
+	Help: "Number of player refreshes dispatched by the fetch scheduler, by whether they were due or ahead of schedule",
+}, []string{"kind", "due"})
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Changelog entries derived from guild stash snapshots have no GGG log id, so they
+-- draw from a descending sequence that can never collide with uploaded (positive) ids.
+CREATE SEQUENCE guild_stash_changelogs_derived_id_seq INCREMENT BY -1 MAXVALUE -1 START WITH -1;
+ALTER TABLE guild_stash_changelogs ALTER COLUMN id SET DEFAULT nextval('guild_stash_changelogs_derived_id_seq');
+ALTER SEQUENCE guild_stash_changelogs_derived_id_seq OWNED BY guild_stash_changelogs.id;
+ALTER TABLE guild_stash_changelogs ADD COLUMN derived bool NOT NULL DEFAULT false;
+CREATE INDEX guild_stash_changelogs_derived_idx ON guild_stash_changelogs USING btree (derived);
+
+-- +goose Down
+DELETE FROM guild_stash_changelogs WHERE derived;
+DROP INDEX IF EXISTS guild_stash_changelogs_derived_idx;
+ALTER TABLE guild_stash_changelogs DROP COLUMN derived;
+ALTER TABLE guild_stash_changelogs ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS guild_stash_changelogs_derived_id_seq;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Wishes used to be a single field/value pair, the pair is kept as the grouping key for priorities
+-- and converted into an equivalent condition so that existing wishes keep matching.
+ALTER TABLE item_wishes ADD COLUMN conditions jsonb NOT NULL DEFAULT '[]'::jsonb;
+UPDATE item_wishes SET conditions = jsonb_build_array(jsonb_build_object('field', item_field, 'operator', 'EQ', 'value', value));
+
+CREATE TABLE item_wish_candidates (
+    id serial4 NOT NULL,
+    item_wish_id int4 NOT NULL,
+    team_id int4 NOT NULL,
+    event_id int4 NOT NULL,
+    item_id text NOT NULL,
+    stash_id text NOT NULL,
+    stash_name text NULL,
+    account_name text DEFAULT ''::text NOT NULL,
+    source unique_item_source NOT NULL,
+    x int4 NULL,
+    y int4 NULL,
+    "timestamp" timestamptz NOT NULL,
+    notified bool DEFAULT false NOT NULL,
+    CONSTRAINT item_wish_candidates_pkey PRIMARY KEY (id),
+    CONSTRAINT item_wish_candidates_wish_item_key UNIQUE (item_wish_id, item_id),
+    CONSTRAINT item_wish_candidates_item_wish_fk FOREIGN KEY (item_wish_id) REFERENCES item_wishes(id) ON DELETE CASCADE,
+    CONSTRAINT item_wish_candidates_team_fk FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+    CONSTRAINT item_wish_candidates_event_fk FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
+CREATE INDEX item_wish_candidates_team_id_idx ON item_wish_candidates USING btree (team_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS item_wish_candidates;
+ALTER TABLE item_wishes DROP COLUMN conditions;
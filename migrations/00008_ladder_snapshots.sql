@@ -0,0 +1,22 @@
+-- +goose Up
+-- A row is only written when a character's ladder entry differs from its previous snapshot,
+-- so the state at any point in time is the latest row per character before that point.
+CREATE TABLE ladder_snapshots (
+	event_id int8 NOT NULL,
+	"character" text NOT NULL,
+	account text NOT NULL,
+	user_id int8 NULL,
+	"class" text NOT NULL,
+	"level" int8 NOT NULL,
+	delve int8 NOT NULL,
+	experience int8 NOT NULL,
+	"rank" int8 NOT NULL,
+	"timestamp" timestamptz NOT NULL,
+	CONSTRAINT ladder_snapshots_pkey PRIMARY KEY (event_id, "character", "timestamp"),
+	CONSTRAINT ladder_snapshots_event_id_fkey FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT ladder_snapshots_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX ladder_snapshots_event_id_level_idx ON ladder_snapshots USING btree (event_id, "level");
+
+-- +goose Down
+DROP TABLE IF EXISTS ladder_snapshots;
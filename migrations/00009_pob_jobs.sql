@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TYPE pob_job_status AS ENUM ('pending', 'running', 'dead');
+
+-- Only the newest character state matters for a PoB calculation, so there is at most one job per character.
+-- Requeueing a character replaces its payload and bumps the version, which keeps a worker that is still
+-- processing the old payload from completing or failing the new job.
+CREATE TABLE pob_jobs (
+	character_id text NOT NULL,
+	event_id int4 NOT NULL,
+	user_id int4 NULL,
+	"character" jsonb NOT NULL,
+	status pob_job_status DEFAULT 'pending'::pob_job_status NOT NULL,
+	"version" int4 DEFAULT 0 NOT NULL,
+	attempts int4 DEFAULT 0 NOT NULL,
+	next_attempt_at timestamptz DEFAULT now() NOT NULL,
+	last_error text DEFAULT ''::text NOT NULL,
+	created_at timestamptz DEFAULT now() NOT NULL,
+	updated_at timestamptz DEFAULT now() NOT NULL,
+	CONSTRAINT pob_jobs_pkey PRIMARY KEY (character_id),
+	CONSTRAINT pob_jobs_event_fk FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+	CONSTRAINT pob_jobs_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX pob_jobs_status_next_attempt_at_idx ON pob_jobs USING btree (status, next_attempt_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS pob_jobs;
+DROP TYPE IF EXISTS pob_job_status;
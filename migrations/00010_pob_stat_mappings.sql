@@ -0,0 +1,23 @@
+-- +goose Up
+-- Event specific tracked values that are read from the PlayerStats of a calculated PoB
+-- and persisted in the stats column of character_pobs, keyed by the mapping name.
+CREATE TYPE pob_stat_aggregation AS ENUM ('MIN', 'MAX', 'SUM');
+
+CREATE TABLE pob_stat_mappings (
+	id serial4 NOT NULL,
+	event_id int4 NOT NULL,
+	"name" text NOT NULL,
+	fields _text NOT NULL,
+	aggregation pob_stat_aggregation DEFAULT 'MAX'::pob_stat_aggregation NOT NULL,
+	multiplier float8 DEFAULT 1 NOT NULL,
+	CONSTRAINT pob_stat_mappings_pkey PRIMARY KEY (id),
+	CONSTRAINT pob_stat_mappings_event_name_key UNIQUE (event_id, "name"),
+	CONSTRAINT pob_stat_mappings_event_fk FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
+
+ALTER TABLE character_pobs ADD COLUMN stats jsonb DEFAULT '{}'::jsonb NOT NULL;
+
+-- +goose Down
+ALTER TABLE character_pobs DROP COLUMN stats;
+DROP TABLE IF EXISTS pob_stat_mappings;
+DROP TYPE IF EXISTS pob_stat_aggregation;
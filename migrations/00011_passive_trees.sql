@@ -0,0 +1,17 @@
+-- +goose Up
+-- A row is only written when a character's allocated passives differ from its previous snapshot.
+CREATE TABLE passive_trees (
+	character_id text NOT NULL,
+	event_id int4 NOT NULL,
+	ascendancy text NOT NULL,
+	"level" int2 NOT NULL,
+	nodes _int2 NOT NULL,
+	"timestamp" timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT passive_trees_pkey PRIMARY KEY (character_id, "timestamp"),
+	CONSTRAINT passive_trees_character_id_fkey FOREIGN KEY (character_id) REFERENCES "characters"(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT passive_trees_event_id_fkey FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX passive_trees_event_id_idx ON passive_trees USING btree (event_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS passive_trees;
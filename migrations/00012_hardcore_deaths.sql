@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN ruleset text NOT NULL DEFAULT 'SOFTCORE';
+ALTER TABLE events ADD COLUMN death_policy text NOT NULL DEFAULT 'FREEZE';
+
+-- A character can only die once, after which it is moved out of the event league.
+CREATE TABLE character_deaths (
+	character_id text NOT NULL,
+	event_id int4 NOT NULL,
+	user_id int4 NOT NULL,
+	team_id int4 NOT NULL,
+	"name" text NOT NULL,
+	"level" int4 NOT NULL,
+	ascendancy text NOT NULL,
+	pob_id int4 NULL,
+	"timestamp" timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT character_deaths_pkey PRIMARY KEY (character_id),
+	CONSTRAINT character_deaths_character_id_fkey FOREIGN KEY (character_id) REFERENCES "characters"(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT character_deaths_event_id_fkey FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT character_deaths_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT character_deaths_pob_id_fkey FOREIGN KEY (pob_id) REFERENCES character_pobs(id) ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX character_deaths_event_id_idx ON character_deaths USING btree (event_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS character_deaths;
+ALTER TABLE events DROP COLUMN death_policy;
+ALTER TABLE events DROP COLUMN ruleset;
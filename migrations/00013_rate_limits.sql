@@ -0,0 +1,22 @@
+-- +goose Up
+-- Rate limit state of the PoE API shared by all replicas. Tokens are stored masked.
+CREATE TABLE rate_limit_policies (
+	token text NOT NULL,
+	endpoint text NOT NULL,
+	rule text NOT NULL,
+	max_hits int4 NOT NULL,
+	period_ms int8 NOT NULL,
+	CONSTRAINT rate_limit_policies_pkey PRIMARY KEY (token, endpoint, rule, max_hits, period_ms)
+);
+
+CREATE TABLE rate_limit_requests (
+	token text NOT NULL,
+	endpoint text NOT NULL,
+	"timestamp" timestamptz NOT NULL
+);
+CREATE INDEX rate_limit_requests_key_idx ON rate_limit_requests USING btree (token, endpoint, "timestamp");
+CREATE INDEX rate_limit_requests_timestamp_idx ON rate_limit_requests USING btree ("timestamp");
+
+-- +goose Down
+DROP TABLE IF EXISTS rate_limit_requests;
+DROP TABLE IF EXISTS rate_limit_policies;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Jobs are no longer unique per type, every event can run its own set of jobs.
+ALTER TABLE recurring_jobs DROP CONSTRAINT uni_bpl2_recurring_jobs_job_type;
+ALTER TABLE recurring_jobs ADD COLUMN id serial4 NOT NULL;
+ALTER TABLE recurring_jobs ADD CONSTRAINT recurring_jobs_pkey PRIMARY KEY (id);
+ALTER TABLE recurring_jobs ADD COLUMN schedule text NULL;
+ALTER TABLE recurring_jobs ADD COLUMN paused bool DEFAULT false NOT NULL;
+CREATE UNIQUE INDEX recurring_jobs_job_type_event_id_idx ON recurring_jobs USING btree (job_type, event_id);
+
+CREATE TYPE recurring_job_run_status AS ENUM ('running', 'succeeded', 'failed', 'cancelled');
+
+CREATE TABLE recurring_job_runs (
+	id serial4 NOT NULL,
+	job_id int4 NOT NULL,
+	started_at timestamptz NOT NULL,
+	ended_at timestamptz NULL,
+	status recurring_job_run_status DEFAULT 'running'::recurring_job_run_status NOT NULL,
+	error text NULL,
+	items_processed int8 DEFAULT 0 NOT NULL,
+	CONSTRAINT recurring_job_runs_pkey PRIMARY KEY (id),
+	CONSTRAINT recurring_job_runs_job_fk FOREIGN KEY (job_id) REFERENCES recurring_jobs(id) ON DELETE CASCADE
+);
+CREATE INDEX recurring_job_runs_job_id_started_at_idx ON recurring_job_runs USING btree (job_id, started_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS recurring_job_runs;
+DROP TYPE IF EXISTS recurring_job_run_status;
+
+DELETE FROM recurring_jobs WHERE id NOT IN (SELECT MAX(id) FROM recurring_jobs GROUP BY job_type);
+DROP INDEX IF EXISTS recurring_jobs_job_type_event_id_idx;
+ALTER TABLE recurring_jobs DROP COLUMN paused;
+ALTER TABLE recurring_jobs DROP COLUMN schedule;
+ALTER TABLE recurring_jobs DROP CONSTRAINT recurring_jobs_pkey;
+ALTER TABLE recurring_jobs DROP COLUMN id;
+ALTER TABLE recurring_jobs ADD CONSTRAINT uni_bpl2_recurring_jobs_job_type PRIMARY KEY (job_type);
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN phase text NOT NULL DEFAULT 'DRAFT';
+ALTER TABLE events ADD COLUMN grace_period_minutes int4 NOT NULL DEFAULT 60;
+
+-- existing events are put into the phase their schedule implies, without running the side effects of the transitions
+UPDATE events SET phase = CASE
+	WHEN now() >= event_end_time + interval '60 minutes' THEN 'FINAL'
+	WHEN now() >= event_end_time THEN 'GRACE_PERIOD'
+	WHEN now() >= event_start_time THEN 'RUNNING'
+	WHEN now() >= application_end_time THEN 'APPLICATIONS_CLOSED'
+	WHEN now() >= application_start_time THEN 'APPLICATIONS_OPEN'
+	ELSE 'DRAFT'
+END;
+
+-- +goose Down
+ALTER TABLE events DROP COLUMN grace_period_minutes;
+ALTER TABLE events DROP COLUMN phase;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Leadership of background work is decided by session level advisory locks. The leases show which instance holds them.
+CREATE TABLE leader_leases (
+	"role" text NOT NULL,
+	instance_id text NOT NULL,
+	acquired_at timestamptz NOT NULL,
+	renewed_at timestamptz NOT NULL,
+	CONSTRAINT leader_leases_pkey PRIMARY KEY ("role")
+);
+
+ALTER TABLE recurring_jobs ADD COLUMN trigger_requested_at timestamptz NULL;
+
+-- +goose Down
+ALTER TABLE recurring_jobs DROP COLUMN trigger_requested_at;
+DROP TABLE IF EXISTS leader_leases;
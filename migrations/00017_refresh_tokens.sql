@@ -0,0 +1,34 @@
+-- +goose Up
+-- Access tokens are short lived, sessions are kept alive by refresh tokens that are rotated on every use.
+-- Only the hash of a refresh token is stored.
+CREATE TABLE refresh_tokens (
+	id serial4 NOT NULL,
+	user_id int4 NOT NULL,
+	token_hash text NOT NULL,
+	-- all tokens that were rotated from the same login, they are revoked together if a rotated token is reused
+	family_id text NOT NULL,
+	-- the access token that was issued together with this refresh token, so it can be revoked with it
+	access_token_id text NOT NULL,
+	access_token_expiry timestamptz NOT NULL,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL,
+	revoked_at timestamptz NULL,
+	CONSTRAINT refresh_tokens_pkey PRIMARY KEY (id),
+	CONSTRAINT refresh_tokens_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX refresh_tokens_token_hash_idx ON refresh_tokens USING btree (token_hash);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens USING btree (user_id);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens USING btree (family_id);
+
+-- Access tokens that were revoked before they expired. Entries can be dropped once the token has expired.
+CREATE TABLE revoked_tokens (
+	token_id text NOT NULL,
+	user_id int4 NOT NULL,
+	expires_at timestamptz NOT NULL,
+	revoked_at timestamptz NOT NULL,
+	CONSTRAINT revoked_tokens_pkey PRIMARY KEY (token_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
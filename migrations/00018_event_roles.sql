@@ -0,0 +1,36 @@
+-- +goose Up
+-- Roles that a user holds in a single event, optionally restricted to one of its teams.
+-- Only admin remains a global permission on the user.
+CREATE TABLE event_roles (
+	id serial4 NOT NULL,
+	user_id int4 NOT NULL,
+	event_id int4 NOT NULL,
+	team_id int4 NULL,
+	"role" text NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT event_roles_pkey PRIMARY KEY (id),
+	CONSTRAINT event_roles_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	CONSTRAINT event_roles_event_fk FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+	CONSTRAINT event_roles_team_fk FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX event_roles_assignment_idx ON event_roles USING btree (event_id, user_id, "role", team_id) NULLS NOT DISTINCT;
+CREATE INDEX event_roles_user_id_idx ON event_roles USING btree (user_id);
+
+-- the global permissions other than admin are granted in every existing event, so nobody loses access
+INSERT INTO event_roles (user_id, event_id, "role")
+SELECT users.id, events.id, permission
+FROM users
+CROSS JOIN LATERAL unnest(users.permissions) AS permission
+CROSS JOIN events
+WHERE permission <> 'admin';
+
+UPDATE users SET permissions = array(SELECT permission FROM unnest(permissions) AS permission WHERE permission = 'admin')
+WHERE permissions <> '{}';
+
+-- +goose Down
+UPDATE users SET permissions = array(
+	SELECT DISTINCT permission FROM unnest(users.permissions || array(
+		SELECT event_roles."role" FROM event_roles WHERE event_roles.user_id = users.id AND event_roles.team_id IS NULL
+	)) AS permission
+);
+DROP TABLE IF EXISTS event_roles;
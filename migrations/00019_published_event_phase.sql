@@ -0,0 +1,10 @@
+-- +goose Up
+-- published events whose applications have not started yet wait in their own phase instead of accepting signups.
+-- The event phases migration put the public events that were scheduled but not open yet into DRAFT, where they would
+-- never be advanced by their schedule.
+UPDATE events SET phase = 'PUBLISHED'
+WHERE now() < application_start_time
+AND (phase = 'APPLICATIONS_OPEN' OR (phase = 'DRAFT' AND public));
+
+-- +goose Down
+UPDATE events SET phase = 'APPLICATIONS_OPEN' WHERE phase = 'PUBLISHED';
@@ -0,0 +1,10 @@
+-- +goose Up
+-- the time of the latest request of all keys, which limits the requests per second across keys without locking them all
+CREATE TABLE rate_limit_pacers (
+	id int4 NOT NULL,
+	last_request timestamptz NOT NULL,
+	CONSTRAINT rate_limit_pacers_pkey PRIMARY KEY (id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS rate_limit_pacers;
@@ -2,10 +2,10 @@ package parser
 
 import (
 	clientModel "bpl/client"
+	"bpl/config"
 	dbModel "bpl/repository"
 	"bpl/utils"
 	"fmt"
-	"log"
 	"regexp"
 	"slices"
 	"strconv"
@@ -13,6 +13,8 @@ import (
 	"time"
 )
 
+var logger = config.Logger("parser")
+
 type itemChecker func(item *clientModel.Item) int
 
 func boolToInt(b bool) int {
@@ -304,7 +306,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Map Tier" {
 						tier, err := strconv.Atoi(property.Values[0].Name())
 						if err != nil {
-							log.Printf("Error parsing map tier %s", property.Values[0].Name())
+							logger.Warn("Failed to parse map tier", "value", property.Values[0].Name())
 							return 0
 						}
 						return tier
@@ -320,7 +322,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Item Quantity" {
 						quantity, err := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(property.Values[0].Name(), "%", ""), "+", ""))
 						if err != nil {
-							log.Printf("Error parsing map quantity %s", property.Values[0].Name())
+							logger.Warn("Failed to parse map quantity", "value", property.Values[0].Name())
 							return 0
 						}
 						return quantity
@@ -336,7 +338,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Map Rarity" {
 						rarity, err := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(property.Values[0].Name(), "%", ""), "+", ""))
 						if err != nil {
-							log.Printf("Error parsing map rarity %s", property.Values[0].Name())
+							logger.Warn("Failed to parse map rarity", "value", property.Values[0].Name())
 							return 0
 						}
 						return rarity
@@ -352,7 +354,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Monster Pack Size" {
 						size, err := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(property.Values[0].Name(), "%", ""), "+", ""))
 						if err != nil {
-							log.Printf("Error parsing monster pack size %s", property.Values[0].Name())
+							logger.Warn("Failed to parse monster pack size", "value", property.Values[0].Name())
 							return 0
 						}
 						return size
@@ -376,7 +378,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Stored Experience: {0}" {
 						exp, err := strconv.Atoi(property.Values[0].Name())
 						if err != nil {
-							log.Printf("Error parsing facetor lens exp %s", property.Values[0].Name())
+							logger.Warn("Failed to parse facetor lens exp", "value", property.Values[0].Name())
 							return 0
 						}
 						return exp
@@ -392,7 +394,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if strings.Contains(property.Name, "Quality") {
 						quality, err := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(property.Values[0].Name(), "%", ""), "+", ""))
 						if err != nil {
-							log.Printf("Error parsing quality %s", property.Values[0].Name())
+							logger.Warn("Failed to parse quality", "value", property.Values[0].Name())
 							return 0
 						}
 						return quality
@@ -408,7 +410,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Level" {
 						level, err := strconv.Atoi(strings.ReplaceAll(property.Values[0].Name(), " (Max)", ""))
 						if err != nil {
-							log.Printf("Error parsing level %s", property.Values[0].Name())
+							logger.Warn("Failed to parse level", "value", property.Values[0].Name())
 							return 0
 						}
 						return level
@@ -424,7 +426,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Memory Strands" {
 						strands, err := strconv.Atoi(property.Values[0].Name())
 						if err != nil {
-							log.Printf("Error parsing memory strands %s", property.Values[0].Name())
+							logger.Warn("Failed to parse memory strands", "value", property.Values[0].Name())
 							return 0
 						}
 						return strands
@@ -446,7 +448,7 @@ func IntFieldGetter(field dbModel.ItemField) (func(item *clientModel.Item) int,
 					if property.Name == "Level" {
 						level, err := strconv.Atoi(strings.ReplaceAll(property.Values[0].Name(), " (Max)", ""))
 						if err != nil {
-							log.Printf("Error parsing graft skill level %s", property.Values[0].Name())
+							logger.Warn("Failed to parse graft skill level", "value", property.Values[0].Name())
 							return 0
 						}
 						return level
@@ -832,7 +834,7 @@ func NewItemChecker(objectives []*dbModel.Objective, ignoreTime bool) (*ItemChec
 			discriminators, remainingConditions := GetDiscriminators(objective.Conditions)
 			conditionFn, err := ComperatorFromConditions(remainingConditions)
 			if err != nil {
-				fmt.Printf("Error getting comparator for objective %d: %s\n", objective.Id, err)
+				logger.Error("Failed to get comparator for objective", "objective_id", objective.Id, "error", err)
 				continue
 			}
 			multiplier := 1
@@ -3,6 +3,7 @@ package parser
 import (
 	clientModel "bpl/client"
 	dbModel "bpl/repository"
+	"bpl/utils"
 	"testing"
 	"time"
 
@@ -1318,6 +1319,76 @@ func TestGetPlayerChecker(t *testing.T) {
 		assert.Equal(t, 5000, checker(&Player{PoB: &dbModel.CharacterPob{Evasion: 5000}}))
 	})
 
+	t.Run("custom PoB stat", func(t *testing.T) {
+		obj := makePlayerObjective(1, dbModel.PoBStatTrackedValue("MIN_ELE_MAX_HIT"))
+		checker, err := GetPlayerChecker(obj)
+		require.NoError(t, err)
+		assert.Equal(t, 4200, checker(&Player{PoB: &dbModel.CharacterPob{Stats: dbModel.PoBStats{"MIN_ELE_MAX_HIT": 4200}}}))
+		assert.Equal(t, 0, checker(&Player{PoB: &dbModel.CharacterPob{Stats: dbModel.PoBStats{}}}))
+		assert.Equal(t, 0, checker(&Player{PoB: nil}))
+	})
+
+	t.Run("active minutes to level", func(t *testing.T) {
+		obj := makePlayerObjective(1, dbModel.ActiveMinutesToLevelTrackedValue(90))
+		checker, err := GetPlayerChecker(obj)
+		require.NoError(t, err)
+		assert.Equal(t, 0, checker(&Player{}))
+		assert.Equal(t, 0, checker(&Player{ActiveTimeToLevel: map[int]time.Duration{85: time.Hour}}))
+		assert.Equal(t, 150, checker(&Player{ActiveTimeToLevel: map[int]time.Duration{90: 150 * time.Minute}}))
+
+		_, err = GetPlayerChecker(makePlayerObjective(1, dbModel.ActiveMinutesToLevelTrackedValue(80)))
+		assert.Error(t, err, "only level milestones are tracked")
+		assert.Contains(t, dbModel.ObjectiveTypeToTrackedValues[dbModel.ObjectiveTypePlayer], dbModel.ActiveMinutesToLevelTrackedValue(90))
+	})
+
+	t.Run("every offered tracked value is supported", func(t *testing.T) {
+		for _, trackedValue := range dbModel.ObjectiveTypeToTrackedValues[dbModel.ObjectiveTypePlayer] {
+			_, err := GetPlayerChecker(makePlayerObjective(1, trackedValue))
+			assert.NoError(t, err, trackedValue)
+		}
+	})
+
+	t.Run("character deaths", func(t *testing.T) {
+		checker, err := GetTeamChecker(makeTeamObjective(1, dbModel.TrackedValueCharacterDeaths))
+		require.NoError(t, err)
+		assert.Equal(t, 3, checker([]*Player{{Deaths: 1}, {Deaths: 2}, {}}))
+	})
+
+	t.Run("apply death with freeze policy", func(t *testing.T) {
+		p := &PlayerUpdate{New: Player{Character: &clientModel.Character{Id: "abc", Level: 80}}}
+		p.Token = "token"
+		p.TokenExpiry = time.Now().Add(time.Hour)
+		p.New.Character.Name = "dead"
+		p.ApplyDeath(dbModel.DeathPolicyFreeze)
+		assert.Equal(t, "abc", p.FrozenCharacterId)
+		assert.True(t, p.IsFrozen())
+		assert.True(t, p.CanMakeRequests(), "the player's characters are still listed to find a replacement")
+		assert.False(t, p.CanUpdateCharacter(), "the dead character is no longer fetched")
+		assert.Equal(t, 1, p.New.Deaths)
+		assert.Equal(t, 80, p.New.Character.Level, "contributions of the dead character are kept")
+
+		p.New.Character = &clientModel.Character{Id: "def", Name: "alive", Level: 81}
+		assert.False(t, p.IsFrozen(), "a new character replaces the frozen one")
+		assert.True(t, p.CanUpdateCharacter())
+	})
+
+	t.Run("apply death with reset policy", func(t *testing.T) {
+		p := &PlayerUpdate{New: Player{
+			Character:  &clientModel.Character{Id: "abc", Level: 80},
+			PoB:        &dbModel.CharacterPob{DPS: 1000},
+			DelveDepth: 50,
+			VoidStones: utils.ToSet([]string{"stone"}),
+		}}
+		p.ApplyDeath(dbModel.DeathPolicyReset)
+		assert.False(t, p.IsFrozen())
+		assert.Equal(t, 1, p.New.Deaths)
+		assert.Equal(t, 0, p.New.Character.Level)
+		assert.Equal(t, "", p.New.Character.Id)
+		assert.Equal(t, int64(0), p.New.PoB.DPS)
+		assert.Equal(t, 0, p.New.DelveDepth)
+		assert.Len(t, p.New.VoidStones, 1, "account wide progress is kept")
+	})
+
 	t.Run("PoB movement speed", func(t *testing.T) {
 		obj := makePlayerObjective(1, dbModel.TrackedValueMovementSpeedBonus)
 		checker, err := GetPlayerChecker(obj)
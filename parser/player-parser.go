@@ -18,6 +18,11 @@ type Player struct {
 	Character         *client.Character
 	PoB               *repository.CharacterPob
 	VoidStones        utils.Set[string]
+	// active play time it took to reach each level milestone. Replace the map instead of mutating it,
+	// since Old and New share it after each loop iteration.
+	ActiveTimeToLevel map[int]time.Duration
+	// number of characters that died in a hardcore event
+	Deaths int
 }
 
 type PlayerUpdate struct {
@@ -29,6 +34,9 @@ type PlayerUpdate struct {
 	Mu               sync.Mutex
 	SuccessiveErrors int
 	LastActive       time.Time
+	// the character that died in a hardcore event with the FREEZE death policy. Its contributions are kept as they were
+	// until another character of the player replaces it.
+	FrozenCharacterId string
 
 	New Player
 	Old Player
@@ -47,6 +55,23 @@ func (p *Player) MaxAtlasTreeNodes() int {
 	})...)
 }
 
+// ApplyDeath counts the death of the current character and applies the death policy of the event to the player's contributions
+func (p *PlayerUpdate) ApplyDeath(policy repository.DeathPolicy) {
+	p.New.Deaths++
+	if policy == repository.DeathPolicyReset {
+		p.New.Character = &client.Character{}
+		p.New.PoB = &repository.CharacterPob{}
+		p.New.DelveDepth = 0
+		return
+	}
+	p.FrozenCharacterId = p.New.Character.Id
+}
+
+// IsFrozen returns whether the player's current character is frozen after its death, so its data is no longer fetched
+func (p *PlayerUpdate) IsFrozen() bool {
+	return p.FrozenCharacterId != "" && p.New.Character.Id == p.FrozenCharacterId
+}
+
 func (p *PlayerUpdate) CanMakeRequests() bool {
 	return p.TokenExpiry.After(time.Now()) && p.Token != "" && p.SuccessiveErrors < 5
 }
@@ -58,41 +83,57 @@ func (p *PlayerUpdate) ShouldUpdateCharacterName(timings map[repository.TimingKe
 	return time.Since(p.LastUpdateTimes.CharacterName) > timings[repository.CharacterNameRefetchDelay]
 }
 
-func (p *PlayerUpdate) ShouldUpdateCharacter(timings map[repository.TimingKey]time.Duration) bool {
-	if !p.CanMakeRequests() {
-		return false
-	}
-	if p.New.Character.Name == "" {
-		return false
-	}
-	if p.LastActive.Before(time.Now().Add(-timings[repository.InactivityDuration])) {
-		return time.Since(p.LastUpdateTimes.Character) > timings[repository.CharacterRefetchDelayInactive]
+func (p *PlayerUpdate) IsInactive(timings map[repository.TimingKey]time.Duration) bool {
+	return p.LastActive.Before(time.Now().Add(-timings[repository.InactivityDuration]))
+}
+
+// CanUpdateCharacter returns whether the player has a character that can be fetched, regardless of when it was last fetched
+func (p *PlayerUpdate) CanUpdateCharacter() bool {
+	return p.CanMakeRequests() && p.New.Character.Name != "" && !p.IsFrozen()
+}
+
+// CharacterRefetchDelay is the regular delay between two fetches of the player's character
+func (p *PlayerUpdate) CharacterRefetchDelay(timings map[repository.TimingKey]time.Duration) time.Duration {
+	if p.IsInactive(timings) {
+		return timings[repository.CharacterRefetchDelayInactive]
 	}
 	if p.New.Character.Level > 40 && !p.New.Character.HasPantheon() {
-		return time.Since(p.LastUpdateTimes.Character) > timings[repository.CharacterRefetchDelayImportant]
+		return timings[repository.CharacterRefetchDelayImportant]
 	}
 	if p.New.Character.Level > 68 && p.New.Character.GetAscendancyPoints() < 8 {
-		return time.Since(p.LastUpdateTimes.Character) > timings[repository.CharacterRefetchDelayImportant]
+		return timings[repository.CharacterRefetchDelayImportant]
 	}
-	return time.Since(p.LastUpdateTimes.Character) > timings[repository.CharacterRefetchDelay]
+	return timings[repository.CharacterRefetchDelay]
 }
 
-func (p *PlayerUpdate) ShouldUpdateLeagueAccount(timings map[repository.TimingKey]time.Duration) bool {
-	if !p.CanMakeRequests() {
-		return false
-	}
-	if p.New.Character.Level < 55 {
+func (p *PlayerUpdate) ShouldUpdateCharacter(timings map[repository.TimingKey]time.Duration) bool {
+	if !p.CanUpdateCharacter() {
 		return false
 	}
-	if p.LastActive.Before(time.Now().Add(-timings[repository.InactivityDuration])) {
-		return time.Since(p.LastUpdateTimes.LeagueAccount) > timings[repository.LeagueAccountRefetchDelayInactive]
-	}
+	return time.Since(p.LastUpdateTimes.Character) > p.CharacterRefetchDelay(timings)
+}
 
+// CanUpdateLeagueAccount returns whether the player's league account can be fetched, regardless of when it was last fetched
+func (p *PlayerUpdate) CanUpdateLeagueAccount() bool {
+	return p.CanMakeRequests() && p.New.Character.Level >= 55 && !p.IsFrozen()
+}
+
+// LeagueAccountRefetchDelay is the regular delay between two fetches of the player's league account
+func (p *PlayerUpdate) LeagueAccountRefetchDelay(timings map[repository.TimingKey]time.Duration) time.Duration {
+	if p.IsInactive(timings) {
+		return timings[repository.LeagueAccountRefetchDelayInactive]
+	}
 	if p.New.MaxAtlasTreeNodes() < 100 {
-		return time.Since(p.LastUpdateTimes.LeagueAccount) > timings[repository.LeagueAccountRefetchDelayImportant]
+		return timings[repository.LeagueAccountRefetchDelayImportant]
 	}
+	return timings[repository.LeagueAccountRefetchDelay]
+}
 
-	return time.Since(p.LastUpdateTimes.LeagueAccount) > timings[repository.LeagueAccountRefetchDelay]
+func (p *PlayerUpdate) ShouldUpdateLeagueAccount(timings map[repository.TimingKey]time.Duration) bool {
+	if !p.CanUpdateLeagueAccount() {
+		return false
+	}
+	return time.Since(p.LastUpdateTimes.LeagueAccount) > p.LeagueAccountRefetchDelay(timings)
 }
 
 type TeamObjectiveChecker func(p []*Player) int
@@ -564,6 +605,10 @@ func parserForTrackedValue(numberField repository.TrackedValue) (PlayerObjective
 		return func(p *Player) int {
 			return len(p.VoidStones)
 		}, nil
+	case repository.TrackedValueCharacterDeaths:
+		return func(p *Player) int {
+			return p.Deaths
+		}, nil
 	case repository.TrackedValueHighItemLevelFlaskCount:
 		return func(p *Player) int {
 			return itemCount(p.Character, func(item client.Item) bool {
@@ -615,9 +660,35 @@ func GetPlayerChecker(objective *repository.Objective) (PlayerObjectiveChecker,
 	if (objective.ObjectiveType != repository.ObjectiveTypePlayer) && (objective.ObjectiveType != repository.ObjectiveTypeTeam) {
 		return nil, fmt.Errorf("not a player objective")
 	}
+	if statName, ok := objective.TrackedValue.PoBStatName(); ok {
+		return pobStatChecker(statName), nil
+	}
+	if level, ok := objective.TrackedValue.ActiveMinutesToLevel(); ok {
+		return activeMinutesToLevelChecker(level), nil
+	}
 	return parserForTrackedValue(objective.TrackedValue)
 }
 
+func pobStatChecker(statName string) PlayerObjectiveChecker {
+	return func(p *Player) int {
+		if p.PoB == nil {
+			return 0
+		}
+		return int(p.PoB.Stats[statName])
+	}
+}
+
+// activeMinutesToLevelChecker returns 0 until the player reached the level
+func activeMinutesToLevelChecker(level int) PlayerObjectiveChecker {
+	return func(p *Player) int {
+		activeTime, ok := p.ActiveTimeToLevel[level]
+		if !ok {
+			return 0
+		}
+		return max(int(activeTime.Minutes()), 1)
+	}
+}
+
 func quality(character *client.Character, superclass string) int {
 	if character == nil || character.Equipment == nil {
 		return 0
@@ -26,6 +26,7 @@ type ActivityRepository interface {
 	GetActivity(userId int, eventId int) ([]*Activity, error)
 	GetAllActivitiesForEvent(eventId int) ([]*Activity, error)
 	GetLatestActiveTimestampsForEvent(eventId int) (map[int]time.Time, error)
+	GetLatestActiveTimestampsForUsers(eventId int, userIds []int, since time.Time) (map[int]time.Time, error)
 	GetActivityHistoryForUsers(userIds []int) (map[int]map[int][]*Activity, error)
 }
 
@@ -80,6 +81,30 @@ func (r *ActivityRepositoryImpl) GetLatestActiveTimestampsForEvent(eventId int)
 	return resultMap, nil
 }
 
+func (r *ActivityRepositoryImpl) GetLatestActiveTimestampsForUsers(eventId int, userIds []int, since time.Time) (map[int]time.Time, error) {
+	type Result struct {
+		UserId int
+		Time   time.Time
+	}
+	resultMap := make(map[int]time.Time)
+	if len(userIds) == 0 {
+		return resultMap, nil
+	}
+	results := []Result{}
+	err := r.DB.Model(&Activity{}).
+		Select("user_id, MAX(time) as time").
+		Where("event_id = ? AND user_id IN ? AND time >= ?", eventId, userIds, since).
+		Group("user_id").
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("error fetching latest active timestamps for users %v: %w", userIds, err)
+	}
+	for _, r := range results {
+		resultMap[r.UserId] = r.Time
+	}
+	return resultMap, nil
+}
+
 func (r *ActivityRepositoryImpl) GetActivityHistoryForUsers(userIds []int) (map[int]map[int][]*Activity, error) {
 	activities := []*Activity{}
 	err := r.DB.Where("user_id IN ?", userIds).Find(&activities).Error
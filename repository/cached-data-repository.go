@@ -14,6 +14,8 @@ type CacheKey int
 const (
 	Score  CacheKey = 1
 	Ladder CacheKey = 2
+	// the score of an event at the moment it became final
+	FinalScore CacheKey = 3
 )
 
 type CachedData struct {
@@ -28,6 +30,8 @@ type CachedDataRepository interface {
 	GetLatestLadder(eventId int) ([]byte, error)
 	GetLatestLadderUnMarshalled(eventId int) (*client.Ladder, error)
 	SaveScore(eventId int, scores []byte) error
+	GetFinalScore(eventId int) ([]byte, error)
+	SaveFinalScore(eventId int, scores []byte) error
 	SaveLadder(eventId int, ladder *client.Ladder) error
 }
 
@@ -82,6 +86,24 @@ func (r *CachedDataRepositoryImpl) SaveScore(eventId int, scores []byte) error {
 	}).Error
 }
 
+func (r *CachedDataRepositoryImpl) GetFinalScore(eventId int) ([]byte, error) {
+	var data CachedData
+	result := r.db.First(&data, CachedData{Key: FinalScore, EventId: eventId})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return data.Data, nil
+}
+
+func (r *CachedDataRepositoryImpl) SaveFinalScore(eventId int, scores []byte) error {
+	return r.db.Save(&CachedData{
+		Key:       FinalScore,
+		EventId:   eventId,
+		Data:      scores,
+		Timestamp: time.Now(),
+	}).Error
+}
+
 func (r *CachedDataRepositoryImpl) SaveLadder(eventId int, ladder *client.Ladder) error {
 	data, err := json.Marshal(ladder)
 	if err != nil {
@@ -9,8 +9,10 @@ import (
 	"compress/zlib"
 	"database/sql/driver"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"maps"
 	"regexp"
 	"strings"
 	"time"
@@ -111,6 +113,28 @@ func (p PoBExport) Value() (driver.Value, error) {
 	return []byte(p), nil
 }
 
+// PoBStats holds the values of the event's PoBStatMappings, keyed by mapping name
+type PoBStats map[string]int64
+
+func (s *PoBStats) Scan(value any) error {
+	if value == nil {
+		*s = make(PoBStats)
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to scan PoBStats: expected []byte, got %T", value)
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+func (s PoBStats) Value() (driver.Value, error) {
+	if s == nil {
+		return json.Marshal(map[string]int64{})
+	}
+	return json.Marshal(map[string]int64(s))
+}
+
 type CharacterPob struct {
 	Id               int           `gorm:"not null;primaryKey"`
 	CharacterId      string        `gorm:"not null;index"`
@@ -137,6 +161,8 @@ type CharacterPob struct {
 	AttackBlock   int8  `gorm:"not null"`
 	SpellBlock    int8  `gorm:"not null"`
 	LowestEleRes  int8  `gorm:"not null"`
+
+	Stats PoBStats `gorm:"type:jsonb;not null;default:'{}'"`
 }
 
 func (c *CharacterPob) HasEqualStats(other *CharacterPob) bool {
@@ -157,7 +183,8 @@ func (c *CharacterPob) HasEqualStats(other *CharacterPob) bool {
 		c.AttackBlock == other.AttackBlock &&
 		c.SpellBlock == other.SpellBlock &&
 		c.LowestEleRes == other.LowestEleRes &&
-		c.HighIlevelFlasks == other.HighIlevelFlasks
+		c.HighIlevelFlasks == other.HighIlevelFlasks &&
+		maps.Equal(c.Stats, other.Stats)
 }
 
 func (p *PoBExport) Decode() (*client.PathOfBuilding, error) {
@@ -190,6 +217,13 @@ func (p *CharacterPob) UpdateStats(pob *client.PathOfBuilding) {
 	p.LowestEleRes = float2Int8(min(pob.Build.PlayerStats.FireResist, pob.Build.PlayerStats.ColdResist, pob.Build.PlayerStats.LightningResist))
 }
 
+func (p *CharacterPob) UpdateCustomStats(pob *client.PathOfBuilding, mappings []*PoBStatMapping) {
+	p.Stats = make(PoBStats, len(mappings))
+	for _, mapping := range mappings {
+		p.Stats[mapping.Name] = mapping.Extract(&pob.Build.PlayerStats)
+	}
+}
+
 type CharacterRepository interface {
 	GetPobByCharacterIdBeforeTimestamp(characterId string, timestamp time.Time) (*CharacterPob, error)
 	GetPobs(characterId string) ([]*CharacterPob, error)
@@ -209,6 +243,7 @@ type CharacterRepository interface {
 	GetHighestCharacterLevelForEventsForUsers(userIds []int) (map[int]map[int]int, error)
 	DeletePoB(pobId int) error
 	GetPoBById(pobId int) (*CharacterPob, error)
+	GetPoBHistoryForEvent(eventId int) ([]*CharacterPob, error)
 }
 
 type CharacterRepositoryImpl struct {
@@ -447,3 +482,20 @@ func (r *CharacterRepositoryImpl) GetPoBById(pobId int) (*CharacterPob, error) {
 	}
 	return charData, nil
 }
+
+// GetPoBHistoryForEvent returns the build summary of every PoB in the event without the export, ordered by creation time
+func (r *CharacterRepositoryImpl) GetPoBHistoryForEvent(eventId int) ([]*CharacterPob, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetPoBHistoryForEvent"))
+	defer timer.ObserveDuration()
+	charData := []*CharacterPob{}
+	query := `SELECT p.character_id, p.level, p.main_skill, p.ascendancy, p.dps, p.ehp, p.created_at
+		FROM character_pobs as p
+		JOIN characters ON p.character_id = characters.id
+		WHERE characters.event_id = ?
+		ORDER BY p.created_at ASC`
+	err := r.DB.Raw(query, eventId).Scan(&charData).Error
+	if err != nil {
+		return nil, fmt.Errorf("error getting PoB history for event %d: %w", eventId, err)
+	}
+	return charData, nil
+}
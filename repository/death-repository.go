@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"bpl/config"
+	"bpl/metrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CharacterDeath records a character that left the league of a hardcore event, together with its last known state
+type CharacterDeath struct {
+	CharacterId string    `gorm:"primaryKey"`
+	EventId     int       `gorm:"not null;index"`
+	UserId      int       `gorm:"not null"`
+	TeamId      int       `gorm:"not null"`
+	Name        string    `gorm:"not null"`
+	Level       int       `gorm:"not null"`
+	Ascendancy  string    `gorm:"not null"`
+	PobId       *int      `gorm:"null"`
+	Timestamp   time.Time `gorm:"not null"`
+}
+
+type DeathRepository interface {
+	SaveDeath(death *CharacterDeath) error
+	GetDeathsForEvent(eventId int) ([]*CharacterDeath, error)
+}
+
+type DeathRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewDeathRepository() DeathRepository {
+	return &DeathRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func (r *DeathRepositoryImpl) SaveDeath(death *CharacterDeath) error {
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(death).Error
+}
+
+func (r *DeathRepositoryImpl) GetDeathsForEvent(eventId int) ([]*CharacterDeath, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetDeathsForEvent"))
+	defer timer.ObserveDuration()
+	var deaths []*CharacterDeath
+	err := r.DB.Where("event_id = ?", eventId).Order("timestamp DESC").Find(&deaths).Error
+	if err != nil {
+		return nil, err
+	}
+	return deaths, nil
+}
@@ -18,6 +18,56 @@ const (
 	PoE2 GameVersion = "poe2"
 )
 
+type EventRuleset string
+
+const (
+	RulesetSoftcore         EventRuleset = "SOFTCORE"
+	RulesetHardcore         EventRuleset = "HARDCORE"
+	RulesetRuthless         EventRuleset = "RUTHLESS"
+	RulesetHardcoreRuthless EventRuleset = "HARDCORE_RUTHLESS"
+)
+
+// DeathPolicy decides what happens to the PLAYER objective contributions of a character that died in a hardcore event
+type DeathPolicy string
+
+const (
+	// the contributions stay at the values the character had when it died, until another character of the player reaches a higher level
+	DeathPolicyFreeze DeathPolicy = "FREEZE"
+	// the contributions are revoked and the player's next character in the league is tracked from scratch
+	DeathPolicyReset DeathPolicy = "RESET"
+)
+
+// EventPhase is the step of an event's lifecycle. Draft events are published by an admin,
+// afterwards the phases follow the event's schedule until the event is final. Archiving is manual again.
+type EventPhase string
+
+const (
+	EventPhaseDraft              EventPhase = "DRAFT"
+	EventPhasePublished          EventPhase = "PUBLISHED"
+	EventPhaseApplicationsOpen   EventPhase = "APPLICATIONS_OPEN"
+	EventPhaseApplicationsClosed EventPhase = "APPLICATIONS_CLOSED"
+	EventPhaseRunning            EventPhase = "RUNNING"
+	EventPhaseGracePeriod        EventPhase = "GRACE_PERIOD"
+	EventPhaseFinal              EventPhase = "FINAL"
+	EventPhaseArchived           EventPhase = "ARCHIVED"
+)
+
+var EventPhases = []EventPhase{
+	EventPhaseDraft,
+	EventPhasePublished,
+	EventPhaseApplicationsOpen,
+	EventPhaseApplicationsClosed,
+	EventPhaseRunning,
+	EventPhaseGracePeriod,
+	EventPhaseFinal,
+	EventPhaseArchived,
+}
+
+// IsBefore returns whether the phase comes earlier in the lifecycle than the other one
+func (p EventPhase) IsBefore(other EventPhase) bool {
+	return slices.Index(EventPhases, p) < slices.Index(EventPhases, other)
+}
+
 type Event struct {
 	Id                   int          `gorm:"primaryKey"`
 	Name                 string       `gorm:"not null"`
@@ -34,6 +84,10 @@ type Event struct {
 	Locked               bool         `gorm:"not null"`
 	IsMainEvent          bool         `gorm:"not null"`
 	UsesMedals           bool         `gorm:"not null"`
+	Ruleset              EventRuleset `gorm:"not null;default:SOFTCORE"`
+	DeathPolicy          DeathPolicy  `gorm:"not null;default:FREEZE"`
+	Phase                EventPhase   `gorm:"not null;default:DRAFT"`
+	GracePeriodMinutes   int          `gorm:"not null;default:60"`
 	Teams                []*Team      `gorm:"foreignKey:EventId;constraint:OnDelete:CASCADE"`
 	Objectives           []*Objective `gorm:"foreignKey:EventId;constraint:OnDelete:CASCADE"`
 }
@@ -46,6 +100,26 @@ func (e *Event) GetRealm() *client.Realm {
 	return nil
 }
 
+// IsHardcore returns whether characters that die leave the event league
+func (e *Event) IsHardcore() bool {
+	return e.Ruleset == RulesetHardcore || e.Ruleset == RulesetHardcoreRuthless
+}
+
+// GracePeriodEndTime is when late data stops being collected and the event becomes final
+func (e *Event) GracePeriodEndTime() time.Time {
+	return e.EventEndTime.Add(time.Duration(e.GracePeriodMinutes) * time.Minute)
+}
+
+// SignupsOpen returns whether players can currently apply for the event or withdraw their application
+func (e *Event) SignupsOpen() bool {
+	return e.Phase == EventPhaseApplicationsOpen
+}
+
+// TeamsFrozen returns whether teams and their members can no longer change, since the scores are attributed to them
+func (e *Event) TeamsFrozen() bool {
+	return !e.Phase.IsBefore(EventPhaseGracePeriod)
+}
+
 func (e *Event) TeamIds() []int {
 	return utils.Map(e.Teams, func(t *Team) int { return t.Id })
 }
@@ -58,6 +132,8 @@ type EventRepository interface {
 	FindAll(preloads ...string) ([]*Event, error)
 	SaveEvent(event *Event) (*Event, error)
 	GetEventByConditionId(conditionId int) (*Event, error)
+	UpdatePhase(eventId int, phase EventPhase) error
+	SetLocked(eventId int, locked bool) error
 }
 
 type EventRepositoryImpl struct {
@@ -161,3 +237,11 @@ func (r *EventRepositoryImpl) GetEventByConditionId(conditionId int) (*Event, er
 	}
 	return &event, nil
 }
+
+func (r *EventRepositoryImpl) UpdatePhase(eventId int, phase EventPhase) error {
+	return r.DB.Model(&Event{}).Where("id = ?", eventId).Update("phase", phase).Error
+}
+
+func (r *EventRepositoryImpl) SetLocked(eventId int, locked bool) error {
+	return r.DB.Model(&Event{}).Where("id = ?", eventId).Update("locked", locked).Error
+}
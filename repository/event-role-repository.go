@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bpl/config"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventRole grants a permission to a user within a single event. A role with a team only applies to that team.
+type EventRole struct {
+	Id        int        `gorm:"primaryKey"`
+	UserId    int        `gorm:"not null;references:users(id)"`
+	EventId   int        `gorm:"not null;references:events(id)"`
+	TeamId    *int       `gorm:"null;references:teams(id)"`
+	Role      Permission `gorm:"not null;type:text"`
+	CreatedAt time.Time  `gorm:"not null"`
+
+	User *User `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+}
+
+// AppliesToTeam reports whether the role applies to the team, roles without a team apply to the whole event
+func (r *EventRole) AppliesToTeam(teamId *int) bool {
+	return r.TeamId == nil || (teamId != nil && *r.TeamId == *teamId)
+}
+
+type EventRoleRepository interface {
+	GetEventRoleById(roleId int) (*EventRole, error)
+	GetEventRolesForEvent(eventId int, preloads ...string) ([]*EventRole, error)
+	GetEventRolesForUser(userId int, eventId int) ([]*EventRole, error)
+	// GetEventIdsForUser returns the events in which the user holds any role, including roles restricted to a team
+	GetEventIdsForUser(userId int) ([]int, error)
+	// FindEventRole returns the role with the same user, event, team and role as the given one
+	FindEventRole(role *EventRole) (*EventRole, error)
+	SaveEventRole(role *EventRole) (*EventRole, error)
+	DeleteEventRole(roleId int) error
+}
+
+type EventRoleRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewEventRoleRepository() EventRoleRepository {
+	return &EventRoleRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func (r *EventRoleRepositoryImpl) GetEventRoleById(roleId int) (*EventRole, error) {
+	var role EventRole
+	err := r.DB.First(&role, roleId).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *EventRoleRepositoryImpl) GetEventRolesForEvent(eventId int, preloads ...string) ([]*EventRole, error) {
+	var roles []*EventRole
+	query := r.DB.Where("event_id = ?", eventId)
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+	err := query.Order("id").Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *EventRoleRepositoryImpl) GetEventRolesForUser(userId int, eventId int) ([]*EventRole, error) {
+	var roles []*EventRole
+	err := r.DB.Where("user_id = ? AND event_id = ?", userId, eventId).Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *EventRoleRepositoryImpl) GetEventIdsForUser(userId int) ([]int, error) {
+	var eventIds []int
+	err := r.DB.Model(&EventRole{}).Where("user_id = ?", userId).Distinct().Pluck("event_id", &eventIds).Error
+	if err != nil {
+		return nil, err
+	}
+	return eventIds, nil
+}
+
+func (r *EventRoleRepositoryImpl) FindEventRole(role *EventRole) (*EventRole, error) {
+	var existing EventRole
+	query := r.DB.Where("user_id = ? AND event_id = ? AND role = ?", role.UserId, role.EventId, role.Role)
+	if role.TeamId == nil {
+		query = query.Where("team_id IS NULL")
+	} else {
+		query = query.Where("team_id = ?", *role.TeamId)
+	}
+	err := query.First(&existing).Error
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *EventRoleRepositoryImpl) SaveEventRole(role *EventRole) (*EventRole, error) {
+	err := r.DB.Save(role).Error
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (r *EventRoleRepositoryImpl) DeleteEventRole(roleId int) error {
+	return r.DB.Delete(&EventRole{}, roleId).Error
+}
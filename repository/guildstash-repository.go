@@ -87,6 +87,7 @@ type GuildStashChangelog struct {
 	ItemName    string    `gorm:"not null"`
 	X           int       `gorm:"not null"`
 	Y           int       `gorm:"not null"`
+	Derived     bool      `gorm:"not null;default:false"` // true if derived from tab snapshots instead of uploaded by a team lead
 }
 
 type Guild struct {
@@ -279,6 +280,8 @@ func (r *GuildStashRepositoryImpl) SaveGuildstashLogs(logs []*GuildStashChangelo
 	return r.db.Save(logs).Error
 }
 
+// GetLatestLogEntryTimestampForGuild returns the range of the uploaded log entries. Derived entries are ignored, since
+// the uploader resumes from this range and would otherwise skip the real entries of the time they cover.
 func (r *GuildStashRepositoryImpl) GetLatestLogEntryTimestampForGuild(event *Event, guildId int) (*int64, *int64) {
 	var result struct {
 		EarliestTimestamp *time.Time
@@ -286,7 +289,7 @@ func (r *GuildStashRepositoryImpl) GetLatestLogEntryTimestampForGuild(event *Eve
 	}
 	err := r.db.Model(&GuildStashChangelog{}).
 		Select("MIN(timestamp) as earliest_timestamp, MAX(timestamp) as latest_timestamp").
-		Where("event_id = ? AND guild_id = ?", event.Id, guildId).
+		Where("event_id = ? AND guild_id = ? AND NOT derived", event.Id, guildId).
 		Scan(&result).Error
 
 	if err != nil || result.EarliestTimestamp == nil || result.LatestTimestamp == nil {
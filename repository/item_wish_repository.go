@@ -2,8 +2,11 @@ package repository
 
 import (
 	"bpl/config"
+	"encoding/json"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ItemWishRepository interface {
@@ -11,9 +14,13 @@ type ItemWishRepository interface {
 	SaveItemWishes(itemWishes []*ItemWish) ([]*ItemWish, error)
 	GetItemWishesForTeamAndUser(teamId int, userId int) (itemWishes []*ItemWish, err error)
 	GetItemWishesForTeam(teamId int) (itemWishes []*ItemWish, err error)
-	GetSimilarItemWishesInTeam(teamId int, itemField ItemField, value string) (itemWishes []*ItemWish, err error)
+	GetSimilarItemWishesInTeam(teamId int, conditions Conditions) (itemWishes []*ItemWish, err error)
 	DeleteItemWish(id int) error
 	GetItemWishById(id int) (*ItemWish, error)
+	GetOpenItemWishesForEvent(eventId int) (itemWishes []*ItemWish, err error)
+	SaveItemWishCandidate(candidate *ItemWishCandidate) (created bool, err error)
+	GetItemWishCandidatesForTeam(teamId int) (candidates []*ItemWishCandidate, err error)
+	SetItemWishCandidatesNotified(ids []int) error
 }
 
 type ItemWishRepositoryImpl struct {
@@ -25,20 +32,40 @@ func NewItemWishRepository() ItemWishRepository {
 }
 
 type ItemWish struct {
-	Id            int       `gorm:"not null;primaryKey;autoIncrement"`
-	UserID        int       `gorm:"not null;index:idx_user_event_item_wish"`
-	TeamID        int       `gorm:"not null;index:idx_user_team_item_wish"`
-	ItemField     ItemField `gorm:"not null"`
-	Value         string    `gorm:"not null"`
-	Extra         string    `gorm:"not null;default:''"`
-	Fulfilled     bool      `gorm:"not null;default:false"`
-	BuildEnabling bool      `gorm:"not null;default:false"`
-	Priority      int       `gorm:"not null;default:0"`
+	Id            int        `gorm:"not null;primaryKey;autoIncrement"`
+	UserID        int        `gorm:"not null;index:idx_user_event_item_wish"`
+	TeamID        int        `gorm:"not null;index:idx_user_team_item_wish"`
+	ItemField     ItemField  `gorm:"not null"`
+	Value         string     `gorm:"not null"`
+	Extra         string     `gorm:"not null;default:''"`
+	Fulfilled     bool       `gorm:"not null;default:false"`
+	BuildEnabling bool       `gorm:"not null;default:false"`
+	Priority      int        `gorm:"not null;default:0"`
+	Conditions    Conditions `gorm:"type:jsonb;not null"`
 
 	User *User `gorm:"foreignKey:UserID"`
 	Team *Team `gorm:"foreignKey:TeamID"`
 }
 
+// ItemWishCandidate is an item seen in one of the team's stashes that satisfies all conditions of an open wish
+type ItemWishCandidate struct {
+	Id          int              `gorm:"not null;primaryKey;autoIncrement"`
+	ItemWishId  int              `gorm:"not null;uniqueIndex:item_wish_candidates_wish_item_key"`
+	TeamId      int              `gorm:"not null;index"`
+	EventId     int              `gorm:"not null"`
+	ItemId      string           `gorm:"not null;uniqueIndex:item_wish_candidates_wish_item_key"`
+	StashId     string           `gorm:"not null"`
+	StashName   *string          `gorm:"null"`
+	AccountName string           `gorm:"not null;default:''"`
+	Source      UniqueItemSource `gorm:"not null"`
+	X           *int             `gorm:"null"`
+	Y           *int             `gorm:"null"`
+	Timestamp   time.Time        `gorm:"not null"`
+	Notified    bool             `gorm:"not null;default:false"`
+
+	ItemWish *ItemWish `gorm:"foreignKey:ItemWishId"`
+}
+
 func (r *ItemWishRepositoryImpl) SaveItemWish(itemWish *ItemWish) (*ItemWish, error) {
 	err := r.DB.Save(itemWish).Error
 	return itemWish, err
@@ -64,8 +91,16 @@ func (r *ItemWishRepositoryImpl) GetItemWishesForTeam(teamId int) (itemWishes []
 	return itemWishes, nil
 }
 
-func (r *ItemWishRepositoryImpl) GetSimilarItemWishesInTeam(teamId int, itemField ItemField, value string) (itemWishes []*ItemWish, err error) {
-	err = r.DB.Where("team_id = ? AND item_field = ? AND value = ?", teamId, itemField, value).Find(&itemWishes).Error
+// GetSimilarItemWishesInTeam returns the wishes of the team with the same conditions, which share one priority ranking
+func (r *ItemWishRepositoryImpl) GetSimilarItemWishesInTeam(teamId int, conditions Conditions) (itemWishes []*ItemWish, err error) {
+	if conditions == nil {
+		conditions = Conditions{}
+	}
+	value, err := json.Marshal(conditions)
+	if err != nil {
+		return nil, err
+	}
+	err = r.DB.Where("team_id = ? AND conditions = ?::jsonb", teamId, string(value)).Find(&itemWishes).Error
 	if err != nil {
 		return nil, err
 	}
@@ -84,3 +119,40 @@ func (r *ItemWishRepositoryImpl) GetItemWishById(id int) (*ItemWish, error) {
 	}
 	return &itemWish, nil
 }
+
+func (r *ItemWishRepositoryImpl) GetOpenItemWishesForEvent(eventId int) (itemWishes []*ItemWish, err error) {
+	err = r.DB.Joins("JOIN teams ON teams.id = item_wishes.team_id").
+		Where("teams.event_id = ? AND item_wishes.fulfilled = false", eventId).
+		Find(&itemWishes).Error
+	if err != nil {
+		return nil, err
+	}
+	return itemWishes, nil
+}
+
+// SaveItemWishCandidate stores the candidate unless the item was already recorded for the wish
+func (r *ItemWishRepositoryImpl) SaveItemWishCandidate(candidate *ItemWishCandidate) (created bool, err error) {
+	result := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "item_wish_id"}, {Name: "item_id"}},
+		DoNothing: true,
+	}).Create(candidate)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *ItemWishRepositoryImpl) GetItemWishCandidatesForTeam(teamId int) (candidates []*ItemWishCandidate, err error) {
+	err = r.DB.Where("team_id = ?", teamId).Order("timestamp DESC").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+func (r *ItemWishRepositoryImpl) SetItemWishCandidatesNotified(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.DB.Model(&ItemWishCandidate{}).Where("id IN ?", ids).Update("notified", true).Error
+}
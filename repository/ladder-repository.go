@@ -4,6 +4,7 @@ import (
 	"bpl/client"
 	"bpl/config"
 	"bpl/metrics"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"gorm.io/gorm"
@@ -22,9 +23,34 @@ type LadderEntry struct {
 	EventId       int     `gorm:"foreignKey:EventId;constraint:OnDelete:CASCADE;index;not null"`
 }
 
+type LadderSnapshot struct {
+	EventId    int       `gorm:"primaryKey"`
+	Character  string    `gorm:"primaryKey"`
+	Account    string    `gorm:"not null"`
+	UserId     *int      `gorm:"null"`
+	Class      string    `gorm:"not null"`
+	Level      int       `gorm:"not null"`
+	Delve      int       `gorm:"not null"`
+	Experience int       `gorm:"not null"`
+	Rank       int       `gorm:"not null"`
+	Timestamp  time.Time `gorm:"primaryKey"`
+}
+
+type LevelReached struct {
+	Character string
+	UserId    *int
+	Timestamp time.Time
+}
+
 type LadderRepository interface {
 	UpsertLadder(ladder []*client.LadderEntry, eventId int, playerMap map[string]int) error
 	GetLadderForEvent(eventId int) ([]*LadderEntry, error)
+	SaveSnapshots(snapshots []*LadderSnapshot) error
+	GetLatestSnapshots(eventId int) ([]*LadderSnapshot, error)
+	GetSnapshotsForCharacter(eventId int, character string) ([]*LadderSnapshot, error)
+	GetSnapshotsForEvent(eventId int) ([]*LadderSnapshot, error)
+	GetFirstTimesReachingLevel(eventId int, level int) ([]*LevelReached, error)
+	DeleteSnapshotsBefore(eventId int, cutoff time.Time) error
 }
 
 type LadderRepositoryImpl struct {
@@ -80,3 +106,80 @@ func (r *LadderRepositoryImpl) GetLadderForEvent(eventId int) ([]*LadderEntry, e
 	}
 	return ladder, nil
 }
+
+func (r *LadderRepositoryImpl) SaveSnapshots(snapshots []*LadderSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return r.DB.CreateInBatches(snapshots, 500).Error
+}
+
+func (r *LadderRepositoryImpl) GetLatestSnapshots(eventId int) ([]*LadderSnapshot, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetLatestSnapshots"))
+	defer timer.ObserveDuration()
+	var snapshots []*LadderSnapshot
+	err := r.DB.Raw(`
+		SELECT DISTINCT ON ("character") *
+		FROM ladder_snapshots
+		WHERE event_id = ?
+		ORDER BY "character", "timestamp" DESC
+	`, eventId).Scan(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (r *LadderRepositoryImpl) GetSnapshotsForCharacter(eventId int, character string) ([]*LadderSnapshot, error) {
+	var snapshots []*LadderSnapshot
+	err := r.DB.Where("event_id = ? AND character = ?", eventId, character).Order("timestamp ASC").Find(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (r *LadderRepositoryImpl) GetSnapshotsForEvent(eventId int) ([]*LadderSnapshot, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetSnapshotsForEvent"))
+	defer timer.ObserveDuration()
+	var snapshots []*LadderSnapshot
+	err := r.DB.Where("event_id = ?", eventId).Order("timestamp ASC").Find(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (r *LadderRepositoryImpl) GetFirstTimesReachingLevel(eventId int, level int) ([]*LevelReached, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetFirstTimesReachingLevel"))
+	defer timer.ObserveDuration()
+	var reached []*LevelReached
+	err := r.DB.Raw(`
+		SELECT "character", MAX(user_id) AS user_id, MIN("timestamp") AS "timestamp"
+		FROM ladder_snapshots
+		WHERE event_id = ? AND "level" >= ?
+		GROUP BY "character"
+	`, eventId, level).Scan(&reached).Error
+	if err != nil {
+		return nil, err
+	}
+	return reached, nil
+}
+
+// DeleteSnapshotsBefore removes snapshots older than the cutoff, but keeps the latest snapshot of every character
+// since it still describes the character's current state, and the first snapshot of every character at each level
+// since the level races are computed from them
+func (r *LadderRepositoryImpl) DeleteSnapshotsBefore(eventId int, cutoff time.Time) error {
+	return r.DB.Exec(`
+		DELETE FROM ladder_snapshots s
+		WHERE s.event_id = ? AND s."timestamp" < ?
+		AND EXISTS (
+			SELECT 1 FROM ladder_snapshots n
+			WHERE n.event_id = s.event_id AND n."character" = s."character" AND n."timestamp" > s."timestamp"
+		)
+		AND EXISTS (
+			SELECT 1 FROM ladder_snapshots p
+			WHERE p.event_id = s.event_id AND p."character" = s."character" AND p."level" = s."level" AND p."timestamp" < s."timestamp"
+		)
+	`, eventId, cutoff).Error
+}
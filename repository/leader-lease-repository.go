@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"bpl/config"
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LeaderLease records which instance currently leads a role. The advisory lock decides the leadership,
+// the lease only makes it visible to the other instances.
+type LeaderLease struct {
+	Role       string    `gorm:"primaryKey"`
+	InstanceId string    `gorm:"not null"`
+	AcquiredAt time.Time `gorm:"not null"`
+	RenewedAt  time.Time `gorm:"not null"`
+}
+
+type LeaderLeaseRepository interface {
+	// TryLock takes the session level advisory lock of the role on a dedicated connection, which holds it until it is unlocked or closed
+	TryLock(ctx context.Context, role string) (*sql.Conn, bool, error)
+	Unlock(conn *sql.Conn, role string) error
+	SaveLease(lease *LeaderLease) error
+	DeleteLease(role string, instanceId string) error
+	GetLeases() ([]*LeaderLease, error)
+}
+
+type LeaderLeaseRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewLeaderLeaseRepository() LeaderLeaseRepository {
+	return &LeaderLeaseRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func (r *LeaderLeaseRepositoryImpl) TryLock(ctx context.Context, role string) (*sql.Conn, bool, error) {
+	sqlDB, err := r.DB.DB()
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", "leader:"+role).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+	return conn, true, nil
+}
+
+func (r *LeaderLeaseRepositoryImpl) Unlock(conn *sql.Conn, role string) error {
+	defer conn.Close()
+	_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", "leader:"+role)
+	return err
+}
+
+func (r *LeaderLeaseRepositoryImpl) SaveLease(lease *LeaderLease) error {
+	return r.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(lease).Error
+}
+
+func (r *LeaderLeaseRepositoryImpl) DeleteLease(role string, instanceId string) error {
+	return r.DB.Where("role = ? AND instance_id = ?", role, instanceId).Delete(&LeaderLease{}).Error
+}
+
+func (r *LeaderLeaseRepositoryImpl) GetLeases() ([]*LeaderLease, error) {
+	var leases []*LeaderLease
+	err := r.DB.Order("role").Find(&leases).Error
+	if err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
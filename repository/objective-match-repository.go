@@ -3,12 +3,16 @@ package repository
 import (
 	"bpl/client"
 	"bpl/config"
-	"log"
+	"bpl/metrics"
+	"context"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"gorm.io/gorm"
 )
 
+var logger = config.Logger("repository")
+
 type ObjectiveMatch struct {
 	ObjectiveId   int       `gorm:"index:obj_match_obj;index:obj_match_obj_user;not null;references:objectives(id)"`
 	Timestamp     time.Time `gorm:"not null"`
@@ -32,11 +36,14 @@ type KafkaConsumer struct {
 type ObjectiveMatchRepository interface {
 	SaveValidations(objectiveValidations []*ObjectiveValidation) error
 	GetValidationsByEventId(eventId int) ([]*ObjectiveValidation, error)
-	SaveMatches(objectiveMatches []*ObjectiveMatch) error
-	OverwriteMatches(objectiveMatches []*ObjectiveMatch, objectiveIds []int) error
+	SaveMatches(ctx context.Context, objectiveMatches []*ObjectiveMatch) error
+	OverwriteMatches(ctx context.Context, objectiveMatches []*ObjectiveMatch, objectiveIds []int) error
 	GetKafkaConsumer(eventId int) (*KafkaConsumer, error)
 	SaveKafkaConsumer(consumer *KafkaConsumer) error
 	DeleteMatches(objectiveIds []int) error
+	GetLatestMatches(objectiveIds []int) ([]*ObjectiveMatch, error)
+	CompactMatches(objectiveIds []int) (int64, error)
+	GetLatestMatchTimestamps(eventId int) (map[ObjectiveType]time.Time, error)
 }
 
 type ObjectiveMatchRepositoryImpl struct {
@@ -68,26 +75,26 @@ func (r *ObjectiveMatchRepositoryImpl) GetValidationsByEventId(eventId int) ([]*
 	return validations, nil
 }
 
-func (r *ObjectiveMatchRepositoryImpl) SaveMatches(objectiveMatches []*ObjectiveMatch) error {
-	result := r.DB.CreateInBatches(objectiveMatches, 1000)
+func (r *ObjectiveMatchRepositoryImpl) SaveMatches(ctx context.Context, objectiveMatches []*ObjectiveMatch) error {
+	result := r.DB.WithContext(ctx).CreateInBatches(objectiveMatches, 1000)
 	if result.Error != nil {
 		return result.Error
 	}
 	return nil
 }
 
-func (r *ObjectiveMatchRepositoryImpl) OverwriteMatches(objectiveMatches []*ObjectiveMatch, objectiveIds []int) error {
-	return r.DB.Transaction(func(tx *gorm.DB) error {
+func (r *ObjectiveMatchRepositoryImpl) OverwriteMatches(ctx context.Context, objectiveMatches []*ObjectiveMatch, objectiveIds []int) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		t := time.Now()
 		err := r.DeleteMatches(objectiveIds)
 		if err != nil {
 			return err
 		}
-		err = r.SaveMatches(objectiveMatches)
+		err = r.SaveMatches(ctx, objectiveMatches)
 		if err != nil {
 			return err
 		}
-		log.Printf("Overwrite took %s", time.Since(t))
+		logger.DebugContext(ctx, "Overwrote matches", "objectives", len(objectiveIds), "matches", len(objectiveMatches), "duration", time.Since(t))
 		return nil
 	})
 }
@@ -119,3 +126,75 @@ func (r *ObjectiveMatchRepositoryImpl) SaveKafkaConsumer(consumer *KafkaConsumer
 func (r *ObjectiveMatchRepositoryImpl) DeleteMatches(objectiveIds []int) error {
 	return r.DB.Where("objective_id IN ?", objectiveIds).Delete(&ObjectiveMatch{}).Error
 }
+
+// GetLatestMatchTimestamps returns when a match was last saved for each objective type of the event
+func (r *ObjectiveMatchRepositoryImpl) GetLatestMatchTimestamps(eventId int) (map[ObjectiveType]time.Time, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetLatestMatchTimestamps"))
+	defer timer.ObserveDuration()
+	type Result struct {
+		ObjectiveType ObjectiveType
+		Timestamp     time.Time
+	}
+	var results []*Result
+	query := `
+		SELECT objectives.objective_type, MAX(objective_matches.timestamp) AS timestamp
+		FROM objective_matches
+		JOIN objectives ON objectives.id = objective_matches.objective_id
+		WHERE objectives.event_id = ?
+		GROUP BY objectives.objective_type
+	`
+	err := r.DB.Raw(query, eventId).Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	timestamps := make(map[ObjectiveType]time.Time, len(results))
+	for _, result := range results {
+		timestamps[result.ObjectiveType] = result.Timestamp
+	}
+	return timestamps, nil
+}
+
+// GetLatestMatches returns the most recent match without a stash change per objective and user or team
+func (r *ObjectiveMatchRepositoryImpl) GetLatestMatches(objectiveIds []int) ([]*ObjectiveMatch, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetLatestMatches"))
+	defer timer.ObserveDuration()
+	var matches []*ObjectiveMatch
+	query := `
+		SELECT DISTINCT ON (objective_id, user_id, team_id) *
+		FROM objective_matches
+		WHERE objective_id IN ? AND stash_change_id IS NULL
+		ORDER BY objective_id, user_id, team_id, timestamp DESC
+	`
+	err := r.DB.Raw(query, objectiveIds).Scan(&matches).Error
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// CompactMatches deletes matches without a stash change that repeat the number of the previous match of the same
+// objective and user or team. The first and the last match of every user or team are always kept, so that the earliest,
+// extreme and latest values and their timestamps stay the same. Returns the number of deleted matches.
+func (r *ObjectiveMatchRepositoryImpl) CompactMatches(objectiveIds []int) (int64, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("CompactMatches"))
+	defer timer.ObserveDuration()
+	query := `
+		WITH ordered AS (
+			SELECT
+				ctid AS row_id,
+				number,
+				LAG(number) OVER series AS previous_number,
+				LEAD(timestamp) OVER series AS next_timestamp
+			FROM objective_matches
+			WHERE objective_id IN ? AND stash_change_id IS NULL
+			WINDOW series AS (PARTITION BY objective_id, user_id, team_id ORDER BY timestamp, ctid)
+		)
+		DELETE FROM objective_matches
+		WHERE ctid IN (
+			SELECT row_id FROM ordered
+			WHERE number = previous_number AND next_timestamp IS NOT NULL
+		)
+	`
+	result := r.DB.Exec(query, objectiveIds)
+	return result.RowsAffected, result.Error
+}
@@ -4,6 +4,9 @@ import (
 	"bpl/config"
 	"bpl/utils"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -52,6 +55,7 @@ const (
 	TrackedValuePersonalObjectiveScore          TrackedValue = "PERSONAL_OBJECTIVE_SCORE"
 	TrackedValueHasRareAscendancyPast90         TrackedValue = "HAS_RARE_ASCENDANCY_PAST_90"
 	TrackedValueVoidStoneCount                  TrackedValue = "VOID_STONE_COUNT"
+	TrackedValueCharacterDeaths                 TrackedValue = "CHARACTER_DEATHS"
 
 	TrackedValueWeaponQuality TrackedValue = "WEAPON_QUALITY"
 	TrackedValueArmourQuality TrackedValue = "ARMOUR_QUALITY"
@@ -86,7 +90,50 @@ const (
 	TrackedValueCompletedChildObjectiveCount TrackedValue = "COMPLETED_CHILD_OBJECTIVE_COUNT"
 )
 
-var playerObjectiveTrackedValues = []TrackedValue{
+// tracked values of PLAYER and TEAM objectives that start with this prefix refer to a PoBStatMapping of the event
+const pobStatTrackedValuePrefix = "POB_STAT:"
+
+func PoBStatTrackedValue(mappingName string) TrackedValue {
+	return TrackedValue(pobStatTrackedValuePrefix + mappingName)
+}
+
+// PoBStatName returns the name of the PoBStatMapping the tracked value refers to
+func (t TrackedValue) PoBStatName() (string, bool) {
+	name, found := strings.CutPrefix(string(t), pobStatTrackedValuePrefix)
+	return name, found && name != ""
+}
+
+// LevelMilestones are the character levels for which the time to reach them is tracked
+var LevelMilestones = []int{70, 85, 90, 95, 100}
+
+const activeMinutesToLevelTrackedValuePrefix = "ACTIVE_MINUTES_TO_LEVEL:"
+
+func ActiveMinutesToLevelTrackedValue(level int) TrackedValue {
+	return TrackedValue(activeMinutesToLevelTrackedValuePrefix + strconv.Itoa(level))
+}
+
+// ActiveMinutesToLevel returns the level milestone the tracked value refers to
+func (t TrackedValue) ActiveMinutesToLevel() (int, bool) {
+	suffix, found := strings.CutPrefix(string(t), activeMinutesToLevelTrackedValuePrefix)
+	if !found {
+		return 0, false
+	}
+	level, err := strconv.Atoi(suffix)
+	if err != nil || !slices.Contains(LevelMilestones, level) {
+		return 0, false
+	}
+	return level, true
+}
+
+func activeMinutesToLevelTrackedValues() []TrackedValue {
+	trackedValues := make([]TrackedValue, 0, len(LevelMilestones))
+	for _, level := range LevelMilestones {
+		trackedValues = append(trackedValues, ActiveMinutesToLevelTrackedValue(level))
+	}
+	return trackedValues
+}
+
+var playerObjectiveTrackedValues = slices.Concat([]TrackedValue{
 	TrackedValueCharacterLevel,
 	TrackedValueDelveDepth,
 	TrackedValueDelveDepthAfter100,
@@ -118,7 +165,8 @@ var playerObjectiveTrackedValues = []TrackedValue{
 	TrackedValueJewelsWithImplicitsCount,
 	TrackedValueHasRareAscendancyPast90,
 	TrackedValueEnchantedItemCount,
-}
+	TrackedValueCharacterDeaths,
+}, activeMinutesToLevelTrackedValues())
 
 var ObjectiveTypeToTrackedValues = map[ObjectiveType][]TrackedValue{
 	ObjectiveTypeItem:       {TrackedValueStackSize, TrackedValueFossilFuelHigh, TrackedValueFossilFuelMid},
@@ -128,6 +176,20 @@ var ObjectiveTypeToTrackedValues = map[ObjectiveType][]TrackedValue{
 	ObjectiveTypeCategory:   {TrackedValueCompletedChildObjectiveCount},
 }
 
+// TrackedValuesForEvent extends ObjectiveTypeToTrackedValues by the tracked values of the event's PoB stat mappings
+func TrackedValuesForEvent(pobStatMappings []*PoBStatMapping) map[ObjectiveType][]TrackedValue {
+	trackedValues := make(map[ObjectiveType][]TrackedValue, len(ObjectiveTypeToTrackedValues))
+	for objectiveType, values := range ObjectiveTypeToTrackedValues {
+		trackedValues[objectiveType] = slices.Clone(values)
+	}
+	for _, mapping := range pobStatMappings {
+		for _, objectiveType := range []ObjectiveType{ObjectiveTypePlayer, ObjectiveTypeTeam} {
+			trackedValues[objectiveType] = append(trackedValues[objectiveType], PoBStatTrackedValue(mapping.Name))
+		}
+	}
+	return trackedValues
+}
+
 type SyncStatus string
 
 const (
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"bpl/config"
+	"bpl/metrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// PassiveTree is a snapshot of the passive nodes a character had allocated at a point in time
+type PassiveTree struct {
+	CharacterId string       `gorm:"primaryKey"`
+	EventId     int          `gorm:"not null;index"`
+	Ascendancy  string       `gorm:"not null"`
+	Level       int          `gorm:"not null"`
+	Nodes       PassiveNodes `gorm:"not null;type:int2[]"`
+	Timestamp   time.Time    `gorm:"primaryKey"`
+}
+
+type PassiveTreeRepository interface {
+	SaveTree(tree *PassiveTree) error
+	GetTreesForCharacter(characterId string) ([]*PassiveTree, error)
+	GetLatestTreesForEvent(eventId int) ([]*PassiveTree, error)
+}
+
+type PassiveTreeRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewPassiveTreeRepository() PassiveTreeRepository {
+	return &PassiveTreeRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func (r *PassiveTreeRepositoryImpl) SaveTree(tree *PassiveTree) error {
+	return r.DB.Create(tree).Error
+}
+
+func (r *PassiveTreeRepositoryImpl) GetTreesForCharacter(characterId string) ([]*PassiveTree, error) {
+	var trees []*PassiveTree
+	err := r.DB.Where("character_id = ?", characterId).Order("timestamp ASC").Find(&trees).Error
+	if err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
+
+func (r *PassiveTreeRepositoryImpl) GetLatestTreesForEvent(eventId int) ([]*PassiveTree, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetLatestPassiveTreesForEvent"))
+	defer timer.ObserveDuration()
+	var trees []*PassiveTree
+	err := r.DB.Raw(`
+		SELECT DISTINCT ON (character_id) *
+		FROM passive_trees
+		WHERE event_id = ?
+		ORDER BY character_id, "timestamp" DESC
+	`, eventId).Scan(&trees).Error
+	if err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
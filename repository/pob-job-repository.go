@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"bpl/client"
+	"bpl/config"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PoBJobStatus string
+
+const (
+	PoBJobStatusPending PoBJobStatus = "pending"
+	PoBJobStatusRunning PoBJobStatus = "running"
+	PoBJobStatusDead    PoBJobStatus = "dead"
+)
+
+type CharacterData client.Character
+
+func (c *CharacterData) Scan(value any) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, c)
+}
+
+func (c CharacterData) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+type PoBJob struct {
+	CharacterId   string        `gorm:"primaryKey"`
+	EventId       int           `gorm:"not null"`
+	UserId        *int          `gorm:"null"`
+	Character     CharacterData `gorm:"type:jsonb;not null"`
+	Status        PoBJobStatus  `gorm:"type:pob_job_status;not null;default:pending"`
+	Version       int           `gorm:"not null;default:0"`
+	Attempts      int           `gorm:"not null;default:0"`
+	NextAttemptAt time.Time     `gorm:"not null"`
+	LastError     string        `gorm:"not null;default:''"`
+	CreatedAt     time.Time     `gorm:"not null"`
+	UpdatedAt     time.Time     `gorm:"not null"`
+}
+
+func (j *PoBJob) GetCharacter() *client.Character {
+	return (*client.Character)(&j.Character)
+}
+
+type PoBJobRepository interface {
+	Enqueue(job *PoBJob) error
+	ClaimJobs(limit int, staleAfter time.Duration) ([]*PoBJob, error)
+	CompleteJob(job *PoBJob) error
+	FailJob(job *PoBJob) error
+	GetJobs(status *PoBJobStatus) ([]*PoBJob, error)
+	RequeueJobs(characterIds []string) (int64, error)
+	CountJobsByStatus() (map[PoBJobStatus]int, error)
+	GetOldestPendingJob() (*PoBJob, error)
+}
+
+type PoBJobRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewPoBJobRepository() PoBJobRepository {
+	return &PoBJobRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+// Enqueue adds a job for the character or replaces the payload of its existing job
+func (r *PoBJobRepositoryImpl) Enqueue(job *PoBJob) error {
+	return r.DB.Exec(`
+		INSERT INTO pob_jobs (character_id, event_id, user_id, "character", status, "version", attempts, next_attempt_at, last_error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 'pending', 0, 0, now(), '', now(), now())
+		ON CONFLICT (character_id) DO UPDATE SET
+			event_id = EXCLUDED.event_id,
+			user_id = EXCLUDED.user_id,
+			"character" = EXCLUDED."character",
+			status = 'pending',
+			"version" = pob_jobs."version" + 1,
+			attempts = 0,
+			next_attempt_at = now(),
+			last_error = '',
+			updated_at = now()
+	`, job.CharacterId, job.EventId, job.UserId, job.Character).Error
+}
+
+// ClaimJobs marks up to limit due jobs as running and returns them. Jobs that have been running for longer
+// than staleAfter are assumed to belong to a worker that died and are claimed again.
+// Every claim bumps the version, so a worker whose claim went stale can no longer complete or fail the job.
+func (r *PoBJobRepositoryImpl) ClaimJobs(limit int, staleAfter time.Duration) ([]*PoBJob, error) {
+	var jobs []*PoBJob
+	err := r.DB.Raw(`
+		UPDATE pob_jobs SET status = 'running', "version" = "version" + 1, updated_at = now()
+		WHERE character_id IN (
+			SELECT character_id FROM pob_jobs
+			WHERE (status = 'pending' AND next_attempt_at <= now())
+			OR (status = 'running' AND updated_at < ?)
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`, time.Now().Add(-staleAfter), limit).Scan(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// CompleteJob removes the job unless it was requeued or claimed by another worker since it was claimed with the given version
+func (r *PoBJobRepositoryImpl) CompleteJob(job *PoBJob) error {
+	return r.DB.Where("character_id = ? AND version = ?", job.CharacterId, job.Version).Delete(&PoBJob{}).Error
+}
+
+func (r *PoBJobRepositoryImpl) FailJob(job *PoBJob) error {
+	return r.DB.Model(&PoBJob{}).
+		Where("character_id = ? AND version = ?", job.CharacterId, job.Version).
+		Updates(map[string]any{
+			"status":          job.Status,
+			"attempts":        job.Attempts,
+			"next_attempt_at": job.NextAttemptAt,
+			"last_error":      job.LastError,
+			"updated_at":      time.Now(),
+		}).Error
+}
+
+func (r *PoBJobRepositoryImpl) GetJobs(status *PoBJobStatus) ([]*PoBJob, error) {
+	var jobs []*PoBJob
+	query := r.DB.Omit("character").Order("next_attempt_at ASC")
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	err := query.Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetOldestPendingJob returns the pending job that has been waiting the longest, or nil if the queue is empty
+func (r *PoBJobRepositoryImpl) GetOldestPendingJob() (*PoBJob, error) {
+	var jobs []*PoBJob
+	err := r.DB.Omit("character").Where("status = ?", PoBJobStatusPending).Order("created_at ASC").Limit(1).Find(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// RequeueJobs resets the given jobs so that they are picked up immediately. Without ids all dead jobs are requeued.
+func (r *PoBJobRepositoryImpl) RequeueJobs(characterIds []string) (int64, error) {
+	query := r.DB.Model(&PoBJob{}).Where("status <> ?", PoBJobStatusRunning)
+	if len(characterIds) > 0 {
+		query = query.Where("character_id IN ?", characterIds)
+	} else {
+		query = query.Where("status = ?", PoBJobStatusDead)
+	}
+	result := query.Updates(map[string]any{
+		"status":          PoBJobStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"updated_at":      time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
+
+func (r *PoBJobRepositoryImpl) CountJobsByStatus() (map[PoBJobStatus]int, error) {
+	type Result struct {
+		Status PoBJobStatus
+		Count  int
+	}
+	var results []*Result
+	err := r.DB.Model(&PoBJob{}).Select("status, COUNT(*) AS count").Group("status").Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[PoBJobStatus]int)
+	for _, result := range results {
+		counts[result.Status] = result.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"bpl/client"
+	"bpl/config"
+	"fmt"
+	"math"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type StatAggregation string
+
+const (
+	StatAggregationMin StatAggregation = "MIN"
+	StatAggregationMax StatAggregation = "MAX"
+	StatAggregationSum StatAggregation = "SUM"
+)
+
+// PoBStatMapping defines an event specific tracked value that is extracted from the PlayerStats of a PoB,
+// e.g. the lowest maximum hit out of FireMaximumHitTaken, ColdMaximumHitTaken and LightningMaximumHitTaken
+type PoBStatMapping struct {
+	Id          int             `gorm:"primaryKey"`
+	EventId     int             `gorm:"not null;uniqueIndex:pob_stat_mappings_event_name_key"`
+	Name        string          `gorm:"not null;uniqueIndex:pob_stat_mappings_event_name_key"`
+	Fields      pq.StringArray  `gorm:"type:text[];not null"`
+	Aggregation StatAggregation `gorm:"type:pob_stat_aggregation;not null;default:MAX"`
+	Multiplier  float64         `gorm:"not null;default:1"`
+}
+
+func (m *PoBStatMapping) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(m.Fields) == 0 {
+		return fmt.Errorf("at least one field is required")
+	}
+	stats := &client.PlayerStats{}
+	for _, field := range m.Fields {
+		if _, ok := stats.GetStat(field); !ok {
+			return fmt.Errorf("unknown player stat %s", field)
+		}
+	}
+	switch m.Aggregation {
+	case StatAggregationMin, StatAggregationMax, StatAggregationSum:
+	default:
+		return fmt.Errorf("unknown aggregation %s", m.Aggregation)
+	}
+	return nil
+}
+
+// Extract aggregates the mapped fields of the player stats and scales the result by the multiplier
+func (m *PoBStatMapping) Extract(stats *client.PlayerStats) int64 {
+	var result float64
+	for i, field := range m.Fields {
+		value, ok := stats.GetStat(field)
+		if !ok {
+			continue
+		}
+		if i == 0 {
+			result = value
+			continue
+		}
+		switch m.Aggregation {
+		case StatAggregationMin:
+			result = math.Min(result, value)
+		case StatAggregationMax:
+			result = math.Max(result, value)
+		case StatAggregationSum:
+			result += value
+		}
+	}
+	multiplier := m.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	return float2Int64(result * multiplier)
+}
+
+type PoBStatRepository interface {
+	GetMappingsForEvent(eventId int) ([]*PoBStatMapping, error)
+	GetMappingById(id int) (*PoBStatMapping, error)
+	SaveMapping(mapping *PoBStatMapping) (*PoBStatMapping, error)
+	DeleteMapping(eventId int, id int) error
+}
+
+type PoBStatRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewPoBStatRepository() PoBStatRepository {
+	return &PoBStatRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func (r *PoBStatRepositoryImpl) GetMappingsForEvent(eventId int) ([]*PoBStatMapping, error) {
+	var mappings []*PoBStatMapping
+	err := r.DB.Where("event_id = ?", eventId).Order("name").Find(&mappings).Error
+	if err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+func (r *PoBStatRepositoryImpl) GetMappingById(id int) (*PoBStatMapping, error) {
+	var mapping PoBStatMapping
+	err := r.DB.First(&mapping, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+func (r *PoBStatRepositoryImpl) SaveMapping(mapping *PoBStatMapping) (*PoBStatMapping, error) {
+	err := r.DB.Save(mapping).Error
+	return mapping, err
+}
+
+func (r *PoBStatRepositoryImpl) DeleteMapping(eventId int, id int) error {
+	return r.DB.Where("event_id = ? AND id = ?", eventId, id).Delete(&PoBStatMapping{}).Error
+}
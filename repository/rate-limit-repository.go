@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"bpl/client"
+	"bpl/config"
+	"bpl/metrics"
+	"bpl/utils"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// requests without a response to learn the policies from block their key for at most this long
+const unknownPolicyPeriod = time.Minute
+
+// requests older than the longest policy period of the PoE API are no longer needed
+const rateLimitRequestRetention = 10 * time.Minute
+
+type RateLimitPolicy struct {
+	Token    string `gorm:"primaryKey"`
+	Endpoint string `gorm:"primaryKey"`
+	Rule     string `gorm:"primaryKey"`
+	MaxHits  int    `gorm:"primaryKey"`
+	PeriodMs int64  `gorm:"primaryKey"`
+}
+
+func (p *RateLimitPolicy) toPolicy() client.Policy {
+	return client.Policy{MaxHits: p.MaxHits, Period: time.Duration(p.PeriodMs) * time.Millisecond}
+}
+
+type RateLimitRequest struct {
+	Token     string    `gorm:"not null"`
+	Endpoint  string    `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null"`
+}
+
+// RateLimitPacer holds the time of the latest request of all keys, so that the requests per second are limited across keys
+type RateLimitPacer struct {
+	Id          int       `gorm:"primaryKey"`
+	LastRequest time.Time `gorm:"not null"`
+}
+
+// RateLimitRepository is a client.RateLimitStore that shares the rate limit state between replicas and restarts
+type RateLimitRepository interface {
+	client.RateLimitStore
+	// DeleteExpiredRequests deletes the requests that no policy of the PoE API counts anymore
+	DeleteExpiredRequests(now time.Time) (int64, error)
+}
+
+// RateLimitRepositoryImpl serializes the reservations and policy updates of a key with advisory locks
+type RateLimitRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewRateLimitRepository() RateLimitRepository {
+	return &RateLimitRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func lockRateLimitKey(tx *gorm.DB, token string, endpoint string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "rate_limit:"+token+":"+endpoint).Error
+}
+
+// reserveRateLimitSlot takes the next request slot of all keys if the interval since the latest request has passed.
+// Otherwise it returns how long it takes until the next slot is free. The pacer row is only locked until the
+// reservation commits.
+func reserveRateLimitSlot(tx *gorm.DB, interval time.Duration, now time.Time) (time.Duration, error) {
+	result := tx.Exec(`
+		INSERT INTO rate_limit_pacers (id, last_request) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET last_request = EXCLUDED.last_request
+		WHERE rate_limit_pacers.last_request <= ?`, now, now.Add(-interval))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return 0, nil
+	}
+	var pacer RateLimitPacer
+	if err := tx.First(&pacer, 1).Error; err != nil {
+		return 0, err
+	}
+	// the clocks of the replicas may differ, the caller still has to wait a little before it tries again
+	return max(time.Millisecond, pacer.LastRequest.Add(interval).Sub(now)), nil
+}
+
+func countRateLimitHits(tx *gorm.DB, token string, endpoint string, since time.Time) (int, error) {
+	var hits int64
+	err := tx.Model(&RateLimitRequest{}).
+		Where("token = ? AND endpoint = ? AND timestamp > ?", token, endpoint, since).
+		Count(&hits).Error
+	return int(hits), err
+}
+
+// rateLimitPolicyWait returns how long it takes until the policy allows another request of the key
+func rateLimitPolicyWait(tx *gorm.DB, token string, endpoint string, policy client.Policy, now time.Time) (time.Duration, error) {
+	var timestamps []time.Time
+	err := tx.Model(&RateLimitRequest{}).
+		Where("token = ? AND endpoint = ? AND timestamp > ?", token, endpoint, now.Add(-policy.Period)).
+		Pluck("timestamp", &timestamps).Error
+	if err != nil {
+		return 0, err
+	}
+	return policy.Wait(timestamps, now), nil
+}
+
+func (r *RateLimitRepositoryImpl) Reserve(key client.RequestKey, maxRequestsPerSecond float64) (time.Duration, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("ReserveRateLimit"))
+	defer timer.ObserveDuration()
+	token := client.MaskToken(key.Token)
+	var wait time.Duration
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockRateLimitKey(tx, token, key.Endpoint); err != nil {
+			return err
+		}
+		now := time.Now()
+		var policies []*RateLimitPolicy
+		if err := tx.Where("token = ? AND endpoint = ?", token, key.Endpoint).Find(&policies).Error; err != nil {
+			return err
+		}
+		keyPolicies := utils.Map(policies, func(policy *RateLimitPolicy) client.Policy { return policy.toPolicy() })
+		if len(keyPolicies) == 0 {
+			// the policies are learnt from the response, until then only a single request is sent
+			keyPolicies = append(keyPolicies, client.Policy{MaxHits: 1, Period: unknownPolicyPeriod})
+		}
+		for _, policy := range keyPolicies {
+			policyWait, err := rateLimitPolicyWait(tx, token, key.Endpoint, policy, now)
+			if err != nil {
+				return err
+			}
+			wait = max(wait, policyWait)
+		}
+		if wait > 0 {
+			return nil
+		}
+		// the slot is taken last, so that other keys are not held up while the policies of this key are checked
+		slotWait, err := reserveRateLimitSlot(tx, client.MinRequestInterval(maxRequestsPerSecond), now)
+		if err != nil || slotWait > 0 {
+			wait = slotWait
+			return err
+		}
+		return tx.Create(&RateLimitRequest{Token: token, Endpoint: key.Endpoint, Timestamp: now}).Error
+	})
+	return wait, err
+}
+
+func (r *RateLimitRepositoryImpl) UpdatePolicies(key client.RequestKey, policies map[string]map[client.Policy]int) error {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("UpdateRateLimitPolicies"))
+	defer timer.ObserveDuration()
+	token := client.MaskToken(key.Token)
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockRateLimitKey(tx, token, key.Endpoint); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Where("token = ? AND endpoint = ?", token, key.Endpoint).Delete(&RateLimitPolicy{}).Error; err != nil {
+			return err
+		}
+		err := tx.Where("token = ? AND endpoint = ? AND timestamp < ?", token, key.Endpoint, now.Add(-rateLimitRequestRetention)).
+			Delete(&RateLimitRequest{}).Error
+		if err != nil {
+			return err
+		}
+		missing := make([]*RateLimitRequest, 0)
+		for rule, rulePolicies := range policies {
+			for policy, currentHits := range rulePolicies {
+				err := tx.Create(&RateLimitPolicy{
+					Token:    token,
+					Endpoint: key.Endpoint,
+					Rule:     rule,
+					MaxHits:  policy.MaxHits,
+					PeriodMs: policy.Period.Milliseconds(),
+				}).Error
+				if err != nil {
+					return err
+				}
+				// hits the API counted that none of the replicas tracked, e.g. from before a restart
+				trackedHits, err := countRateLimitHits(tx, token, key.Endpoint, now.Add(-policy.Period))
+				if err != nil {
+					return err
+				}
+				for range currentHits - trackedHits - len(missing) {
+					missing = append(missing, &RateLimitRequest{Token: token, Endpoint: key.Endpoint, Timestamp: now})
+				}
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		return tx.Create(&missing).Error
+	})
+}
+
+func (r *RateLimitRepositoryImpl) RemainingRequests(key client.RequestKey) (int, error) {
+	token := client.MaskToken(key.Token)
+	var policies []*RateLimitPolicy
+	if err := r.DB.Where("token = ? AND endpoint = ?", token, key.Endpoint).Find(&policies).Error; err != nil {
+		return 0, err
+	}
+	if len(policies) == 0 {
+		return 1, nil
+	}
+	now := time.Now()
+	remaining := math.MaxInt
+	for _, policy := range policies {
+		hits, err := countRateLimitHits(r.DB, token, key.Endpoint, now.Add(-policy.toPolicy().Period))
+		if err != nil {
+			return 0, err
+		}
+		remaining = min(remaining, max(0, policy.MaxHits-hits))
+	}
+	return remaining, nil
+}
+
+func (r *RateLimitRepositoryImpl) Usage() ([]*client.PolicyUsage, error) {
+	timer := prometheus.NewTimer(metrics.QueryDuration.WithLabelValues("GetRateLimitUsage"))
+	defer timer.ObserveDuration()
+	var rows []*struct {
+		RateLimitPolicy
+		CurrentHits int
+	}
+	err := r.DB.Raw(`
+		SELECT p.*, (
+			SELECT count(*) FROM rate_limit_requests r
+			WHERE r.token = p.token AND r.endpoint = p.endpoint
+			AND r."timestamp" > ?::timestamptz - p.period_ms * interval '1 millisecond'
+		) AS current_hits
+		FROM rate_limit_policies p
+		ORDER BY p.endpoint, p.token, p.rule, p.period_ms
+	`, time.Now()).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]*client.PolicyUsage, 0, len(rows))
+	for _, row := range rows {
+		usage = append(usage, &client.PolicyUsage{
+			Token:       row.Token,
+			Endpoint:    row.Endpoint,
+			Rule:        row.Rule,
+			Policy:      row.toPolicy(),
+			CurrentHits: row.CurrentHits,
+		})
+	}
+	return usage, nil
+}
+
+func (r *RateLimitRepositoryImpl) DeleteExpiredRequests(now time.Time) (int64, error) {
+	result := r.DB.Where("timestamp < ?", now.Add(-rateLimitRequestRetention)).Delete(&RateLimitRequest{})
+	return result.RowsAffected, result.Error
+}
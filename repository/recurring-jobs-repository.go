@@ -5,27 +5,58 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type JobType string
 
 const (
-	FetchStashChanges    JobType = "FetchStashChanges"
-	EvaluateStashChanges JobType = "EvaluateStashChanges"
-	FetchCharacterData   JobType = "FetchCharacterData"
-	FetchGuildStashes    JobType = "FetchGuildStashes"
+	FetchStashChanges       JobType = "FetchStashChanges"
+	EvaluateStashChanges    JobType = "EvaluateStashChanges"
+	FetchCharacterData      JobType = "FetchCharacterData"
+	FetchGuildStashes       JobType = "FetchGuildStashes"
+	CompactObjectiveMatches JobType = "CompactObjectiveMatches"
 )
 
 type RecurringJob struct {
-	JobType                  JobType   `gorm:"primaryKey;not null;unique"`
-	EventId                  int       `gorm:"not null"`
+	Id                       int       `gorm:"primaryKey"`
+	JobType                  JobType   `gorm:"not null;uniqueIndex:recurring_jobs_job_type_event_id_idx"`
+	EventId                  int       `gorm:"not null;uniqueIndex:recurring_jobs_job_type_event_id_idx"`
 	SleepAfterEachRunSeconds int       `gorm:"not null"`
+	Schedule                 *string   `gorm:"null"`
+	Paused                   bool      `gorm:"not null;default:false"`
 	EndDate                  time.Time `gorm:"not null"`
+	// set by instances that are not running the jobs to ask the leader for an immediate run
+	TriggerRequestedAt *time.Time `gorm:"null"`
+}
+
+type RecurringJobRunStatus string
+
+const (
+	RecurringJobRunStatusRunning   RecurringJobRunStatus = "running"
+	RecurringJobRunStatusSucceeded RecurringJobRunStatus = "succeeded"
+	RecurringJobRunStatusFailed    RecurringJobRunStatus = "failed"
+	RecurringJobRunStatusCancelled RecurringJobRunStatus = "cancelled"
+)
+
+type RecurringJobRun struct {
+	Id             int                   `gorm:"primaryKey"`
+	JobId          int                   `gorm:"not null"`
+	StartedAt      time.Time             `gorm:"not null"`
+	EndedAt        *time.Time            `gorm:"null"`
+	Status         RecurringJobRunStatus `gorm:"type:recurring_job_run_status;not null;default:running"`
+	Error          *string               `gorm:"null"`
+	ItemsProcessed int64                 `gorm:"not null;default:0"`
 }
 
 type RecurringJobsRepository interface {
-	CreateRecurringJob(job *RecurringJob) error
+	SaveRecurringJob(job *RecurringJob) error
 	GetAllJobs() (jobs []*RecurringJob, err error)
+	StartRun(jobId int) (*RecurringJobRun, error)
+	FinishRun(run *RecurringJobRun) error
+	FailUnfinishedRuns(message string) (int64, error)
+	RequestTrigger(jobId int) error
+	GetRuns(jobId int, limit int) ([]*RecurringJobRun, error)
 }
 
 type RecurringJobsRepositoryImpl struct {
@@ -36,12 +67,60 @@ func NewRecurringJobsRepository() RecurringJobsRepository {
 	return &RecurringJobsRepositoryImpl{DB: config.DatabaseConnection()}
 }
 
-func (r *RecurringJobsRepositoryImpl) CreateRecurringJob(job *RecurringJob) error {
-	r.DB.Delete(&RecurringJob{}, &RecurringJob{JobType: job.JobType})
-	return r.DB.Create(job).Error
+// SaveRecurringJob creates the job or replaces the settings of the existing job with the same type and event
+func (r *RecurringJobsRepositoryImpl) SaveRecurringJob(job *RecurringJob) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_type"}, {Name: "event_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"sleep_after_each_run_seconds", "schedule", "paused", "end_date"}),
+	}).Create(job).Error
 }
 
 func (r *RecurringJobsRepositoryImpl) GetAllJobs() (jobs []*RecurringJob, err error) {
-	err = r.DB.Find(&jobs).Error
+	err = r.DB.Order("id").Find(&jobs).Error
 	return jobs, err
 }
+
+func (r *RecurringJobsRepositoryImpl) StartRun(jobId int) (*RecurringJobRun, error) {
+	run := &RecurringJobRun{
+		JobId:     jobId,
+		StartedAt: time.Now(),
+		Status:    RecurringJobRunStatusRunning,
+	}
+	err := r.DB.Create(run).Error
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (r *RecurringJobsRepositoryImpl) FinishRun(run *RecurringJobRun) error {
+	return r.DB.Model(&RecurringJobRun{}).Where("id = ?", run.Id).Updates(map[string]any{
+		"ended_at":        run.EndedAt,
+		"status":          run.Status,
+		"error":           run.Error,
+		"items_processed": run.ItemsProcessed,
+	}).Error
+}
+
+// FailUnfinishedRuns marks runs that are still running as failed. Called when an instance becomes the leader, when no run of another instance can be active anymore.
+func (r *RecurringJobsRepositoryImpl) FailUnfinishedRuns(message string) (int64, error) {
+	result := r.DB.Model(&RecurringJobRun{}).Where("status = ?", RecurringJobRunStatusRunning).Updates(map[string]any{
+		"ended_at": time.Now(),
+		"status":   RecurringJobRunStatusFailed,
+		"error":    message,
+	})
+	return result.RowsAffected, result.Error
+}
+
+func (r *RecurringJobsRepositoryImpl) RequestTrigger(jobId int) error {
+	return r.DB.Model(&RecurringJob{}).Where("id = ?", jobId).Update("trigger_requested_at", time.Now()).Error
+}
+
+func (r *RecurringJobsRepositoryImpl) GetRuns(jobId int, limit int) ([]*RecurringJobRun, error) {
+	var runs []*RecurringJobRun
+	err := r.DB.Where("job_id = ?", jobId).Order("started_at DESC").Limit(limit).Find(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
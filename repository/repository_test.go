@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
 
 	"github.com/lib/pq"
@@ -50,7 +52,7 @@ func TestMain(m *testing.M) {
 				TablePrefix:   "bpl2.",
 				SingularTable: false,
 			},
-			Logger: logger.Default.LogMode(logger.Silent),
+			Logger: gormlogger.Default.LogMode(gormlogger.Silent),
 		})
 		if err != nil {
 			return err
@@ -948,7 +950,7 @@ func TestObjectiveMatchRepository_SaveAndDeleteMatches(t *testing.T) {
 		{ObjectiveId: obj.Id, Timestamp: time.Now(), Number: 1, TeamId: teams[0].Id, UserId: &users[0].Id},
 		{ObjectiveId: obj.Id, Timestamp: time.Now(), Number: 2, TeamId: teams[1].Id, UserId: &users[2].Id},
 	}
-	err := repo.SaveMatches(matches)
+	err := repo.SaveMatches(context.Background(), matches)
 	require.NoError(t, err)
 
 	var count int64
@@ -978,7 +980,7 @@ func TestObjectiveMatchRepository_OverwriteMatches(t *testing.T) {
 	newMatches := []*ObjectiveMatch{
 		{ObjectiveId: obj.Id, Timestamp: time.Now(), Number: 99, TeamId: teams[1].Id, UserId: &users[2].Id},
 	}
-	err := repo.OverwriteMatches(newMatches, []int{obj.Id})
+	err := repo.OverwriteMatches(context.Background(), newMatches, []int{obj.Id})
 	require.NoError(t, err)
 
 	var count int64
@@ -990,6 +992,50 @@ func TestObjectiveMatchRepository_OverwriteMatches(t *testing.T) {
 	assert.Equal(t, 99, match.Number)
 }
 
+func TestObjectiveMatchRepository_GetLatestAndCompactMatches(t *testing.T) {
+	defer tearDown()
+	repo := &ObjectiveMatchRepositoryImpl{DB: db}
+	event := createTestEvent()
+	teams, users := createTestTeamsWithUsers(event)
+	obj := &Objective{Name: "level", EventId: event.Id, ObjectiveType: ObjectiveTypePlayer, TrackedValue: TrackedValueCharacterLevel, CountingMethod: CountingMethodHighestValue, SyncStatus: SyncStatusSynced}
+	db.Create(obj)
+
+	start := time.Now().Add(-time.Hour)
+	numbers := []int{10, 10, 20, 20, 20, 30, 30}
+	for i, number := range numbers {
+		db.Create(&ObjectiveMatch{ObjectiveId: obj.Id, Timestamp: start.Add(time.Duration(i) * time.Minute), Number: number, TeamId: teams[0].Id, UserId: &users[0].Id})
+	}
+	db.Create(&ObjectiveMatch{ObjectiveId: obj.Id, Timestamp: start, Number: 5, TeamId: teams[1].Id, UserId: &users[2].Id})
+	db.Create(&ObjectiveMatch{ObjectiveId: obj.Id, Timestamp: start, Number: 3, TeamId: teams[1].Id})
+
+	latest, err := repo.GetLatestMatches([]int{obj.Id})
+	require.NoError(t, err)
+	require.Len(t, latest, 3)
+	latestByUser := map[int]int{}
+	for _, match := range latest {
+		userId := 0
+		if match.UserId != nil {
+			userId = *match.UserId
+		}
+		latestByUser[userId] = match.Number
+	}
+	assert.Equal(t, map[int]int{users[0].Id: 30, users[2].Id: 5, 0: 3}, latestByUser)
+
+	deleted, err := repo.CompactMatches([]int{obj.Id})
+	require.NoError(t, err)
+	// the repeated 10 and both repeated 20s are dropped, the last match is kept although it repeats 30
+	assert.Equal(t, int64(3), deleted)
+
+	var remaining []*ObjectiveMatch
+	db.Where("objective_id = ? AND user_id = ?", obj.Id, users[0].Id).Order("timestamp").Find(&remaining)
+	remainingNumbers := make([]int, 0, len(remaining))
+	for _, match := range remaining {
+		remainingNumbers = append(remainingNumbers, match.Number)
+	}
+	assert.Equal(t, []int{10, 20, 30, 30}, remainingNumbers)
+	assert.Equal(t, start.Add(6*time.Minute).Unix(), remaining[len(remaining)-1].Timestamp.Unix())
+}
+
 // ==================== StashChangeRepository Tests ====================
 
 func TestStashChangeRepository_CreateStashChangeIfNotExists(t *testing.T) {
@@ -1859,3 +1905,364 @@ func TestCharacterRepository_GetPobByCharacterIdBeforeTimestamp(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, int64(1000), pob.DPS)
 }
+
+// ==================== RecurringJobsRepository DB Tests ====================
+
+func TestRecurringJobsRepository_SaveJobsAndRuns(t *testing.T) {
+	defer tearDown()
+	db.Exec(`CREATE TYPE recurring_job_run_status AS ENUM ('running', 'succeeded', 'failed', 'cancelled')`)
+	defer db.Exec("DROP TYPE IF EXISTS recurring_job_run_status")
+	require.NoError(t, db.AutoMigrate(&RecurringJob{}, &RecurringJobRun{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.recurring_jobs")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.recurring_job_runs")
+
+	repo := &RecurringJobsRepositoryImpl{DB: db}
+	event := createTestEvent()
+	otherEvent := &Event{Name: "other-event", MaxSize: 10, GameVersion: PoE1}
+	require.NoError(t, db.Create(otherEvent).Error)
+
+	job := &RecurringJob{JobType: FetchCharacterData, EventId: event.Id, EndDate: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.SaveRecurringJob(job))
+	replacement := &RecurringJob{JobType: FetchCharacterData, EventId: event.Id, Paused: true, EndDate: time.Now().Add(2 * time.Hour)}
+	require.NoError(t, repo.SaveRecurringJob(replacement))
+	assert.Equal(t, job.Id, replacement.Id, "a job of the same type for the same event should be replaced")
+	otherJob := &RecurringJob{JobType: FetchCharacterData, EventId: otherEvent.Id, EndDate: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.SaveRecurringJob(otherJob))
+	assert.NotEqual(t, job.Id, otherJob.Id, "every event can have its own job of each type")
+
+	jobs, err := repo.GetAllJobs()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.True(t, jobs[0].Paused)
+
+	first, err := repo.StartRun(job.Id)
+	require.NoError(t, err)
+	ended := time.Now()
+	message := "boom"
+	first.EndedAt = &ended
+	first.Status = RecurringJobRunStatusFailed
+	first.Error = &message
+	first.ItemsProcessed = 12
+	require.NoError(t, repo.FinishRun(first))
+	time.Sleep(10 * time.Millisecond)
+	second, err := repo.StartRun(job.Id)
+	require.NoError(t, err)
+
+	runs, err := repo.GetRuns(job.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, second.Id, runs[0].Id, "the newest run should come first")
+	assert.Equal(t, RecurringJobRunStatusFailed, runs[1].Status)
+	assert.Equal(t, int64(12), runs[1].ItemsProcessed)
+	assert.Equal(t, "boom", *runs[1].Error)
+
+	failed, err := repo.FailUnfinishedRuns("interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), failed)
+	runs, err = repo.GetRuns(job.Id, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, RecurringJobRunStatusFailed, runs[0].Status)
+	assert.NotNil(t, runs[0].EndedAt)
+}
+
+func TestLeaderLeaseRepository_LockAndLeases(t *testing.T) {
+	require.NoError(t, db.AutoMigrate(&LeaderLease{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.leader_leases")
+
+	repo := &LeaderLeaseRepositoryImpl{DB: db}
+	ctx := context.Background()
+
+	conn, ok, err := repo.TryLock(ctx, "test-role")
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = repo.TryLock(ctx, "test-role")
+	require.NoError(t, err)
+	assert.False(t, ok, "a second session should not get the lock while it is held")
+	otherConn, ok, err := repo.TryLock(ctx, "other-role")
+	require.NoError(t, err)
+	require.True(t, ok, "roles should be locked independently")
+	require.NoError(t, repo.Unlock(otherConn, "other-role"))
+
+	now := time.Now()
+	require.NoError(t, repo.SaveLease(&LeaderLease{Role: "test-role", InstanceId: "a", AcquiredAt: now, RenewedAt: now}))
+	require.NoError(t, repo.SaveLease(&LeaderLease{Role: "test-role", InstanceId: "a", AcquiredAt: now, RenewedAt: now.Add(time.Minute)}))
+	leases, err := repo.GetLeases()
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.WithinDuration(t, now.Add(time.Minute), leases[0].RenewedAt, time.Second)
+
+	require.NoError(t, repo.Unlock(conn, "test-role"))
+	conn, ok, err = repo.TryLock(ctx, "test-role")
+	require.NoError(t, err)
+	require.True(t, ok, "the lock should be free after it was released")
+	require.NoError(t, repo.Unlock(conn, "test-role"))
+
+	require.NoError(t, repo.DeleteLease("test-role", "b"))
+	leases, err = repo.GetLeases()
+	require.NoError(t, err)
+	assert.Len(t, leases, 1, "only the owner should delete its lease")
+	require.NoError(t, repo.DeleteLease("test-role", "a"))
+	leases, err = repo.GetLeases()
+	require.NoError(t, err)
+	assert.Empty(t, leases)
+}
+
+func TestTokenRepository_RotateAndRevoke(t *testing.T) {
+	defer tearDown()
+	require.NoError(t, db.AutoMigrate(&RefreshToken{}, &RevokedToken{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.refresh_tokens")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.revoked_tokens")
+
+	repo := &TokenRepositoryImpl{DB: db}
+	user := &User{DisplayName: "token-user"}
+	require.NoError(t, db.Create(user).Error)
+	now := time.Now()
+	newToken := func(hash string, familyId string) *RefreshToken {
+		return &RefreshToken{
+			UserId:            user.Id,
+			TokenHash:         hash,
+			FamilyId:          familyId,
+			AccessTokenId:     "access-" + hash,
+			AccessTokenExpiry: now.Add(time.Minute),
+			CreatedAt:         now,
+			ExpiresAt:         now.Add(time.Hour),
+		}
+	}
+	isRevoked := func(tokenId string) bool {
+		revoked, err := repo.IsTokenRevoked(tokenId)
+		require.NoError(t, err)
+		return revoked
+	}
+
+	first := newToken("first", "family")
+	require.NoError(t, repo.SaveRefreshToken(first))
+	second := newToken("second", "family")
+	require.NoError(t, repo.RotateRefreshToken(first, second))
+	assert.NotNil(t, first.RevokedAt)
+	assert.ErrorIs(t, repo.RotateRefreshToken(first, newToken("third", "family")), ErrRefreshTokenReused, "a rotated token must not be rotated again")
+	_, err := repo.GetRefreshToken("third")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "the successor of a reused token should not be saved")
+	stored, err := repo.GetRefreshToken("first")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	other := newToken("other", "other-family")
+	require.NoError(t, repo.SaveRefreshToken(other))
+	require.NoError(t, repo.RevokeSession("family"))
+	assert.True(t, isRevoked("access-first"), "access tokens of rotated refresh tokens should be revoked as well")
+	assert.True(t, isRevoked("access-second"))
+	assert.False(t, isRevoked("access-other"), "other sessions should stay valid")
+	stored, err = repo.GetRefreshToken("other")
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt)
+
+	require.NoError(t, repo.RevokeAccessTokens(user.Id))
+	assert.True(t, isRevoked("access-other"))
+	stored, err = repo.GetRefreshToken("other")
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt, "revoking the access tokens should keep the session")
+	require.NoError(t, repo.RevokeSessions(user.Id))
+	stored, err = repo.GetRefreshToken("other")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	require.NoError(t, repo.RevokeToken(&RevokedToken{TokenId: "bot", ExpiresAt: now.Add(-time.Minute), RevokedAt: now}))
+	require.NoError(t, repo.RevokeToken(&RevokedToken{TokenId: "bot", ExpiresAt: now.Add(-time.Minute), RevokedAt: now}), "revoking a token twice should not fail")
+	assert.True(t, isRevoked("bot"))
+
+	deleted, err := repo.DeleteExpiredTokens(now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "only the expired revocation should be deleted")
+	deleted, err = repo.DeleteExpiredTokens(now.Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), deleted)
+}
+
+func TestEventRoleRepository_FindEventRole(t *testing.T) {
+	defer tearDown()
+	require.NoError(t, db.AutoMigrate(&EventRole{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.event_roles")
+
+	repo := &EventRoleRepositoryImpl{DB: db}
+	user := &User{DisplayName: "judge"}
+	require.NoError(t, db.Create(user).Error)
+	event := createTestEvent()
+	team := &Team{Name: "team", EventId: event.Id}
+	require.NoError(t, db.Create(team).Error)
+
+	eventWide, err := repo.SaveEventRole(&EventRole{UserId: user.Id, EventId: event.Id, Role: PermissionSubmissionJudge, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	forTeam, err := repo.SaveEventRole(&EventRole{UserId: user.Id, EventId: event.Id, TeamId: &team.Id, Role: PermissionSubmissionJudge, CreatedAt: time.Now()})
+	require.NoError(t, err)
+
+	found, err := repo.FindEventRole(&EventRole{UserId: user.Id, EventId: event.Id, Role: PermissionSubmissionJudge})
+	require.NoError(t, err)
+	assert.Equal(t, eventWide.Id, found.Id, "a role without team should not match the role of a team")
+	found, err = repo.FindEventRole(&EventRole{UserId: user.Id, EventId: event.Id, TeamId: &team.Id, Role: PermissionSubmissionJudge})
+	require.NoError(t, err)
+	assert.Equal(t, forTeam.Id, found.Id)
+	_, err = repo.FindEventRole(&EventRole{UserId: user.Id, EventId: event.Id, Role: PermissionManager})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	roles, err := repo.GetEventRolesForUser(user.Id, event.Id)
+	require.NoError(t, err)
+	assert.Len(t, roles, 2)
+	require.NoError(t, repo.DeleteEventRole(eventWide.Id))
+	roles, err = repo.GetEventRolesForEvent(event.Id, "User")
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, "judge", roles[0].User.DisplayName)
+}
+
+func TestGuildStashRepository_LatestTimestampIgnoresDerivedEntries(t *testing.T) {
+	require.NoError(t, db.AutoMigrate(&GuildStashChangelog{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.guild_stash_changelogs")
+
+	repo := &GuildStashRepositoryImpl{db: db}
+	event := &Event{Id: 1}
+	start := time.Unix(1_700_000_000, 0)
+	logs := []*GuildStashChangelog{
+		{Timestamp: start, GuildId: 5, EventId: 1, AccountName: "lead", Action: ActionAdded, ItemName: "Chaos Orb"},
+		{Timestamp: start.Add(time.Hour), GuildId: 5, EventId: 1, AccountName: "lead", Action: ActionAdded, ItemName: "Chaos Orb"},
+		{Timestamp: start.Add(-time.Hour), GuildId: 5, EventId: 1, AccountName: "lead", Action: ActionAdded, ItemName: "Chaos Orb", Derived: true},
+		{Timestamp: start.Add(3 * time.Hour), GuildId: 5, EventId: 1, AccountName: "lead", Action: ActionAdded, ItemName: "Chaos Orb", Derived: true},
+	}
+	require.NoError(t, repo.SaveGuildstashLogs(logs))
+
+	earliest, latest := repo.GetLatestLogEntryTimestampForGuild(event, 5)
+	require.NotNil(t, earliest)
+	require.NotNil(t, latest)
+	assert.Equal(t, start.Unix()-1, *earliest)
+	assert.Equal(t, start.Add(time.Hour).Unix()+1, *latest, "derived entries must not move the resume point forward")
+}
+
+func TestPoBJobRepository_ReclaimedJobCanOnlyBeCompletedByNewClaim(t *testing.T) {
+	db.Exec("CREATE TYPE bpl2.pob_job_status AS ENUM ('pending', 'running', 'dead')")
+	require.NoError(t, db.AutoMigrate(&PoBJob{}))
+	defer db.Exec("DROP TYPE IF EXISTS bpl2.pob_job_status")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.pob_jobs")
+	defer tearDown()
+
+	event := createTestEvent()
+	repo := &PoBJobRepositoryImpl{DB: db}
+	require.NoError(t, repo.Enqueue(&PoBJob{CharacterId: "char", EventId: event.Id, Character: CharacterData{Id: "char"}}))
+
+	first, err := repo.ClaimJobs(1, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	// the first worker is considered dead once its claim is older than the stale threshold
+	second, err := repo.ClaimJobs(1, -time.Second)
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Greater(t, second[0].Version, first[0].Version, "reclaiming a job should bump its version")
+
+	require.NoError(t, repo.CompleteJob(first[0]))
+	jobs, err := repo.GetJobs(nil)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1, "the stale worker should not complete the reclaimed job")
+
+	require.NoError(t, repo.CompleteJob(second[0]))
+	jobs, err = repo.GetJobs(nil)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestRateLimitRepository_ConcurrentReservationsAcrossKeys(t *testing.T) {
+	require.NoError(t, db.AutoMigrate(&RateLimitPolicy{}, &RateLimitRequest{}, &RateLimitPacer{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.rate_limit_policies")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.rate_limit_requests")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.rate_limit_pacers")
+
+	repo := &RateLimitRepositoryImpl{DB: db}
+	expired := &RateLimitRequest{Token: "old", Endpoint: "ep", Timestamp: time.Now().Add(-2 * rateLimitRequestRetention)}
+	require.NoError(t, db.Create(expired).Error)
+
+	const reservations = 10
+	waits := make([]time.Duration, reservations)
+	var wg sync.WaitGroup
+	for i := range reservations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := repo.Reserve(client.RequestKey{Token: fmt.Sprintf("token-%d", i), Endpoint: "ep"}, 1)
+			assert.NoError(t, err)
+			waits[i] = wait
+		}()
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, wait := range waits {
+		if wait == 0 {
+			reserved++
+		} else {
+			assert.LessOrEqual(t, wait, time.Second, "the wait should end when the per second limit allows the next request")
+		}
+	}
+	assert.Equal(t, 1, reserved, "only one request per second should be reserved across all keys")
+
+	deleted, err := repo.DeleteExpiredRequests(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	var remaining []*RateLimitRequest
+	require.NoError(t, db.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.NotEqual(t, "old", remaining[0].Token, "expired requests should be pruned")
+}
+
+func TestRateLimitRepository_WaitsForPolicyReset(t *testing.T) {
+	require.NoError(t, db.AutoMigrate(&RateLimitPolicy{}, &RateLimitRequest{}, &RateLimitPacer{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.rate_limit_policies")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.rate_limit_requests")
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.rate_limit_pacers")
+
+	repo := &RateLimitRepositoryImpl{DB: db}
+	key := client.RequestKey{Token: "token", Endpoint: "ep"}
+	policy := client.Policy{MaxHits: 2, Period: 10 * time.Second}
+	require.NoError(t, repo.UpdatePolicies(key, map[string]map[client.Policy]int{"account": {policy: 2}}))
+
+	wait, err := repo.Reserve(key, 1000)
+	require.NoError(t, err)
+	assert.InDelta(t, policy.Period, wait, float64(time.Second), "the wait should last until the counted hits expire")
+}
+
+// ==================== LadderRepository DB Tests ====================
+
+func TestLadderRepository_PruningKeepsFirstSnapshotPerLevel(t *testing.T) {
+	require.NoError(t, db.AutoMigrate(&LadderSnapshot{}))
+	defer db.Exec("DROP TABLE IF EXISTS bpl2.ladder_snapshots")
+	defer tearDown()
+
+	repo := &LadderRepositoryImpl{DB: db}
+	event := createTestEvent()
+	start := time.Now().Add(-time.Hour)
+	snapshot := func(minutes int, level int, experience int) *LadderSnapshot {
+		return &LadderSnapshot{
+			EventId: event.Id, Character: "char", Account: "acc", Class: "Witch",
+			Level: level, Experience: experience, Timestamp: start.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+	require.NoError(t, repo.SaveSnapshots([]*LadderSnapshot{
+		snapshot(0, 10, 100),
+		snapshot(5, 10, 200),
+		snapshot(10, 12, 300),
+		snapshot(15, 12, 400),
+		snapshot(20, 12, 500),
+	}))
+
+	require.NoError(t, repo.DeleteSnapshotsBefore(event.Id, time.Now()))
+
+	snapshots, err := repo.GetSnapshotsForCharacter(event.Id, "char")
+	require.NoError(t, err)
+	experiences := make([]int, 0, len(snapshots))
+	for _, s := range snapshots {
+		experiences = append(experiences, s.Experience)
+	}
+	assert.Equal(t, []int{100, 300, 500}, experiences, "the first snapshot per level and the latest snapshot should be kept")
+
+	reached, err := repo.GetFirstTimesReachingLevel(event.Id, 11)
+	require.NoError(t, err)
+	require.Len(t, reached, 1)
+	assert.WithinDuration(t, start.Add(10*time.Minute), reached[0].Timestamp, time.Second, "the level race should not change by pruning")
+}
@@ -27,6 +27,9 @@ const (
 	GuildstashUpdateInterval        TimingKey = "guildstash_update_interval"
 	GuildstashPriorityFetchInterval TimingKey = "guildstash_priority_fetch_interval"
 	PublicStashUpdateInterval       TimingKey = "public_stash_update_interval"
+
+	LadderSnapshotInterval  TimingKey = "ladder_snapshot_interval"
+	LadderSnapshotRetention TimingKey = "ladder_snapshot_retention"
 )
 
 var TimingKeyDescriptions = map[TimingKey]string{
@@ -46,6 +49,9 @@ var TimingKeyDescriptions = map[TimingKey]string{
 	GuildstashUpdateInterval:        "Interval at which the guild stash is updated",
 	GuildstashPriorityFetchInterval: "Interval at which priority guild stashes are updated",
 	PublicStashUpdateInterval:       "Interval at which the public stash is updated",
+
+	LadderSnapshotInterval:  "Interval at which changed ladder entries are stored in the ladder history",
+	LadderSnapshotRetention: "Duration for which ladder history is kept, 0 keeps it for the whole event",
 }
 
 var DefaultTimings = map[TimingKey]time.Duration{
@@ -66,6 +72,9 @@ var DefaultTimings = map[TimingKey]time.Duration{
 	GuildstashUpdateInterval:        2 * time.Minute,
 	GuildstashPriorityFetchInterval: 5 * time.Second,
 	PublicStashUpdateInterval:       0 * time.Minute,
+
+	LadderSnapshotInterval:  5 * time.Minute,
+	LadderSnapshotRetention: 0,
 }
 
 type Timing struct {
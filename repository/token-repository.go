@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"bpl/config"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// RefreshToken is a session of a user. It is replaced by a new token every time it is used to get an access token.
+type RefreshToken struct {
+	Id        int    `gorm:"primaryKey"`
+	UserId    int    `gorm:"not null;references:users(id)"`
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	// all tokens that were rotated from the same login
+	FamilyId string `gorm:"not null;index"`
+	// the access token that was issued together with this refresh token
+	AccessTokenId     string     `gorm:"not null"`
+	AccessTokenExpiry time.Time  `gorm:"not null"`
+	CreatedAt         time.Time  `gorm:"not null"`
+	ExpiresAt         time.Time  `gorm:"not null"`
+	RevokedAt         *time.Time `gorm:"null"`
+}
+
+// RevokedToken is an access token that must no longer be accepted although it has not expired yet
+type RevokedToken struct {
+	TokenId   string    `gorm:"primaryKey"`
+	UserId    int       `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt time.Time `gorm:"not null"`
+}
+
+type TokenRepository interface {
+	SaveRefreshToken(token *RefreshToken) error
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+	// RotateRefreshToken revokes the token and saves its successor. It returns ErrRefreshTokenReused if the token
+	// has been revoked in the meantime, e.g. by a concurrent rotation.
+	RotateRefreshToken(token *RefreshToken, successor *RefreshToken) error
+	// RevokeSession revokes the refresh tokens of the family together with the access tokens issued with them
+	RevokeSession(familyId string) error
+	// RevokeSessions revokes all refresh tokens of the user together with the access tokens issued with them
+	RevokeSessions(userId int) error
+	// RevokeAccessTokens revokes the unexpired access tokens of the user but keeps the sessions valid
+	RevokeAccessTokens(userId int) error
+	RevokeToken(token *RevokedToken) error
+	IsTokenRevoked(tokenId string) (bool, error)
+	// DeleteExpiredTokens removes refresh tokens and revocations that are no longer needed because their tokens have expired
+	DeleteExpiredTokens(now time.Time) (int64, error)
+}
+
+type TokenRepositoryImpl struct {
+	DB *gorm.DB
+}
+
+func NewTokenRepository() TokenRepository {
+	return &TokenRepositoryImpl{DB: config.DatabaseConnection()}
+}
+
+func (r *TokenRepositoryImpl) SaveRefreshToken(token *RefreshToken) error {
+	return r.DB.Save(token).Error
+}
+
+func (r *TokenRepositoryImpl) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.DB.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *TokenRepositoryImpl) RotateRefreshToken(token *RefreshToken, successor *RefreshToken) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", token.Id).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		token.RevokedAt = &now
+		return tx.Create(successor).Error
+	})
+}
+
+func (r *TokenRepositoryImpl) RevokeSession(familyId string) error {
+	return r.revokeSessions("family_id", familyId)
+}
+
+func (r *TokenRepositoryImpl) RevokeSessions(userId int) error {
+	return r.revokeSessions("user_id", userId)
+}
+
+func (r *TokenRepositoryImpl) revokeSessions(column string, value any) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&RefreshToken{}).
+			Where(column+" = ? AND revoked_at IS NULL", value).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return revokeAccessTokens(tx, column, value, now)
+	})
+}
+
+func (r *TokenRepositoryImpl) RevokeAccessTokens(userId int) error {
+	return revokeAccessTokens(r.DB, "user_id", userId, time.Now())
+}
+
+// revokeAccessTokens revokes the access tokens that were issued together with the matching refresh tokens. Every access
+// token is recorded on the refresh token it was issued with, so this includes the tokens of already rotated refresh tokens.
+func revokeAccessTokens(db *gorm.DB, column string, value any, now time.Time) error {
+	return db.Exec(`
+		INSERT INTO revoked_tokens (token_id, user_id, expires_at, revoked_at)
+		SELECT access_token_id, user_id, access_token_expiry, ?
+		FROM refresh_tokens
+		WHERE `+column+` = ? AND access_token_expiry > ?
+		ON CONFLICT DO NOTHING`, now, value, now).Error
+}
+
+func (r *TokenRepositoryImpl) RevokeToken(token *RevokedToken) error {
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+func (r *TokenRepositoryImpl) IsTokenRevoked(tokenId string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&RevokedToken{}).Where("token_id = ?", tokenId).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *TokenRepositoryImpl) DeleteExpiredTokens(now time.Time) (int64, error) {
+	var deleted int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("expires_at < ?", now).Delete(&RevokedToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted += result.RowsAffected
+		result = tx.Where("expires_at < ?", now).Delete(&RefreshToken{})
+		deleted += result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
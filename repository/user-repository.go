@@ -6,7 +6,6 @@ import (
 	"bpl/utils"
 	"database/sql/driver"
 	"fmt"
-	"log"
 	"slices"
 	"strings"
 	"time"
@@ -205,7 +204,6 @@ func LoadUsersIntoEvent(DB *gorm.DB, event *Event) error {
 		return team.Id
 	})).Scan(&users).Error
 	if err != nil {
-		log.Print(err)
 		return fmt.Errorf("failed to load users into event: %v", err)
 	}
 	for _, user := range users {
@@ -1,17 +1,21 @@
 package scoring
 
 import (
+	"bpl/config"
 	"bpl/metrics"
 	"bpl/repository"
 	"bpl/utils"
 	"fmt"
-	"log"
 	"sort"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
+var logger = config.Logger("scoring")
+
 type ObjectiveIdTeamId struct {
 	ObjectiveId int
 	TeamId      int
@@ -74,9 +78,14 @@ func AggregateMatches(db *gorm.DB, event *repository.Event, objectives []*reposi
 	} {
 		if handler, ok := aggregationMap[aggregation]; ok {
 			t := time.Now()
-			matches, err := handler(db, objectivesByAggregation[aggregation], teamIds, event.Id)
+			ctx, span := config.Tracer().Start(db.Statement.Context, "AggregateMatches", trace.WithAttributes(
+				attribute.String("counting_method", string(aggregation)),
+				attribute.Int("objective.count", len(objectivesByAggregation[aggregation])),
+			))
+			matches, err := handler(db.WithContext(ctx), objectivesByAggregation[aggregation], teamIds, event.Id)
+			config.EndSpan(span, err)
 			if err != nil {
-				log.Print(err)
+				logger.ErrorContext(ctx, "Failed to aggregate matches", "counting_method", aggregation, "error", err)
 				continue
 			}
 			for _, match := range matches {
@@ -302,6 +311,7 @@ func handleLatest(db *gorm.DB, objectives []*repository.Objective, teamIds []int
 		objective_matches AS match
 	JOIN
 		latest ON latest.objective_id = match.objective_id AND latest.team_id = match.team_id
+		AND latest.timestamp = match.timestamp
 	`
 	matches := make([]*Match, 0)
 	err := db.Raw(query, map[string]any{"objectiveIds": getObjectiveIds(objectives)}).Scan(&matches).Error
@@ -371,7 +381,7 @@ func handleDifferenceBetween(db *gorm.DB, objectives []*repository.Objective, te
 	matches := make([]*Match, 0)
 	for _, objective := range objectives {
 		if objective.ValidFrom == nil || objective.ValidTo == nil {
-			fmt.Printf("VALUE_CHANGE_IN_WINDOW objective %d does not have timestamps set\n", objective.Id)
+			logger.Warn("VALUE_CHANGE_IN_WINDOW objective does not have timestamps set", "objective_id", objective.Id)
 			continue
 		}
 
@@ -9,7 +9,7 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
 
 	"github.com/ory/dockertest/v3"
@@ -48,7 +48,7 @@ func TestMain(m *testing.M) {
 				TablePrefix:   "bpl2.",
 				SingularTable: false,
 			},
-			Logger: logger.Default.LogMode(logger.Silent),
+			Logger: gormlogger.Default.LogMode(gormlogger.Silent),
 		})
 
 		if err != nil {
@@ -77,6 +77,11 @@ func EvaluateAggregations(objective *repository.Objective, aggregations Objectiv
 			return err
 		}
 	}
+	return evaluateScoringRules(objective, aggregations, scoreMap)
+}
+
+// evaluateScoringRules applies the scoring rules of the objective itself, assuming that its children have been evaluated
+func evaluateScoringRules(objective *repository.Objective, aggregations ObjectiveTeamMatches, scoreMap map[int]map[int]*Score) error {
 	for _, preset := range objective.ScoringRules {
 		if fun, ok := scoringFunctions[preset.RuleType]; ok {
 			err := fun(objective, preset, aggregations, scoreMap)
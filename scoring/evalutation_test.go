@@ -2429,3 +2429,156 @@ func TestHandleChildRankingByTime_MultipleUnfinishedTeams(t *testing.T) {
 	assert.False(t, scoreMap[3][objective.Id].PresetCompletions[presetId].Finished)
 	assert.False(t, scoreMap[4][objective.Id].PresetCompletions[presetId].Finished)
 }
+
+// ========== Objective gaps ==========
+
+func TestCalculateGaps(t *testing.T) {
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	presence := &repository.Objective{
+		Id:             2,
+		RequiredAmount: 5,
+		CountingMethod: repository.CountingMethodFirstCompletion,
+		ScoringRules: []*repository.ScoringRule{
+			{Id: 1, Points: repository.ExtendingNumberSlice{10}, RuleType: repository.FIXED_POINTS_ON_COMPLETION},
+		},
+	}
+	ranked := &repository.Objective{
+		Id:             3,
+		RequiredAmount: 1,
+		CountingMethod: repository.CountingMethodHighestValue,
+		ScoringRules: []*repository.ScoringRule{
+			{Id: 2, Points: repository.ExtendingNumberSlice{30, 20, 10}, RuleType: repository.RANK_BY_HIGHEST_VALUE},
+		},
+	}
+	root := &repository.Objective{Id: 1, CountingMethod: repository.CountingMethodChildResult, Children: []*repository.Objective{presence, ranked}}
+	aggregations := ObjectiveTeamMatches{
+		2: {
+			1: {ObjectiveId: 2, TeamId: 1, Number: 3, Timestamp: earlier},
+		},
+		3: {
+			1: {ObjectiveId: 3, TeamId: 1, Number: 50, Timestamp: earlier, Finished: true},
+			2: {ObjectiveId: 3, TeamId: 2, Number: 80, Timestamp: earlier, Finished: true},
+			3: {ObjectiveId: 3, TeamId: 3, Number: 100, Timestamp: earlier, Finished: true},
+		},
+	}
+
+	gaps, err := CalculateGaps(root, []int{1, 2, 3}, aggregations, 1, now)
+	assert.NoError(t, err)
+	gapMap := make(map[int]*ObjectiveGap)
+	for _, gap := range gaps {
+		gapMap[gap.ObjectiveId] = gap
+	}
+
+	assert.Equal(t, 3, gapMap[2].Number)
+	assert.Equal(t, 5, gapMap[2].RequiredAmount)
+	assert.False(t, gapMap[2].Finished)
+	assert.Equal(t, 10, gapMap[2].PointsOnFinish)
+	assert.Equal(t, 0, gapMap[2].PointsOnRankUp)
+
+	assert.True(t, gapMap[3].Finished)
+	assert.Equal(t, 3, gapMap[3].Rank)
+	assert.Equal(t, 10, gapMap[3].Points)
+	assert.Equal(t, 0, gapMap[3].PointsOnFinish)
+	assert.Equal(t, 10, gapMap[3].PointsOnRankUp, "overtaking team 2 should move from 10 to 20 points")
+}
+
+func TestCalculateGapsRespectsHiddenProgress(t *testing.T) {
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	hidden := &repository.Objective{
+		Id:             2,
+		RequiredAmount: 100,
+		HideProgress:   true,
+		CountingMethod: repository.CountingMethodHighestValue,
+		ScoringRules: []*repository.ScoringRule{
+			{Id: 1, Points: repository.ExtendingNumberSlice{30, 20}, RuleType: repository.RANK_BY_HIGHEST_VALUE},
+		},
+	}
+	root := &repository.Objective{Id: 1, CountingMethod: repository.CountingMethodChildResult, Children: []*repository.Objective{hidden}}
+	aggregations := ObjectiveTeamMatches{
+		2: {
+			1: {ObjectiveId: 2, TeamId: 1, Number: 10, Timestamp: now},
+			2: {ObjectiveId: 2, TeamId: 2, Number: 60, Timestamp: now},
+		},
+	}
+
+	visible := VisibleAggregations(root, aggregations, 1)
+	assert.Contains(t, visible[2], 1)
+	assert.NotContains(t, visible[2], 2, "unfinished progress of other teams must not be visible")
+
+	gaps, err := CalculateGaps(root, []int{1, 2}, aggregations, 1, now)
+	assert.NoError(t, err)
+	for _, gap := range gaps {
+		if gap.ObjectiveId == 2 {
+			assert.Equal(t, 30, gap.PointsOnFinish)
+			assert.Equal(t, 0, gap.PointsOnRankUp, "there is no visible team to overtake")
+		}
+	}
+}
+
+func TestCalculateGapsMatchesFullEvaluation(t *testing.T) {
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	leaf := func(id int, ruleId int) *repository.Objective {
+		return &repository.Objective{
+			Id:             id,
+			RequiredAmount: 1,
+			CountingMethod: repository.CountingMethodFirstCompletion,
+			ScoringRules: []*repository.ScoringRule{
+				{Id: ruleId, Points: repository.ExtendingNumberSlice{5}, RuleType: repository.FIXED_POINTS_ON_COMPLETION},
+			},
+		}
+	}
+	category := &repository.Objective{
+		Id:             2,
+		CountingMethod: repository.CountingMethodChildResult,
+		Children:       []*repository.Objective{leaf(3, 1), leaf(4, 2), leaf(5, 3)},
+		ScoringRules: []*repository.ScoringRule{
+			{Id: 4, Points: repository.ExtendingNumberSlice{20, 10}, RuleType: repository.RANK_BY_CHILD_COMPLETION_TIME},
+			{Id: 5, Points: repository.ExtendingNumberSlice{3, 2, 1}, RuleType: repository.BONUS_PER_CHILD_COMPLETION},
+		},
+	}
+	ranked := &repository.Objective{
+		Id:             6,
+		RequiredAmount: 1,
+		CountingMethod: repository.CountingMethodHighestValue,
+		ScoringRules: []*repository.ScoringRule{
+			{Id: 6, Points: repository.ExtendingNumberSlice{30, 20, 10}, RuleType: repository.RANK_BY_HIGHEST_VALUE},
+		},
+	}
+	root := &repository.Objective{Id: 1, CountingMethod: repository.CountingMethodChildResult, Children: []*repository.Objective{category, ranked}}
+	aggregations := ObjectiveTeamMatches{
+		3: {
+			1: {ObjectiveId: 3, TeamId: 1, Number: 1, Timestamp: now.Add(-3 * time.Hour), Finished: true},
+			2: {ObjectiveId: 3, TeamId: 2, Number: 1, Timestamp: now.Add(-2 * time.Hour), Finished: true},
+		},
+		4: {
+			2: {ObjectiveId: 4, TeamId: 2, Number: 1, Timestamp: now.Add(-time.Hour), Finished: true},
+		},
+		6: {
+			1: {ObjectiveId: 6, TeamId: 1, Number: 10, Timestamp: now, Finished: true},
+			2: {ObjectiveId: 6, TeamId: 2, Number: 20, Timestamp: now, Finished: true},
+		},
+	}
+	teamIds := []int{1, 2}
+
+	gaps, err := CalculateGaps(root, teamIds, aggregations, 1, now)
+	assert.NoError(t, err)
+	base, err := EvaluateScores(root, teamIds, aggregations)
+	assert.NoError(t, err)
+	fullEvaluation := func(objectiveId int, number int) int {
+		scores, err := EvaluateScores(root, teamIds, withMatch(aggregations, objectiveId, &Match{
+			ObjectiveId: objectiveId, TeamId: 1, Number: number, Timestamp: now, Finished: true,
+		}))
+		assert.NoError(t, err)
+		return totalPoints(scores[1]) - totalPoints(base[1])
+	}
+	gapMap := make(map[int]*ObjectiveGap)
+	for _, gap := range gaps {
+		gapMap[gap.ObjectiveId] = gap
+	}
+	assert.Equal(t, fullEvaluation(4, 1), gapMap[4].PointsOnFinish)
+	assert.Equal(t, fullEvaluation(5, 1), gapMap[5].PointsOnFinish)
+	assert.Equal(t, 5+2, gapMap[4].PointsOnFinish, "finishing should also give the bonus of the second child completion")
+	assert.Equal(t, fullEvaluation(6, 21), gapMap[6].PointsOnRankUp)
+	assert.Equal(t, 10, gapMap[6].PointsOnRankUp)
+}
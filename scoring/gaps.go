@@ -0,0 +1,266 @@
+package scoring
+
+import (
+	"bpl/repository"
+	"time"
+)
+
+type ObjectiveGap struct {
+	ObjectiveId    int
+	Number         int
+	RequiredAmount int
+	Finished       bool
+	Rank           int
+	Points         int
+	// additional points the team would gain by finishing the objective right now
+	PointsOnFinish int
+	// additional points the team would gain by overtaking the next better team in a value ranking
+	PointsOnRankUp int
+}
+
+func (g *ObjectiveGap) MarginalPoints() int {
+	return max(g.PointsOnFinish, g.PointsOnRankUp)
+}
+
+// NewScoreMap creates empty scores for every team and objective in the tree, ready to be filled by EvaluateAggregations
+func NewScoreMap(rootObjective *repository.Objective, teamIds []int) map[int]map[int]*Score {
+	teamScores := make(map[int]map[int]*Score)
+	for _, teamId := range teamIds {
+		teamScores[teamId] = make(map[int]*Score)
+		for _, obj := range rootObjective.FlatMap() {
+			teamScores[teamId][obj.Id] = newScore(obj, teamId)
+		}
+	}
+	return teamScores
+}
+
+func newScore(obj *repository.Objective, teamId int) *Score {
+	presetCompletions := make(map[int]*PresetCompletion)
+	for _, preset := range obj.ScoringRules {
+		presetCompletions[preset.Id] = &PresetCompletion{
+			ObjectiveId: obj.Id,
+		}
+	}
+	return &Score{
+		ObjectiveId:       obj.Id,
+		TeamId:            teamId,
+		HideProgress:      obj.HideProgress,
+		PresetCompletions: presetCompletions,
+	}
+}
+
+// EvaluateScores evaluates the whole objective tree for the given teams and returns the resulting scores by team and objective
+func EvaluateScores(rootObjective *repository.Objective, teamIds []int, aggregations ObjectiveTeamMatches) (map[int]map[int]*Score, error) {
+	teamScores := NewScoreMap(rootObjective, teamIds)
+	err := EvaluateAggregations(rootObjective, aggregations, teamScores)
+	if err != nil {
+		return nil, err
+	}
+	return teamScores, nil
+}
+
+func totalPoints(teamScores map[int]*Score) int {
+	total := 0
+	for _, score := range teamScores {
+		total += score.Points()
+	}
+	return total
+}
+
+// VisibleAggregations removes the unfinished progress of other teams on objectives that hide their progress,
+// so that calculations done on behalf of a team can't leak information it isn't allowed to see
+func VisibleAggregations(rootObjective *repository.Objective, aggregations ObjectiveTeamMatches, teamId int) ObjectiveTeamMatches {
+	visible := make(ObjectiveTeamMatches, len(aggregations))
+	hidden := make(map[int]bool)
+	for _, objective := range rootObjective.FlatMap() {
+		hidden[objective.Id] = objective.HideProgress
+	}
+	for objectiveId, teamMatches := range aggregations {
+		if !hidden[objectiveId] {
+			visible[objectiveId] = teamMatches
+			continue
+		}
+		visible[objectiveId] = make(TeamMatches)
+		for matchTeamId, match := range teamMatches {
+			if matchTeamId == teamId || match.Finished {
+				visible[objectiveId][matchTeamId] = match
+			}
+		}
+	}
+	return visible
+}
+
+// CalculateGaps determines for every objective how far the team is from finishing it and how many points it would gain
+// by finishing it or improving its rank by one, by re-evaluating the tree with a hypothetical match for the team.
+func CalculateGaps(rootObjective *repository.Objective, teamIds []int, aggregations ObjectiveTeamMatches, teamId int, now time.Time) ([]*ObjectiveGap, error) {
+	aggregations = VisibleAggregations(rootObjective, aggregations, teamId)
+	baseScores, err := EvaluateScores(rootObjective, teamIds, aggregations)
+	if err != nil {
+		return nil, err
+	}
+	evaluator := &gapEvaluator{
+		teamIds:      teamIds,
+		teamId:       teamId,
+		aggregations: aggregations,
+		baseScores:   baseScores,
+		parents:      parentMap(rootObjective),
+	}
+
+	gaps := make([]*ObjectiveGap, 0)
+	for _, objective := range rootObjective.FlatMap() {
+		score := baseScores[teamId][objective.Id]
+		gap := &ObjectiveGap{
+			ObjectiveId:    objective.Id,
+			RequiredAmount: objective.RequiredAmount,
+			Finished:       len(score.PresetCompletions) > 0 && score.Finished(),
+			Points:         score.Points(),
+		}
+		for _, completion := range score.PresetCompletions {
+			gap.Number = max(gap.Number, completion.Number)
+			if completion.Rank > 0 && (gap.Rank == 0 || completion.Rank < gap.Rank) {
+				gap.Rank = completion.Rank
+			}
+		}
+		current := aggregations[objective.Id][teamId]
+		if current != nil {
+			gap.Number = current.Number
+			gap.Finished = current.Finished
+		}
+		if objective.CountingMethod == repository.CountingMethodChildResult || objective.CountingMethod == repository.CountingMethodValueChangeInWindow {
+			// progress on these objectives can't be simulated directly
+			gaps = append(gaps, gap)
+			continue
+		}
+		if current == nil || !current.Finished {
+			gap.PointsOnFinish, err = evaluator.pointsWith(objective, &Match{
+				ObjectiveId: objective.Id,
+				TeamId:      teamId,
+				Number:      max(objective.RequiredAmount, gap.Number),
+				Timestamp:   now,
+				Finished:    true,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if target := nextRankNumber(objective, aggregations[objective.Id], teamId); target != nil {
+			gap.PointsOnRankUp, err = evaluator.pointsWith(objective, &Match{
+				ObjectiveId: objective.Id,
+				TeamId:      teamId,
+				Number:      *target,
+				Timestamp:   now,
+				Finished:    objective.RequiredAmount <= *target,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		gaps = append(gaps, gap)
+	}
+	return gaps, nil
+}
+
+// gapEvaluator calculates the points of hypothetical matches of a team. A match only changes the score of its objective
+// and of the objectives above it, which read the scores of their children, so only these are evaluated again instead of
+// the whole tree for every objective.
+type gapEvaluator struct {
+	teamIds      []int
+	teamId       int
+	aggregations ObjectiveTeamMatches
+	baseScores   map[int]map[int]*Score
+	parents      map[int]*repository.Objective
+}
+
+// pointsWith returns the points the team gains if its match for the objective is replaced by the given one
+func (e *gapEvaluator) pointsWith(objective *repository.Objective, match *Match) (int, error) {
+	aggregations := withMatch(e.aggregations, objective.Id, match)
+	path := make([]*repository.Objective, 0)
+	for current := objective; current != nil; current = e.parents[current.Id] {
+		path = append(path, current)
+	}
+	scores := make(map[int]map[int]*Score, len(e.teamIds))
+	for _, teamId := range e.teamIds {
+		scores[teamId] = make(map[int]*Score)
+		for _, current := range path {
+			scores[teamId][current.Id] = newScore(current, teamId)
+		}
+		for _, current := range path {
+			for _, child := range current.Children {
+				if _, ok := scores[teamId][child.Id]; ok {
+					continue
+				}
+				// the results of the other children stay the same, only the bonus points given by their parent can change
+				childScore := *e.baseScores[teamId][child.Id]
+				childScore.BonusPoints = 0
+				scores[teamId][child.Id] = &childScore
+			}
+		}
+	}
+	for _, current := range path {
+		if err := evaluateScoringRules(current, aggregations, scores); err != nil {
+			return 0, err
+		}
+	}
+	difference := 0
+	for objectiveId, score := range scores[e.teamId] {
+		difference += score.Points() - e.baseScores[e.teamId][objectiveId].Points()
+	}
+	return difference, nil
+}
+
+func parentMap(rootObjective *repository.Objective) map[int]*repository.Objective {
+	parents := make(map[int]*repository.Objective)
+	for _, objective := range rootObjective.FlatMap() {
+		for _, child := range objective.Children {
+			parents[child.Id] = objective
+		}
+	}
+	return parents
+}
+
+// nextRankNumber returns the number the team would need to overtake the closest better team on a value ranked objective
+func nextRankNumber(objective *repository.Objective, teamMatches TeamMatches, teamId int) *int {
+	for _, rule := range objective.ScoringRules {
+		var better func(a, b int) bool
+		var step int
+		switch rule.RuleType {
+		case repository.RANK_BY_HIGHEST_VALUE:
+			better, step = func(a, b int) bool { return a > b }, 1
+		case repository.RANK_BY_LOWEST_VALUE:
+			better, step = func(a, b int) bool { return a < b }, -1
+		default:
+			continue
+		}
+		own := teamMatches[teamId]
+		var closest *int
+		for otherTeamId, match := range teamMatches {
+			if otherTeamId == teamId || (own != nil && !better(match.Number, own.Number)) {
+				continue
+			}
+			if closest == nil || better(*closest, match.Number) {
+				closest = &match.Number
+			}
+		}
+		if closest == nil {
+			return nil
+		}
+		target := *closest + step
+		return &target
+	}
+	return nil
+}
+
+// withMatch returns a copy of the aggregations in which the team's match for the given objective is replaced
+func withMatch(aggregations ObjectiveTeamMatches, objectiveId int, match *Match) ObjectiveTeamMatches {
+	modified := make(ObjectiveTeamMatches, len(aggregations))
+	for id, teamMatches := range aggregations {
+		modified[id] = teamMatches
+	}
+	teamMatches := make(TeamMatches, len(aggregations[objectiveId])+1)
+	for teamId, m := range aggregations[objectiveId] {
+		teamMatches[teamId] = m
+	}
+	teamMatches[match.TeamId] = match
+	modified[objectiveId] = teamMatches
+	return modified
+}
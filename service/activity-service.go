@@ -38,10 +38,21 @@ func (s *ActivityServiceImpl) CalculateActiveTime(userId int, event *repository.
 }
 
 func determineActiveTime(activities []*repository.Activity, threshold time.Duration) time.Duration {
+	var totalDuration time.Duration
+	for _, session := range activitySessions(activities, threshold) {
+		totalDuration += session.End.Sub(session.Start)
+	}
+	return totalDuration
+}
+
+// activitySessions groups activities into sessions, starting a new session whenever two activities are more than threshold apart
+func activitySessions(activities []*repository.Activity, threshold time.Duration) []ActivitySession {
+	if len(activities) == 0 {
+		return []ActivitySession{}
+	}
 	slices.SortFunc(activities, func(a, b *repository.Activity) int {
 		return a.Time.Compare(b.Time)
 	})
-	var totalDuration time.Duration
 	var sessions []ActivitySession
 	sessionStart := activities[0].Time
 	sessionEnd := activities[0].Time
@@ -53,11 +64,23 @@ func determineActiveTime(activities []*repository.Activity, threshold time.Durat
 		sessionEnd = activity.Time
 
 	}
-	sessions = append(sessions, ActivitySession{Start: sessionStart, End: sessionEnd})
+	return append(sessions, ActivitySession{Start: sessionStart, End: sessionEnd})
+}
+
+// activeTimeUntil sums up the time spent in sessions before the cutoff
+func activeTimeUntil(sessions []ActivitySession, cutoff time.Time) time.Duration {
+	var total time.Duration
 	for _, session := range sessions {
-		totalDuration += session.End.Sub(session.Start)
+		if !session.Start.Before(cutoff) {
+			break
+		}
+		end := session.End
+		if end.After(cutoff) {
+			end = cutoff
+		}
+		total += end.Sub(session.Start)
 	}
-	return totalDuration
+	return total
 }
 
 func (s *ActivityServiceImpl) CalculateActiveTimesForEvent(event *repository.Event, threshold time.Duration) (map[int]int, error) {
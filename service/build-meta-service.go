@@ -0,0 +1,244 @@
+package service
+
+import (
+	"bpl/client"
+	"bpl/repository"
+	"bpl/utils"
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// minBuildMetaInterval bounds the number of evolution snapshots that are computed for a single request
+	minBuildMetaInterval = time.Hour
+	// the meta is public, so the PoB history of an event is shared by the requests within this time
+	pobHistoryCacheTtl = 5 * time.Minute
+)
+
+type BuildMetaFilter struct {
+	TeamId   *int
+	MinLevel int
+	MaxLevel int
+	// Interval between two snapshots of the meta evolution
+	Interval time.Duration
+}
+
+type ArchetypeStats struct {
+	Name      string
+	Count     int
+	Share     float64
+	MedianDPS int64
+	TopDPS    int64
+	MedianEHP int32
+	TopEHP    int32
+}
+
+type BuildMetaSnapshot struct {
+	Timestamp    time.Time
+	Characters   int
+	Classes      map[string]int
+	Ascendancies map[string]int
+	MainSkills   map[string]int
+	MedianDPS    int64
+	MedianEHP    int32
+}
+
+type BuildMeta struct {
+	Characters   int
+	Classes      []*ArchetypeStats
+	Ascendancies []*ArchetypeStats
+	MainSkills   []*ArchetypeStats
+	Evolution    []*BuildMetaSnapshot
+}
+
+type BuildMetaService interface {
+	GetBuildMeta(event *repository.Event, filter BuildMetaFilter) (*BuildMeta, error)
+}
+
+type BuildMetaServiceImpl struct {
+	characterRepository repository.CharacterRepository
+	teamRepository      repository.TeamRepository
+	mu                  sync.Mutex
+	pobHistories        map[int]*pobHistory
+}
+
+type pobHistory struct {
+	pobs     []*repository.CharacterPob
+	loadedAt time.Time
+}
+
+func NewBuildMetaService() BuildMetaService {
+	return &BuildMetaServiceImpl{
+		characterRepository: repository.NewCharacterRepository(),
+		teamRepository:      repository.NewTeamRepository(),
+		pobHistories:        make(map[int]*pobHistory),
+	}
+}
+
+// getPoBHistory returns the PoB history of the event, which is loaded at most once per pobHistoryCacheTtl
+func (s *BuildMetaServiceImpl) getPoBHistory(eventId int) ([]*repository.CharacterPob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history, ok := s.pobHistories[eventId]
+	if !ok || time.Since(history.loadedAt) >= pobHistoryCacheTtl {
+		pobs, err := s.characterRepository.GetPoBHistoryForEvent(eventId)
+		if err != nil {
+			return nil, err
+		}
+		history = &pobHistory{pobs: pobs, loadedAt: time.Now()}
+		s.pobHistories[eventId] = history
+	}
+	return history.pobs, nil
+}
+
+func (s *BuildMetaServiceImpl) GetBuildMeta(event *repository.Event, filter BuildMetaFilter) (*BuildMeta, error) {
+	pobs, err := s.getPoBHistory(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	if filter.TeamId != nil {
+		characters, err := s.characterRepository.GetCharactersForEvent(event.Id)
+		if err != nil {
+			return nil, err
+		}
+		teamUsers, err := s.teamRepository.GetTeamUsersForEvent(event.Id)
+		if err != nil {
+			return nil, err
+		}
+		teamMembers := make(map[int]bool)
+		for _, teamUser := range teamUsers {
+			if teamUser.TeamId == *filter.TeamId {
+				teamMembers[teamUser.UserId] = true
+			}
+		}
+		teamCharacters := make(map[string]bool)
+		for _, character := range characters {
+			if character.UserId != nil && teamMembers[*character.UserId] {
+				teamCharacters[character.Id] = true
+			}
+		}
+		pobs = utils.Filter(pobs, func(pob *repository.CharacterPob) bool {
+			return teamCharacters[pob.CharacterId]
+		})
+	}
+	end := time.Now()
+	if event.EventEndTime.Before(end) {
+		end = event.EventEndTime
+	}
+	return AggregateBuildMeta(pobs, filter, buildMetaSnapshotTimes(event.EventStartTime, end, filter.Interval)), nil
+}
+
+func buildMetaSnapshotTimes(start time.Time, end time.Time, interval time.Duration) []time.Time {
+	if interval < minBuildMetaInterval {
+		interval = minBuildMetaInterval
+	}
+	times := make([]time.Time, 0)
+	for t := start.Add(interval); !t.After(end); t = t.Add(interval) {
+		times = append(times, t)
+	}
+	return times
+}
+
+// AggregateBuildMeta computes the build distribution from the latest PoB of every character as well as
+// snapshots of the distribution at the given times. The pobs have to be ordered by creation time.
+func AggregateBuildMeta(pobs []*repository.CharacterPob, filter BuildMetaFilter, snapshotTimes []time.Time) *BuildMeta {
+	latest := make(map[string]*repository.CharacterPob)
+	evolution := make([]*BuildMetaSnapshot, 0, len(snapshotTimes))
+	i := 0
+	for _, snapshotTime := range snapshotTimes {
+		for ; i < len(pobs) && !pobs[i].CreatedAt.After(snapshotTime); i++ {
+			latest[pobs[i].CharacterId] = pobs[i]
+		}
+		evolution = append(evolution, buildMetaSnapshot(snapshotTime, filterByLevel(utils.Values(latest), filter)))
+	}
+	for ; i < len(pobs); i++ {
+		latest[pobs[i].CharacterId] = pobs[i]
+	}
+
+	current := filterByLevel(utils.Values(latest), filter)
+	return &BuildMeta{
+		Characters: len(current),
+		Classes: archetypeStats(current, func(pob *repository.CharacterPob) string {
+			return client.GetBaseClass(pob.Ascendancy)
+		}),
+		Ascendancies: archetypeStats(current, func(pob *repository.CharacterPob) string { return pob.Ascendancy }),
+		MainSkills:   archetypeStats(current, func(pob *repository.CharacterPob) string { return pob.MainSkill }),
+		Evolution:    evolution,
+	}
+}
+
+func filterByLevel(pobs []*repository.CharacterPob, filter BuildMetaFilter) []*repository.CharacterPob {
+	return utils.Filter(pobs, func(pob *repository.CharacterPob) bool {
+		return pob.Level >= filter.MinLevel && (filter.MaxLevel == 0 || pob.Level <= filter.MaxLevel)
+	})
+}
+
+func buildMetaSnapshot(timestamp time.Time, pobs []*repository.CharacterPob) *BuildMetaSnapshot {
+	snapshot := &BuildMetaSnapshot{
+		Timestamp:    timestamp,
+		Characters:   len(pobs),
+		Classes:      make(map[string]int),
+		Ascendancies: make(map[string]int),
+		MainSkills:   make(map[string]int),
+		MedianDPS:    median(utils.Map(pobs, func(pob *repository.CharacterPob) int64 { return pob.DPS })),
+		MedianEHP:    median(utils.Map(pobs, func(pob *repository.CharacterPob) int32 { return pob.EHP })),
+	}
+	for _, pob := range pobs {
+		if pob.Ascendancy != "" {
+			snapshot.Classes[client.GetBaseClass(pob.Ascendancy)]++
+			snapshot.Ascendancies[pob.Ascendancy]++
+		}
+		if pob.MainSkill != "" {
+			snapshot.MainSkills[pob.MainSkill]++
+		}
+	}
+	return snapshot
+}
+
+// archetypeStats groups the pobs by the given key and returns the groups ordered by popularity
+func archetypeStats(pobs []*repository.CharacterPob, key func(*repository.CharacterPob) string) []*ArchetypeStats {
+	groups := make(map[string][]*repository.CharacterPob)
+	for _, pob := range pobs {
+		name := key(pob)
+		if name == "" {
+			continue
+		}
+		groups[name] = append(groups[name], pob)
+	}
+	stats := make([]*ArchetypeStats, 0, len(groups))
+	for name, group := range groups {
+		dps := utils.Map(group, func(pob *repository.CharacterPob) int64 { return pob.DPS })
+		ehp := utils.Map(group, func(pob *repository.CharacterPob) int32 { return pob.EHP })
+		stats = append(stats, &ArchetypeStats{
+			Name:      name,
+			Count:     len(group),
+			Share:     float64(len(group)) / float64(len(pobs)),
+			MedianDPS: median(dps),
+			TopDPS:    slices.Max(dps),
+			MedianEHP: median(ehp),
+			TopEHP:    slices.Max(ehp),
+		})
+	}
+	slices.SortFunc(stats, func(a, b *ArchetypeStats) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return stats
+}
+
+func median[T int32 | int64 | float64](values []T) T {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -10,6 +10,8 @@ type CachedDataService interface {
 	GetLatestLadder(eventId int) ([]byte, error)
 	GetLatestLadderUnMarshalled(eventId int) (*client.Ladder, error)
 	SaveScore(eventId int, data []byte) error
+	GetFinalScore(eventId int) ([]byte, error)
+	SaveFinalScore(eventId int, data []byte) error
 	SaveLadder(eventId int, ladder *client.Ladder) error
 }
 
@@ -37,6 +39,14 @@ func (s *CachedDataServiceImpl) SaveScore(eventId int, data []byte) error {
 	return s.repository.SaveScore(eventId, data)
 }
 
+func (s *CachedDataServiceImpl) GetFinalScore(eventId int) ([]byte, error) {
+	return s.repository.GetFinalScore(eventId)
+}
+
+func (s *CachedDataServiceImpl) SaveFinalScore(eventId int, data []byte) error {
+	return s.repository.SaveFinalScore(eventId, data)
+}
+
 func (s *CachedDataServiceImpl) SaveLadder(eventId int, ladder *client.Ladder) error {
 	return s.repository.SaveLadder(eventId, ladder)
 }
@@ -7,12 +7,18 @@ import (
 	"bpl/parser"
 	"bpl/repository"
 	"bpl/utils"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 )
 
+var ErrPoBOfOtherCharacter = errors.New("PoB belongs to another character")
+
 type CharacterService interface {
 	TrackActivity(eventId int, update *parser.PlayerUpdate) error
 	GetCharactersForUser(user *repository.User) ([]*repository.Character, error)
@@ -31,6 +37,7 @@ type CharacterService interface {
 	UpdatePoBStats() error
 	GetPoBById(pobId int) (*repository.CharacterPob, error)
 	DeletePoB(pobId int) error
+	ComparePoBs(characterId string, fromId int, toId int) (*PoBDiff, error)
 }
 
 type CharacterServiceImpl struct {
@@ -42,6 +49,7 @@ type CharacterServiceImpl struct {
 	atlasService        AtlasService
 	itemService         ItemService
 	poeClient           *client.PoEClient
+	logger              *slog.Logger
 }
 
 func NewCharacterService(poeClient *client.PoEClient) CharacterService {
@@ -54,6 +62,7 @@ func NewCharacterService(poeClient *client.PoEClient) CharacterService {
 		atlasService:        NewAtlasService(),
 		itemService:         NewItemService(),
 		poeClient:           poeClient,
+		logger:              config.Logger("service"),
 	}
 }
 
@@ -65,7 +74,7 @@ func (c *CharacterServiceImpl) TrackActivity(eventId int, update *parser.PlayerU
 			EventId: eventId,
 		})
 		if err != nil {
-			fmt.Println("Error saving activity")
+			c.logger.Error("Failed to save activity", "user_id", update.UserId, "event_id", eventId, "error", err)
 		}
 	}
 
@@ -231,7 +240,7 @@ func (c *CharacterServiceImpl) UpdatePoB(pob *repository.CharacterPob) error {
 	if err == nil {
 		pob.UpdateStats(pobDecoded)
 	} else {
-		fmt.Printf("Error decoding updated PoB for character %s: %v\n", pob.CharacterId, err)
+		c.logger.Warn("Failed to decode updated PoB", "character_id", pob.CharacterId, "pob_id", pob.Id, "error", err)
 	}
 	return c.characterRepository.SavePoB(pob)
 }
@@ -242,18 +251,18 @@ func (c *CharacterServiceImpl) UpdateLatestPoBs() error {
 	startId := 0
 
 	for {
-		fmt.Printf("Fetching PoBs starting from ID %d\n", startId)
+		c.logger.Info("Fetching PoBs", "start_id", startId)
 		pobs, err := c.characterRepository.GetPobsFromIdWithLimit(startId+1, 100)
 
 		if err != nil {
-			fmt.Printf("Error getting PoBs from id %d: %v\n", startId, err)
+			c.logger.Error("Failed to get PoBs", "start_id", startId, "error", err)
 			return err
 		}
 		if len(pobs) == 0 {
 			break
 		}
 		for _, characterPob := range pobs {
-			fmt.Printf("Processing PoB ID %d\n", characterPob.Id)
+			c.logger.Debug("Processing PoB", "pob_id", characterPob.Id)
 			startId = characterPob.Id
 			if characterPob.UpdatedAt.After(updateStart) {
 				continue
@@ -263,7 +272,7 @@ func (c *CharacterServiceImpl) UpdateLatestPoBs() error {
 				defer func() { <-semaphore }() // Release the slot when done
 				err := c.UpdatePoB(characterPob)
 				if err != nil {
-					fmt.Printf("Error updating PoB for character %s: %v\n", characterPob.CharacterId, err)
+					c.logger.Error("Failed to update PoB", "character_id", characterPob.CharacterId, "pob_id", characterPob.Id, "error", err)
 				}
 			}(characterPob)
 		}
@@ -282,7 +291,7 @@ func (c *CharacterServiceImpl) UpdatePoBStats() error {
 		pobs, err := c.characterRepository.GetPobsFromIdWithLimit(startId+1, 1000)
 
 		if err != nil {
-			fmt.Printf("Error getting PoBs from id %d: %v\n", startId, err)
+			c.logger.Error("Failed to get PoBs", "start_id", startId, "error", err)
 			return err
 		}
 		if len(pobs) == 0 {
@@ -292,7 +301,7 @@ func (c *CharacterServiceImpl) UpdatePoBStats() error {
 			startId = characterPob.Id
 			pob, err := characterPob.Export.Decode()
 			if err != nil {
-				fmt.Printf("Error decoding PoB for character %s: %v\n", characterPob.CharacterId, err)
+				c.logger.Warn("Failed to decode PoB", "character_id", characterPob.CharacterId, "pob_id", characterPob.Id, "error", err)
 				continue
 			}
 			itemIndexes := make(map[int]bool)
@@ -300,7 +309,7 @@ func (c *CharacterServiceImpl) UpdatePoBStats() error {
 				if item.Rarity == "UNIQUE" {
 					itemId, err := c.itemService.GetOrCreateId(item.Name, repository.ItemTypeUnique)
 					if err != nil {
-						fmt.Printf("Error getting unique item id %s: %v\n", item.Name, err)
+						c.logger.Error("Failed to get unique item id", "item", item.Name, "error", err)
 						continue
 					}
 					itemIndexes[itemId] = true
@@ -315,7 +324,7 @@ func (c *CharacterServiceImpl) UpdatePoBStats() error {
 						}
 						itemId, err := c.itemService.GetOrCreateId(name, repository.ItemTypeGem)
 						if err != nil {
-							fmt.Printf("Error getting gem item id %s: %v\n", name, err)
+							c.logger.Error("Failed to get gem item id", "item", name, "error", err)
 							continue
 						}
 						itemIndexes[itemId] = true
@@ -333,9 +342,9 @@ func (c *CharacterServiceImpl) UpdatePoBStats() error {
 		}
 		err = c.characterRepository.SavePoBs(pobs)
 		if err != nil {
-			fmt.Printf("Error saving PoBs: %v\n", err)
+			c.logger.Error("Failed to save PoBs", "error", err)
 		}
-		fmt.Printf("Updated PoBs up to ID %d\n", startId)
+		c.logger.Info("Updated PoBs", "up_to_id", startId)
 	}
 	return nil
 }
@@ -347,3 +356,152 @@ func (c *CharacterServiceImpl) GetPoBById(pobId int) (*repository.CharacterPob,
 func (c *CharacterServiceImpl) DeletePoB(pobId int) error {
 	return c.characterRepository.DeletePoB(pobId)
 }
+
+type PoBItemChange struct {
+	Slot string
+	From *client.PoBItem
+	To   *client.PoBItem
+}
+
+type PoBGemChange struct {
+	Name      string
+	FromLevel *int
+	ToLevel   *int
+}
+
+type PoBStatDelta struct {
+	Stat  string
+	From  float64
+	To    float64
+	Delta float64
+}
+
+type PoBDiff struct {
+	From              *repository.CharacterPob
+	To                *repository.CharacterPob
+	Items             []*PoBItemChange
+	GemsAdded         []*PoBGemChange
+	GemsRemoved       []*PoBGemChange
+	GemsLevelled      []*PoBGemChange
+	PassivesAllocated []int
+	PassivesRemoved   []int
+	Stats             []*PoBStatDelta
+}
+
+// pobDiffStats are the player stats compared between two PoBs, in the order they are returned
+var pobDiffStats = []string{
+	"FullDPS", "CombinedDPS", "TotalEHP", "Life", "EnergyShield", "Mana", "Armour", "Evasion",
+	"PhysicalMaximumHitTaken", "FireMaximumHitTaken", "ColdMaximumHitTaken", "LightningMaximumHitTaken", "ChaosMaximumHitTaken",
+	"FireResist", "ColdResist", "LightningResist", "ChaosResist",
+	"EffectiveBlockChance", "EffectiveSpellBlockChance", "EffectiveSpellSuppressionChance", "EffectiveMovementSpeedMod",
+}
+
+func (c *CharacterServiceImpl) ComparePoBs(characterId string, fromId int, toId int) (*PoBDiff, error) {
+	fromPoB, err := c.characterRepository.GetPoBById(fromId)
+	if err != nil {
+		return nil, err
+	}
+	toPoB, err := c.characterRepository.GetPoBById(toId)
+	if err != nil {
+		return nil, err
+	}
+	if fromPoB.CharacterId != characterId || toPoB.CharacterId != characterId {
+		return nil, fmt.Errorf("%w: PoBs %d and %d do not both belong to character %s", ErrPoBOfOtherCharacter, fromId, toId, characterId)
+	}
+	from, err := fromPoB.Export.Decode()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding PoB %d: %w", fromId, err)
+	}
+	to, err := toPoB.Export.Decode()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding PoB %d: %w", toId, err)
+	}
+	diff := DiffPoBs(from, to)
+	diff.From = fromPoB
+	diff.To = toPoB
+	return diff, nil
+}
+
+// DiffPoBs compares the equipped items, gems, passives and main stats of two decoded PoBs
+func DiffPoBs(from *client.PathOfBuilding, to *client.PathOfBuilding) *PoBDiff {
+	diff := &PoBDiff{
+		Items:             diffPoBItems(from.GetEquippedItems(), to.GetEquippedItems()),
+		GemsAdded:         []*PoBGemChange{},
+		GemsRemoved:       []*PoBGemChange{},
+		GemsLevelled:      []*PoBGemChange{},
+		PassivesAllocated: []int{},
+		PassivesRemoved:   []int{},
+		Stats:             make([]*PoBStatDelta, 0, len(pobDiffStats)),
+	}
+
+	fromGems := from.GetGemLevels()
+	toGems := to.GetGemLevels()
+	for _, name := range slices.Sorted(maps.Keys(toGems)) {
+		toLevel := toGems[name]
+		fromLevel, ok := fromGems[name]
+		if !ok {
+			diff.GemsAdded = append(diff.GemsAdded, &PoBGemChange{Name: name, ToLevel: &toLevel})
+		} else if fromLevel != toLevel {
+			diff.GemsLevelled = append(diff.GemsLevelled, &PoBGemChange{Name: name, FromLevel: &fromLevel, ToLevel: &toLevel})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(fromGems)) {
+		if _, ok := toGems[name]; !ok {
+			fromLevel := fromGems[name]
+			diff.GemsRemoved = append(diff.GemsRemoved, &PoBGemChange{Name: name, FromLevel: &fromLevel})
+		}
+	}
+
+	fromPassives := make(map[int]bool)
+	for _, passive := range from.GetPassives() {
+		fromPassives[passive] = true
+	}
+	toPassives := make(map[int]bool)
+	for _, passive := range to.GetPassives() {
+		toPassives[passive] = true
+		if !fromPassives[passive] {
+			diff.PassivesAllocated = append(diff.PassivesAllocated, passive)
+		}
+	}
+	for passive := range fromPassives {
+		if !toPassives[passive] {
+			diff.PassivesRemoved = append(diff.PassivesRemoved, passive)
+		}
+	}
+	slices.Sort(diff.PassivesAllocated)
+	slices.Sort(diff.PassivesRemoved)
+
+	for _, stat := range pobDiffStats {
+		fromValue, _ := from.Build.PlayerStats.GetStat(stat)
+		toValue, _ := to.Build.PlayerStats.GetStat(stat)
+		diff.Stats = append(diff.Stats, &PoBStatDelta{Stat: stat, From: fromValue, To: toValue, Delta: toValue - fromValue})
+	}
+	return diff
+}
+
+func diffPoBItems(from map[string]client.PoBItem, to map[string]client.PoBItem) []*PoBItemChange {
+	slots := utils.Keys(from)
+	for slot := range to {
+		if _, ok := from[slot]; !ok {
+			slots = append(slots, slot)
+		}
+	}
+	slices.Sort(slots)
+	changes := make([]*PoBItemChange, 0)
+	for _, slot := range slots {
+		fromItem, fromOk := from[slot]
+		toItem, toOk := to[slot]
+		if fromOk && toOk && fromItem.Name == toItem.Name && fromItem.BaseType == toItem.BaseType && fromItem.Rarity == toItem.Rarity {
+			continue
+		}
+		change := &PoBItemChange{Slot: slot}
+		if fromOk {
+			change.From = &fromItem
+		}
+		if toOk {
+			change.To = &toItem
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"bpl/repository"
+	"slices"
+)
+
+type TeamDeathCount struct {
+	TeamId int
+	Deaths int
+}
+
+type DeathService interface {
+	RecordDeath(death *repository.CharacterDeath) error
+	GetDeathsForEvent(eventId int) ([]*repository.CharacterDeath, error)
+	GetTeamDeathCounts(event *repository.Event) ([]*TeamDeathCount, error)
+}
+
+type DeathServiceImpl struct {
+	deathRepository repository.DeathRepository
+}
+
+func NewDeathService() DeathService {
+	return &DeathServiceImpl{
+		deathRepository: repository.NewDeathRepository(),
+	}
+}
+
+func (s *DeathServiceImpl) RecordDeath(death *repository.CharacterDeath) error {
+	return s.deathRepository.SaveDeath(death)
+}
+
+func (s *DeathServiceImpl) GetDeathsForEvent(eventId int) ([]*repository.CharacterDeath, error) {
+	return s.deathRepository.GetDeathsForEvent(eventId)
+}
+
+func (s *DeathServiceImpl) GetTeamDeathCounts(event *repository.Event) ([]*TeamDeathCount, error) {
+	deaths, err := s.deathRepository.GetDeathsForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	return CountDeathsPerTeam(deaths, event.TeamIds()), nil
+}
+
+// CountDeathsPerTeam returns the number of deaths of every given team, including teams without any deaths
+func CountDeathsPerTeam(deaths []*repository.CharacterDeath, teamIds []int) []*TeamDeathCount {
+	counts := make(map[int]int, len(teamIds))
+	for _, teamId := range teamIds {
+		counts[teamId] = 0
+	}
+	for _, death := range deaths {
+		if _, ok := counts[death.TeamId]; ok {
+			counts[death.TeamId]++
+		}
+	}
+	result := make([]*TeamDeathCount, 0, len(counts))
+	for teamId, count := range counts {
+		result = append(result, &TeamDeathCount{TeamId: teamId, Deaths: count})
+	}
+	slices.SortFunc(result, func(a, b *TeamDeathCount) int {
+		return a.TeamId - b.TeamId
+	})
+	return result
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"bpl/repository"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DueEventPhase returns the phase that the event's schedule implies at the given time.
+// Draft and archived events are only moved by an admin and events never move back to an earlier phase.
+func DueEventPhase(event *repository.Event, now time.Time) repository.EventPhase {
+	if event.Phase == repository.EventPhaseDraft || event.Phase == repository.EventPhaseArchived {
+		return event.Phase
+	}
+	due := repository.EventPhasePublished
+	switch {
+	case !now.Before(event.GracePeriodEndTime()):
+		due = repository.EventPhaseFinal
+	case !now.Before(event.EventEndTime):
+		due = repository.EventPhaseGracePeriod
+	case !now.Before(event.EventStartTime):
+		due = repository.EventPhaseRunning
+	case !now.Before(event.ApplicationEndTime):
+		due = repository.EventPhaseApplicationsClosed
+	case !now.Before(event.ApplicationStartTime):
+		due = repository.EventPhaseApplicationsOpen
+	}
+	if due.IsBefore(event.Phase) {
+		return event.Phase
+	}
+	return due
+}
+
+// EventPhaseTransitions returns the phases an event enters when it is moved from one phase to another, in order
+func EventPhaseTransitions(from repository.EventPhase, to repository.EventPhase) ([]repository.EventPhase, error) {
+	fromIndex := slices.Index(repository.EventPhases, from)
+	toIndex := slices.Index(repository.EventPhases, to)
+	if fromIndex == -1 || toIndex == -1 {
+		return nil, fmt.Errorf("invalid event phase")
+	}
+	if toIndex <= fromIndex {
+		return nil, fmt.Errorf("event cannot move from %s back to %s", from, to)
+	}
+	return repository.EventPhases[fromIndex+1 : toIndex+1], nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bpl/config"
+	"bpl/repository"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidEventRole = errors.New("invalid event role")
+
+// EventRoles are the permissions that can be granted within an event. Admin is only granted globally.
+var EventRoles = []repository.Permission{
+	repository.PermissionManager,
+	repository.PermissionObjectiveDesigner,
+	repository.PermissionSubmissionJudge,
+}
+
+type EventRoleService interface {
+	GetEventRoles(eventId int) ([]*repository.EventRole, error)
+	GetEventRolesForUser(userId int, eventId int) ([]*repository.EventRole, error)
+	// GetEventPermissions returns the roles of the user in the event that apply to the team, or to the whole event if teamId is nil
+	GetEventPermissions(userId int, eventId int, teamId *int) ([]repository.Permission, error)
+	// GetEventIdsForUser returns the events in which the user holds any role, these are visible to the user before they are public
+	GetEventIdsForUser(userId int) ([]int, error)
+	GrantEventRole(role *repository.EventRole) (*repository.EventRole, error)
+	RevokeEventRole(eventId int, roleId int) error
+}
+
+type EventRoleServiceImpl struct {
+	eventRoleRepository repository.EventRoleRepository
+	teamRepository      repository.TeamRepository
+	logger              *slog.Logger
+}
+
+func NewEventRoleService() EventRoleService {
+	return &EventRoleServiceImpl{
+		eventRoleRepository: repository.NewEventRoleRepository(),
+		teamRepository:      repository.NewTeamRepository(),
+		logger:              config.Logger("service"),
+	}
+}
+
+func (s *EventRoleServiceImpl) GetEventRoles(eventId int) ([]*repository.EventRole, error) {
+	return s.eventRoleRepository.GetEventRolesForEvent(eventId, "User.OauthAccounts")
+}
+
+func (s *EventRoleServiceImpl) GetEventRolesForUser(userId int, eventId int) ([]*repository.EventRole, error) {
+	return s.eventRoleRepository.GetEventRolesForUser(userId, eventId)
+}
+
+func (s *EventRoleServiceImpl) GetEventPermissions(userId int, eventId int, teamId *int) ([]repository.Permission, error) {
+	roles, err := s.eventRoleRepository.GetEventRolesForUser(userId, eventId)
+	if err != nil {
+		return nil, err
+	}
+	return EventPermissions(roles, teamId), nil
+}
+
+func (s *EventRoleServiceImpl) GetEventIdsForUser(userId int) ([]int, error) {
+	return s.eventRoleRepository.GetEventIdsForUser(userId)
+}
+
+// EventPermissions returns the distinct permissions of the roles that apply to the team
+func EventPermissions(roles []*repository.EventRole, teamId *int) []repository.Permission {
+	permissions := make([]repository.Permission, 0, len(roles))
+	for _, role := range roles {
+		if role.AppliesToTeam(teamId) && !slices.Contains(permissions, role.Role) {
+			permissions = append(permissions, role.Role)
+		}
+	}
+	return permissions
+}
+
+func (s *EventRoleServiceImpl) GrantEventRole(role *repository.EventRole) (*repository.EventRole, error) {
+	if !slices.Contains(EventRoles, role.Role) {
+		return nil, fmt.Errorf("%w: %s can not be granted within an event", ErrInvalidEventRole, role.Role)
+	}
+	if role.TeamId != nil {
+		team, err := s.teamRepository.GetTeamById(*role.TeamId)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err != nil || team.EventId != role.EventId {
+			return nil, fmt.Errorf("%w: team %d does not belong to event %d", ErrInvalidEventRole, *role.TeamId, role.EventId)
+		}
+	}
+	existing, err := s.eventRoleRepository.FindEventRole(role)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	role.Id = 0
+	role.CreatedAt = time.Now()
+	role, err = s.eventRoleRepository.SaveEventRole(role)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("Granted event role", "user_id", role.UserId, "event_id", role.EventId, "team_id", role.TeamId, "role", role.Role)
+	return role, nil
+}
+
+func (s *EventRoleServiceImpl) RevokeEventRole(eventId int, roleId int) error {
+	role, err := s.eventRoleRepository.GetEventRoleById(roleId)
+	if err != nil {
+		return err
+	}
+	if role.EventId != eventId {
+		return gorm.ErrRecordNotFound
+	}
+	if err := s.eventRoleRepository.DeleteEventRole(roleId); err != nil {
+		return err
+	}
+	s.logger.Info("Revoked event role", "user_id", role.UserId, "event_id", role.EventId, "team_id", role.TeamId, "role", role.Role)
+	return nil
+}
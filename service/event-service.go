@@ -34,6 +34,8 @@ type EventService interface {
 	DeleteEvent(event *repository.Event) error
 	GetEventByConditionId(conditionId int) (*repository.Event, error)
 	GetEventStatus(event *repository.Event, user *repository.User) (*EventStatus, error)
+	UpdatePhase(event *repository.Event, phase repository.EventPhase) error
+	LockEvent(event *repository.Event) error
 }
 
 type EventServiceImpl struct {
@@ -58,7 +60,24 @@ func (e *EventServiceImpl) GetAllEvents(preloads ...string) ([]*repository.Event
 	return e.eventRepository.FindAll(preloads...)
 }
 
+// keepPhase makes sure that saving the settings of an event does not change its lifecycle phase
+func (e *EventServiceImpl) keepPhase(event *repository.Event) error {
+	if event.Id == 0 {
+		event.Phase = repository.EventPhaseDraft
+		return nil
+	}
+	existing, err := e.eventRepository.GetEventById(event.Id)
+	if err != nil {
+		return err
+	}
+	event.Phase = existing.Phase
+	return nil
+}
+
 func (e *EventServiceImpl) CreateEvent(event *repository.Event) (*repository.Event, error) {
+	if err := e.keepPhase(event); err != nil {
+		return nil, err
+	}
 	if event.Id == 0 {
 		event.Objectives = []*repository.Objective{{
 			Name: "default",
@@ -73,6 +92,9 @@ func (e *EventServiceImpl) CreateEvent(event *repository.Event) (*repository.Eve
 	return e.eventRepository.SaveEvent(event)
 }
 func (e *EventServiceImpl) CreateEventWithoutCategory(event *repository.Event) (*repository.Event, error) {
+	if err := e.keepPhase(event); err != nil {
+		return nil, err
+	}
 	if event.IsCurrent {
 		err := e.eventRepository.InvalidateCurrentEvent()
 		if err != nil {
@@ -102,6 +124,24 @@ func (e *EventServiceImpl) DeleteEvent(event *repository.Event) error {
 	return e.scoringRuleRepository.DeleteRulesForEvent(event.Id)
 }
 
+func (e *EventServiceImpl) UpdatePhase(event *repository.Event, phase repository.EventPhase) error {
+	err := e.eventRepository.UpdatePhase(event.Id, phase)
+	if err != nil {
+		return err
+	}
+	event.Phase = phase
+	return nil
+}
+
+func (e *EventServiceImpl) LockEvent(event *repository.Event) error {
+	err := e.eventRepository.SetLocked(event.Id, true)
+	if err != nil {
+		return err
+	}
+	event.Locked = true
+	return nil
+}
+
 func (e *EventServiceImpl) GetEventByConditionId(conditionId int) (*repository.Event, error) {
 	return e.eventRepository.GetEventByConditionId(conditionId)
 }
@@ -2,9 +2,13 @@ package service
 
 import (
 	"bpl/client"
+	"bpl/parser"
 	"bpl/repository"
 	"bpl/utils"
+	"cmp"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -21,6 +25,7 @@ type GuildStashService interface {
 	GetGuildsForEvent(event *repository.Event) ([]*repository.Guild, error)
 	GetGuildById(guildId int, eventId int) (*repository.Guild, error)
 	GetEarliestDeposits(event *repository.Event) ([]*repository.PlayerCompletion, error)
+	SearchGuildStash(teamId int, conditions []*repository.Condition, limit, offset *int) (*GuildStashSearchResult, error)
 }
 
 type GuildStashServiceImpl struct {
@@ -149,3 +154,164 @@ func (s *GuildStashServiceImpl) GetGuildById(guildId int, eventId int) (*reposit
 func (s *GuildStashServiceImpl) GetEarliestDeposits(event *repository.Event) ([]*repository.PlayerCompletion, error) {
 	return s.GuildStashRepository.GetEarliestDeposits(event)
 }
+
+type GuildStashSearchHit struct {
+	Item      client.Item
+	TabId     string
+	TabName   string
+	ParentId  *string
+	LastFetch time.Time
+}
+
+type BaseTypeCount struct {
+	BaseType  string
+	ItemCount int
+	StackSize int
+}
+
+type GuildStashSearchResult struct {
+	Total          int
+	Hits           []*GuildStashSearchHit
+	BaseTypeCounts []*BaseTypeCount
+}
+
+// SearchGuildStash returns the items of the team's guild stash tabs that satisfy all conditions, which are expected to be validated by the caller
+func (s *GuildStashServiceImpl) SearchGuildStash(teamId int, conditions []*repository.Condition, limit, offset *int) (*GuildStashSearchResult, error) {
+	checker, err := parser.ComperatorFromConditions(conditions)
+	if err != nil {
+		return nil, err
+	}
+	tabs, err := s.GuildStashRepository.GetByTeam(teamId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guild stash tabs for team %d: %w", teamId, err)
+	}
+	hits, err := searchGuildStashTabs(tabs, func(item *client.Item) bool { return checker(item) > 0 })
+	if err != nil {
+		return nil, err
+	}
+	result := &GuildStashSearchResult{
+		Total:          len(hits),
+		BaseTypeCounts: countBaseTypes(hits),
+	}
+	result.Hits = paginate(hits, limit, offset)
+	return result, nil
+}
+
+// paginate returns the page of the hits, out of range values are clamped
+func paginate(hits []*GuildStashSearchHit, limit, offset *int) []*GuildStashSearchHit {
+	start := max(0, min(utils.Deref(offset), len(hits)))
+	end := len(hits)
+	if limit != nil {
+		end = max(start, min(start+*limit, len(hits)))
+	}
+	return hits[start:end]
+}
+
+// searchGuildStashTabs returns all items in the fetched contents of the given tabs that satisfy the predicate,
+// ordered by tab index and position inside the tab
+func searchGuildStashTabs(tabs []*repository.GuildStashTab, predicate func(item *client.Item) bool) ([]*GuildStashSearchHit, error) {
+	slices.SortStableFunc(tabs, func(a, b *repository.GuildStashTab) int {
+		return cmp.Compare(utils.Deref(a.Index), utils.Deref(b.Index))
+	})
+	hits := make([]*GuildStashSearchHit, 0)
+	for _, tab := range tabs {
+		if tab.Raw == "" || tab.Raw == "{}" {
+			continue
+		}
+		var contents client.GuildStashTabGGG
+		if err := json.Unmarshal([]byte(tab.Raw), &contents); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stash data for stash %s: %w", tab.Id, err)
+		}
+		for _, item := range utils.Deref(contents.Items) {
+			if !predicate(&item) {
+				continue
+			}
+			hits = append(hits, &GuildStashSearchHit{
+				Item:      item,
+				TabId:     tab.Id,
+				TabName:   tab.Name,
+				ParentId:  tab.ParentId,
+				LastFetch: tab.LastFetch,
+			})
+		}
+	}
+	return hits, nil
+}
+
+func countBaseTypes(hits []*GuildStashSearchHit) []*BaseTypeCount {
+	counts := make(map[string]*BaseTypeCount)
+	for _, hit := range hits {
+		count, exists := counts[hit.Item.BaseType]
+		if !exists {
+			count = &BaseTypeCount{BaseType: hit.Item.BaseType}
+			counts[hit.Item.BaseType] = count
+		}
+		count.ItemCount++
+		count.StackSize += stackSize(hit.Item)
+	}
+	result := utils.Values(counts)
+	slices.SortFunc(result, func(a, b *BaseTypeCount) int {
+		if a.StackSize != b.StackSize {
+			return b.StackSize - a.StackSize
+		}
+		return cmp.Compare(a.BaseType, b.BaseType)
+	})
+	return result
+}
+
+// DiffGuildStashItems compares two snapshots of the same guild stash tab by item id and returns
+// the changelog entries explaining the difference. Items that kept their id but changed their
+// stack size or position are reported as modified with the signed stack size delta.
+// Timestamp, guild, event and account are left for the caller to fill in.
+func DiffGuildStashItems(previous []client.Item, current []client.Item) []*repository.GuildStashChangelog {
+	previousItems := make(map[string]client.Item, len(previous))
+	for _, item := range previous {
+		previousItems[item.Id] = item
+	}
+	currentIds := make(utils.Set[string], len(current))
+	logs := make([]*repository.GuildStashChangelog, 0)
+	for _, item := range current {
+		currentIds.Add(item.Id)
+		old, exists := previousItems[item.Id]
+		if !exists {
+			logs = append(logs, toDerivedLogEntry(item, repository.ActionAdded, stackSize(item)))
+			continue
+		}
+		delta := stackSize(item) - stackSize(old)
+		if delta != 0 || utils.Deref(item.X) != utils.Deref(old.X) || utils.Deref(item.Y) != utils.Deref(old.Y) {
+			logs = append(logs, toDerivedLogEntry(item, repository.ActionModified, delta))
+		}
+	}
+	for _, item := range previous {
+		if !currentIds[item.Id] {
+			logs = append(logs, toDerivedLogEntry(item, repository.ActionRemoved, stackSize(item)))
+		}
+	}
+	return logs
+}
+
+func toDerivedLogEntry(item client.Item, action repository.Action, number int) *repository.GuildStashChangelog {
+	return &repository.GuildStashChangelog{
+		Action:   action,
+		Number:   number,
+		ItemName: guildStashItemName(item),
+		X:        utils.Deref(item.X),
+		Y:        utils.Deref(item.Y),
+		Derived:  true,
+	}
+}
+
+// guildStashItemName mirrors the naming of the guild stash log, which prefixes the type line with the item name for uniques
+func guildStashItemName(item client.Item) string {
+	if item.Name == "" {
+		return item.TypeLine
+	}
+	return item.Name + " " + item.TypeLine
+}
+
+func stackSize(item client.Item) int {
+	if item.StackSize == nil {
+		return 1
+	}
+	return *item.StackSize
+}
@@ -2,63 +2,103 @@ package service
 
 import (
 	"bpl/client"
+	"bpl/config"
+	"bpl/parser"
 	"bpl/repository"
 	"bpl/utils"
+	"fmt"
+	"log/slog"
 	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ItemWishService interface {
 	CreateItemWish(itemWish *repository.ItemWish, teamId int) (*repository.ItemWish, error)
-	UpdateItemWish(itemWish *repository.ItemWish, teamId int, Fulfilled *bool, BuildEnabling *bool, Priority *int) (*repository.ItemWish, error)
+	UpdateItemWish(itemWish *repository.ItemWish, teamId int, Fulfilled *bool, BuildEnabling *bool, Priority *int, Conditions repository.Conditions) (*repository.ItemWish, error)
 	GetItemWishById(id int) (*repository.ItemWish, error)
 	DeleteItemWish(id int) error
 	GetItemWishesForTeam(teamId int) ([]*repository.ItemWish, error)
 	UpdateItemWishFulfillment(teamId int, userId int, character *client.Character) error
+	MatchStashItems(eventId int, teamId int, stash *client.PublicStashChange, source repository.UniqueItemSource, timestamp time.Time) error
+	GetItemWishCandidatesForTeam(teamId int) ([]*repository.ItemWishCandidate, error)
 }
 
 type ItemWishServiceImpl struct {
 	itemWishRepository repository.ItemWishRepository
+	userRepository     repository.UserRepository
+	discordClient      *client.LocalDiscordClient
+	openItemWishes     *itemWishCache
+	logger             *slog.Logger
 }
 
 func NewItemWishService() ItemWishService {
 	return &ItemWishServiceImpl{
 		itemWishRepository: repository.NewItemWishRepository(),
+		userRepository:     repository.NewUserRepository(),
+		discordClient:      client.NewLocalDiscordClient(),
+		openItemWishes:     openItemWishes,
+		logger:             config.Logger("service"),
 	}
 }
 
+// CreateItemWish saves the wish with the lowest priority among the team's wishes with the same conditions.
+// The conditions are expected to be validated by the caller.
 func (s *ItemWishServiceImpl) CreateItemWish(itemWish *repository.ItemWish, teamId int) (*repository.ItemWish, error) {
-	itemWishes, err := s.itemWishRepository.GetSimilarItemWishesInTeam(teamId, itemWish.ItemField, itemWish.Value)
+	if len(itemWish.Conditions) == 0 {
+		itemWish.Conditions = repository.Conditions{{Field: itemWish.ItemField, Operator: repository.EQ, Value: itemWish.Value}}
+	}
+	itemWishes, err := s.itemWishRepository.GetSimilarItemWishesInTeam(teamId, itemWish.Conditions)
 	if err != nil {
 		return nil, err
 	}
 	itemWish.Priority = len(itemWishes)
+	defer s.openItemWishes.invalidate()
 	return s.itemWishRepository.SaveItemWish(itemWish)
 }
 
-func (s *ItemWishServiceImpl) UpdateItemWish(itemWish *repository.ItemWish, teamId int, Fulfilled *bool, BuildEnabling *bool, Priority *int) (*repository.ItemWish, error) {
+// UpdateItemWish applies the given changes to the wish. Changed conditions move the wish to the end of the priority ranking
+// of the wishes with the new conditions, before a given priority is applied within that ranking.
+func (s *ItemWishServiceImpl) UpdateItemWish(itemWish *repository.ItemWish, teamId int, Fulfilled *bool, BuildEnabling *bool, Priority *int, Conditions repository.Conditions) (*repository.ItemWish, error) {
 	if Fulfilled != nil {
 		itemWish.Fulfilled = *Fulfilled
 	}
 	if BuildEnabling != nil {
 		itemWish.BuildEnabling = *BuildEnabling
 	}
-	if Priority != nil {
-		itemWishes, err := s.itemWishRepository.GetSimilarItemWishesInTeam(teamId, itemWish.ItemField, itemWish.Value)
+	defer s.openItemWishes.invalidate()
+	conditionsChanged := len(Conditions) > 0 && !reflect.DeepEqual(Conditions, itemWish.Conditions)
+	if conditionsChanged {
+		// item field and value only describe the condition of wishes created without conditions
+		itemWish.ItemField = ""
+		itemWish.Value = ""
+		itemWish.Conditions = Conditions
+	}
+	if conditionsChanged || Priority != nil {
+		itemWishes, err := s.itemWishRepository.GetSimilarItemWishesInTeam(teamId, itemWish.Conditions)
 		if err != nil {
 			return nil, err
 		}
-		priority := int(math.Max(math.Min(float64(*Priority), float64(len(itemWishes)-1)), 0))
-		for _, iw := range itemWishes {
-			if iw.Priority == priority {
-				iw.Priority = itemWish.Priority
-				_, err = s.itemWishRepository.SaveItemWish(iw)
-				if err != nil {
-					return nil, err
+		others := utils.Filter(itemWishes, func(iw *repository.ItemWish) bool { return iw.Id != itemWish.Id })
+		if conditionsChanged {
+			itemWish.Priority = len(others)
+		}
+		if Priority != nil {
+			priority := int(math.Max(math.Min(float64(*Priority), float64(len(others))), 0))
+			for _, iw := range others {
+				if iw.Priority == priority {
+					iw.Priority = itemWish.Priority
+					_, err = s.itemWishRepository.SaveItemWish(iw)
+					if err != nil {
+						return nil, err
+					}
+					break
 				}
-				break
 			}
+			itemWish.Priority = priority
 		}
-		itemWish.Priority = priority
 	}
 	return s.itemWishRepository.SaveItemWish(itemWish)
 }
@@ -68,6 +108,7 @@ func (s *ItemWishServiceImpl) GetItemWishById(id int) (*repository.ItemWish, err
 }
 
 func (s *ItemWishServiceImpl) DeleteItemWish(id int) error {
+	defer s.openItemWishes.invalidate()
 	return s.itemWishRepository.DeleteItemWish(id)
 }
 
@@ -80,43 +121,231 @@ func (s *ItemWishServiceImpl) GetItemWishesForTeam(teamId int) ([]*repository.It
 }
 
 func (s *ItemWishServiceImpl) UpdateItemWishFulfillment(teamId int, userId int, character *client.Character) error {
+	if character.Equipment == nil {
+		return nil
+	}
 	itemWishes, err := s.itemWishRepository.GetItemWishesForTeamAndUser(teamId, userId)
 	if err != nil {
 		return err
 	}
-	toSave := make([]*repository.ItemWish, 0)
-	for _, itemWish := range itemWishes {
-		if itemWish.Fulfilled || character.Equipment == nil {
-			continue
+	equipped := utils.FlatMap(*character.Equipment, func(i client.Item) []client.Item {
+		items := []client.Item{i}
+		if i.SocketedItems != nil {
+			items = append(items, *i.SocketedItems...)
 		}
-		for _, item := range utils.FlatMap(*character.Equipment, func(i client.Item) []client.Item {
-			items := []client.Item{i}
-			if i.SocketedItems != nil {
-				items = append(items, *i.SocketedItems...)
-			}
-			return items
-		}) {
-			switch itemWish.ItemField {
-			case repository.BASE_TYPE:
-				if item.BaseType == itemWish.Value {
-					itemWish.Fulfilled = true
-					toSave = append(toSave, itemWish)
-				}
-			case repository.NAME:
-				if item.Name == itemWish.Value {
-					itemWish.Fulfilled = true
-					toSave = append(toSave, itemWish)
-				}
-			default:
-				continue
-			}
+		return items
+	})
+	matches, err := MatchItemWishes(utils.Filter(itemWishes, func(iw *repository.ItemWish) bool { return !iw.Fulfilled }), equipped)
+	if err != nil {
+		return err
+	}
+	toSave := make([]*repository.ItemWish, 0)
+	for _, match := range matches {
+		if !match.Wish.Fulfilled {
+			match.Wish.Fulfilled = true
+			toSave = append(toSave, match.Wish)
 		}
 	}
 	if len(toSave) > 0 {
 		_, err = s.itemWishRepository.SaveItemWishes(toSave)
+		s.openItemWishes.invalidate()
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+type ItemWishMatch struct {
+	Wish *repository.ItemWish
+	Item *client.Item
+}
+
+// MatchItemWishes returns every combination of wish and item where the item satisfies all of the wish's conditions.
+// Wishes without conditions never match, since they would otherwise be satisfied by any item.
+func MatchItemWishes(itemWishes []*repository.ItemWish, items []client.Item) ([]*ItemWishMatch, error) {
+	compiled, err := compileItemWishes(itemWishes)
+	if err != nil {
+		return nil, err
+	}
+	return matchCompiledItemWishes(compiled, items), nil
+}
+
+type compiledItemWish struct {
+	wish    *repository.ItemWish
+	checker func(*client.Item) int
+}
+
+func compileItemWishes(itemWishes []*repository.ItemWish) ([]*compiledItemWish, error) {
+	compiled := make([]*compiledItemWish, 0, len(itemWishes))
+	for _, itemWish := range itemWishes {
+		if len(itemWish.Conditions) == 0 {
+			continue
+		}
+		checker, err := parser.ComperatorFromConditions(itemWish.Conditions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conditions for item wish %d: %w", itemWish.Id, err)
+		}
+		compiled = append(compiled, &compiledItemWish{wish: itemWish, checker: checker})
+	}
+	return compiled, nil
+}
+
+func matchCompiledItemWishes(itemWishes []*compiledItemWish, items []client.Item) []*ItemWishMatch {
+	matches := make([]*ItemWishMatch, 0)
+	for _, itemWish := range itemWishes {
+		for i := range items {
+			if itemWish.checker(&items[i]) > 0 {
+				matches = append(matches, &ItemWishMatch{Wish: itemWish.wish, Item: &items[i]})
+			}
+		}
+	}
+	return matches
+}
+
+// itemWishCacheTtl bounds how long wish changes made by another instance take to reach the matcher
+const itemWishCacheTtl = time.Minute
+
+// openItemWishes is shared by the item wish services of the process, so that changes through any of them invalidate it
+var openItemWishes = newItemWishCache(itemWishCacheTtl)
+
+// itemWishCache holds the compiled open wishes of each event by team, so matching a stash neither queries nor compiles them
+type itemWishCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	byEvent map[int]*eventItemWishes
+}
+
+type eventItemWishes struct {
+	byTeam   map[int][]*compiledItemWish
+	loadedAt time.Time
+}
+
+func newItemWishCache(ttl time.Duration) *itemWishCache {
+	return &itemWishCache{ttl: ttl, byEvent: make(map[int]*eventItemWishes)}
+}
+
+// get returns the compiled open wishes of the team, loading all open wishes of the event if they are not cached or expired
+func (c *itemWishCache) get(eventId int, teamId int, load func(eventId int) ([]*repository.ItemWish, error)) ([]*compiledItemWish, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.byEvent[eventId]
+	if !ok || time.Since(cached.loadedAt) >= c.ttl {
+		itemWishes, err := load(eventId)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := compileItemWishes(itemWishes)
+		if err != nil {
+			return nil, err
+		}
+		cached = &eventItemWishes{byTeam: make(map[int][]*compiledItemWish), loadedAt: time.Now()}
+		for _, itemWish := range compiled {
+			cached.byTeam[itemWish.wish.TeamID] = append(cached.byTeam[itemWish.wish.TeamID], itemWish)
+		}
+		c.byEvent[eventId] = cached
+	}
+	return cached.byTeam[teamId], nil
+}
+
+func (c *itemWishCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.byEvent)
+}
+
+// MatchStashItems records items of a team's stash that satisfy open wishes of the team and notifies the wishers about new candidates
+func (s *ItemWishServiceImpl) MatchStashItems(eventId int, teamId int, stash *client.PublicStashChange, source repository.UniqueItemSource, timestamp time.Time) error {
+	if len(stash.Items) == 0 {
+		return nil
+	}
+	itemWishes, err := s.openItemWishes.get(eventId, teamId, s.itemWishRepository.GetOpenItemWishesForEvent)
+	if err != nil {
+		return fmt.Errorf("failed to get open item wishes for event %d: %w", eventId, err)
+	}
+	matches := matchCompiledItemWishes(itemWishes, stash.Items)
+	newCandidates := make(map[int][]*repository.ItemWishCandidate)
+	for _, match := range matches {
+		if match.Item.Id == "" {
+			continue
+		}
+		candidate := &repository.ItemWishCandidate{
+			ItemWishId:  match.Wish.Id,
+			TeamId:      teamId,
+			EventId:     eventId,
+			ItemId:      match.Item.Id,
+			StashId:     stash.Id,
+			StashName:   stash.Stash,
+			AccountName: utils.Deref(stash.AccountName),
+			Source:      source,
+			X:           match.Item.X,
+			Y:           match.Item.Y,
+			Timestamp:   timestamp,
+		}
+		created, err := s.itemWishRepository.SaveItemWishCandidate(candidate)
+		if err != nil {
+			return fmt.Errorf("failed to save candidate for item wish %d: %w", match.Wish.Id, err)
+		}
+		if created {
+			candidate.ItemWish = match.Wish
+			newCandidates[match.Wish.UserID] = append(newCandidates[match.Wish.UserID], candidate)
+		}
+	}
+	return s.notifyWishers(newCandidates, matches)
+}
+
+func (s *ItemWishServiceImpl) notifyWishers(candidatesByUser map[int][]*repository.ItemWishCandidate, matches []*ItemWishMatch) error {
+	if len(candidatesByUser) == 0 {
+		return nil
+	}
+	itemNames := make(map[string]string)
+	for _, match := range matches {
+		itemNames[match.Item.Id] = guildStashItemName(*match.Item)
+	}
+	users, err := s.userRepository.GetUsersByIds(utils.Keys(candidatesByUser), "OauthAccounts")
+	if err != nil {
+		return fmt.Errorf("failed to get users to notify: %w", err)
+	}
+	notified := make([]int, 0)
+	for _, user := range users {
+		discordId := ""
+		for _, oauth := range user.OauthAccounts {
+			if oauth.Provider == repository.ProviderDiscord {
+				discordId = oauth.AccountId
+			}
+		}
+		if discordId == "" {
+			continue
+		}
+		candidates := candidatesByUser[user.Id]
+		if err := s.discordClient.SendDirectMessage(discordId, itemWishNotification(candidates, itemNames)); err != nil {
+			s.logger.Error("Failed to notify user about item wish candidates", "user_id", user.Id, "error", err)
+			continue
+		}
+		notified = append(notified, utils.Map(candidates, func(c *repository.ItemWishCandidate) int { return c.Id })...)
+	}
+	return s.itemWishRepository.SetItemWishCandidatesNotified(notified)
+}
+
+func itemWishNotification(candidates []*repository.ItemWishCandidate, itemNames map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString("Items matching your wishes were found:\n")
+	for _, candidate := range candidates {
+		location := candidate.StashId
+		if candidate.StashName != nil && *candidate.StashName != "" {
+			location = *candidate.StashName
+		}
+		if candidate.AccountName != "" {
+			location = fmt.Sprintf("%s of %s", location, candidate.AccountName)
+		}
+		if candidate.X != nil && candidate.Y != nil {
+			location = fmt.Sprintf("%s (x: %d, y: %d)", location, *candidate.X, *candidate.Y)
+		}
+		sb.WriteString(fmt.Sprintf("- %s in %s\n", itemNames[candidate.ItemId], location))
+	}
+	return sb.String()
+}
+
+func (s *ItemWishServiceImpl) GetItemWishCandidatesForTeam(teamId int) ([]*repository.ItemWishCandidate, error) {
+	return s.itemWishRepository.GetItemWishCandidatesForTeam(teamId)
+}
@@ -3,20 +3,30 @@ package service
 import (
 	"bpl/client"
 	"bpl/repository"
+	"bpl/utils"
+	"fmt"
+	"slices"
+	"time"
 )
 
 type LadderService interface {
 	UpsertLadder(ladder []*client.LadderEntry, eventId int, playerMap map[string]int) error
 	GetLadderForEvent(eventId int) ([]*repository.LadderEntry, error)
+	SnapshotLadder(eventId int, timestamp time.Time) error
+	PruneSnapshots(eventId int, retention time.Duration) error
+	GetCharacterTimeline(eventId int, character string) ([]*repository.LadderSnapshot, error)
+	GetLevelRace(eventId int, level int) ([]*LevelRaceEntry, error)
 }
 
 type LadderServiceImpl struct {
 	ladderRepository repository.LadderRepository
+	userRepository   repository.UserRepository
 }
 
 func NewLadderService() LadderService {
 	return &LadderServiceImpl{
 		ladderRepository: repository.NewLadderRepository(),
+		userRepository:   repository.NewUserRepository(),
 	}
 }
 
@@ -27,3 +37,107 @@ func (s *LadderServiceImpl) UpsertLadder(ladder []*client.LadderEntry, eventId i
 func (s *LadderServiceImpl) GetLadderForEvent(eventId int) ([]*repository.LadderEntry, error) {
 	return s.ladderRepository.GetLadderForEvent(eventId)
 }
+
+// SnapshotLadder stores the entries of the current ladder that changed since their last snapshot
+func (s *LadderServiceImpl) SnapshotLadder(eventId int, timestamp time.Time) error {
+	ladder, err := s.ladderRepository.GetLadderForEvent(eventId)
+	if err != nil {
+		return fmt.Errorf("failed to get ladder for event %d: %w", eventId, err)
+	}
+	latest, err := s.ladderRepository.GetLatestSnapshots(eventId)
+	if err != nil {
+		return fmt.Errorf("failed to get latest ladder snapshots for event %d: %w", eventId, err)
+	}
+	return s.ladderRepository.SaveSnapshots(DiffLadderSnapshots(latest, ladder, timestamp))
+}
+
+func (s *LadderServiceImpl) PruneSnapshots(eventId int, retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+	return s.ladderRepository.DeleteSnapshotsBefore(eventId, time.Now().Add(-retention))
+}
+
+func (s *LadderServiceImpl) GetCharacterTimeline(eventId int, character string) ([]*repository.LadderSnapshot, error) {
+	return s.ladderRepository.GetSnapshotsForCharacter(eventId, character)
+}
+
+type LevelRaceEntry struct {
+	TeamId    int
+	UserId    int
+	Character string
+	Timestamp time.Time
+}
+
+// GetLevelRace returns the first character of every team that reached the given level, fastest team first
+func (s *LadderServiceImpl) GetLevelRace(eventId int, level int) ([]*LevelRaceEntry, error) {
+	reached, err := s.ladderRepository.GetFirstTimesReachingLevel(eventId, level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get characters reaching level %d: %w", level, err)
+	}
+	users, err := s.userRepository.GetUsersWithTeamForEvent(eventId)
+	if err != nil {
+		return nil, err
+	}
+	userTeams := make(map[int]int, len(users))
+	for userId, user := range users {
+		userTeams[userId] = user.TeamId
+	}
+	return fastestPerTeam(reached, userTeams), nil
+}
+
+// DiffLadderSnapshots returns snapshots for all ladder entries that are new or differ from their latest snapshot
+func DiffLadderSnapshots(latest []*repository.LadderSnapshot, ladder []*repository.LadderEntry, timestamp time.Time) []*repository.LadderSnapshot {
+	latestByCharacter := make(map[string]*repository.LadderSnapshot, len(latest))
+	for _, snapshot := range latest {
+		latestByCharacter[snapshot.Character] = snapshot
+	}
+	snapshots := make([]*repository.LadderSnapshot, 0)
+	for _, entry := range ladder {
+		previous, ok := latestByCharacter[entry.Character]
+		if ok && previous.Level == entry.Level && previous.Experience == entry.Experience &&
+			previous.Delve == entry.Delve && previous.Rank == entry.Rank && previous.Class == entry.Class {
+			continue
+		}
+		snapshots = append(snapshots, &repository.LadderSnapshot{
+			EventId:    entry.EventId,
+			Character:  entry.Character,
+			Account:    entry.Account,
+			UserId:     entry.UserId,
+			Class:      entry.Class,
+			Level:      entry.Level,
+			Delve:      entry.Delve,
+			Experience: entry.Experience,
+			Rank:       entry.Rank,
+			Timestamp:  timestamp,
+		})
+	}
+	return snapshots
+}
+
+func fastestPerTeam(reached []*repository.LevelReached, userTeams map[int]int) []*LevelRaceEntry {
+	fastest := make(map[int]*LevelRaceEntry)
+	for _, r := range reached {
+		if r.UserId == nil {
+			continue
+		}
+		teamId, ok := userTeams[*r.UserId]
+		if !ok {
+			continue
+		}
+		if current, ok := fastest[teamId]; ok && !r.Timestamp.Before(current.Timestamp) {
+			continue
+		}
+		fastest[teamId] = &LevelRaceEntry{
+			TeamId:    teamId,
+			UserId:    *r.UserId,
+			Character: r.Character,
+			Timestamp: r.Timestamp,
+		}
+	}
+	entries := utils.Values(fastest)
+	slices.SortFunc(entries, func(a, b *LevelRaceEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return entries
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bpl/config"
+	"bpl/repository"
+	"context"
+	"database/sql"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Roles of background work that must only run on one instance at a time
+const (
+	LeaderRoleRecurringJobs   = "recurring-jobs"
+	LeaderRoleScoreUpdater    = "score-updater"
+	LeaderRolePoETokenRefresh = "poe-token-refresh"
+	LeaderRoleTokenCleanup    = "token-cleanup"
+	LeaderRoleRateLimitPrune  = "rate-limit-prune"
+)
+
+// how often followers try to take over a role and the leader checks that it still holds its lock
+const leaderElectionInterval = 5 * time.Second
+
+// LeaderElector decides which instance runs which background role. Leadership is held through a session level
+// postgres advisory lock, so it is released by the database as soon as the connection of the leader is gone.
+type LeaderElector struct {
+	leaseRepository repository.LeaderLeaseRepository
+	logger          *slog.Logger
+	instanceId      string
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	mu              sync.Mutex
+	leading         map[string]bool
+}
+
+var (
+	leaderElectorInstance *LeaderElector
+	leaderElectorOnce     sync.Once
+)
+
+// NewLeaderElector returns the elector of this process
+func NewLeaderElector() *LeaderElector {
+	leaderElectorOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderElectorInstance = &LeaderElector{
+			leaseRepository: repository.NewLeaderLeaseRepository(),
+			logger:          config.Logger("service").With("instance_id", config.Env().InstanceId),
+			instanceId:      config.Env().InstanceId,
+			ctx:             ctx,
+			cancel:          cancel,
+			leading:         make(map[string]bool),
+		}
+	})
+	return leaderElectorInstance
+}
+
+func (e *LeaderElector) InstanceId() string {
+	return e.instanceId
+}
+
+// IsLeader returns true if this instance currently holds the role
+func (e *LeaderElector) IsLeader(role string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading[role]
+}
+
+// LeadingRoles returns the roles this instance currently holds
+func (e *LeaderElector) LeadingRoles() map[string]bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return maps.Clone(e.leading)
+}
+
+func (e *LeaderElector) GetLeases() ([]*repository.LeaderLease, error) {
+	return e.leaseRepository.GetLeases()
+}
+
+// RunAsLeader campaigns for the role in the background and calls run whenever this instance becomes its leader.
+// The context passed to run is cancelled when the leadership is lost or the elector shuts down.
+func (e *LeaderElector) RunAsLeader(role string, run func(ctx context.Context)) {
+	e.wg.Go(func() {
+		for {
+			conn, ok, err := e.leaseRepository.TryLock(e.ctx, role)
+			if err != nil && e.ctx.Err() == nil {
+				e.logger.Error("Failed to campaign for leadership", "role", role, "error", err)
+			}
+			if ok {
+				e.lead(role, conn, run)
+			}
+			select {
+			case <-e.ctx.Done():
+				return
+			case <-time.After(leaderElectionInterval):
+			}
+		}
+	})
+}
+
+func (e *LeaderElector) lead(role string, conn *sql.Conn, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	lease := &repository.LeaderLease{
+		Role:       role,
+		InstanceId: e.instanceId,
+		AcquiredAt: time.Now(),
+		RenewedAt:  time.Now(),
+	}
+	if err := e.leaseRepository.SaveLease(lease); err != nil {
+		e.logger.Error("Failed to save lease", "role", role, "error", err)
+	}
+	e.setLeading(role, true)
+	e.logger.Info("Became leader", "role", role)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	ticker := time.NewTicker(leaderElectionInterval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case <-done:
+			running = false
+		case <-ticker.C:
+			// the lock lives as long as the session, a broken connection means another instance may already have taken over
+			if err := conn.PingContext(ctx); err != nil {
+				e.logger.Warn("Lost the connection holding the lock", "role", role, "error", err)
+				running = false
+				continue
+			}
+			lease.RenewedAt = time.Now()
+			if err := e.leaseRepository.SaveLease(lease); err != nil {
+				e.logger.Error("Failed to renew lease", "role", role, "error", err)
+			}
+		}
+	}
+	cancel()
+	<-done
+
+	e.setLeading(role, false)
+	if err := e.leaseRepository.Unlock(conn, role); err != nil {
+		e.logger.Error("Failed to release lock", "role", role, "error", err)
+	}
+	if err := e.leaseRepository.DeleteLease(role, e.instanceId); err != nil {
+		e.logger.Error("Failed to delete lease", "role", role, "error", err)
+	}
+	e.logger.Info("Stepped down as leader", "role", role)
+}
+
+func (e *LeaderElector) setLeading(role string, leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if leading {
+		e.leading[role] = true
+	} else {
+		delete(e.leading, role)
+	}
+}
+
+// Shutdown stops all roles of this instance and releases their locks so that other instances can take over right away.
+// It returns the error of the context if the roles did not stop in time.
+func (e *LeaderElector) Shutdown(ctx context.Context) error {
+	e.cancel()
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bpl/repository"
+	"cmp"
+	"slices"
+	"time"
+)
+
+// activities further apart than this belong to different play sessions
+const levelingSessionThreshold = 30 * time.Minute
+
+type XPSample struct {
+	Timestamp time.Time
+	Level     int
+	XP        int64
+}
+
+type LevelMilestone struct {
+	Level      int
+	ReachedAt  time.Time
+	WallClock  time.Duration
+	ActiveTime time.Duration
+}
+
+type CharacterLeveling struct {
+	CharacterId     string
+	Name            string
+	UserId          int
+	TeamId          *int
+	Level           int
+	XP              int64
+	ActiveTime      time.Duration
+	XPPerActiveHour float64
+	Milestones      []*LevelMilestone
+}
+
+type TeamMilestone struct {
+	Level            int
+	Reached          int
+	FastestActive    time.Duration
+	MedianActive     time.Duration
+	FastestWallClock time.Duration
+}
+
+type TeamLeveling struct {
+	TeamId                int
+	Characters            int
+	MedianXPPerActiveHour float64
+	Milestones            []*TeamMilestone
+}
+
+type LevelingReport struct {
+	Characters []*CharacterLeveling
+	Teams      []*TeamLeveling
+}
+
+type LevelingService interface {
+	GetLevelingReport(event *repository.Event) (*LevelingReport, error)
+	// GetActiveTimesToLevel returns the fastest active time to reach each level milestone per user
+	GetActiveTimesToLevel(event *repository.Event) (map[int]map[int]time.Duration, error)
+	GetActiveTime(userId int, event *repository.Event, until time.Time) (time.Duration, error)
+}
+
+type LevelingServiceImpl struct {
+	characterRepository repository.CharacterRepository
+	ladderRepository    repository.LadderRepository
+	activityRepository  repository.ActivityRepository
+	teamRepository      repository.TeamRepository
+}
+
+func NewLevelingService() LevelingService {
+	return &LevelingServiceImpl{
+		characterRepository: repository.NewCharacterRepository(),
+		ladderRepository:    repository.NewLadderRepository(),
+		activityRepository:  repository.NewActivityRepository(),
+		teamRepository:      repository.NewTeamRepository(),
+	}
+}
+
+// GetLevelingReport combines the XP recorded with every PoB and every ladder snapshot into a timeline per character
+// and measures it against the play sessions of the character's owner
+func (s *LevelingServiceImpl) GetLevelingReport(event *repository.Event) (*LevelingReport, error) {
+	characters, err := s.characterRepository.GetCharactersForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	pobs, err := s.characterRepository.GetPoBHistoryForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := s.ladderRepository.GetSnapshotsForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	activities, err := s.activityRepository.GetAllActivitiesForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+	teamUsers, err := s.teamRepository.GetTeamUsersForEvent(event.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	characterIdByName := make(map[string]string, len(characters))
+	for _, character := range characters {
+		characterIdByName[character.Name] = character.Id
+	}
+	samples := make(map[string][]*XPSample)
+	for _, pob := range pobs {
+		samples[pob.CharacterId] = append(samples[pob.CharacterId], &XPSample{Timestamp: pob.CreatedAt, Level: pob.Level, XP: pob.XP})
+	}
+	for _, snapshot := range snapshots {
+		if characterId, ok := characterIdByName[snapshot.Character]; ok {
+			samples[characterId] = append(samples[characterId], &XPSample{Timestamp: snapshot.Timestamp, Level: snapshot.Level, XP: int64(snapshot.Experience)})
+		}
+	}
+	userActivities := make(map[int][]*repository.Activity)
+	for _, activity := range activities {
+		userActivities[activity.UserId] = append(userActivities[activity.UserId], activity)
+	}
+	sessions := make(map[int][]ActivitySession, len(userActivities))
+	for userId, activities := range userActivities {
+		sessions[userId] = activitySessions(activities, levelingSessionThreshold)
+	}
+	teamByUser := make(map[int]int, len(teamUsers))
+	for _, teamUser := range teamUsers {
+		teamByUser[teamUser.UserId] = teamUser.TeamId
+	}
+
+	report := &LevelingReport{Characters: make([]*CharacterLeveling, 0, len(characters))}
+	for _, character := range characters {
+		if character.UserId == nil || len(samples[character.Id]) == 0 {
+			continue
+		}
+		leveling := CalculateCharacterLeveling(samples[character.Id], sessions[*character.UserId], event.EventStartTime)
+		leveling.CharacterId = character.Id
+		leveling.Name = character.Name
+		leveling.UserId = *character.UserId
+		if teamId, ok := teamByUser[*character.UserId]; ok {
+			leveling.TeamId = &teamId
+		}
+		report.Characters = append(report.Characters, leveling)
+	}
+	slices.SortFunc(report.Characters, func(a, b *CharacterLeveling) int {
+		if a.XP != b.XP {
+			return cmp.Compare(b.XP, a.XP)
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	report.Teams = AggregateTeamLeveling(report.Characters)
+	return report, nil
+}
+
+func (s *LevelingServiceImpl) GetActiveTimesToLevel(event *repository.Event) (map[int]map[int]time.Duration, error) {
+	report, err := s.GetLevelingReport(event)
+	if err != nil {
+		return nil, err
+	}
+	activeTimes := make(map[int]map[int]time.Duration)
+	for _, character := range report.Characters {
+		if activeTimes[character.UserId] == nil {
+			activeTimes[character.UserId] = make(map[int]time.Duration)
+		}
+		for _, milestone := range character.Milestones {
+			if current, ok := activeTimes[character.UserId][milestone.Level]; !ok || milestone.ActiveTime < current {
+				activeTimes[character.UserId][milestone.Level] = milestone.ActiveTime
+			}
+		}
+	}
+	return activeTimes, nil
+}
+
+func (s *LevelingServiceImpl) GetActiveTime(userId int, event *repository.Event, until time.Time) (time.Duration, error) {
+	activities, err := s.activityRepository.GetActivity(userId, event.Id)
+	if err != nil {
+		return 0, err
+	}
+	return activeTimeUntil(activitySessions(activities, levelingSessionThreshold), until), nil
+}
+
+// CalculateCharacterLeveling determines when each level milestone was first reached and the XP gained per hour of active play
+func CalculateCharacterLeveling(samples []*XPSample, sessions []ActivitySession, eventStart time.Time) *CharacterLeveling {
+	slices.SortFunc(samples, func(a, b *XPSample) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	leveling := &CharacterLeveling{Milestones: []*LevelMilestone{}}
+	milestoneIndex := 0
+	for _, sample := range samples {
+		for milestoneIndex < len(repository.LevelMilestones) && sample.Level >= repository.LevelMilestones[milestoneIndex] {
+			leveling.Milestones = append(leveling.Milestones, &LevelMilestone{
+				Level:      repository.LevelMilestones[milestoneIndex],
+				ReachedAt:  sample.Timestamp,
+				WallClock:  sample.Timestamp.Sub(eventStart),
+				ActiveTime: activeTimeUntil(sessions, sample.Timestamp),
+			})
+			milestoneIndex++
+		}
+		if sample.XP >= leveling.XP {
+			leveling.XP = sample.XP
+			leveling.Level = max(leveling.Level, sample.Level)
+			leveling.ActiveTime = activeTimeUntil(sessions, sample.Timestamp)
+		}
+	}
+	if leveling.ActiveTime > 0 {
+		leveling.XPPerActiveHour = float64(leveling.XP) / leveling.ActiveTime.Hours()
+	}
+	return leveling
+}
+
+// AggregateTeamLeveling compares how fast the characters of each team reached the level milestones
+func AggregateTeamLeveling(characters []*CharacterLeveling) []*TeamLeveling {
+	teamCharacters := make(map[int][]*CharacterLeveling)
+	for _, character := range characters {
+		if character.TeamId != nil {
+			teamCharacters[*character.TeamId] = append(teamCharacters[*character.TeamId], character)
+		}
+	}
+	teams := make([]*TeamLeveling, 0, len(teamCharacters))
+	for teamId, characters := range teamCharacters {
+		team := &TeamLeveling{
+			TeamId:     teamId,
+			Characters: len(characters),
+			Milestones: make([]*TeamMilestone, 0, len(repository.LevelMilestones)),
+		}
+		xpRates := make([]float64, 0, len(characters))
+		for _, character := range characters {
+			if character.XPPerActiveHour > 0 {
+				xpRates = append(xpRates, character.XPPerActiveHour)
+			}
+		}
+		team.MedianXPPerActiveHour = median(xpRates)
+		for _, level := range repository.LevelMilestones {
+			activeTimes := make([]int64, 0)
+			var fastestWallClock time.Duration
+			for _, character := range characters {
+				for _, milestone := range character.Milestones {
+					if milestone.Level != level {
+						continue
+					}
+					activeTimes = append(activeTimes, int64(milestone.ActiveTime))
+					if len(activeTimes) == 1 || milestone.WallClock < fastestWallClock {
+						fastestWallClock = milestone.WallClock
+					}
+				}
+			}
+			milestone := &TeamMilestone{Level: level, Reached: len(activeTimes)}
+			if len(activeTimes) > 0 {
+				milestone.FastestActive = time.Duration(slices.Min(activeTimes))
+				milestone.MedianActive = time.Duration(median(activeTimes))
+				milestone.FastestWallClock = fastestWallClock
+			}
+			team.Milestones = append(team.Milestones, milestone)
+		}
+		teams = append(teams, team)
+	}
+	slices.SortFunc(teams, func(a, b *TeamLeveling) int {
+		return a.TeamId - b.TeamId
+	})
+	return teams
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sync"
@@ -46,6 +47,7 @@ type OauthServiceImpl struct {
 	userService                UserService
 	clientCredentialRepository repository.ClientCredentialsRepository
 	oauthRepository            repository.OauthRepository
+	logger                     *slog.Logger
 }
 
 type DiscordUserResponse struct {
@@ -133,6 +135,7 @@ func NewOauthService() OauthService {
 		userService:                NewUserService(),
 		clientCredentialRepository: repository.NewClientCredentialsRepository(),
 		oauthRepository:            repository.NewOauthRepository(),
+		logger:                     config.Logger("service"),
 	}
 }
 
@@ -186,10 +189,10 @@ func (e *OauthServiceImpl) Verify(state string, code string, referrer *string, p
 func (e *OauthServiceImpl) addAccountToUser(authState *OauthState, referrer *string, accountId string, accountName string, token *oauth2.Token, provider repository.Provider) (*OauthState, error) {
 	user, err := e.userService.GetUserByOauthProviderAndAccountId(provider, accountId)
 	if err == nil {
-		fmt.Printf("Updating %s account %s for user %s\n", provider, accountName, user.DisplayName)
+		e.logger.Info("Updating oauth account", "provider", provider, "account", accountName, "user_id", user.Id)
 		authState.User = user
 	} else if authState.User == nil {
-		fmt.Printf("Creating new user for %s account %s\n", provider, accountName)
+		e.logger.Info("Creating new user for oauth account", "provider", provider, "account", accountName)
 		authState.User = &repository.User{
 			Permissions:   []repository.Permission{},
 			DisplayName:   accountName,
@@ -197,7 +200,7 @@ func (e *OauthServiceImpl) addAccountToUser(authState *OauthState, referrer *str
 			Referrer:      referrer,
 		}
 	} else {
-		fmt.Printf("Adding %s account %s to user %s\n", provider, accountName, authState.User.DisplayName)
+		e.logger.Info("Adding oauth account to user", "provider", provider, "account", accountName, "user_id", authState.User.Id)
 	}
 	newAccount := &repository.Oauth{
 		UserId:        authState.User.Id,
@@ -221,11 +224,11 @@ func (e *OauthServiceImpl) addAccountToUser(authState *OauthState, referrer *str
 	)
 	err = e.oauthRepository.DeleteOauthsByUserIdAndProvider(authState.User.Id, provider)
 	if err != nil {
-		fmt.Printf("Failed to delete old oauth accounts: %v\n", err)
+		e.logger.Error("Failed to delete old oauth accounts", "provider", provider, "user_id", authState.User.Id, "error", err)
 	}
 	_, err = e.userService.SaveUser(authState.User)
 	if err != nil {
-		fmt.Printf("Failed to save user: %v\n", err)
+		e.logger.Error("Failed to save user", "user_id", authState.User.Id, "error", err)
 	}
 	return authState, err
 }
@@ -253,14 +256,14 @@ func (e *OauthServiceImpl) VerifyDiscord(state string, code string, referrer *st
 	client := oauthConfig.Client(context.Background(), token)
 	response, err := client.Get("https://discord.com/api/users/@me")
 	if err != nil {
-		fmt.Printf("Failed to get discord user: %v\n", err)
+		e.logger.Error("Failed to get discord user", "error", err)
 		return nil, err
 	}
 	defer utils.Closer(response.Body)()
 	discordUser := &DiscordUserResponse{}
 	err = json.NewDecoder(response.Body).Decode(discordUser)
 	if err != nil {
-		fmt.Printf("Failed to decode discord user response: %v\n", err)
+		e.logger.Error("Failed to decode discord user response", "error", err)
 		return nil, fmt.Errorf("failed to decode discord user response: %v", err)
 	}
 	return e.addAccountToUser(authState, referrer, discordUser.Id, discordUser.Username, token, repository.ProviderDiscord)
@@ -319,7 +322,7 @@ func (e *OauthServiceImpl) VerifyPoE(state string, code string, referrer *string
 	}
 	resp, clientError := client.GetAccessToken(oauthConfig.ClientID, oauthConfig.ClientSecret, code, authState.Verifier, oauthConfig.Scopes, oauthConfig.RedirectURL)
 	if clientError != nil {
-		fmt.Printf("Failed to get access token: %v\n", clientError)
+		e.logger.Error("Failed to get PoE access token", "error", clientError)
 		return nil, fmt.Errorf("failed to get access token: %v", clientError)
 	}
 	token := &oauth2.Token{
@@ -330,7 +333,7 @@ func (e *OauthServiceImpl) VerifyPoE(state string, code string, referrer *string
 	}
 	profile, clientError := client.GetAccountProfile(token.AccessToken)
 	if clientError != nil {
-		fmt.Printf("Failed to get profile: %v\n", clientError)
+		e.logger.Error("Failed to get PoE profile", "error", clientError)
 		return nil, fmt.Errorf("failed to get profile: %v", clientError)
 	}
 	return e.addAccountToUser(&authState, referrer, profile.UUId, profile.Name, token, repository.ProviderPoE)
@@ -413,7 +416,7 @@ func (e *OauthServiceImpl) RefreshOnePoEToken() error {
 	}
 	_, err = e.oauthRepository.SaveOauth(oauth)
 	if err == nil {
-		fmt.Printf("Refreshed PoE token for user %s\n", oauth.Name)
+		e.logger.Info("Refreshed PoE token", "user_id", oauth.UserId, "account", oauth.Name)
 	}
 	return err
 }
@@ -428,7 +431,7 @@ func (e *OauthServiceImpl) RefreshPoETokensLoop(ctx context.Context, sleepDurati
 		case <-ticker.C:
 			err := e.RefreshOnePoEToken()
 			if err != nil {
-				fmt.Printf("Failed to refresh PoE token: %v\n", err)
+				e.logger.ErrorContext(ctx, "Failed to refresh PoE token", "error", err)
 			}
 		}
 	}
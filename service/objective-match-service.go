@@ -2,28 +2,82 @@ package service
 
 import (
 	"bpl/repository"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
 )
 
 type ObjectiveMatchService interface {
 	CreateItemMatches(matches map[int]int, userId *int, teamId int, stashChange *repository.StashChange) []*repository.ObjectiveMatch
-	SaveMatches(matches []*repository.ObjectiveMatch, desyncedObjectIds []int) error
+	SaveMatches(ctx context.Context, matches []*repository.ObjectiveMatch, desyncedObjectIds []int) error
 	GetKafkaConsumer(eventId int) (*repository.KafkaConsumer, error)
 	SaveKafkaConsumerId(consumer *repository.KafkaConsumer) error
 	GetValidationsByEventId(eventId int) ([]*repository.ObjectiveValidation, error)
+	SaveChangedMatches(matches []*repository.ObjectiveMatch, objectives []*repository.Objective) error
+	CompactMatches(eventId int) (int64, error)
 }
 
 type ObjectiveMatchServiceImpl struct {
 	objectiveMatchRepository repository.ObjectiveMatchRepository
 	stashchangeRepository    repository.StashChangeRepository
+	objectiveRepository      repository.ObjectiveRepository
+	latestMatches            *latestMatchCache
 }
 
 func NewObjectiveMatchService() ObjectiveMatchService {
 	return &ObjectiveMatchServiceImpl{
 		objectiveMatchRepository: repository.NewObjectiveMatchRepository(),
 		stashchangeRepository:    repository.NewStashChangeRepository(),
+		objectiveRepository:      repository.NewObjectiveRepository(),
+		latestMatches:            latestMatches,
 	}
 }
 
+// latestMatches is shared by the objective match services of the process, so that deleting the matches of an
+// objective through any of them makes the next matches of that objective persisted again
+var latestMatches = newLatestMatchCache()
+
+// latestMatchCache holds the last persisted number per objective and user or team, loaded lazily per objective
+type latestMatchCache struct {
+	mu                 sync.Mutex
+	numbers            map[MatchKey]int
+	loadedObjectiveIds map[int]bool
+}
+
+func newLatestMatchCache() *latestMatchCache {
+	return &latestMatchCache{numbers: make(map[MatchKey]int), loadedObjectiveIds: make(map[int]bool)}
+}
+
+// forget drops the numbers of the objectives, which are loaded again on their next matches
+func (c *latestMatchCache) forget(objectiveIds []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.numbers {
+		if slices.Contains(objectiveIds, key.ObjectiveId) {
+			delete(c.numbers, key)
+		}
+	}
+	for _, objectiveId := range objectiveIds {
+		delete(c.loadedObjectiveIds, objectiveId)
+	}
+}
+
+// MatchKey identifies the series of matches of an objective for a user, or for a team if the match has no user
+type MatchKey struct {
+	ObjectiveId int
+	UserId      int
+	TeamId      int
+}
+
+func matchKey(match *repository.ObjectiveMatch) MatchKey {
+	key := MatchKey{ObjectiveId: match.ObjectiveId, TeamId: match.TeamId}
+	if match.UserId != nil {
+		key.UserId = *match.UserId
+	}
+	return key
+}
+
 func (e *ObjectiveMatchServiceImpl) CreateItemMatches(matches map[int]int, userId *int, teamId int, stashChange *repository.StashChange) []*repository.ObjectiveMatch {
 	stashChange, err := e.stashchangeRepository.CreateStashChangeIfNotExists(stashChange)
 	if err != nil {
@@ -44,11 +98,12 @@ func (e *ObjectiveMatchServiceImpl) CreateItemMatches(matches map[int]int, userI
 	return objectiveMatches
 }
 
-func (e *ObjectiveMatchServiceImpl) SaveMatches(matches []*repository.ObjectiveMatch, desyncedObjectIds []int) error {
+func (e *ObjectiveMatchServiceImpl) SaveMatches(ctx context.Context, matches []*repository.ObjectiveMatch, desyncedObjectIds []int) error {
 	if len(desyncedObjectIds) > 0 {
-		return e.objectiveMatchRepository.OverwriteMatches(matches, desyncedObjectIds)
+		defer e.latestMatches.forget(desyncedObjectIds)
+		return e.objectiveMatchRepository.OverwriteMatches(ctx, matches, desyncedObjectIds)
 	}
-	return e.objectiveMatchRepository.SaveMatches(matches)
+	return e.objectiveMatchRepository.SaveMatches(ctx, matches)
 }
 
 func (e *ObjectiveMatchServiceImpl) GetKafkaConsumer(eventId int) (*repository.KafkaConsumer, error) {
@@ -62,3 +117,94 @@ func (e *ObjectiveMatchServiceImpl) SaveKafkaConsumerId(consumer *repository.Kaf
 func (e *ObjectiveMatchServiceImpl) GetValidationsByEventId(eventId int) ([]*repository.ObjectiveValidation, error) {
 	return e.objectiveMatchRepository.GetValidationsByEventId(eventId)
 }
+
+// SaveChangedMatches persists only the player and team matches whose number differs from the last one persisted for
+// the same objective and user or team. Objectives that are counted by their value change within a time window are
+// persisted on every call, since their aggregation compares the latest matches of all players at the window boundaries.
+func (e *ObjectiveMatchServiceImpl) SaveChangedMatches(matches []*repository.ObjectiveMatch, objectives []*repository.Objective) error {
+	windowed := make(map[int]bool)
+	for _, objective := range objectives {
+		if objective.CountingMethod == repository.CountingMethodValueChangeInWindow {
+			windowed[objective.Id] = true
+		}
+	}
+	cache := e.latestMatches
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	unloaded := make([]int, 0)
+	for _, match := range matches {
+		if !windowed[match.ObjectiveId] && !cache.loadedObjectiveIds[match.ObjectiveId] && !slices.Contains(unloaded, match.ObjectiveId) {
+			unloaded = append(unloaded, match.ObjectiveId)
+		}
+	}
+	if len(unloaded) > 0 {
+		latest, err := e.objectiveMatchRepository.GetLatestMatches(unloaded)
+		if err != nil {
+			return fmt.Errorf("failed to load latest matches: %w", err)
+		}
+		for _, match := range latest {
+			cache.numbers[matchKey(match)] = match.Number
+		}
+		for _, objectiveId := range unloaded {
+			cache.loadedObjectiveIds[objectiveId] = true
+		}
+	}
+	changed := ChangedMatches(cache.numbers, matches, windowed)
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := e.objectiveMatchRepository.SaveMatches(context.Background(), changed); err != nil {
+		return err
+	}
+	for _, match := range changed {
+		if !windowed[match.ObjectiveId] {
+			cache.numbers[matchKey(match)] = match.Number
+		}
+	}
+	return nil
+}
+
+// ChangedMatches returns the matches whose number differs from the latest known number of their objective and user or
+// team, taking earlier matches of the same batch into account. Matches of the unconditional objectives are always returned.
+func ChangedMatches(latestNumbers map[MatchKey]int, matches []*repository.ObjectiveMatch, unconditional map[int]bool) []*repository.ObjectiveMatch {
+	pending := make(map[MatchKey]int)
+	changed := make([]*repository.ObjectiveMatch, 0)
+	for _, match := range matches {
+		if unconditional[match.ObjectiveId] {
+			changed = append(changed, match)
+			continue
+		}
+		key := matchKey(match)
+		number, ok := pending[key]
+		if !ok {
+			number, ok = latestNumbers[key]
+		}
+		if ok && number == match.Number {
+			continue
+		}
+		pending[key] = match.Number
+		changed = append(changed, match)
+	}
+	return changed
+}
+
+// CompactMatches collapses repeated matches of the player and team objectives of an event. Objectives that are counted
+// by their value change within a time window are skipped, since their aggregation compares the latest matches of all
+// players of a team at the window boundaries.
+func (e *ObjectiveMatchServiceImpl) CompactMatches(eventId int) (int64, error) {
+	objectives, err := e.objectiveRepository.GetObjectivesByEventIdFlat(eventId)
+	if err != nil {
+		return 0, err
+	}
+	objectiveIds := make([]int, 0)
+	for _, objective := range objectives {
+		if (objective.ObjectiveType == repository.ObjectiveTypePlayer || objective.ObjectiveType == repository.ObjectiveTypeTeam) &&
+			objective.CountingMethod != repository.CountingMethodValueChangeInWindow {
+			objectiveIds = append(objectiveIds, objective.Id)
+		}
+	}
+	if len(objectiveIds) == 0 {
+		return 0, nil
+	}
+	return e.objectiveMatchRepository.CompactMatches(objectiveIds)
+}
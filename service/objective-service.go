@@ -4,6 +4,7 @@ import (
 	"bpl/parser"
 	"bpl/repository"
 	"bpl/utils"
+	"fmt"
 )
 
 type ObjectiveService interface {
@@ -22,16 +23,21 @@ type ObjectiveService interface {
 type ObjectiveServiceImpl struct {
 	objectiveRepository   repository.ObjectiveRepository
 	scoringRuleRepository repository.ScoringRuleRepository
+	pobStatRepository     repository.PoBStatRepository
 }
 
 func NewObjectiveService() ObjectiveService {
 	return &ObjectiveServiceImpl{
 		objectiveRepository:   repository.NewObjectiveRepository(),
 		scoringRuleRepository: repository.NewScoringRuleRepository(),
+		pobStatRepository:     repository.NewPoBStatRepository(),
 	}
 }
 
 func (e *ObjectiveServiceImpl) CreateObjective(objective *repository.Objective, ruleIds []int) (*repository.Objective, error) {
+	if err := e.validatePoBStatTrackedValue(objective); err != nil {
+		return nil, err
+	}
 	var err error
 	objective, err = e.objectiveRepository.SaveObjective(objective)
 	if err != nil {
@@ -44,6 +50,24 @@ func (e *ObjectiveServiceImpl) CreateObjective(objective *repository.Objective,
 	return objective, nil
 }
 
+// validatePoBStatTrackedValue rejects objectives that track a PoB stat the event has no mapping for
+func (e *ObjectiveServiceImpl) validatePoBStatTrackedValue(objective *repository.Objective) error {
+	statName, ok := objective.TrackedValue.PoBStatName()
+	if !ok {
+		return nil
+	}
+	mappings, err := e.pobStatRepository.GetMappingsForEvent(objective.EventId)
+	if err != nil {
+		return err
+	}
+	for _, mapping := range mappings {
+		if mapping.Name == statName {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown PoB stat mapping %q", statName)
+}
+
 func (e *ObjectiveServiceImpl) DeleteObjective(objectiveId int) error {
 	return e.objectiveRepository.DeleteObjective(objectiveId)
 }
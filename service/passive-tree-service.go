@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bpl/client"
+	"bpl/repository"
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+type PassiveTreeChange struct {
+	Timestamp  time.Time
+	Level      int
+	Ascendancy string
+	NodeCount  int
+	Allocated  []int
+	Removed    []int
+}
+
+type NodePopularity struct {
+	Node  int
+	Count int
+	Share float64
+}
+
+type AscendancyNodes struct {
+	Ascendancy string
+	Characters int
+	Nodes      []*NodePopularity
+}
+
+type PassiveTreeService interface {
+	SaveTree(eventId int, character *client.Character) error
+	GetTimeline(characterId string) ([]*PassiveTreeChange, error)
+	GetCommonNodes(eventId int, limit int) ([]*AscendancyNodes, error)
+}
+
+type PassiveTreeServiceImpl struct {
+	passiveTreeRepository repository.PassiveTreeRepository
+	mu                    sync.Mutex
+	// hash of the latest saved tree per character, per event
+	latestTrees map[int]map[string][32]byte
+}
+
+func NewPassiveTreeService() PassiveTreeService {
+	return &PassiveTreeServiceImpl{
+		passiveTreeRepository: repository.NewPassiveTreeRepository(),
+		latestTrees:           make(map[int]map[string][32]byte),
+	}
+}
+
+func (s *PassiveTreeServiceImpl) initCache(eventId int) error {
+	if s.latestTrees[eventId] != nil {
+		return nil
+	}
+	trees, err := s.passiveTreeRepository.GetLatestTreesForEvent(eventId)
+	if err != nil {
+		return err
+	}
+	s.latestTrees[eventId] = make(map[string][32]byte, len(trees))
+	for _, tree := range trees {
+		s.latestTrees[eventId][tree.CharacterId] = tree.Nodes.GetHash()
+	}
+	return nil
+}
+
+// SaveTree stores the allocated passives of the character unless they are unchanged since the last snapshot
+func (s *PassiveTreeServiceImpl) SaveTree(eventId int, character *client.Character) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.initCache(eventId); err != nil {
+		return err
+	}
+	nodes := slices.Clone(character.Passives.Hashes)
+	slices.Sort(nodes)
+	hash := repository.PassiveNodes(nodes).GetHash()
+	if previous, ok := s.latestTrees[eventId][character.Id]; ok && previous == hash {
+		return nil
+	}
+	err := s.passiveTreeRepository.SaveTree(&repository.PassiveTree{
+		CharacterId: character.Id,
+		EventId:     eventId,
+		Ascendancy:  character.Class,
+		Level:       character.Level,
+		Nodes:       repository.PassiveNodes(nodes),
+		Timestamp:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	s.latestTrees[eventId][character.Id] = hash
+	return nil
+}
+
+func (s *PassiveTreeServiceImpl) GetTimeline(characterId string) ([]*PassiveTreeChange, error) {
+	trees, err := s.passiveTreeRepository.GetTreesForCharacter(characterId)
+	if err != nil {
+		return nil, err
+	}
+	return PassiveTreeTimeline(trees), nil
+}
+
+func (s *PassiveTreeServiceImpl) GetCommonNodes(eventId int, limit int) ([]*AscendancyNodes, error) {
+	trees, err := s.passiveTreeRepository.GetLatestTreesForEvent(eventId)
+	if err != nil {
+		return nil, err
+	}
+	return CommonNodesPerAscendancy(trees, limit), nil
+}
+
+// PassiveTreeTimeline turns consecutive tree snapshots into the nodes allocated and removed at each snapshot.
+// Removed nodes indicate a respec.
+func PassiveTreeTimeline(trees []*repository.PassiveTree) []*PassiveTreeChange {
+	timeline := make([]*PassiveTreeChange, 0, len(trees))
+	previous := make(map[int]bool)
+	for _, tree := range trees {
+		current := make(map[int]bool, len(tree.Nodes))
+		change := &PassiveTreeChange{
+			Timestamp:  tree.Timestamp,
+			Level:      tree.Level,
+			Ascendancy: tree.Ascendancy,
+			NodeCount:  len(tree.Nodes),
+			Allocated:  []int{},
+			Removed:    []int{},
+		}
+		for _, node := range tree.Nodes {
+			current[node] = true
+			if !previous[node] {
+				change.Allocated = append(change.Allocated, node)
+			}
+		}
+		for node := range previous {
+			if !current[node] {
+				change.Removed = append(change.Removed, node)
+			}
+		}
+		slices.Sort(change.Allocated)
+		slices.Sort(change.Removed)
+		timeline = append(timeline, change)
+		previous = current
+	}
+	return timeline
+}
+
+// CommonNodesPerAscendancy returns the most allocated nodes of each ascendancy, ordered by ascendancy popularity
+func CommonNodesPerAscendancy(trees []*repository.PassiveTree, limit int) []*AscendancyNodes {
+	characters := make(map[string]int)
+	nodeCounts := make(map[string]map[int]int)
+	for _, tree := range trees {
+		characters[tree.Ascendancy]++
+		if nodeCounts[tree.Ascendancy] == nil {
+			nodeCounts[tree.Ascendancy] = make(map[int]int)
+		}
+		for _, node := range tree.Nodes {
+			nodeCounts[tree.Ascendancy][node]++
+		}
+	}
+	result := make([]*AscendancyNodes, 0, len(characters))
+	for ascendancy, count := range characters {
+		nodes := make([]*NodePopularity, 0, len(nodeCounts[ascendancy]))
+		for node, nodeCount := range nodeCounts[ascendancy] {
+			nodes = append(nodes, &NodePopularity{Node: node, Count: nodeCount, Share: float64(nodeCount) / float64(count)})
+		}
+		slices.SortFunc(nodes, func(a, b *NodePopularity) int {
+			if a.Count != b.Count {
+				return b.Count - a.Count
+			}
+			return a.Node - b.Node
+		})
+		if limit > 0 && len(nodes) > limit {
+			nodes = nodes[:limit]
+		}
+		result = append(result, &AscendancyNodes{Ascendancy: ascendancy, Characters: count, Nodes: nodes})
+	}
+	slices.SortFunc(result, func(a, b *AscendancyNodes) int {
+		if a.Characters != b.Characters {
+			return b.Characters - a.Characters
+		}
+		return cmp.Compare(a.Ascendancy, b.Ascendancy)
+	})
+	return result
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"bpl/config"
+	"bpl/repository"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type HealthStatus string
+
+const (
+	HealthStatusOk       HealthStatus = "ok"
+	HealthStatusDegraded HealthStatus = "degraded"
+	HealthStatusFailing  HealthStatus = "failing"
+)
+
+var healthStatusOrder = []HealthStatus{HealthStatusOk, HealthStatusDegraded, HealthStatusFailing}
+
+// WorstHealthStatus returns the most severe of the given statuses
+func WorstHealthStatus(statuses ...HealthStatus) HealthStatus {
+	worst := HealthStatusOk
+	for _, status := range statuses {
+		if slices.Index(healthStatusOrder, status) > slices.Index(healthStatusOrder, worst) {
+			worst = status
+		}
+	}
+	return worst
+}
+
+// HealthStatusForAge is degraded once the age exceeds the first and failing once it exceeds the second threshold
+func HealthStatusForAge(age time.Duration, degradedAfter time.Duration, failingAfter time.Duration) HealthStatus {
+	switch {
+	case age > failingAfter:
+		return HealthStatusFailing
+	case age > degradedAfter:
+		return HealthStatusDegraded
+	default:
+		return HealthStatusOk
+	}
+}
+
+// IsGuildStashOverdue returns true if the tab has missed a whole fetch interval
+func IsGuildStashOverdue(tab *repository.GuildStashTab, timings map[repository.TimingKey]time.Duration, now time.Time) bool {
+	if !tab.FetchEnabled {
+		return false
+	}
+	interval := timings[repository.GuildstashUpdateInterval]
+	if tab.PriorityFetch {
+		interval = timings[repository.GuildstashPriorityFetchInterval]
+	}
+	return now.Sub(tab.LastFetch) > 2*interval
+}
+
+const (
+	// how long the health report is reused, so that frequent checks do not hit poe.ninja and kafka every time
+	pipelineHealthCacheDuration = 15 * time.Second
+	// tokens expiring within this window should already be picked up by the token refresh
+	tokenExpiryWarning       = 24 * time.Hour
+	stashChangeDegradedAfter = 5 * time.Minute
+	stashChangeFailingAfter  = 30 * time.Minute
+	consumerLagDegradedAbove = 100
+	consumerLagFailingAbove  = 1000
+	pobQueueDegradedAfter    = 10 * time.Minute
+	pobQueueFailingAfter     = time.Hour
+)
+
+type PublicStashHealth struct {
+	Status        HealthStatus `json:"status" binding:"required"`
+	ChangeId      string       `json:"change_id" binding:"required"`
+	NinjaChangeId string       `json:"ninja_change_id" binding:"required"`
+	// how far the change id of the event is behind the one of poe.ninja
+	ChangeIdLag  int        `json:"change_id_lag" binding:"required"`
+	LastChangeAt *time.Time `json:"last_change_at"`
+	Error        *string    `json:"error"`
+}
+
+type KafkaConsumerHealth struct {
+	Status  HealthStatus `json:"status" binding:"required"`
+	GroupId int          `json:"group_id" binding:"required"`
+	Lag     int64        `json:"lag" binding:"required"`
+	Error   *string      `json:"error"`
+}
+
+type ObjectiveMatchHealth struct {
+	ObjectiveType repository.ObjectiveType `json:"objective_type" binding:"required"`
+	LastMatchAt   time.Time                `json:"last_match_at" binding:"required"`
+	SecondsSince  int64                    `json:"seconds_since" binding:"required"`
+}
+
+type GuildStashHealth struct {
+	Status       HealthStatus `json:"status" binding:"required"`
+	ActiveTabs   int          `json:"active_tabs" binding:"required"`
+	OverdueTabs  []string     `json:"overdue_tabs" binding:"required"`
+	OldestFetch  *time.Time   `json:"oldest_fetch"`
+	IntervalSecs int64        `json:"interval_seconds" binding:"required"`
+}
+
+type OauthTokenHealth struct {
+	Status       HealthStatus `json:"status" binding:"required"`
+	Tokens       int          `json:"tokens" binding:"required"`
+	Expired      int          `json:"expired" binding:"required"`
+	ExpiringSoon int          `json:"expiring_soon" binding:"required"`
+}
+
+type EventPipelineHealth struct {
+	EventId          int                     `json:"event_id" binding:"required"`
+	EventName        string                  `json:"event_name" binding:"required"`
+	Status           HealthStatus            `json:"status" binding:"required"`
+	PublicStashes    *PublicStashHealth      `json:"public_stashes" binding:"required"`
+	KafkaConsumer    *KafkaConsumerHealth    `json:"kafka_consumer" binding:"required"`
+	ObjectiveMatches []*ObjectiveMatchHealth `json:"objective_matches" binding:"required"`
+	GuildStashes     *GuildStashHealth       `json:"guild_stashes" binding:"required"`
+	OauthTokens      *OauthTokenHealth       `json:"oauth_tokens" binding:"required"`
+}
+
+type PoBQueueHealth struct {
+	Status          HealthStatus `json:"status" binding:"required"`
+	Pending         int          `json:"pending" binding:"required"`
+	Dead            int          `json:"dead" binding:"required"`
+	OldestPendingAt *time.Time   `json:"oldest_pending_at"`
+	Error           *string      `json:"error"`
+}
+
+type PipelineHealth struct {
+	// whether the database of this instance is reachable
+	Ready     bool                   `json:"ready" binding:"required"`
+	Status    HealthStatus           `json:"status" binding:"required"`
+	CheckedAt time.Time              `json:"checked_at" binding:"required"`
+	Events    []*EventPipelineHealth `json:"events" binding:"required"`
+	PoBQueue  *PoBQueueHealth        `json:"pob_queue" binding:"required"`
+	Errors    []string               `json:"errors" binding:"required"`
+}
+
+type PipelineHealthService interface {
+	CheckReadiness(ctx context.Context) error
+	GetPipelineHealth(ctx context.Context) *PipelineHealth
+}
+
+type PipelineHealthServiceImpl struct {
+	eventService             EventService
+	stashChangeService       StashChangeService
+	objectiveMatchService    ObjectiveMatchService
+	pobQueueService          PoBQueueService
+	timingService            TimingService
+	objectiveMatchRepository repository.ObjectiveMatchRepository
+	guildStashRepository     repository.GuildStashRepository
+	userRepository           repository.UserRepository
+	mu                       sync.Mutex
+	cached                   *PipelineHealth
+}
+
+func NewPipelineHealthService() PipelineHealthService {
+	return &PipelineHealthServiceImpl{
+		eventService:             NewEventService(),
+		stashChangeService:       NewStashChangeService(),
+		objectiveMatchService:    NewObjectiveMatchService(),
+		pobQueueService:          NewPoBQueueService(),
+		timingService:            NewTimingService(),
+		objectiveMatchRepository: repository.NewObjectiveMatchRepository(),
+		guildStashRepository:     repository.NewGuildStashRepository(),
+		userRepository:           repository.NewUserRepository(),
+	}
+}
+
+// CheckReadiness returns an error if this instance cannot serve requests. It only depends on the database,
+// a lagging pipeline does not stop the instance from serving requests.
+func (s *PipelineHealthServiceImpl) CheckReadiness(ctx context.Context) error {
+	return pingDatabase(ctx)
+}
+
+// GetPipelineHealth checks every stage of the data pipeline of the running events. The report is computed without
+// holding the lock, so a slow poe.ninja or kafka does not block other callers that can use the cached report.
+func (s *PipelineHealthServiceImpl) GetPipelineHealth(ctx context.Context) *PipelineHealth {
+	now := time.Now()
+	s.mu.Lock()
+	cached := s.cached
+	s.mu.Unlock()
+	if cached != nil && now.Sub(cached.CheckedAt) < pipelineHealthCacheDuration {
+		return cached
+	}
+	health := s.computePipelineHealth(ctx, now)
+	s.mu.Lock()
+	if s.cached == nil || s.cached.CheckedAt.Before(health.CheckedAt) {
+		s.cached = health
+	}
+	s.mu.Unlock()
+	return health
+}
+
+func (s *PipelineHealthServiceImpl) computePipelineHealth(ctx context.Context, now time.Time) *PipelineHealth {
+	health := &PipelineHealth{
+		Ready:     true,
+		CheckedAt: now,
+		Events:    make([]*EventPipelineHealth, 0),
+		Errors:    make([]string, 0),
+	}
+	if err := pingDatabase(ctx); err != nil {
+		health.Ready = false
+		health.Status = HealthStatusFailing
+		health.Errors = append(health.Errors, "database: "+err.Error())
+		return health
+	}
+
+	health.PoBQueue = s.getPoBQueueHealth(now)
+	statuses := []HealthStatus{health.PoBQueue.Status}
+	events, err := s.eventService.GetAllEvents()
+	if err != nil {
+		health.Errors = append(health.Errors, "events: "+err.Error())
+		statuses = append(statuses, HealthStatusFailing)
+	}
+	live := make([]*repository.Event, 0)
+	for _, event := range events {
+		if event.Phase == repository.EventPhaseRunning || event.Phase == repository.EventPhaseGracePeriod {
+			live = append(live, event)
+		}
+	}
+	if len(live) > 0 {
+		ninjaChangeId, ninjaErr := GetNinjaChangeId()
+		timings, err := s.timingService.GetTimings()
+		if err != nil {
+			health.Errors = append(health.Errors, "timings: "+err.Error())
+		}
+		for _, event := range live {
+			eventHealth := &EventPipelineHealth{
+				EventId:          event.Id,
+				EventName:        event.Name,
+				PublicStashes:    s.getPublicStashHealth(event, ninjaChangeId, ninjaErr, now),
+				KafkaConsumer:    s.getKafkaConsumerHealth(ctx, event),
+				ObjectiveMatches: s.getObjectiveMatchHealth(event, now),
+				GuildStashes:     s.getGuildStashHealth(event, timings, now),
+				OauthTokens:      s.getOauthTokenHealth(event, now),
+			}
+			eventHealth.Status = WorstHealthStatus(
+				eventHealth.PublicStashes.Status,
+				eventHealth.KafkaConsumer.Status,
+				eventHealth.GuildStashes.Status,
+				eventHealth.OauthTokens.Status,
+			)
+			statuses = append(statuses, eventHealth.Status)
+			health.Events = append(health.Events, eventHealth)
+		}
+	}
+	health.Status = WorstHealthStatus(statuses...)
+	return health
+}
+
+func pingDatabase(ctx context.Context) error {
+	db, err := config.DatabaseConnection().DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+func errorMessage(err error) *string {
+	message := err.Error()
+	return &message
+}
+
+func (s *PipelineHealthServiceImpl) getPublicStashHealth(event *repository.Event, ninjaChangeId string, ninjaErr error, now time.Time) *PublicStashHealth {
+	health := &PublicStashHealth{Status: HealthStatusOk, NinjaChangeId: ninjaChangeId}
+	changeId, err := s.stashChangeService.GetCurrentChangeIdForEvent(event)
+	if err != nil {
+		health.Status = HealthStatusFailing
+		health.Error = errorMessage(err)
+		return health
+	}
+	health.ChangeId = changeId.NextChangeId
+	health.LastChangeAt = &changeId.Timestamp
+	health.Status = HealthStatusForAge(now.Sub(changeId.Timestamp), stashChangeDegradedAfter, stashChangeFailingAfter)
+	if ninjaErr != nil {
+		health.Error = errorMessage(ninjaErr)
+		return health
+	}
+	health.ChangeIdLag = ChangeIdToInt(ninjaChangeId) - ChangeIdToInt(changeId.NextChangeId)
+	return health
+}
+
+func (s *PipelineHealthServiceImpl) getKafkaConsumerHealth(ctx context.Context, event *repository.Event) *KafkaConsumerHealth {
+	health := &KafkaConsumerHealth{Status: HealthStatusOk}
+	consumer, err := s.objectiveMatchService.GetKafkaConsumer(event.Id)
+	if err != nil {
+		health.Status = HealthStatusFailing
+		health.Error = errorMessage(err)
+		return health
+	}
+	health.GroupId = consumer.GroupId
+	lag, err := config.GetConsumerLag(ctx, event.Id, consumer.GroupId)
+	if err != nil {
+		health.Status = HealthStatusFailing
+		health.Error = errorMessage(err)
+		return health
+	}
+	health.Lag = lag
+	switch {
+	case lag > consumerLagFailingAbove:
+		health.Status = HealthStatusFailing
+	case lag > consumerLagDegradedAbove:
+		health.Status = HealthStatusDegraded
+	}
+	return health
+}
+
+// getObjectiveMatchHealth only reports the age of the latest matches, some objective types legitimately match rarely
+func (s *PipelineHealthServiceImpl) getObjectiveMatchHealth(event *repository.Event, now time.Time) []*ObjectiveMatchHealth {
+	health := make([]*ObjectiveMatchHealth, 0)
+	timestamps, err := s.objectiveMatchRepository.GetLatestMatchTimestamps(event.Id)
+	if err != nil {
+		return health
+	}
+	for objectiveType, timestamp := range timestamps {
+		health = append(health, &ObjectiveMatchHealth{
+			ObjectiveType: objectiveType,
+			LastMatchAt:   timestamp,
+			SecondsSince:  int64(now.Sub(timestamp).Seconds()),
+		})
+	}
+	slices.SortFunc(health, func(a, b *ObjectiveMatchHealth) int {
+		return int(a.SecondsSince - b.SecondsSince)
+	})
+	return health
+}
+
+func (s *PipelineHealthServiceImpl) getGuildStashHealth(event *repository.Event, timings map[repository.TimingKey]time.Duration, now time.Time) *GuildStashHealth {
+	health := &GuildStashHealth{
+		Status:       HealthStatusOk,
+		OverdueTabs:  make([]string, 0),
+		IntervalSecs: int64(timings[repository.GuildstashUpdateInterval].Seconds()),
+	}
+	tabs, err := s.guildStashRepository.GetActiveByEvent(event.Id)
+	if err != nil {
+		health.Status = HealthStatusFailing
+		return health
+	}
+	health.ActiveTabs = len(tabs)
+	for _, tab := range tabs {
+		if health.OldestFetch == nil || tab.LastFetch.Before(*health.OldestFetch) {
+			health.OldestFetch = &tab.LastFetch
+		}
+		if IsGuildStashOverdue(tab, timings, now) {
+			health.OverdueTabs = append(health.OverdueTabs, tab.Id)
+		}
+	}
+	if len(health.OverdueTabs) > 0 {
+		health.Status = HealthStatusDegraded
+	}
+	return health
+}
+
+func (s *PipelineHealthServiceImpl) getOauthTokenHealth(event *repository.Event, now time.Time) *OauthTokenHealth {
+	health := &OauthTokenHealth{Status: HealthStatusOk}
+	users, err := s.userRepository.GetUsersForEvent(event.Id)
+	if err != nil {
+		health.Status = HealthStatusFailing
+		return health
+	}
+	for _, user := range users {
+		if user.Token == "" {
+			continue
+		}
+		health.Tokens++
+		switch {
+		case user.TokenExpiry.Before(now):
+			health.Expired++
+		case user.TokenExpiry.Before(now.Add(tokenExpiryWarning)):
+			health.ExpiringSoon++
+		}
+	}
+	if health.Expired > 0 {
+		health.Status = HealthStatusDegraded
+	}
+	return health
+}
+
+func (s *PipelineHealthServiceImpl) getPoBQueueHealth(now time.Time) *PoBQueueHealth {
+	health := &PoBQueueHealth{Status: HealthStatusOk}
+	counts, err := s.pobQueueService.CountJobsByStatus()
+	if err != nil {
+		health.Status = HealthStatusFailing
+		health.Error = errorMessage(err)
+		return health
+	}
+	health.Pending = counts[repository.PoBJobStatusPending]
+	health.Dead = counts[repository.PoBJobStatusDead]
+	oldest, err := s.pobQueueService.GetOldestPendingJob()
+	if err != nil {
+		health.Status = HealthStatusFailing
+		health.Error = errorMessage(err)
+		return health
+	}
+	if oldest != nil {
+		health.OldestPendingAt = &oldest.CreatedAt
+		health.Status = HealthStatusForAge(now.Sub(oldest.CreatedAt), pobQueueDegradedAfter, pobQueueFailingAfter)
+	}
+	return health
+}
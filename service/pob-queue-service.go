@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bpl/client"
+	"bpl/repository"
+	"time"
+)
+
+const (
+	MaxPoBJobAttempts = 8
+	pobJobBaseBackoff = 30 * time.Second
+	pobJobMaxBackoff  = 1 * time.Hour
+	// longer than the pob client timeout, so that only jobs of crashed workers are considered stale
+	pobJobStaleAfter = 5 * time.Minute
+)
+
+type PoBQueueService interface {
+	Enqueue(eventId int, userId *int, character *client.Character) error
+	ClaimJobs(limit int) ([]*repository.PoBJob, error)
+	CompleteJob(job *repository.PoBJob) error
+	FailJob(job *repository.PoBJob, jobErr error) error
+	GetJobs(status *repository.PoBJobStatus) ([]*repository.PoBJob, error)
+	RequeueJobs(characterIds []string) (int64, error)
+	CountJobsByStatus() (map[repository.PoBJobStatus]int, error)
+	GetOldestPendingJob() (*repository.PoBJob, error)
+}
+
+type PoBQueueServiceImpl struct {
+	pobJobRepository repository.PoBJobRepository
+}
+
+func NewPoBQueueService() PoBQueueService {
+	return &PoBQueueServiceImpl{
+		pobJobRepository: repository.NewPoBJobRepository(),
+	}
+}
+
+func (s *PoBQueueServiceImpl) Enqueue(eventId int, userId *int, character *client.Character) error {
+	return s.pobJobRepository.Enqueue(&repository.PoBJob{
+		CharacterId: character.Id,
+		EventId:     eventId,
+		UserId:      userId,
+		Character:   repository.CharacterData(*character),
+	})
+}
+
+func (s *PoBQueueServiceImpl) ClaimJobs(limit int) ([]*repository.PoBJob, error) {
+	if limit <= 0 {
+		return []*repository.PoBJob{}, nil
+	}
+	return s.pobJobRepository.ClaimJobs(limit, pobJobStaleAfter)
+}
+
+func (s *PoBQueueServiceImpl) CompleteJob(job *repository.PoBJob) error {
+	return s.pobJobRepository.CompleteJob(job)
+}
+
+// FailJob schedules the job for another attempt with exponential backoff, or moves it to the dead letter state
+// once it has used up all attempts
+func (s *PoBQueueServiceImpl) FailJob(job *repository.PoBJob, jobErr error) error {
+	applyPoBJobFailure(job, jobErr, time.Now())
+	return s.pobJobRepository.FailJob(job)
+}
+
+func (s *PoBQueueServiceImpl) GetJobs(status *repository.PoBJobStatus) ([]*repository.PoBJob, error) {
+	return s.pobJobRepository.GetJobs(status)
+}
+
+func (s *PoBQueueServiceImpl) RequeueJobs(characterIds []string) (int64, error) {
+	return s.pobJobRepository.RequeueJobs(characterIds)
+}
+
+func (s *PoBQueueServiceImpl) CountJobsByStatus() (map[repository.PoBJobStatus]int, error) {
+	return s.pobJobRepository.CountJobsByStatus()
+}
+
+func (s *PoBQueueServiceImpl) GetOldestPendingJob() (*repository.PoBJob, error) {
+	return s.pobJobRepository.GetOldestPendingJob()
+}
+
+func applyPoBJobFailure(job *repository.PoBJob, jobErr error, now time.Time) {
+	job.Attempts++
+	job.LastError = jobErr.Error()
+	if job.Attempts >= MaxPoBJobAttempts {
+		job.Status = repository.PoBJobStatusDead
+		job.NextAttemptAt = now
+		return
+	}
+	job.Status = repository.PoBJobStatusPending
+	job.NextAttemptAt = now.Add(PoBJobBackoff(job.Attempts))
+}
+
+// PoBJobBackoff returns the delay before the next attempt of a job that failed the given number of times
+func PoBJobBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	backoff := pobJobBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= pobJobMaxBackoff {
+			return pobJobMaxBackoff
+		}
+	}
+	return backoff
+}
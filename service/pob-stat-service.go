@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bpl/config"
+	"bpl/repository"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+var ErrPoBStatMappingInUse = errors.New("PoB stat mapping is tracked by objectives")
+
+type PoBStatService interface {
+	GetMappingsForEvent(eventId int) ([]*repository.PoBStatMapping, error)
+	SaveMapping(mapping *repository.PoBStatMapping) (*repository.PoBStatMapping, error)
+	DeleteMapping(eventId int, id int) error
+	RecalculateLatestStats(eventId int) (int, error)
+}
+
+type PoBStatServiceImpl struct {
+	pobStatRepository   repository.PoBStatRepository
+	characterRepository repository.CharacterRepository
+	objectiveRepository repository.ObjectiveRepository
+	logger              *slog.Logger
+}
+
+func NewPoBStatService() PoBStatService {
+	return &PoBStatServiceImpl{
+		pobStatRepository:   repository.NewPoBStatRepository(),
+		characterRepository: repository.NewCharacterRepository(),
+		objectiveRepository: repository.NewObjectiveRepository(),
+		logger:              config.Logger("service"),
+	}
+}
+
+func (s *PoBStatServiceImpl) GetMappingsForEvent(eventId int) ([]*repository.PoBStatMapping, error) {
+	return s.pobStatRepository.GetMappingsForEvent(eventId)
+}
+
+func (s *PoBStatServiceImpl) SaveMapping(mapping *repository.PoBStatMapping) (*repository.PoBStatMapping, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	if mapping.Id != 0 {
+		existing, err := s.getMappingOfEvent(mapping.EventId, mapping.Id)
+		if err != nil {
+			return nil, err
+		}
+		// objectives refer to the mapping by its name, so renaming it would leave them without a value
+		if existing.Name != mapping.Name {
+			if err := s.checkMappingUnused(existing); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.pobStatRepository.SaveMapping(mapping)
+}
+
+func (s *PoBStatServiceImpl) DeleteMapping(eventId int, id int) error {
+	existing, err := s.getMappingOfEvent(eventId, id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkMappingUnused(existing); err != nil {
+		return err
+	}
+	return s.pobStatRepository.DeleteMapping(eventId, id)
+}
+
+// getMappingOfEvent returns gorm.ErrRecordNotFound unless the mapping exists and belongs to the event
+func (s *PoBStatServiceImpl) getMappingOfEvent(eventId int, id int) (*repository.PoBStatMapping, error) {
+	existing, err := s.pobStatRepository.GetMappingById(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.EventId != eventId {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return existing, nil
+}
+
+// checkMappingUnused returns ErrPoBStatMappingInUse if an objective of the event tracks the mapping
+func (s *PoBStatServiceImpl) checkMappingUnused(mapping *repository.PoBStatMapping) error {
+	objectives, err := s.objectiveRepository.GetObjectivesByEventIdFlat(mapping.EventId)
+	if err != nil {
+		return err
+	}
+	for _, objective := range objectives {
+		if objective.TrackedValue == repository.PoBStatTrackedValue(mapping.Name) {
+			return fmt.Errorf("%w: %s", ErrPoBStatMappingInUse, objective.Name)
+		}
+	}
+	return nil
+}
+
+// RecalculateLatestStats fills the custom stats of the latest PoB of every character in the event,
+// so that newly added mappings apply without waiting for the characters to change their gear
+func (s *PoBStatServiceImpl) RecalculateLatestStats(eventId int) (int, error) {
+	mappings, err := s.pobStatRepository.GetMappingsForEvent(eventId)
+	if err != nil {
+		return 0, err
+	}
+	pobs, err := s.characterRepository.GetLatestPoBsForEvent(eventId)
+	if err != nil {
+		return 0, err
+	}
+	updated := make([]*repository.CharacterPob, 0, len(pobs))
+	for _, pob := range pobs {
+		decoded, err := pob.Export.Decode()
+		if err != nil {
+			s.logger.Warn("Failed to decode PoB", "pob_id", pob.Id, "character_id", pob.CharacterId, "event_id", eventId, "error", err)
+			continue
+		}
+		pob.UpdateCustomStats(decoded, mappings)
+		updated = append(updated, pob)
+	}
+	if len(updated) == 0 {
+		return 0, nil
+	}
+	return len(updated), s.characterRepository.SavePoBs(updated)
+}
@@ -6,12 +6,16 @@ import (
 	"bpl/repository"
 	"bpl/scoring"
 	"bpl/utils"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"slices"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -64,6 +68,17 @@ func (s ScoreMap) setDiff(score *scoring.Score, diff *ScoreDifference) {
 	s[score.TeamId][score.ObjectiveId] = diff
 }
 
+// Scores returns the scores of all teams and objectives in the map
+func (s ScoreMap) Scores() []*scoring.Score {
+	scores := make([]*scoring.Score, 0)
+	for _, teamScore := range s {
+		for _, scoreDiff := range teamScore {
+			scores = append(scores, scoreDiff.Score)
+		}
+	}
+	return scores
+}
+
 func (s ScoreMap) GetSimpleScore() map[int]int {
 	scores := make(map[int]int)
 	for _, teamScore := range s {
@@ -91,20 +106,24 @@ type ScoreDifference struct {
 
 type ScoreService interface {
 	GetNewDiff(eventId int) (ScoreMap, error)
+	GetCachedDiff(eventId int) (ScoreMap, error)
 	GetCurrentScore(eventId int) (ScoreMap, error)
 	IsCalculating(eventId int) bool
 	GetPlayerAttributionsFromGuildstash(event *repository.Event, objectiveTree *repository.Objective) (AttributionOverwrites, error)
 	GetLatestScores(eventId int) ScoreMap
+	SaveFinalScore(eventId int) (ScoreMap, error)
+	GetObjectiveGaps(eventId int, teamId int) ([]*ObjectiveGap, error)
 }
 
 type ScoreServiceImpl struct {
-	LatestScores      map[int]ScoreMap
-	eventService      EventService
-	objectiveService  ObjectiveService
-	guildStashService GuildStashService
-	cachedDataService CachedDataService
-	userService       UserService
-	db                *gorm.DB
+	LatestScores          map[int]ScoreMap
+	eventService          EventService
+	objectiveService      ObjectiveService
+	guildStashService     GuildStashService
+	cachedDataService     CachedDataService
+	userService           UserService
+	teamSuggestionService TeamSuggestionService
+	db                    *gorm.DB
 	// Mutex to protect concurrent access to calculation state
 	calculationMutex sync.Mutex
 	calculating      map[int]chan ScoreMap // Track which events are currently being calculated with result channels
@@ -114,14 +133,15 @@ func NewScoreService(PoEClient *client.PoEClient) ScoreService {
 	eventService := NewEventService()
 	objectiveService := NewObjectiveService()
 	return &ScoreServiceImpl{
-		db:                config.DatabaseConnection(),
-		eventService:      eventService,
-		objectiveService:  objectiveService,
-		guildStashService: NewGuildStashService(PoEClient),
-		cachedDataService: NewCachedDataService(),
-		userService:       NewUserService(),
-		LatestScores:      make(map[int]ScoreMap),
-		calculating:       make(map[int]chan ScoreMap),
+		db:                    config.DatabaseConnection(),
+		eventService:          eventService,
+		objectiveService:      objectiveService,
+		guildStashService:     NewGuildStashService(PoEClient),
+		cachedDataService:     NewCachedDataService(),
+		userService:           NewUserService(),
+		teamSuggestionService: NewTeamSuggestionService(),
+		LatestScores:          make(map[int]ScoreMap),
+		calculating:           make(map[int]chan ScoreMap),
 	}
 }
 
@@ -192,6 +212,9 @@ func (s *ScoreServiceImpl) GetNewDiff(eventId int) (ScoreMap, error) {
 		return result, nil
 	}
 
+	ctx, span := config.Tracer().Start(context.Background(), "GetNewDiff", trace.WithAttributes(attribute.Int("event.id", eventId)))
+	defer span.End()
+
 	// Create a channel to communicate the result to other waiting goroutines
 	resultChan := make(chan ScoreMap, 1)
 	defer close(resultChan)
@@ -205,7 +228,7 @@ func (s *ScoreServiceImpl) GetNewDiff(eventId int) (ScoreMap, error) {
 		s.calculationMutex.Unlock()
 	}()
 
-	newScores, err := s.calcScores(eventId)
+	newScores, err := s.calcScores(ctx, eventId)
 	if err != nil {
 		// Send empty result to notify waiting goroutines of the error
 		return nil, err
@@ -214,6 +237,7 @@ func (s *ScoreServiceImpl) GetNewDiff(eventId int) (ScoreMap, error) {
 	oldScore := s.LatestScores[eventId]
 	newScoreMap, diff := Diff(oldScore, newScores)
 	s.LatestScores[eventId] = newScoreMap
+	span.SetAttributes(attribute.Int("score.changes", len(diff)))
 
 	if len(diff) == 0 {
 		// Send empty result to notify waiting goroutines
@@ -235,7 +259,28 @@ func (s *ScoreServiceImpl) GetNewDiff(eventId int) (ScoreMap, error) {
 	return diff, nil
 }
 
-func (s *ScoreServiceImpl) calcScores(eventId int) (score []*scoring.Score, err error) {
+// GetCachedDiff is the counterpart of GetNewDiff for instances that do not calculate the scores themselves.
+// It compares the latest scores that were cached by the calculating instance with the ones seen before.
+func (s *ScoreServiceImpl) GetCachedDiff(eventId int) (ScoreMap, error) {
+	cached, err := s.cachedDataService.GetLatestScore(eventId)
+	if err != nil {
+		return nil, err
+	}
+	cachedScore := make(ScoreMap)
+	if err := json.Unmarshal(cached, &cachedScore); err != nil {
+		return nil, err
+	}
+	newScoreMap, diff := Diff(s.LatestScores[eventId], cachedScore.Scores())
+	s.LatestScores[eventId] = newScoreMap
+	if len(diff) == 0 {
+		return nil, fmt.Errorf("no changes in scores")
+	}
+	return diff, nil
+}
+
+func (s *ScoreServiceImpl) calcScores(ctx context.Context, eventId int) (score []*scoring.Score, err error) {
+	ctx, span := config.Tracer().Start(ctx, "CalculateScores", trace.WithAttributes(attribute.Int("event.id", eventId)))
+	defer func() { config.EndSpan(span, err) }()
 	event, err := s.eventService.GetEventById(eventId, "Teams", "Teams.Users")
 	if err != nil {
 		return nil, err
@@ -244,26 +289,10 @@ func (s *ScoreServiceImpl) calcScores(eventId int) (score []*scoring.Score, err
 	if err != nil {
 		return nil, err
 	}
-	matches := scoring.AggregateMatches(s.db, event, rootObjective.FlatMap())
-	teamScores := make(map[int]map[int]*scoring.Score)
-	for _, team := range event.Teams {
-		teamScores[team.Id] = make(map[int]*scoring.Score)
-		for _, obj := range rootObjective.FlatMap() {
-			presetCompletions := make(map[int]*scoring.PresetCompletion)
-			for _, preset := range obj.ScoringRules {
-				presetCompletions[preset.Id] = &scoring.PresetCompletion{
-					ObjectiveId: obj.Id,
-				}
-			}
-			teamScores[team.Id][obj.Id] = &scoring.Score{
-				ObjectiveId:       obj.Id,
-				TeamId:            team.Id,
-				HideProgress:      obj.HideProgress,
-				PresetCompletions: presetCompletions,
-			}
-		}
-	}
-	err = scoring.EvaluateAggregations(rootObjective, matches, teamScores)
+	matches := scoring.AggregateMatches(s.db.WithContext(ctx), event, rootObjective.FlatMap())
+	_, evaluationSpan := config.Tracer().Start(ctx, "EvaluateScores")
+	teamScores, err := scoring.EvaluateScores(rootObjective, event.TeamIds(), matches)
+	config.EndSpan(evaluationSpan, err)
 	if err != nil {
 		return nil, err
 	}
@@ -288,10 +317,40 @@ func (s *ScoreServiceImpl) calcScores(eventId int) (score []*scoring.Score, err
 	return scores, nil
 }
 
+// SaveFinalScore calculates the scores of an event that has become final and keeps them as its final snapshot
+func (s *ScoreServiceImpl) SaveFinalScore(eventId int) (ScoreMap, error) {
+	scores, err := s.calcScores(context.Background(), eventId)
+	if err != nil {
+		return nil, err
+	}
+	scoreMap, _ := Diff(nil, scores)
+	byteData, err := json.Marshal(scoreMap)
+	if err != nil {
+		return nil, err
+	}
+	err = s.cachedDataService.SaveFinalScore(eventId, byteData)
+	if err != nil {
+		return nil, err
+	}
+	err = s.cachedDataService.SaveScore(eventId, byteData)
+	if err != nil {
+		return nil, err
+	}
+	s.LatestScores[eventId] = scoreMap
+	return scoreMap, nil
+}
+
 func (s *ScoreServiceImpl) GetCurrentScore(eventId int) (ScoreMap, error) {
 	if s.LatestScores[eventId] != nil {
 		return s.LatestScores[eventId], nil
 	}
+	if final, err := s.cachedDataService.GetFinalScore(eventId); err == nil {
+		score := make(ScoreMap)
+		if err := json.Unmarshal(final, &score); err == nil {
+			s.LatestScores[eventId] = score
+			return score, nil
+		}
+	}
 	cached, err := s.cachedDataService.GetLatestScore(eventId)
 	if err == nil {
 		score := make(ScoreMap)
@@ -359,3 +418,65 @@ func (s *ScoreServiceImpl) GetPlayerAttributionsFromGuildstash(event *repository
 	}
 	return overwrites, nil
 }
+
+var ErrTeamNotInEvent = errors.New("team does not belong to the event")
+
+type ObjectiveGap struct {
+	*scoring.ObjectiveGap
+	Suggested       bool
+	SuggestionExtra string
+}
+
+// GetObjectiveGaps returns how far the team is from finishing each objective of the event and the points it would gain
+// from progressing on it, ordered so that the most valuable objectives come first
+func (s *ScoreServiceImpl) GetObjectiveGaps(eventId int, teamId int) ([]*ObjectiveGap, error) {
+	event, err := s.eventService.GetEventById(eventId, "Teams")
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(event.TeamIds(), teamId) {
+		return nil, fmt.Errorf("%w: team %d, event %d", ErrTeamNotInEvent, teamId, eventId)
+	}
+	rootObjective, err := s.objectiveService.GetObjectiveTreeForEvent(event.Id, "ScoringRules")
+	if err != nil {
+		return nil, err
+	}
+	matches := scoring.AggregateMatches(s.db, event, rootObjective.FlatMap())
+	scoringGaps, err := scoring.CalculateGaps(rootObjective, event.TeamIds(), matches, teamId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	suggestions, err := s.teamSuggestionService.GetSuggestionsForTeam(teamId)
+	if err != nil {
+		return nil, err
+	}
+	return toObjectiveGaps(scoringGaps, suggestions), nil
+}
+
+func toObjectiveGaps(scoringGaps []*scoring.ObjectiveGap, suggestions []*repository.TeamSuggestion) []*ObjectiveGap {
+	suggestionMap := make(map[int]*repository.TeamSuggestion)
+	for _, suggestion := range suggestions {
+		suggestionMap[suggestion.Id] = suggestion
+	}
+	gaps := utils.Map(scoringGaps, func(gap *scoring.ObjectiveGap) *ObjectiveGap {
+		objectiveGap := &ObjectiveGap{ObjectiveGap: gap}
+		if suggestion, ok := suggestionMap[gap.ObjectiveId]; ok {
+			objectiveGap.Suggested = true
+			objectiveGap.SuggestionExtra = suggestion.Extra
+		}
+		return objectiveGap
+	})
+	slices.SortStableFunc(gaps, func(a, b *ObjectiveGap) int {
+		if a.MarginalPoints() != b.MarginalPoints() {
+			return b.MarginalPoints() - a.MarginalPoints()
+		}
+		if a.Suggested != b.Suggested {
+			if a.Suggested {
+				return -1
+			}
+			return 1
+		}
+		return a.ObjectiveId - b.ObjectiveId
+	})
+	return gaps
+}
@@ -1,11 +1,18 @@
 package service
 
 import (
+	"bpl/auth"
+	"bpl/client"
 	"bpl/repository"
 	"bpl/scoring"
+	"bpl/utils"
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
@@ -287,6 +294,119 @@ func (m *mockOauthRepo) SaveOauth(oauth *repository.Oauth) (*repository.Oauth, e
 	return args.Get(0).(*repository.Oauth), args.Error(1)
 }
 
+// mockTokenRepo implements repository.TokenRepository
+type mockTokenRepo struct{ mock.Mock }
+
+func (m *mockTokenRepo) SaveRefreshToken(token *repository.RefreshToken) error {
+	return m.Called(token).Error(0)
+}
+func (m *mockTokenRepo) GetRefreshToken(tokenHash string) (*repository.RefreshToken, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.RefreshToken), args.Error(1)
+}
+func (m *mockTokenRepo) RotateRefreshToken(token *repository.RefreshToken, successor *repository.RefreshToken) error {
+	return m.Called(token, successor).Error(0)
+}
+func (m *mockTokenRepo) RevokeSession(familyId string) error {
+	return m.Called(familyId).Error(0)
+}
+func (m *mockTokenRepo) RevokeSessions(userId int) error {
+	return m.Called(userId).Error(0)
+}
+func (m *mockTokenRepo) RevokeAccessTokens(userId int) error {
+	return m.Called(userId).Error(0)
+}
+func (m *mockTokenRepo) RevokeToken(token *repository.RevokedToken) error {
+	return m.Called(token).Error(0)
+}
+func (m *mockTokenRepo) IsTokenRevoked(tokenId string) (bool, error) {
+	args := m.Called(tokenId)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockTokenRepo) DeleteExpiredTokens(now time.Time) (int64, error) {
+	args := m.Called(now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// mockEventRoleRepo implements repository.EventRoleRepository
+type mockEventRoleRepo struct{ mock.Mock }
+
+func (m *mockEventRoleRepo) GetEventRoleById(roleId int) (*repository.EventRole, error) {
+	args := m.Called(roleId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.EventRole), args.Error(1)
+}
+func (m *mockEventRoleRepo) GetEventRolesForEvent(eventId int, preloads ...string) ([]*repository.EventRole, error) {
+	args := m.Called(eventId, preloads)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*repository.EventRole), args.Error(1)
+}
+func (m *mockEventRoleRepo) GetEventRolesForUser(userId int, eventId int) ([]*repository.EventRole, error) {
+	args := m.Called(userId, eventId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*repository.EventRole), args.Error(1)
+}
+func (m *mockEventRoleRepo) GetEventIdsForUser(userId int) ([]int, error) {
+	args := m.Called(userId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int), args.Error(1)
+}
+func (m *mockEventRoleRepo) FindEventRole(role *repository.EventRole) (*repository.EventRole, error) {
+	args := m.Called(role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.EventRole), args.Error(1)
+}
+func (m *mockEventRoleRepo) SaveEventRole(role *repository.EventRole) (*repository.EventRole, error) {
+	args := m.Called(role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.EventRole), args.Error(1)
+}
+func (m *mockEventRoleRepo) DeleteEventRole(roleId int) error {
+	return m.Called(roleId).Error(0)
+}
+
+type mockPoBStatRepo struct{ mock.Mock }
+
+func (m *mockPoBStatRepo) GetMappingsForEvent(eventId int) ([]*repository.PoBStatMapping, error) {
+	args := m.Called(eventId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*repository.PoBStatMapping), args.Error(1)
+}
+func (m *mockPoBStatRepo) GetMappingById(id int) (*repository.PoBStatMapping, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PoBStatMapping), args.Error(1)
+}
+func (m *mockPoBStatRepo) SaveMapping(mapping *repository.PoBStatMapping) (*repository.PoBStatMapping, error) {
+	args := m.Called(mapping)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PoBStatMapping), args.Error(1)
+}
+func (m *mockPoBStatRepo) DeleteMapping(eventId int, id int) error {
+	return m.Called(eventId, id).Error(0)
+}
+
 // ==================== Pure Function Tests: Activity ====================
 
 func TestDetermineActiveTime_SingleActivity(t *testing.T) {
@@ -346,6 +466,667 @@ func TestChangeIdToInt_Invalid(t *testing.T) {
 	assert.Equal(t, 0, ChangeIdToInt(""))
 }
 
+// ==================== Pure Function Tests: Guild Stash Diff ====================
+
+func TestDiffGuildStashItems(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	previous := []client.Item{
+		{Id: "a", TypeLine: "Divine Orb", StackSize: intPtr(5), X: intPtr(0), Y: intPtr(0)},
+		{Id: "b", TypeLine: "Hubris Circlet", X: intPtr(1), Y: intPtr(0)},
+		{Id: "c", Name: "Headhunter", TypeLine: "Leather Belt", X: intPtr(2), Y: intPtr(0)},
+	}
+	current := []client.Item{
+		{Id: "a", TypeLine: "Divine Orb", StackSize: intPtr(3), X: intPtr(0), Y: intPtr(0)},
+		{Id: "c", Name: "Headhunter", TypeLine: "Leather Belt", X: intPtr(2), Y: intPtr(0)},
+		{Id: "d", Name: "Mageblood", TypeLine: "Heavy Belt", X: intPtr(3), Y: intPtr(0)},
+	}
+
+	logs := DiffGuildStashItems(previous, current)
+	require.Len(t, logs, 3)
+
+	assert.Equal(t, repository.ActionModified, logs[0].Action)
+	assert.Equal(t, "Divine Orb", logs[0].ItemName)
+	assert.Equal(t, -2, logs[0].Number)
+
+	assert.Equal(t, repository.ActionAdded, logs[1].Action)
+	assert.Equal(t, "Mageblood Heavy Belt", logs[1].ItemName)
+	assert.Equal(t, 1, logs[1].Number)
+	assert.Equal(t, 3, logs[1].X)
+
+	assert.Equal(t, repository.ActionRemoved, logs[2].Action)
+	assert.Equal(t, "Hubris Circlet", logs[2].ItemName)
+	assert.Equal(t, 1, logs[2].Number)
+
+	for _, log := range logs {
+		assert.True(t, log.Derived)
+	}
+}
+
+func TestDiffGuildStashItems_Unchanged(t *testing.T) {
+	items := []client.Item{{Id: "a", TypeLine: "Chaos Orb"}}
+	assert.Empty(t, DiffGuildStashItems(items, items))
+}
+
+func TestSearchGuildStashTabs(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	tabs := []*repository.GuildStashTab{
+		{Id: "second", Name: "Uniques", Index: intPtr(1), Raw: `{"id":"second","items":[{"id":"u1","name":"Hubris","typeLine":"Hubris Circlet","baseType":"Hubris Circlet","ilvl":86,"x":4,"y":2}]}`},
+		{Id: "empty", Name: "Unfetched", Index: intPtr(2), Raw: "{}"},
+		{Id: "first", Name: "Currency", Index: intPtr(0), Raw: `{"id":"first","items":[{"id":"c1","typeLine":"Divine Orb","baseType":"Divine Orb","stackSize":7,"ilvl":0,"x":1,"y":0},{"id":"c2","typeLine":"Divine Orb","baseType":"Divine Orb","stackSize":3,"ilvl":0,"x":2,"y":0},{"id":"c3","typeLine":"Chaos Orb","baseType":"Chaos Orb","stackSize":20,"ilvl":0,"x":3,"y":0}]}`},
+	}
+
+	hits, err := searchGuildStashTabs(tabs, func(item *client.Item) bool { return item.BaseType != "Chaos Orb" })
+	require.NoError(t, err)
+	require.Len(t, hits, 3)
+	assert.Equal(t, "Currency", hits[0].TabName, "tabs should be ordered by index")
+	assert.Equal(t, "c1", hits[0].Item.Id)
+	assert.Equal(t, "Uniques", hits[2].TabName)
+
+	counts := countBaseTypes(hits)
+	require.Len(t, counts, 2)
+	assert.Equal(t, &BaseTypeCount{BaseType: "Divine Orb", ItemCount: 2, StackSize: 10}, counts[0])
+	assert.Equal(t, &BaseTypeCount{BaseType: "Hubris Circlet", ItemCount: 1, StackSize: 1}, counts[1])
+}
+
+func TestPaginateGuildStashHits(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	hits := []*GuildStashSearchHit{{TabName: "a"}, {TabName: "b"}, {TabName: "c"}}
+
+	assert.Len(t, paginate(hits, nil, nil), 3)
+	assert.Equal(t, []*GuildStashSearchHit{hits[1]}, paginate(hits, intPtr(1), intPtr(1)))
+	assert.Empty(t, paginate(hits, intPtr(2), intPtr(5)), "an offset past the end should return no hits")
+	assert.Equal(t, hits[:2], paginate(hits, intPtr(2), intPtr(-3)), "a negative offset should start at the first hit")
+	assert.Empty(t, paginate(hits, intPtr(-1), nil), "a negative limit should not panic")
+}
+
+// ==================== Pure Function Tests: Item Wish Matching ====================
+
+func TestMatchItemWishes(t *testing.T) {
+	wishes := []*repository.ItemWish{
+		{Id: 1, Conditions: repository.Conditions{
+			{Field: repository.BASE_TYPE, Operator: repository.EQ, Value: "Hubris Circlet"},
+			{Field: repository.ILVL, Operator: repository.GT, Value: "85"},
+		}},
+		{Id: 2, Conditions: repository.Conditions{{Field: repository.NAME, Operator: repository.EQ, Value: "Mageblood"}}},
+		{Id: 3},
+	}
+	items := []client.Item{
+		{Id: "low", BaseType: "Hubris Circlet", Ilvl: 84},
+		{Id: "high", BaseType: "Hubris Circlet", Ilvl: 86},
+		{Id: "belt", Name: "Headhunter", BaseType: "Leather Belt", Ilvl: 86},
+	}
+
+	matches, err := MatchItemWishes(wishes, items)
+	require.NoError(t, err)
+	require.Len(t, matches, 1, "wishes without conditions must not match everything")
+	assert.Equal(t, 1, matches[0].Wish.Id)
+	assert.Equal(t, "high", matches[0].Item.Id)
+}
+
+func TestItemWishCacheLoadsEventOnceUntilInvalidated(t *testing.T) {
+	loads := 0
+	load := func(eventId int) ([]*repository.ItemWish, error) {
+		loads++
+		return []*repository.ItemWish{
+			{Id: 1, TeamID: 10, Conditions: repository.Conditions{{Field: repository.NAME, Operator: repository.EQ, Value: "Mageblood"}}},
+			{Id: 2, TeamID: 20, Conditions: repository.Conditions{{Field: repository.NAME, Operator: repository.EQ, Value: "Headhunter"}}},
+		}, nil
+	}
+	cache := newItemWishCache(time.Hour)
+
+	wishes, err := cache.get(1, 10, load)
+	require.NoError(t, err)
+	require.Len(t, wishes, 1)
+	assert.Equal(t, 1, wishes[0].wish.Id)
+	wishes, err = cache.get(1, 20, load)
+	require.NoError(t, err)
+	require.Len(t, wishes, 1)
+	assert.Equal(t, 2, wishes[0].wish.Id)
+	assert.Equal(t, 1, loads, "the wishes of all teams should be loaded with a single query")
+
+	matches := matchCompiledItemWishes(wishes, []client.Item{{Id: "a", Name: "Headhunter"}, {Id: "b", Name: "Mageblood"}})
+	require.Len(t, matches, 1)
+	assert.Equal(t, "a", matches[0].Item.Id)
+
+	cache.invalidate()
+	_, err = cache.get(1, 10, load)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loads, "an invalidated cache should be reloaded")
+
+	expired := newItemWishCache(0)
+	_, err = expired.get(1, 10, load)
+	require.NoError(t, err)
+	_, err = expired.get(1, 10, load)
+	require.NoError(t, err)
+	assert.Equal(t, 4, loads, "expired wishes should be reloaded")
+}
+
+// similarItemWishRepo groups the saved wishes of a team by their conditions
+type similarItemWishRepo struct {
+	repository.ItemWishRepository
+	wishes []*repository.ItemWish
+}
+
+func (r *similarItemWishRepo) GetSimilarItemWishesInTeam(teamId int, conditions repository.Conditions) ([]*repository.ItemWish, error) {
+	return utils.Filter(r.wishes, func(iw *repository.ItemWish) bool {
+		return iw.TeamID == teamId && reflect.DeepEqual(iw.Conditions, conditions)
+	}), nil
+}
+
+func (r *similarItemWishRepo) SaveItemWish(itemWish *repository.ItemWish) (*repository.ItemWish, error) {
+	return itemWish, nil
+}
+
+func TestUpdateItemWishRanksChangedConditionsAmongTheirWishes(t *testing.T) {
+	mageblood := repository.Conditions{{Field: repository.NAME, Operator: repository.EQ, Value: "Mageblood"}}
+	headhunter := repository.Conditions{{Field: repository.NAME, Operator: repository.EQ, Value: "Headhunter"}}
+	wish := &repository.ItemWish{Id: 1, TeamID: 10, ItemField: repository.NAME, Value: "Mageblood", Conditions: mageblood}
+	other := &repository.ItemWish{Id: 2, TeamID: 10, Conditions: headhunter, Priority: 0}
+	repo := &similarItemWishRepo{wishes: []*repository.ItemWish{
+		wish,
+		{Id: 3, TeamID: 10, Conditions: mageblood, Priority: 1},
+		other,
+		{Id: 4, TeamID: 20, Conditions: headhunter, Priority: 0},
+	}}
+	s := &ItemWishServiceImpl{itemWishRepository: repo, openItemWishes: newItemWishCache(time.Hour)}
+
+	updated, err := s.UpdateItemWish(wish, 10, nil, nil, nil, headhunter)
+	require.NoError(t, err)
+	assert.Equal(t, headhunter, updated.Conditions)
+	assert.Empty(t, updated.ItemField, "the item field no longer describes the wish")
+	assert.Equal(t, 1, updated.Priority, "the wish should be ranked behind the team's other wish with the same conditions")
+
+	priority := 0
+	updated, err = s.UpdateItemWish(wish, 10, nil, nil, &priority, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, updated.Priority)
+	assert.Equal(t, 1, other.Priority, "the wish should swap priorities with the wish of the same conditions")
+}
+
+func TestItemWishNotification(t *testing.T) {
+	x, y := 3, 4
+	stashName := "Dump"
+	message := itemWishNotification([]*repository.ItemWishCandidate{
+		{ItemId: "a", StashId: "s1", StashName: &stashName, AccountName: "player#1234", X: &x, Y: &y},
+		{ItemId: "b", StashId: "s2"},
+	}, map[string]string{"a": "Hubris Circlet", "b": "Mageblood Heavy Belt"})
+	assert.Contains(t, message, "- Hubris Circlet in Dump of player#1234 (x: 3, y: 4)")
+	assert.Contains(t, message, "- Mageblood Heavy Belt in s2")
+}
+
+// ==================== Pure Function Tests: Ladder History ====================
+
+func TestDiffLadderSnapshots(t *testing.T) {
+	now := time.Now()
+	latest := []*repository.LadderSnapshot{
+		{Character: "unchanged", Level: 90, Experience: 1000, Rank: 1},
+		{Character: "leveled", Level: 80, Experience: 500, Rank: 2},
+	}
+	ladder := []*repository.LadderEntry{
+		{Character: "unchanged", Level: 90, Experience: 1000, Rank: 1, EventId: 1},
+		{Character: "leveled", Level: 81, Experience: 700, Rank: 2, EventId: 1},
+		{Character: "new", Level: 2, Experience: 10, Rank: 3, EventId: 1},
+	}
+
+	snapshots := DiffLadderSnapshots(latest, ladder, now)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, "leveled", snapshots[0].Character)
+	assert.Equal(t, 81, snapshots[0].Level)
+	assert.Equal(t, "new", snapshots[1].Character)
+	assert.Equal(t, now, snapshots[1].Timestamp)
+}
+
+func TestFastestPerTeam(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	userId := func(i int) *int { return &i }
+	reached := []*repository.LevelReached{
+		{Character: "slow", UserId: userId(1), Timestamp: start.Add(3 * time.Hour)},
+		{Character: "fast", UserId: userId(2), Timestamp: start.Add(1 * time.Hour)},
+		{Character: "other", UserId: userId(3), Timestamp: start.Add(2 * time.Hour)},
+		{Character: "unknown", UserId: nil, Timestamp: start},
+		{Character: "teamless", UserId: userId(4), Timestamp: start},
+	}
+	userTeams := map[int]int{1: 10, 2: 10, 3: 20}
+
+	entries := fastestPerTeam(reached, userTeams)
+	require.Len(t, entries, 2)
+	assert.Equal(t, &LevelRaceEntry{TeamId: 10, UserId: 2, Character: "fast", Timestamp: start.Add(1 * time.Hour)}, entries[0])
+	assert.Equal(t, 20, entries[1].TeamId)
+}
+
+// ==================== Pure Function Tests: PoB Queue ====================
+
+func TestPoBJobBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), PoBJobBackoff(0))
+	assert.Equal(t, 30*time.Second, PoBJobBackoff(1))
+	assert.Equal(t, 60*time.Second, PoBJobBackoff(2))
+	assert.Equal(t, 4*time.Minute, PoBJobBackoff(4))
+	assert.Equal(t, time.Hour, PoBJobBackoff(20))
+}
+
+func TestApplyPoBJobFailure(t *testing.T) {
+	now := time.Now()
+	job := &repository.PoBJob{Status: repository.PoBJobStatusRunning}
+	applyPoBJobFailure(job, errors.New("timeout"), now)
+	assert.Equal(t, repository.PoBJobStatusPending, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "timeout", job.LastError)
+	assert.Equal(t, now.Add(30*time.Second), job.NextAttemptAt)
+
+	job.Attempts = MaxPoBJobAttempts - 1
+	applyPoBJobFailure(job, errors.New("timeout"), now)
+	assert.Equal(t, repository.PoBJobStatusDead, job.Status, "jobs should be dead lettered after the last attempt")
+}
+
+// ==================== Pure Function Tests: PoB Diff ====================
+
+func TestDiffPoBs(t *testing.T) {
+	from := &client.PathOfBuilding{
+		Items: []client.PoBItem{
+			{Id: 1, Rarity: "RARE", Name: "Doom Visor", BaseType: "Hubris Circlet"},
+			{Id: 2, Rarity: "UNIQUE", Name: "Tabula Rasa", BaseType: "Simple Robe"},
+		},
+		ItemSets: []client.PoBItemSet{{Id: 1, Slots: []client.PoBSlot{{Name: "Helmet", ItemId: 1}, {Name: "Body Armour", ItemId: 2}}}},
+		Skills: client.Skills{SkillSets: []client.SkillSet{{Skills: []client.Skill{
+			{Gems: []client.Gem{{NameSpec: "Cyclone", Level: "18"}, {NameSpec: "Melee Physical Damage", Level: "20"}}},
+		}}}},
+		Tree:  client.Tree{Spec: client.Spec{Nodes: "1,2,3"}},
+		Build: client.Build{PlayerStats: client.PlayerStats{FullDPS: 100000, FireResist: 60}},
+	}
+	to := &client.PathOfBuilding{
+		Items: []client.PoBItem{
+			{Id: 1, Rarity: "RARE", Name: "Doom Visor", BaseType: "Hubris Circlet"},
+			{Id: 2, Rarity: "RARE", Name: "Storm Shell", BaseType: "Vaal Regalia"},
+			{Id: 3, Rarity: "UNIQUE", Name: "Ryslatha's Coil", BaseType: "Studded Belt"},
+		},
+		ItemSets: []client.PoBItemSet{{Id: 1, Slots: []client.PoBSlot{{Name: "Helmet", ItemId: 1}, {Name: "Body Armour", ItemId: 2}, {Name: "Belt", ItemId: 3}}}},
+		Skills: client.Skills{SkillSets: []client.SkillSet{{Skills: []client.Skill{
+			{Gems: []client.Gem{{NameSpec: "Cyclone", Level: "20"}, {NameSpec: "Brutality", Level: "1"}}},
+		}}}},
+		Tree:  client.Tree{Spec: client.Spec{Nodes: "2,3,4"}},
+		Build: client.Build{PlayerStats: client.PlayerStats{FullDPS: 250000, FireResist: 75}},
+	}
+
+	diff := DiffPoBs(from, to)
+
+	require.Len(t, diff.Items, 2)
+	assert.Equal(t, "Belt", diff.Items[0].Slot)
+	assert.Nil(t, diff.Items[0].From)
+	assert.Equal(t, "Ryslatha's Coil", diff.Items[0].To.Name)
+	assert.Equal(t, "Body Armour", diff.Items[1].Slot)
+	assert.Equal(t, "Tabula Rasa", diff.Items[1].From.Name)
+	assert.Equal(t, "Storm Shell", diff.Items[1].To.Name)
+
+	require.Len(t, diff.GemsAdded, 1)
+	assert.Equal(t, "Brutality", diff.GemsAdded[0].Name)
+	require.Len(t, diff.GemsRemoved, 1)
+	assert.Equal(t, "Melee Physical Damage", diff.GemsRemoved[0].Name)
+	require.Len(t, diff.GemsLevelled, 1)
+	assert.Equal(t, 18, *diff.GemsLevelled[0].FromLevel)
+	assert.Equal(t, 20, *diff.GemsLevelled[0].ToLevel)
+
+	assert.Equal(t, []int{4}, diff.PassivesAllocated)
+	assert.Equal(t, []int{1}, diff.PassivesRemoved)
+
+	stats := make(map[string]*PoBStatDelta)
+	for _, delta := range diff.Stats {
+		stats[delta.Stat] = delta
+	}
+	assert.Equal(t, 150000.0, stats["FullDPS"].Delta)
+	assert.Equal(t, 15.0, stats["FireResist"].Delta)
+	assert.Equal(t, 0.0, stats["ChaosResist"].Delta)
+}
+
+// ==================== Pure Function Tests: Build Meta ====================
+
+func TestAggregateBuildMeta(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pobs := []*repository.CharacterPob{
+		{CharacterId: "a", Level: 20, Ascendancy: "Witch", MainSkill: "Freezing Pulse", DPS: 1000, EHP: 500, CreatedAt: start.Add(time.Hour)},
+		{CharacterId: "b", Level: 30, Ascendancy: "Slayer", MainSkill: "Cyclone", DPS: 3000, EHP: 900, CreatedAt: start.Add(2 * time.Hour)},
+		{CharacterId: "a", Level: 80, Ascendancy: "Necromancer", MainSkill: "Raise Spectre", DPS: 9000, EHP: 4000, CreatedAt: start.Add(26 * time.Hour)},
+		{CharacterId: "c", Level: 85, Ascendancy: "Elementalist", MainSkill: "Raise Spectre", DPS: 5000, EHP: 3000, CreatedAt: start.Add(30 * time.Hour)},
+	}
+
+	meta := AggregateBuildMeta(pobs, BuildMetaFilter{}, []time.Time{start.Add(24 * time.Hour), start.Add(48 * time.Hour)})
+
+	assert.Equal(t, 3, meta.Characters)
+	require.Len(t, meta.Classes, 2)
+	assert.Equal(t, "Witch", meta.Classes[0].Name)
+	assert.Equal(t, 2, meta.Classes[0].Count)
+	assert.Equal(t, int64(7000), meta.Classes[0].MedianDPS)
+	assert.Equal(t, int64(9000), meta.Classes[0].TopDPS)
+	assert.Equal(t, int32(4000), meta.Classes[0].TopEHP)
+	require.Len(t, meta.MainSkills, 2)
+	assert.Equal(t, "Raise Spectre", meta.MainSkills[0].Name)
+	assert.InDelta(t, 2.0/3.0, meta.MainSkills[0].Share, 0.0001)
+
+	require.Len(t, meta.Evolution, 2)
+	assert.Equal(t, 2, meta.Evolution[0].Characters)
+	assert.Equal(t, map[string]int{"Witch": 1, "Slayer": 1}, meta.Evolution[0].Ascendancies)
+	assert.Equal(t, int64(2000), meta.Evolution[0].MedianDPS)
+	assert.Equal(t, 3, meta.Evolution[1].Characters)
+	assert.Equal(t, 2, meta.Evolution[1].MainSkills["Raise Spectre"])
+
+	bracket := AggregateBuildMeta(pobs, BuildMetaFilter{MinLevel: 80, MaxLevel: 84}, []time.Time{start.Add(24 * time.Hour)})
+	assert.Equal(t, 1, bracket.Characters)
+	assert.Equal(t, "Necromancer", bracket.Ascendancies[0].Name)
+	assert.Equal(t, 0, bracket.Evolution[0].Characters, "character a was below the bracket after the first day")
+}
+
+type pobHistoryRepo struct {
+	repository.CharacterRepository
+	loads int
+}
+
+func (r *pobHistoryRepo) GetPoBHistoryForEvent(eventId int) ([]*repository.CharacterPob, error) {
+	r.loads++
+	return []*repository.CharacterPob{{CharacterId: "a", Level: 90, Ascendancy: "Witch"}}, nil
+}
+
+func TestGetBuildMeta_ReusesPoBHistory(t *testing.T) {
+	repo := &pobHistoryRepo{}
+	svc := &BuildMetaServiceImpl{characterRepository: repo, pobHistories: make(map[int]*pobHistory)}
+	event := &repository.Event{Id: 1, EventStartTime: time.Now().Add(-time.Hour), EventEndTime: time.Now().Add(time.Hour)}
+
+	for range 3 {
+		meta, err := svc.GetBuildMeta(event, BuildMetaFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, meta.Characters)
+	}
+	assert.Equal(t, 1, repo.loads, "the history should only be queried once per cache period")
+
+	svc.pobHistories[1].loadedAt = time.Now().Add(-pobHistoryCacheTtl)
+	_, err := svc.GetBuildMeta(event, BuildMetaFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, repo.loads, "an expired history should be reloaded")
+}
+
+func TestBuildMetaSnapshotTimes(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Len(t, buildMetaSnapshotTimes(start, start.Add(72*time.Hour), 24*time.Hour), 3)
+	assert.Len(t, buildMetaSnapshotTimes(start, start.Add(3*time.Hour), time.Minute), 3, "interval is clamped to an hour")
+}
+
+// ==================== Pure Function Tests: Passive Trees ====================
+
+func TestPassiveTreeTimeline(t *testing.T) {
+	start := time.Now()
+	trees := []*repository.PassiveTree{
+		{Level: 10, Nodes: repository.PassiveNodes{1, 2}, Timestamp: start},
+		{Level: 20, Nodes: repository.PassiveNodes{1, 2, 3, 4}, Timestamp: start.Add(time.Hour)},
+		{Level: 30, Nodes: repository.PassiveNodes{1, 4, 5}, Timestamp: start.Add(2 * time.Hour)},
+	}
+	timeline := PassiveTreeTimeline(trees)
+	require.Len(t, timeline, 3)
+	assert.Equal(t, []int{1, 2}, timeline[0].Allocated)
+	assert.Equal(t, []int{3, 4}, timeline[1].Allocated)
+	assert.Empty(t, timeline[1].Removed)
+	assert.Equal(t, []int{5}, timeline[2].Allocated)
+	assert.Equal(t, []int{2, 3}, timeline[2].Removed)
+	assert.Equal(t, 3, timeline[2].NodeCount)
+}
+
+func TestCommonNodesPerAscendancy(t *testing.T) {
+	trees := []*repository.PassiveTree{
+		{Ascendancy: "Slayer", Nodes: repository.PassiveNodes{1, 2, 3}},
+		{Ascendancy: "Slayer", Nodes: repository.PassiveNodes{1, 3}},
+		{Ascendancy: "Elementalist", Nodes: repository.PassiveNodes{7}},
+	}
+	common := CommonNodesPerAscendancy(trees, 2)
+	require.Len(t, common, 2)
+	assert.Equal(t, "Slayer", common[0].Ascendancy)
+	assert.Equal(t, 2, common[0].Characters)
+	require.Len(t, common[0].Nodes, 2)
+	assert.Equal(t, 1, common[0].Nodes[0].Node)
+	assert.Equal(t, 3, common[0].Nodes[1].Node)
+	assert.Equal(t, 1.0, common[0].Nodes[1].Share)
+	assert.Equal(t, "Elementalist", common[1].Ascendancy)
+}
+
+// ==================== Pure Function Tests: Leveling ====================
+
+func TestActiveTimeUntil(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sessions := []ActivitySession{
+		{Start: start, End: start.Add(time.Hour)},
+		{Start: start.Add(3 * time.Hour), End: start.Add(5 * time.Hour)},
+	}
+	assert.Equal(t, 30*time.Minute, activeTimeUntil(sessions, start.Add(30*time.Minute)))
+	assert.Equal(t, time.Hour, activeTimeUntil(sessions, start.Add(2*time.Hour)))
+	assert.Equal(t, 2*time.Hour, activeTimeUntil(sessions, start.Add(4*time.Hour)))
+	assert.Equal(t, 3*time.Hour, activeTimeUntil(sessions, start.Add(10*time.Hour)))
+}
+
+func TestCalculateCharacterLeveling(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sessions := []ActivitySession{
+		{Start: start, End: start.Add(2 * time.Hour)},
+		{Start: start.Add(10 * time.Hour), End: start.Add(12 * time.Hour)},
+	}
+	samples := []*XPSample{
+		{Timestamp: start.Add(11 * time.Hour), Level: 86, XP: 3000},
+		{Timestamp: start.Add(time.Hour), Level: 50, XP: 1000},
+		{Timestamp: start.Add(2 * time.Hour), Level: 72, XP: 2000},
+	}
+	leveling := CalculateCharacterLeveling(samples, sessions, start)
+	assert.Equal(t, 86, leveling.Level)
+	assert.Equal(t, int64(3000), leveling.XP)
+	assert.Equal(t, 3*time.Hour, leveling.ActiveTime)
+	assert.Equal(t, 1000.0, leveling.XPPerActiveHour)
+	require.Len(t, leveling.Milestones, 2)
+	assert.Equal(t, 70, leveling.Milestones[0].Level)
+	assert.Equal(t, 2*time.Hour, leveling.Milestones[0].ActiveTime)
+	assert.Equal(t, 85, leveling.Milestones[1].Level)
+	assert.Equal(t, 11*time.Hour, leveling.Milestones[1].WallClock)
+	assert.Equal(t, 3*time.Hour, leveling.Milestones[1].ActiveTime)
+}
+
+func TestAggregateTeamLeveling(t *testing.T) {
+	teamId := 1
+	characters := []*CharacterLeveling{
+		{TeamId: &teamId, XPPerActiveHour: 100, Milestones: []*LevelMilestone{{Level: 70, ActiveTime: 4 * time.Hour, WallClock: 6 * time.Hour}}},
+		{TeamId: &teamId, XPPerActiveHour: 300, Milestones: []*LevelMilestone{{Level: 70, ActiveTime: 2 * time.Hour, WallClock: 8 * time.Hour}}},
+		{TeamId: nil, XPPerActiveHour: 1000},
+	}
+	teams := AggregateTeamLeveling(characters)
+	require.Len(t, teams, 1)
+	assert.Equal(t, 2, teams[0].Characters)
+	assert.Equal(t, 200.0, teams[0].MedianXPPerActiveHour)
+	assert.Equal(t, 70, teams[0].Milestones[0].Level)
+	assert.Equal(t, 2, teams[0].Milestones[0].Reached)
+	assert.Equal(t, 2*time.Hour, teams[0].Milestones[0].FastestActive)
+	assert.Equal(t, 3*time.Hour, teams[0].Milestones[0].MedianActive)
+	assert.Equal(t, 6*time.Hour, teams[0].Milestones[0].FastestWallClock)
+	assert.Equal(t, 0, teams[0].Milestones[1].Reached)
+}
+
+// ==================== Pure Function Tests: Deaths ====================
+
+func TestCountDeathsPerTeam(t *testing.T) {
+	deaths := []*repository.CharacterDeath{
+		{CharacterId: "a", TeamId: 2},
+		{CharacterId: "b", TeamId: 2},
+		{CharacterId: "c", TeamId: 1},
+		{CharacterId: "d", TeamId: 99},
+	}
+	counts := CountDeathsPerTeam(deaths, []int{3, 1, 2})
+	require.Len(t, counts, 3)
+	assert.Equal(t, &TeamDeathCount{TeamId: 1, Deaths: 1}, counts[0])
+	assert.Equal(t, &TeamDeathCount{TeamId: 2, Deaths: 2}, counts[1])
+	assert.Equal(t, &TeamDeathCount{TeamId: 3, Deaths: 0}, counts[2])
+}
+
+// ==================== Pure Function Tests: Objective Matches ====================
+
+func TestChangedMatches(t *testing.T) {
+	userId := 7
+	latest := map[MatchKey]int{
+		{ObjectiveId: 1, UserId: 7, TeamId: 2}: 50,
+		{ObjectiveId: 2, TeamId: 2}:            3,
+	}
+	matches := []*repository.ObjectiveMatch{
+		{ObjectiveId: 1, UserId: &userId, TeamId: 2, Number: 50},
+		{ObjectiveId: 2, TeamId: 2, Number: 4},
+		{ObjectiveId: 3, UserId: &userId, TeamId: 2, Number: 0},
+		{ObjectiveId: 2, TeamId: 2, Number: 4},
+		{ObjectiveId: 2, TeamId: 2, Number: 3},
+		{ObjectiveId: 2, TeamId: 5, Number: 3},
+	}
+	changed := ChangedMatches(latest, matches, nil)
+	require.Len(t, changed, 4)
+	assert.Same(t, matches[1], changed[0], "a new team value should be persisted")
+	assert.Same(t, matches[2], changed[1], "the first value of a series should be persisted")
+	assert.Same(t, matches[4], changed[2], "a change back within the batch should be persisted")
+	assert.Same(t, matches[5], changed[3], "series of other teams are independent")
+	assert.Equal(t, 50, latest[MatchKey{ObjectiveId: 1, UserId: 7, TeamId: 2}], "the latest numbers should not be modified")
+
+	changed = ChangedMatches(latest, matches, map[int]bool{1: true})
+	require.Len(t, changed, 5)
+	assert.Same(t, matches[0], changed[0], "unconditional objectives should be persisted on every call")
+}
+
+// overwriteMatchRepo records the objectives whose matches are overwritten
+type overwriteMatchRepo struct {
+	repository.ObjectiveMatchRepository
+	overwritten []int
+}
+
+func (r *overwriteMatchRepo) OverwriteMatches(ctx context.Context, matches []*repository.ObjectiveMatch, objectiveIds []int) error {
+	r.overwritten = append(r.overwritten, objectiveIds...)
+	return nil
+}
+
+func TestSaveMatchesForgetsLatestNumbersOfOverwrittenObjectives(t *testing.T) {
+	repo := &overwriteMatchRepo{}
+	cache := newLatestMatchCache()
+	cache.numbers[MatchKey{ObjectiveId: 1, UserId: 7}] = 50
+	cache.numbers[MatchKey{ObjectiveId: 2, UserId: 7}] = 3
+	cache.loadedObjectiveIds[1] = true
+	cache.loadedObjectiveIds[2] = true
+	s := &ObjectiveMatchServiceImpl{objectiveMatchRepository: repo, latestMatches: cache}
+
+	require.NoError(t, s.SaveMatches(context.Background(), nil, []int{1}))
+	assert.Equal(t, []int{1}, repo.overwritten)
+	assert.Equal(t, map[MatchKey]int{{ObjectiveId: 2, UserId: 7}: 3}, cache.numbers)
+	assert.Equal(t, map[int]bool{2: true}, cache.loadedObjectiveIds, "the numbers of the objective should be loaded again")
+}
+
+// ==================== Pure Function Tests: Event Lifecycle ====================
+
+func TestDueEventPhase(t *testing.T) {
+	start := time.Date(2025, 1, 10, 20, 0, 0, 0, time.UTC)
+	event := &repository.Event{
+		ApplicationStartTime: start.AddDate(0, 0, -10),
+		ApplicationEndTime:   start.AddDate(0, 0, -2),
+		EventStartTime:       start,
+		EventEndTime:         start.AddDate(0, 0, 14),
+		GracePeriodMinutes:   60,
+		Phase:                repository.EventPhaseApplicationsOpen,
+	}
+	tests := []struct {
+		now      time.Time
+		expected repository.EventPhase
+	}{
+		{start.AddDate(0, 0, -5), repository.EventPhaseApplicationsOpen},
+		{start.AddDate(0, 0, -2), repository.EventPhaseApplicationsClosed},
+		{start, repository.EventPhaseRunning},
+		{start.AddDate(0, 0, 14).Add(30 * time.Minute), repository.EventPhaseGracePeriod},
+		{start.AddDate(0, 0, 14).Add(time.Hour), repository.EventPhaseFinal},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, DueEventPhase(event, test.now), test.now)
+	}
+
+	event.Phase = repository.EventPhasePublished
+	assert.Equal(t, repository.EventPhasePublished, DueEventPhase(event, start.AddDate(0, 0, -11)), "applications should not open before their start")
+	assert.Equal(t, repository.EventPhaseApplicationsOpen, DueEventPhase(event, start.AddDate(0, 0, -10)))
+	event.Phase = repository.EventPhaseFinal
+	assert.Equal(t, repository.EventPhaseFinal, DueEventPhase(event, start), "events should never move back")
+	event.Phase = repository.EventPhaseDraft
+	assert.Equal(t, repository.EventPhaseDraft, DueEventPhase(event, start), "drafts should only be published manually")
+	event.Phase = repository.EventPhaseArchived
+	assert.Equal(t, repository.EventPhaseArchived, DueEventPhase(event, start.AddDate(1, 0, 0)))
+}
+
+func TestEventPhaseTransitions(t *testing.T) {
+	phases, err := EventPhaseTransitions(repository.EventPhaseApplicationsClosed, repository.EventPhaseFinal)
+	assert.NoError(t, err)
+	assert.Equal(t, []repository.EventPhase{
+		repository.EventPhaseRunning,
+		repository.EventPhaseGracePeriod,
+		repository.EventPhaseFinal,
+	}, phases, "all phases on the way should be entered")
+
+	_, err = EventPhaseTransitions(repository.EventPhaseRunning, repository.EventPhaseRunning)
+	assert.Error(t, err)
+	_, err = EventPhaseTransitions(repository.EventPhaseFinal, repository.EventPhaseRunning)
+	assert.Error(t, err)
+	_, err = EventPhaseTransitions(repository.EventPhaseDraft, "UNKNOWN")
+	assert.Error(t, err)
+}
+
+func TestEventPhaseFreezes(t *testing.T) {
+	event := &repository.Event{Phase: repository.EventPhaseApplicationsOpen}
+	assert.True(t, event.SignupsOpen())
+	assert.False(t, event.TeamsFrozen())
+	event.Phase = repository.EventPhasePublished
+	assert.False(t, event.SignupsOpen(), "signups should only open once the event's applications start")
+	event.Phase = repository.EventPhaseRunning
+	assert.False(t, event.SignupsOpen())
+	assert.False(t, event.TeamsFrozen(), "teams can still change while the event is running")
+	event.Phase = repository.EventPhaseGracePeriod
+	assert.True(t, event.TeamsFrozen())
+}
+
+// ==================== Pure Function Tests: Pipeline Health ====================
+
+func TestWorstHealthStatus(t *testing.T) {
+	assert.Equal(t, HealthStatusOk, WorstHealthStatus())
+	assert.Equal(t, HealthStatusDegraded, WorstHealthStatus(HealthStatusOk, HealthStatusDegraded, HealthStatusOk))
+	assert.Equal(t, HealthStatusFailing, WorstHealthStatus(HealthStatusFailing, HealthStatusDegraded))
+}
+
+func TestHealthStatusForAge(t *testing.T) {
+	assert.Equal(t, HealthStatusOk, HealthStatusForAge(time.Minute, 5*time.Minute, 30*time.Minute))
+	assert.Equal(t, HealthStatusDegraded, HealthStatusForAge(10*time.Minute, 5*time.Minute, 30*time.Minute))
+	assert.Equal(t, HealthStatusFailing, HealthStatusForAge(time.Hour, 5*time.Minute, 30*time.Minute))
+}
+
+func TestIsGuildStashOverdue(t *testing.T) {
+	now := time.Date(2025, 1, 10, 20, 0, 0, 0, time.UTC)
+	timings := map[repository.TimingKey]time.Duration{
+		repository.GuildstashUpdateInterval:        10 * time.Minute,
+		repository.GuildstashPriorityFetchInterval: time.Minute,
+	}
+	tab := &repository.GuildStashTab{FetchEnabled: true, LastFetch: now.Add(-15 * time.Minute)}
+	assert.False(t, IsGuildStashOverdue(tab, timings, now), "a single missed fetch is not overdue yet")
+	tab.LastFetch = now.Add(-25 * time.Minute)
+	assert.True(t, IsGuildStashOverdue(tab, timings, now))
+	tab.FetchEnabled = false
+	assert.False(t, IsGuildStashOverdue(tab, timings, now), "disabled tabs are never overdue")
+	tab = &repository.GuildStashTab{FetchEnabled: true, PriorityFetch: true, LastFetch: now.Add(-5 * time.Minute)}
+	assert.True(t, IsGuildStashOverdue(tab, timings, now), "priority tabs use the priority interval")
+}
+
+// ==================== Pure Function Tests: Event Roles ====================
+
+func TestEventPermissions(t *testing.T) {
+	teamId := 3
+	otherTeamId := 4
+	roles := []*repository.EventRole{
+		{Role: repository.PermissionSubmissionJudge},
+		{Role: repository.PermissionManager, TeamId: &teamId},
+		{Role: repository.PermissionSubmissionJudge, TeamId: &teamId},
+		{Role: repository.PermissionObjectiveDesigner, TeamId: &otherTeamId},
+	}
+
+	assert.Equal(t, []repository.Permission{repository.PermissionSubmissionJudge}, EventPermissions(roles, nil),
+		"roles of a team should not apply to the whole event")
+	assert.Equal(t, []repository.Permission{repository.PermissionSubmissionJudge, repository.PermissionManager}, EventPermissions(roles, &teamId))
+	assert.Empty(t, EventPermissions(nil, &teamId))
+}
+
 // ==================== Pure Function Tests: Score Trie ====================
 
 func TestBuildTrieAndFindObjectiveId(t *testing.T) {
@@ -388,6 +1169,23 @@ func TestFindObjectiveId_PartialMatch(t *testing.T) {
 	assert.Equal(t, 10, *result)
 }
 
+func TestToObjectiveGaps_SortsByMarginalPointsAndSuggestions(t *testing.T) {
+	gaps := []*scoring.ObjectiveGap{
+		{ObjectiveId: 1, PointsOnFinish: 5},
+		{ObjectiveId: 2, PointsOnFinish: 10},
+		{ObjectiveId: 3, PointsOnRankUp: 5},
+		{ObjectiveId: 4},
+	}
+	suggestions := []*repository.TeamSuggestion{{Id: 3, TeamId: 1, Extra: "farm this"}}
+
+	result := toObjectiveGaps(gaps, suggestions)
+	require.Len(t, result, 4)
+	assert.Equal(t, []int{2, 3, 1, 4}, []int{result[0].ObjectiveId, result[1].ObjectiveId, result[2].ObjectiveId, result[3].ObjectiveId})
+	assert.True(t, result[1].Suggested)
+	assert.Equal(t, "farm this", result[1].SuggestionExtra)
+	assert.False(t, result[0].Suggested)
+}
+
 // ==================== Pure Function Tests: Score Diff ====================
 
 func TestGetScoreDifference_New(t *testing.T) {
@@ -494,6 +1292,21 @@ func TestScoreMap_GetSimpleScore(t *testing.T) {
 	assert.Equal(t, 7, simple[2])
 }
 
+func TestScoreMap_Scores(t *testing.T) {
+	score1 := &scoring.Score{ObjectiveId: 1, TeamId: 1, PresetCompletions: map[int]*scoring.PresetCompletion{100: {Points: 10}}}
+	score2 := &scoring.Score{ObjectiveId: 2, TeamId: 2, PresetCompletions: map[int]*scoring.PresetCompletion{100: {Points: 5}}}
+	cached, _ := Diff(nil, []*scoring.Score{score1, score2})
+
+	scores := cached.Scores()
+	assert.ElementsMatch(t, []*scoring.Score{score1, score2}, scores)
+
+	// an instance that has already seen the cached scores finds no changes in them
+	_, diff := Diff(cached, scores)
+	assert.Empty(t, diff)
+	_, diff = Diff(nil, scores)
+	assert.Len(t, diff, 2)
+}
+
 // ==================== Mock-Based Tests: EventService ====================
 
 func TestGetEventStatus_NoUser(t *testing.T) {
@@ -784,6 +1597,204 @@ func TestRemoveProvider_Success(t *testing.T) {
 	mockOR.AssertCalled(t, "DeleteOauthsByUserIdAndProvider", 1, repository.ProviderPoE)
 }
 
+// ==================== Mock-Based Tests: TokenService ====================
+
+func TestRefresh_RotatesTokenWithCurrentPermissions(t *testing.T) {
+	mockTR := new(mockTokenRepo)
+	mockUR := new(mockUserRepo)
+
+	stored := &repository.RefreshToken{Id: 1, UserId: 7, FamilyId: "family", ExpiresAt: time.Now().Add(time.Hour)}
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("refresh")).Return(stored, nil)
+	mockUR.On("GetUserById", 7, []string(nil)).Return(&repository.User{
+		Id:          7,
+		Permissions: []repository.Permission{repository.PermissionAdmin},
+	}, nil)
+	mockTR.On("RotateRefreshToken", stored, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+	mockTR.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := &TokenServiceImpl{tokenRepository: mockTR, userRepository: mockUR, logger: slog.Default()}
+	tokens, err := svc.Refresh("refresh")
+	require.NoError(t, err)
+	assert.NotEqual(t, "refresh", tokens.RefreshToken)
+
+	successor := mockTR.Calls[1].Arguments.Get(1).(*repository.RefreshToken)
+	assert.Equal(t, "family", successor.FamilyId, "the successor should stay in the session of the token")
+	assert.Equal(t, auth.HashRefreshToken(tokens.RefreshToken), successor.TokenHash)
+
+	claims, err := svc.VerifyAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.UserId)
+	assert.Equal(t, successor.AccessTokenId, claims.Id)
+	assert.Equal(t, []string{string(repository.PermissionAdmin)}, claims.Permissions)
+}
+
+func TestRefresh_ReusedTokenRevokesSession(t *testing.T) {
+	mockTR := new(mockTokenRepo)
+
+	revokedAt := time.Now().Add(-time.Minute)
+	stored := &repository.RefreshToken{Id: 1, UserId: 7, FamilyId: "family", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("refresh")).Return(stored, nil)
+	mockTR.On("RevokeSession", "family").Return(nil)
+
+	svc := &TokenServiceImpl{tokenRepository: mockTR, logger: slog.Default()}
+	_, err := svc.Refresh("refresh")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	mockTR.AssertCalled(t, "RevokeSession", "family")
+}
+
+func TestRefresh_ConcurrentRotationRevokesSession(t *testing.T) {
+	mockTR := new(mockTokenRepo)
+	mockUR := new(mockUserRepo)
+
+	stored := &repository.RefreshToken{Id: 1, UserId: 7, FamilyId: "family", ExpiresAt: time.Now().Add(time.Hour)}
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("refresh")).Return(stored, nil)
+	mockUR.On("GetUserById", 7, []string(nil)).Return(&repository.User{Id: 7}, nil)
+	mockTR.On("RotateRefreshToken", stored, mock.Anything).Return(repository.ErrRefreshTokenReused)
+	mockTR.On("RevokeSession", "family").Return(nil)
+
+	svc := &TokenServiceImpl{tokenRepository: mockTR, userRepository: mockUR, logger: slog.Default()}
+	_, err := svc.Refresh("refresh")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	mockTR.AssertCalled(t, "RevokeSession", "family")
+}
+
+func TestRefresh_UnknownOrExpiredToken(t *testing.T) {
+	mockTR := new(mockTokenRepo)
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("unknown")).Return(nil, gorm.ErrRecordNotFound)
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("expired")).Return(&repository.RefreshToken{
+		Id: 1, UserId: 7, FamilyId: "family", ExpiresAt: time.Now().Add(-time.Minute),
+	}, nil)
+
+	svc := &TokenServiceImpl{tokenRepository: mockTR, logger: slog.Default()}
+	_, err := svc.Refresh("unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = svc.Refresh("expired")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	mockTR.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestVerifyAccessToken_Revoked(t *testing.T) {
+	mockTR := new(mockTokenRepo)
+	accessToken, claims, err := auth.CreateAccessToken(&repository.User{Id: 7})
+	require.NoError(t, err)
+	mockTR.On("IsTokenRevoked", claims.Id).Return(true, nil)
+
+	svc := &TokenServiceImpl{tokenRepository: mockTR, logger: slog.Default()}
+	_, err = svc.VerifyAccessToken(accessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestLogout_IgnoresRefreshTokenOfOtherUser(t *testing.T) {
+	mockTR := new(mockTokenRepo)
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("other")).Return(&repository.RefreshToken{UserId: 8, FamilyId: "other"}, nil)
+	mockTR.On("GetRefreshToken", auth.HashRefreshToken("own")).Return(&repository.RefreshToken{UserId: 7, FamilyId: "own"}, nil)
+	mockTR.On("RevokeSession", "own").Return(nil)
+	mockTR.On("RevokeToken", mock.Anything).Return(nil)
+
+	svc := &TokenServiceImpl{tokenRepository: mockTR, logger: slog.Default()}
+	claims := &auth.Claims{UserId: 7, Id: "jti", Exp: time.Now().Add(time.Minute).Unix()}
+	require.NoError(t, svc.Logout(claims, "other"))
+	mockTR.AssertNotCalled(t, "RevokeSession", "other")
+	require.NoError(t, svc.Logout(claims, "own"))
+	mockTR.AssertCalled(t, "RevokeSession", "own")
+	mockTR.AssertNumberOfCalls(t, "RevokeToken", 2)
+}
+
+// ==================== Mock-Based Tests: EventRoleService ====================
+
+func TestGrantEventRole_RejectsGlobalAndForeignTeamRoles(t *testing.T) {
+	mockERR := new(mockEventRoleRepo)
+	mockTR := new(mockTeamRepo)
+	mockTR.On("GetTeamById", 3).Return(&repository.Team{Id: 3, EventId: 2}, nil)
+	mockTR.On("GetTeamById", 4).Return((*repository.Team)(nil), gorm.ErrRecordNotFound)
+
+	svc := &EventRoleServiceImpl{eventRoleRepository: mockERR, teamRepository: mockTR, logger: slog.Default()}
+	_, err := svc.GrantEventRole(&repository.EventRole{UserId: 1, EventId: 1, Role: repository.PermissionAdmin})
+	assert.ErrorIs(t, err, ErrInvalidEventRole)
+	teamOfOtherEvent := 3
+	_, err = svc.GrantEventRole(&repository.EventRole{UserId: 1, EventId: 1, TeamId: &teamOfOtherEvent, Role: repository.PermissionManager})
+	assert.ErrorIs(t, err, ErrInvalidEventRole)
+	unknownTeam := 4
+	_, err = svc.GrantEventRole(&repository.EventRole{UserId: 1, EventId: 1, TeamId: &unknownTeam, Role: repository.PermissionManager})
+	assert.ErrorIs(t, err, ErrInvalidEventRole)
+	mockERR.AssertNotCalled(t, "SaveEventRole", mock.Anything)
+}
+
+func TestGrantEventRole_ExistingRoleIsKept(t *testing.T) {
+	mockERR := new(mockEventRoleRepo)
+	existing := &repository.EventRole{Id: 5, UserId: 1, EventId: 1, Role: repository.PermissionSubmissionJudge}
+	mockERR.On("FindEventRole", mock.Anything).Return(existing, nil)
+
+	svc := &EventRoleServiceImpl{eventRoleRepository: mockERR, logger: slog.Default()}
+	role, err := svc.GrantEventRole(&repository.EventRole{UserId: 1, EventId: 1, Role: repository.PermissionSubmissionJudge})
+	require.NoError(t, err)
+	assert.Equal(t, 5, role.Id)
+	mockERR.AssertNotCalled(t, "SaveEventRole", mock.Anything)
+}
+
+func TestRevokeEventRole_OfOtherEvent(t *testing.T) {
+	mockERR := new(mockEventRoleRepo)
+	mockERR.On("GetEventRoleById", 5).Return(&repository.EventRole{Id: 5, EventId: 2}, nil)
+
+	svc := &EventRoleServiceImpl{eventRoleRepository: mockERR, logger: slog.Default()}
+	err := svc.RevokeEventRole(1, 5)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	mockERR.AssertNotCalled(t, "DeleteEventRole", 5)
+}
+
+// ==================== Mock-Based Tests: PoBStatService ====================
+
+func TestPoBStatMappingOfOtherEvent(t *testing.T) {
+	mockPSR := new(mockPoBStatRepo)
+	mockPSR.On("GetMappingById", 5).Return(&repository.PoBStatMapping{Id: 5, EventId: 2, Name: "dps"}, nil)
+
+	svc := &PoBStatServiceImpl{pobStatRepository: mockPSR, logger: slog.Default()}
+	_, err := svc.SaveMapping(&repository.PoBStatMapping{Id: 5, EventId: 1, Name: "dps", Fields: []string{"TotalDPS"}, Aggregation: repository.StatAggregationMax, Multiplier: 1})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	err = svc.DeleteMapping(1, 5)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	mockPSR.AssertNotCalled(t, "SaveMapping", mock.Anything)
+	mockPSR.AssertNotCalled(t, "DeleteMapping", mock.Anything, mock.Anything)
+}
+
+// eventObjectiveRepo returns a fixed set of objectives for every event
+type eventObjectiveRepo struct {
+	repository.ObjectiveRepository
+	objectives []*repository.Objective
+}
+
+func (r *eventObjectiveRepo) GetObjectivesByEventIdFlat(eventId int, preloads ...string) ([]*repository.Objective, error) {
+	return r.objectives, nil
+}
+
+func TestPoBStatMappingTrackedByObjectives(t *testing.T) {
+	mapping := &repository.PoBStatMapping{Id: 5, EventId: 1, Name: "dps", Fields: []string{"TotalDPS"}, Aggregation: repository.StatAggregationMax, Multiplier: 1}
+	mockPSR := new(mockPoBStatRepo)
+	mockPSR.On("GetMappingById", 5).Return(mapping, nil)
+	mockPSR.On("SaveMapping", mock.Anything).Return(mapping, nil)
+	objectives := &eventObjectiveRepo{objectives: []*repository.Objective{
+		{Id: 1, Name: "Biggest hitter", TrackedValue: repository.PoBStatTrackedValue("dps")},
+	}}
+
+	svc := &PoBStatServiceImpl{pobStatRepository: mockPSR, objectiveRepository: objectives, logger: slog.Default()}
+	err := svc.DeleteMapping(1, 5)
+	assert.ErrorIs(t, err, ErrPoBStatMappingInUse)
+	_, err = svc.SaveMapping(&repository.PoBStatMapping{Id: 5, EventId: 1, Name: "damage", Fields: []string{"TotalDPS"}, Aggregation: repository.StatAggregationMax, Multiplier: 1})
+	assert.ErrorIs(t, err, ErrPoBStatMappingInUse, "renaming the mapping would orphan the objective as well")
+	_, err = svc.SaveMapping(&repository.PoBStatMapping{Id: 5, EventId: 1, Name: "dps", Fields: []string{"CombinedDPS"}, Aggregation: repository.StatAggregationMax, Multiplier: 1})
+	assert.NoError(t, err, "the fields of a tracked mapping can still be changed")
+	mockPSR.AssertNotCalled(t, "DeleteMapping", mock.Anything, mock.Anything)
+}
+
+func TestCreateObjective_RejectsUnknownPoBStat(t *testing.T) {
+	mockPSR := new(mockPoBStatRepo)
+	mockPSR.On("GetMappingsForEvent", 1).Return([]*repository.PoBStatMapping{{Id: 5, EventId: 1, Name: "dps"}}, nil)
+
+	svc := &ObjectiveServiceImpl{pobStatRepository: mockPSR}
+	_, err := svc.CreateObjective(&repository.Objective{EventId: 1, ObjectiveType: repository.ObjectiveTypePlayer, TrackedValue: repository.PoBStatTrackedValue("life")}, nil)
+	assert.ErrorContains(t, err, "unknown PoB stat mapping")
+}
+
 // ==================== HTTP Mock Test: GetNinjaChangeId ====================
 
 func TestGetNinjaChangeId(t *testing.T) {
@@ -1,11 +1,12 @@
 package service
 
 import (
+	"bpl/config"
 	"bpl/repository"
 	"bpl/utils"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -39,11 +40,13 @@ type StashChangeService interface {
 
 type StashChangeServiceImpl struct {
 	stashChangeRepository repository.StashChangeRepository
+	logger                *slog.Logger
 }
 
 func NewStashChangeService() StashChangeService {
 	return &StashChangeServiceImpl{
 		stashChangeRepository: repository.NewStashChangeRepository(),
+		logger:                config.Logger("service"),
 	}
 }
 
@@ -70,8 +73,11 @@ func (s *StashChangeServiceImpl) GetCurrentChangeIdForEvent(event *repository.Ev
 	return &changeId, nil
 }
 
+// ninjaClient gives up on poe.ninja quickly, so that the health report and the event start do not hang on it
+var ninjaClient = &http.Client{Timeout: 10 * time.Second}
+
 func GetNinjaChangeId() (string, error) {
-	response, err := http.Get(ninjaStatsURL)
+	response, err := ninjaClient.Get(ninjaStatsURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch ninja change id: %s", err)
 	}
@@ -89,7 +95,7 @@ func (s *StashChangeServiceImpl) GetInitialChangeId(event *repository.Event) (st
 	if err == nil {
 		return stashChange, nil
 	}
-	log.Print("Initial change id not found, fetching from poe.ninja")
+	s.logger.Info("Initial change id not found, fetching from poe.ninja", "event_id", event.Id)
 	return GetNinjaChangeId()
 }
 
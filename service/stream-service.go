@@ -2,9 +2,10 @@ package service
 
 import (
 	"bpl/client"
+	"bpl/config"
 	"bpl/repository"
 	"bpl/utils"
-	"log"
+	"log/slog"
 )
 
 type StreamService interface {
@@ -18,6 +19,7 @@ type StreamServiceImpl struct {
 	eventRepository  repository.EventRepository
 	twitchClient     *client.TwitchClient
 	oauthService     OauthService
+	logger           *slog.Logger
 }
 
 func NewStreamService() StreamService {
@@ -28,10 +30,11 @@ func NewStreamService() StreamService {
 		ladderRepository: repository.NewLadderRepository(),
 		eventRepository:  repository.NewEventRepository(),
 		oauthService:     oauthService,
+		logger:           config.Logger("service"),
 	}
 	token, err := oauthService.GetApplicationToken(repository.ProviderTwitch)
 	if err != nil {
-		log.Printf("Failed to get twitch token: %v", err)
+		s.logger.Error("Failed to get twitch token", "error", err)
 		return s
 	}
 	s.twitchClient = client.NewTwitchClient(token)
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bpl/auth"
+	"bpl/config"
+	"bpl/repository"
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+)
+
+type TokenPair struct {
+	AccessToken       string
+	AccessTokenExpiry time.Time
+	RefreshToken      string
+}
+
+type TokenService interface {
+	// IssueTokens starts a new session for the user
+	IssueTokens(user *repository.User) (*TokenPair, error)
+	// Refresh replaces the refresh token and issues an access token with the current permissions of the user.
+	// A refresh token that is used after it has been replaced must have been stolen, so its whole session is revoked.
+	Refresh(refreshToken string) (*TokenPair, error)
+	// VerifyAccessToken checks the signature, expiry and revocation of the token and returns its claims
+	VerifyAccessToken(tokenString string) (*auth.Claims, error)
+	// Logout revokes the access token and, if given, the session of the refresh token
+	Logout(claims *auth.Claims, refreshToken string) error
+	// RevokeAccessTokens revokes the access tokens of all sessions of the user, so that the clients have to
+	// refresh them and pick up changed permissions
+	RevokeAccessTokens(userId int) error
+	// RevokeAllTokens ends all sessions of the user
+	RevokeAllTokens(userId int) error
+	DeleteExpiredTokensLoop(ctx context.Context, interval time.Duration)
+}
+
+type TokenServiceImpl struct {
+	tokenRepository repository.TokenRepository
+	userRepository  repository.UserRepository
+	logger          *slog.Logger
+}
+
+func NewTokenService() TokenService {
+	return &TokenServiceImpl{
+		tokenRepository: repository.NewTokenRepository(),
+		userRepository:  repository.NewUserRepository(),
+		logger:          config.Logger("service"),
+	}
+}
+
+func (s *TokenServiceImpl) IssueTokens(user *repository.User) (*TokenPair, error) {
+	pair, refreshToken, err := s.createTokens(user, rand.Text())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokenRepository.SaveRefreshToken(refreshToken); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (s *TokenServiceImpl) createTokens(user *repository.User, familyId string) (*TokenPair, *repository.RefreshToken, error) {
+	accessToken, claims, err := auth.CreateAccessToken(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, hash := auth.NewRefreshToken()
+	now := time.Now()
+	refreshToken := &repository.RefreshToken{
+		UserId:            user.Id,
+		TokenHash:         hash,
+		FamilyId:          familyId,
+		AccessTokenId:     claims.Id,
+		AccessTokenExpiry: claims.ExpiresAt(),
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(config.Env().RefreshTokenTTL),
+	}
+	pair := &TokenPair{
+		AccessToken:       accessToken,
+		AccessTokenExpiry: claims.ExpiresAt(),
+		RefreshToken:      token,
+	}
+	return pair, refreshToken, nil
+}
+
+func (s *TokenServiceImpl) Refresh(refreshToken string) (*TokenPair, error) {
+	token, err := s.tokenRepository.GetRefreshToken(auth.HashRefreshToken(refreshToken))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil {
+		return nil, s.revokeReusedSession(token)
+	}
+	if token.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	// the permissions are read from the user instead of the previous token, so that changes take effect now
+	user, err := s.userRepository.GetUserById(token.UserId)
+	if err != nil {
+		return nil, err
+	}
+	pair, successor, err := s.createTokens(user, token.FamilyId)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tokenRepository.RotateRefreshToken(token, successor)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		return nil, s.revokeReusedSession(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (s *TokenServiceImpl) revokeReusedSession(token *repository.RefreshToken) error {
+	s.logger.Warn("Replaced refresh token was used again, revoking its session", "user_id", token.UserId, "family_id", token.FamilyId)
+	if err := s.tokenRepository.RevokeSession(token.FamilyId); err != nil {
+		return err
+	}
+	return ErrInvalidRefreshToken
+}
+
+func (s *TokenServiceImpl) VerifyAccessToken(tokenString string) (*auth.Claims, error) {
+	token, err := auth.ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	claims := &auth.Claims{}
+	claims.FromJWTClaims(token.Claims)
+	if err := claims.Valid(); err != nil {
+		return nil, err
+	}
+	revoked, err := s.tokenRepository.IsTokenRevoked(claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func (s *TokenServiceImpl) Logout(claims *auth.Claims, refreshToken string) error {
+	if refreshToken != "" {
+		token, err := s.tokenRepository.GetRefreshToken(auth.HashRefreshToken(refreshToken))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// a refresh token of another user must not end their session
+		if err == nil && token.UserId == claims.UserId {
+			if err := s.tokenRepository.RevokeSession(token.FamilyId); err != nil {
+				return err
+			}
+		}
+	}
+	// the access token may not belong to a session, e.g. the one of the discord bot
+	return s.tokenRepository.RevokeToken(&repository.RevokedToken{
+		TokenId:   claims.Id,
+		UserId:    claims.UserId,
+		ExpiresAt: claims.ExpiresAt(),
+		RevokedAt: time.Now(),
+	})
+}
+
+func (s *TokenServiceImpl) RevokeAccessTokens(userId int) error {
+	return s.tokenRepository.RevokeAccessTokens(userId)
+}
+
+func (s *TokenServiceImpl) RevokeAllTokens(userId int) error {
+	return s.tokenRepository.RevokeSessions(userId)
+}
+
+func (s *TokenServiceImpl) DeleteExpiredTokensLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.tokenRepository.DeleteExpiredTokens(time.Now())
+			if err != nil {
+				s.logger.ErrorContext(ctx, "Failed to delete expired tokens", "error", err)
+				continue
+			}
+			s.logger.DebugContext(ctx, "Deleted expired tokens", "count", deleted)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package service
 
 import (
-	"bpl/auth"
 	"bpl/repository"
 	"fmt"
 	"math/rand/v2"
@@ -9,7 +8,6 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type UserService interface {
@@ -33,6 +31,7 @@ type UserServiceImpl struct {
 	userRepository  repository.UserRepository
 	oauthRepository repository.OauthRepository
 	teamService     TeamService
+	tokenService    TokenService
 }
 
 func NewUserService() UserService {
@@ -40,6 +39,7 @@ func NewUserService() UserService {
 		userRepository:  repository.NewUserRepository(),
 		oauthRepository: repository.NewOauthRepository(),
 		teamService:     NewTeamService(),
+		tokenService:    NewTokenService(),
 	}
 }
 
@@ -102,20 +102,11 @@ func (s *UserServiceImpl) GetUserFromAuthHeader(c *gin.Context) (*repository.Use
 }
 
 func (s *UserServiceImpl) GetUserFromToken(tokenString string) (*repository.User, error) {
-	token, err := auth.ParseToken(tokenString)
+	claims, err := s.tokenService.VerifyAccessToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
-
-	claims := &auth.Claims{}
-	if token.Valid {
-		claims.FromJWTClaims(token.Claims)
-		if err := claims.Valid(); err != nil {
-			return nil, err
-		}
-		return s.GetUserById(claims.UserId, "OauthAccounts")
-	}
-	return nil, jwt.ErrInvalidKey
+	return s.GetUserById(claims.UserId, "OauthAccounts")
 }
 
 func (s *UserServiceImpl) ChangePermissions(userId int, permissions []repository.Permission) (*repository.User, error) {
@@ -124,7 +115,15 @@ func (s *UserServiceImpl) ChangePermissions(userId int, permissions []repository
 		return nil, err
 	}
 	user.Permissions = permissions
-	return s.userRepository.SaveUser(user)
+	user, err = s.userRepository.SaveUser(user)
+	if err != nil {
+		return nil, err
+	}
+	// the permissions are part of the access tokens, revoking them makes the clients refresh to get the new ones
+	if err := s.tokenService.RevokeAccessTokens(userId); err != nil {
+		return nil, fmt.Errorf("permissions were saved but the tokens of the user could not be revoked: %v", err)
+	}
+	return user, nil
 }
 
 func (s *UserServiceImpl) RemoveProvider(user *repository.User, provider repository.Provider) (*repository.User, error) {
@@ -2,7 +2,7 @@ package utils
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	"github.com/lib/pq"
@@ -256,7 +256,7 @@ type Closable interface {
 func Closer(c Closable) func() {
 	return func() {
 		if err := c.Close(); err != nil {
-			log.Printf("Error closing resource: %v\n", err)
+			slog.Error("Failed to close resource", "error", err)
 		}
 	}
 }
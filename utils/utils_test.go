@@ -2,11 +2,11 @@ package utils
 
 import (
 	"errors"
-	"log"
-	"os"
+	"log/slog"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -434,8 +434,80 @@ func TestCloser_Error(t *testing.T) {
 	closer := Closer(c)
 	// Capture log output
 	var buf strings.Builder
-	log.SetOutput(&buf)
-	defer log.SetOutput(os.Stderr)
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
 	closer()
-	assert.Contains(t, buf.String(), "Error closing resource")
+	assert.Contains(t, buf.String(), "Failed to close resource")
+	assert.Contains(t, buf.String(), "close error")
+}
+
+// ==================== CircuitBreaker ====================
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	assert.True(t, breaker.Allow())
+	breaker.Failure()
+	assert.True(t, breaker.Allow(), "breaker should stay closed below the threshold")
+	breaker.Failure()
+	assert.True(t, breaker.IsOpen())
+	assert.False(t, breaker.Allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow(), "a trial call should be allowed after the cooldown")
+	assert.False(t, breaker.Allow(), "only a single trial call should be allowed")
+	breaker.CancelTrial()
+	assert.True(t, breaker.Allow(), "a cancelled trial should be available again")
+	breaker.Failure()
+	assert.False(t, breaker.Allow(), "a failed trial should reopen the breaker")
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+	breaker.Success()
+	assert.False(t, breaker.IsOpen())
+	assert.True(t, breaker.Allow())
+}
+
+// ==================== CronSchedule ====================
+
+func TestParseCronSchedule_Invalid(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCronSchedule(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 7, 30, 0, time.UTC) // a wednesday
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2025, 1, 2, 3, 30, 0, 0, time.UTC)},
+		{"0 0 1 3 *", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0,6", time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)},
+		// with both day fields restricted either one matches
+		{"0 0 15 * 5", time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCronSchedule(test.expression)
+		assert.NoError(t, err, test.expression)
+		assert.Equal(t, test.expected, schedule.Next(start), test.expression)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), ExponentialBackoff(0, time.Second, time.Minute))
+	assert.Equal(t, time.Second, ExponentialBackoff(1, time.Second, time.Minute))
+	assert.Equal(t, 8*time.Second, ExponentialBackoff(4, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, ExponentialBackoff(10, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, ExponentialBackoff(1, 2*time.Minute, time.Minute))
 }